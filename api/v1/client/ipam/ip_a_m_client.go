@@ -52,6 +52,38 @@ func (a *Client) DeleteIPAMIP(params *DeleteIPAMIPParams) (*DeleteIPAMIPOK, erro
 
 }
 
+/*
+GetIPAM gets IP address management status
+
+Returns the IPAM mode, the allocated IP addresses and, in cluster-pool
+mode, the CIDRs leased by all nodes.
+
+*/
+func (a *Client) GetIPAM(params *GetIPAMParams) (*GetIPAMOK, error) {
+	// TODO: Validate the params before sending
+	if params == nil {
+		params = NewGetIPAMParams()
+	}
+
+	result, err := a.transport.Submit(&runtime.ClientOperation{
+		ID:                 "GetIPAM",
+		Method:             "GET",
+		PathPattern:        "/ipam",
+		ProducesMediaTypes: []string{"application/json"},
+		ConsumesMediaTypes: []string{"application/json"},
+		Schemes:            []string{"http"},
+		Params:             params,
+		Reader:             &GetIPAMReader{formats: a.formats},
+		Context:            params.Context,
+		Client:             params.HTTPClient,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result.(*GetIPAMOK), nil
+
+}
+
 /*
 PostIPAM allocates an IP address
 */
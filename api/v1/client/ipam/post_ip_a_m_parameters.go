@@ -64,6 +64,16 @@ type PostIPAMParams struct {
 
 	/*Family*/
 	Family *string
+	/*Owner
+	  Owner of the allocation in the form namespace/pod, used to select the IP pool from annotations
+
+	*/
+	Owner *string
+	/*Pool
+	  Name of the IP pool to allocate from
+
+	*/
+	Pool *string
 
 	timeout    time.Duration
 	Context    context.Context
@@ -114,6 +124,28 @@ func (o *PostIPAMParams) SetFamily(family *string) {
 	o.Family = family
 }
 
+// WithOwner adds the owner to the post IP a m params
+func (o *PostIPAMParams) WithOwner(owner *string) *PostIPAMParams {
+	o.SetOwner(owner)
+	return o
+}
+
+// SetOwner adds the owner to the post IP a m params
+func (o *PostIPAMParams) SetOwner(owner *string) {
+	o.Owner = owner
+}
+
+// WithPool adds the pool to the post IP a m params
+func (o *PostIPAMParams) WithPool(pool *string) *PostIPAMParams {
+	o.SetPool(pool)
+	return o
+}
+
+// SetPool adds the pool to the post IP a m params
+func (o *PostIPAMParams) SetPool(pool *string) {
+	o.Pool = pool
+}
+
 // WriteToRequest writes these params to a swagger request
 func (o *PostIPAMParams) WriteToRequest(r runtime.ClientRequest, reg strfmt.Registry) error {
 
@@ -138,6 +170,38 @@ func (o *PostIPAMParams) WriteToRequest(r runtime.ClientRequest, reg strfmt.Regi
 
 	}
 
+	if o.Owner != nil {
+
+		// query param owner
+		var qrOwner string
+		if o.Owner != nil {
+			qrOwner = *o.Owner
+		}
+		qOwner := qrOwner
+		if qOwner != "" {
+			if err := r.SetQueryParam("owner", qOwner); err != nil {
+				return err
+			}
+		}
+
+	}
+
+	if o.Pool != nil {
+
+		// query param pool
+		var qrPool string
+		if o.Pool != nil {
+			qrPool = *o.Pool
+		}
+		qPool := qrPool
+		if qPool != "" {
+			if err := r.SetQueryParam("pool", qPool); err != nil {
+				return err
+			}
+		}
+
+	}
+
 	if len(res) > 0 {
 		return errors.CompositeValidationError(res...)
 	}
@@ -142,6 +142,34 @@ func (a *Client) GetPolicy(params *GetPolicyParams) (*GetPolicyOK, error) {
 
 }
 
+/*
+GetPolicyDiff computes access changes caused by importing policy rules
+*/
+func (a *Client) GetPolicyDiff(params *GetPolicyDiffParams) (*GetPolicyDiffOK, error) {
+	// TODO: Validate the params before sending
+	if params == nil {
+		params = NewGetPolicyDiffParams()
+	}
+
+	result, err := a.transport.Submit(&runtime.ClientOperation{
+		ID:                 "GetPolicyDiff",
+		Method:             "GET",
+		PathPattern:        "/policy/diff",
+		ProducesMediaTypes: []string{"application/json"},
+		ConsumesMediaTypes: []string{"application/json"},
+		Schemes:            []string{"http"},
+		Params:             params,
+		Reader:             &GetPolicyDiffReader{formats: a.formats},
+		Context:            params.Context,
+		Client:             params.HTTPClient,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result.(*GetPolicyDiffOK), nil
+
+}
+
 /*
 GetPolicyResolve resolves policy for an identity context
 */
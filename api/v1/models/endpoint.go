@@ -21,6 +21,9 @@ type Endpoint struct {
 	// addressing
 	Addressing *EndpointAddressing `json:"addressing,omitempty"`
 
+	// Bandwidth limits of endpoint
+	Bandwidth *EndpointBandwidth `json:"bandwidth,omitempty"`
+
 	// ID assigned by container runtime
 	ContainerID string `json:"container-id,omitempty"`
 
@@ -77,6 +80,8 @@ type Endpoint struct {
 
 /* polymorph Endpoint addressing false */
 
+/* polymorph Endpoint bandwidth false */
+
 /* polymorph Endpoint container-id false */
 
 /* polymorph Endpoint container-name false */
@@ -120,6 +125,11 @@ func (m *Endpoint) Validate(formats strfmt.Registry) error {
 		res = append(res, err)
 	}
 
+	if err := m.validateBandwidth(formats); err != nil {
+		// prop
+		res = append(res, err)
+	}
+
 	if err := m.validateIdentity(formats); err != nil {
 		// prop
 		res = append(res, err)
@@ -170,6 +180,25 @@ func (m *Endpoint) validateAddressing(formats strfmt.Registry) error {
 	return nil
 }
 
+func (m *Endpoint) validateBandwidth(formats strfmt.Registry) error {
+
+	if swag.IsZero(m.Bandwidth) { // not required
+		return nil
+	}
+
+	if m.Bandwidth != nil {
+
+		if err := m.Bandwidth.Validate(formats); err != nil {
+			if ve, ok := err.(*errors.Validation); ok {
+				return ve.ValidateName("bandwidth")
+			}
+			return err
+		}
+	}
+
+	return nil
+}
+
 func (m *Endpoint) validateIdentity(formats strfmt.Registry) error {
 
 	if swag.IsZero(m.Identity) { // not required
@@ -27,6 +27,12 @@ type IdentityContext struct {
 	// from
 	From Labels `json:"from"`
 
+	// http
+	HTTP *TraceHTTPRequest `json:"http,omitempty"`
+
+	// kafka
+	Kafka *TraceKafkaRequest `json:"kafka,omitempty"`
+
 	// to
 	To Labels `json:"to"`
 
@@ -39,6 +45,10 @@ type IdentityContext struct {
 
 /* polymorph IdentityContext from false */
 
+/* polymorph IdentityContext http false */
+
+/* polymorph IdentityContext kafka false */
+
 /* polymorph IdentityContext to false */
 
 /* polymorph IdentityContext verbose false */
@@ -52,6 +62,16 @@ func (m *IdentityContext) Validate(formats strfmt.Registry) error {
 		res = append(res, err)
 	}
 
+	if err := m.validateHTTP(formats); err != nil {
+		// prop
+		res = append(res, err)
+	}
+
+	if err := m.validateKafka(formats); err != nil {
+		// prop
+		res = append(res, err)
+	}
+
 	if len(res) > 0 {
 		return errors.CompositeValidationError(res...)
 	}
@@ -85,6 +105,44 @@ func (m *IdentityContext) validateDports(formats strfmt.Registry) error {
 	return nil
 }
 
+func (m *IdentityContext) validateHTTP(formats strfmt.Registry) error {
+
+	if swag.IsZero(m.HTTP) { // not required
+		return nil
+	}
+
+	if m.HTTP != nil {
+
+		if err := m.HTTP.Validate(formats); err != nil {
+			if ve, ok := err.(*errors.Validation); ok {
+				return ve.ValidateName("http")
+			}
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m *IdentityContext) validateKafka(formats strfmt.Registry) error {
+
+	if swag.IsZero(m.Kafka) { // not required
+		return nil
+	}
+
+	if m.Kafka != nil {
+
+		if err := m.Kafka.Validate(formats); err != nil {
+			if ve, ok := err.(*errors.Validation); ok {
+				return ve.ValidateName("kafka")
+			}
+			return err
+		}
+	}
+
+	return nil
+}
+
 // MarshalBinary interface implementation
 func (m *IdentityContext) MarshalBinary() ([]byte, error) {
 	if m == nil {
@@ -6,10 +6,14 @@ package models
 // Editing this file might prove futile when you re-run the swagger generate command
 
 import (
+	"encoding/json"
+	"strconv"
+
 	strfmt "github.com/go-openapi/strfmt"
 
 	"github.com/go-openapi/errors"
 	"github.com/go-openapi/swag"
+	"github.com/go-openapi/validate"
 )
 
 // IPAMStatus Status of IP address management
@@ -17,21 +21,41 @@ import (
 
 type IPAMStatus struct {
 
+	// Status of the cluster-pool IPAM mode
+	ClusterPool *IPAMClusterPoolStatus `json:"cluster-pool,omitempty"`
+
 	// ipv4
 	IPV4 []string `json:"ipv4"`
 
 	// ipv6
 	IPV6 []string `json:"ipv6"`
+
+	// IPAM mode
+	Mode string `json:"mode,omitempty"`
+
+	// Usage of the IP pools
+	Pools []*IPAMPoolStatus `json:"pools"`
 }
 
+/* polymorph IPAMStatus cluster-pool false */
+
 /* polymorph IPAMStatus ipv4 false */
 
 /* polymorph IPAMStatus ipv6 false */
 
+/* polymorph IPAMStatus mode false */
+
+/* polymorph IPAMStatus pools false */
+
 // Validate validates this IP a m status
 func (m *IPAMStatus) Validate(formats strfmt.Registry) error {
 	var res []error
 
+	if err := m.validateClusterPool(formats); err != nil {
+		// prop
+		res = append(res, err)
+	}
+
 	if err := m.validateIPV4(formats); err != nil {
 		// prop
 		res = append(res, err)
@@ -42,12 +66,41 @@ func (m *IPAMStatus) Validate(formats strfmt.Registry) error {
 		res = append(res, err)
 	}
 
+	if err := m.validateMode(formats); err != nil {
+		// prop
+		res = append(res, err)
+	}
+
+	if err := m.validatePools(formats); err != nil {
+		// prop
+		res = append(res, err)
+	}
+
 	if len(res) > 0 {
 		return errors.CompositeValidationError(res...)
 	}
 	return nil
 }
 
+func (m *IPAMStatus) validateClusterPool(formats strfmt.Registry) error {
+
+	if swag.IsZero(m.ClusterPool) { // not required
+		return nil
+	}
+
+	if m.ClusterPool != nil {
+
+		if err := m.ClusterPool.Validate(formats); err != nil {
+			if ve, ok := err.(*errors.Validation); ok {
+				return ve.ValidateName("cluster-pool")
+			}
+			return err
+		}
+	}
+
+	return nil
+}
+
 func (m *IPAMStatus) validateIPV4(formats strfmt.Registry) error {
 
 	if swag.IsZero(m.IPV4) { // not required
@@ -66,6 +119,74 @@ func (m *IPAMStatus) validateIPV6(formats strfmt.Registry) error {
 	return nil
 }
 
+var ipAMStatusTypeModePropEnum []interface{}
+
+func init() {
+	var res []string
+	if err := json.Unmarshal([]byte(`["host-local","cluster-pool"]`), &res); err != nil {
+		panic(err)
+	}
+	for _, v := range res {
+		ipAMStatusTypeModePropEnum = append(ipAMStatusTypeModePropEnum, v)
+	}
+}
+
+const (
+	// IPAMStatusModeHostLocal captures enum value "host-local"
+	IPAMStatusModeHostLocal string = "host-local"
+	// IPAMStatusModeClusterPool captures enum value "cluster-pool"
+	IPAMStatusModeClusterPool string = "cluster-pool"
+)
+
+// prop value enum
+func (m *IPAMStatus) validateModeEnum(path, location string, value string) error {
+	if err := validate.Enum(path, location, value, ipAMStatusTypeModePropEnum); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (m *IPAMStatus) validateMode(formats strfmt.Registry) error {
+
+	if swag.IsZero(m.Mode) { // not required
+		return nil
+	}
+
+	// value enum
+	if err := m.validateModeEnum("mode", "body", m.Mode); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (m *IPAMStatus) validatePools(formats strfmt.Registry) error {
+
+	if swag.IsZero(m.Pools) { // not required
+		return nil
+	}
+
+	for i := 0; i < len(m.Pools); i++ {
+
+		if swag.IsZero(m.Pools[i]) { // not required
+			continue
+		}
+
+		if m.Pools[i] != nil {
+
+			if err := m.Pools[i].Validate(formats); err != nil {
+				if ve, ok := err.(*errors.Validation); ok {
+					return ve.ValidateName("pools" + "." + strconv.Itoa(i))
+				}
+				return err
+			}
+		}
+
+	}
+
+	return nil
+}
+
 // MarshalBinary interface implementation
 func (m *IPAMStatus) MarshalBinary() ([]byte, error) {
 	if m == nil {
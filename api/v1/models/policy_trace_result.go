@@ -6,6 +6,8 @@ package models
 // Editing this file might prove futile when you re-run the swagger generate command
 
 import (
+	"strconv"
+
 	strfmt "github.com/go-openapi/strfmt"
 
 	"github.com/go-openapi/errors"
@@ -17,27 +19,91 @@ import (
 
 type PolicyTraceResult struct {
 
+	// l4
+	L4 *L4Policy `json:"l4,omitempty"`
+
+	// Verdict of the layer 7 request evaluation
+	L7Verdict string `json:"l7-verdict,omitempty"`
+
 	// log
 	Log string `json:"log,omitempty"`
 
+	// Labels of all rules selecting the source or destination
+	MatchedRules []Labels `json:"matched-rules"`
+
 	// verdict
 	Verdict string `json:"verdict,omitempty"`
 }
 
+/* polymorph PolicyTraceResult l4 false */
+
+/* polymorph PolicyTraceResult l7-verdict false */
+
 /* polymorph PolicyTraceResult log false */
 
+/* polymorph PolicyTraceResult matched-rules false */
+
 /* polymorph PolicyTraceResult verdict false */
 
 // Validate validates this policy trace result
 func (m *PolicyTraceResult) Validate(formats strfmt.Registry) error {
 	var res []error
 
+	if err := m.validateL4(formats); err != nil {
+		// prop
+		res = append(res, err)
+	}
+
+	if err := m.validateMatchedRules(formats); err != nil {
+		// prop
+		res = append(res, err)
+	}
+
 	if len(res) > 0 {
 		return errors.CompositeValidationError(res...)
 	}
 	return nil
 }
 
+func (m *PolicyTraceResult) validateL4(formats strfmt.Registry) error {
+
+	if swag.IsZero(m.L4) { // not required
+		return nil
+	}
+
+	if m.L4 != nil {
+
+		if err := m.L4.Validate(formats); err != nil {
+			if ve, ok := err.(*errors.Validation); ok {
+				return ve.ValidateName("l4")
+			}
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m *PolicyTraceResult) validateMatchedRules(formats strfmt.Registry) error {
+
+	if swag.IsZero(m.MatchedRules) { // not required
+		return nil
+	}
+
+	for i := 0; i < len(m.MatchedRules); i++ {
+
+		if err := m.MatchedRules[i].Validate(formats); err != nil {
+			if ve, ok := err.(*errors.Validation); ok {
+				return ve.ValidateName("matched-rules" + "." + strconv.Itoa(i))
+			}
+			return err
+		}
+
+	}
+
+	return nil
+}
+
 // MarshalBinary interface implementation
 func (m *PolicyTraceResult) MarshalBinary() ([]byte, error) {
 	if m == nil {
@@ -20,6 +20,9 @@ import (
 
 type Port struct {
 
+	// Name of a named port, used instead of the port number
+	Name string `json:"name,omitempty"`
+
 	// Layer 4 port number
 	Port uint16 `json:"port,omitempty"`
 
@@ -27,6 +30,8 @@ type Port struct {
 	Protocol string `json:"protocol,omitempty"`
 }
 
+/* polymorph Port name false */
+
 /* polymorph Port port false */
 
 /* polymorph Port protocol false */
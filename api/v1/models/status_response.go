@@ -23,6 +23,9 @@ type StatusResponse struct {
 	// Status of local container runtime
 	ContainerRuntime *Status `json:"container-runtime,omitempty"`
 
+	// Status of the identity garbage collector
+	IdentityGc *IdentityGCStatus `json:"identity-gc,omitempty"`
+
 	// Status of IP address management
 	IPAM *IPAMStatus `json:"ipam,omitempty"`
 
@@ -40,6 +43,8 @@ type StatusResponse struct {
 
 /* polymorph StatusResponse container-runtime false */
 
+/* polymorph StatusResponse identity-gc false */
+
 /* polymorph StatusResponse ipam false */
 
 /* polymorph StatusResponse kubernetes false */
@@ -62,6 +67,11 @@ func (m *StatusResponse) Validate(formats strfmt.Registry) error {
 		res = append(res, err)
 	}
 
+	if err := m.validateIdentityGc(formats); err != nil {
+		// prop
+		res = append(res, err)
+	}
+
 	if err := m.validateIPAM(formats); err != nil {
 		// prop
 		res = append(res, err)
@@ -126,6 +136,25 @@ func (m *StatusResponse) validateContainerRuntime(formats strfmt.Registry) error
 	return nil
 }
 
+func (m *StatusResponse) validateIdentityGc(formats strfmt.Registry) error {
+
+	if swag.IsZero(m.IdentityGc) { // not required
+		return nil
+	}
+
+	if m.IdentityGc != nil {
+
+		if err := m.IdentityGc.Validate(formats); err != nil {
+			if ve, ok := err.(*errors.Validation); ok {
+				return ve.ValidateName("identity-gc")
+			}
+			return err
+		}
+	}
+
+	return nil
+}
+
 func (m *StatusResponse) validateIPAM(formats strfmt.Registry) error {
 
 	if swag.IsZero(m.IPAM) { // not required
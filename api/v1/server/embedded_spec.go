@@ -508,6 +508,21 @@ func init() {
       }
     },
     "/ipam": {
+      "get": {
+        "description": "Returns the IPAM mode, the allocated IP addresses and, in cluster-pool\nmode, the CIDRs leased by all nodes.\n",
+        "tags": [
+          "ipam"
+        ],
+        "summary": "Get IP address management status",
+        "responses": {
+          "200": {
+            "description": "Success",
+            "schema": {
+              "$ref": "#/definitions/IPAMStatus"
+            }
+          }
+        }
+      },
       "post": {
         "tags": [
           "ipam"
@@ -516,6 +531,12 @@ func init() {
         "parameters": [
           {
             "$ref": "#/parameters/ipam-family"
+          },
+          {
+            "$ref": "#/parameters/ipam-pool"
+          },
+          {
+            "$ref": "#/parameters/ipam-owner"
           }
         ],
         "responses": {
@@ -715,6 +736,35 @@ func init() {
         }
       }
     },
+    "/policy/diff": {
+      "get": {
+        "description": "Computes which pairs of security identities gain or lose access\nif the given policy rules were imported. The policy repository is not\nmodified.\n",
+        "tags": [
+          "policy"
+        ],
+        "summary": "Compute access changes caused by importing policy rules",
+        "parameters": [
+          {
+            "$ref": "#/parameters/policy-rules"
+          }
+        ],
+        "responses": {
+          "200": {
+            "description": "Success",
+            "schema": {
+              "$ref": "#/definitions/PolicyDiffResult"
+            }
+          },
+          "400": {
+            "description": "Invalid policy",
+            "schema": {
+              "$ref": "#/definitions/Error"
+            },
+            "x-go-name": "InvalidPolicy"
+          }
+        }
+      }
+    },
     "/policy/resolve": {
       "get": {
         "tags": [
@@ -1055,6 +1105,10 @@ func init() {
         "addressing": {
           "$ref": "#/definitions/EndpointAddressing"
         },
+        "bandwidth": {
+          "description": "Bandwidth limits of endpoint",
+          "$ref": "#/definitions/EndpointBandwidth"
+        },
         "container-id": {
           "description": "ID assigned by container runtime",
           "type": "string"
@@ -1139,6 +1193,20 @@ func init() {
         }
       }
     },
+    "EndpointBandwidth": {
+      "description": "Bandwidth limits of an endpoint",
+      "type": "object",
+      "properties": {
+        "egress": {
+          "description": "Limit of sent traffic in bits per second, 0 if unlimited",
+          "type": "integer"
+        },
+        "ingress": {
+          "description": "Limit of received traffic in bits per second, 0 if unlimited",
+          "type": "integer"
+        }
+      }
+    },
     "EndpointChangeRequest": {
       "description": "Structure which contains the mutable elements of an Endpoint.\n",
       "type": "object",
@@ -1181,6 +1249,14 @@ func init() {
           "description": "Name of network device",
           "type": "string"
         },
+        "k8s-namespace": {
+          "description": "Kubernetes namespace name",
+          "type": "string"
+        },
+        "k8s-pod-name": {
+          "description": "Kubernetes pod name",
+          "type": "string"
+        },
         "labels": {
           "description": "Labels describing the identity",
           "$ref": "#/definitions/Labels"
@@ -1315,9 +1391,87 @@ func init() {
         }
       }
     },
+    "IPAMClusterPoolStatus": {
+      "description": "Status of the cluster-pool IPAM mode",
+      "properties": {
+        "ipv4-cluster-cidr": {
+          "description": "Cluster wide IPv4 CIDR out of which node CIDRs are leased",
+          "type": "string"
+        },
+        "ipv4-node-cidr": {
+          "description": "IPv4 CIDR leased by the local node",
+          "type": "string"
+        },
+        "ipv6-cluster-cidr": {
+          "description": "Cluster wide IPv6 CIDR out of which node CIDRs are leased",
+          "type": "string"
+        },
+        "ipv6-node-cidr": {
+          "description": "IPv6 CIDR leased by the local node",
+          "type": "string"
+        },
+        "leases": {
+          "description": "CIDRs leased by all nodes of the cluster",
+          "type": "array",
+          "items": {
+            "$ref": "#/definitions/IPAMNodeCIDRLease"
+          }
+        }
+      }
+    },
+    "IPAMNodeCIDRLease": {
+      "description": "CIDR leased by a node out of the cluster pool",
+      "properties": {
+        "cidr": {
+          "description": "Leased CIDR",
+          "type": "string"
+        },
+        "node": {
+          "description": "Name of the node holding the lease",
+          "type": "string"
+        }
+      }
+    },
+    "IPAMPoolStatus": {
+      "description": "Usage of an IP pool",
+      "properties": {
+        "ipv4-cidr": {
+          "description": "IPv4 CIDR of the pool",
+          "type": "string"
+        },
+        "ipv4-free": {
+          "description": "Number of available IPv4 addresses",
+          "type": "integer"
+        },
+        "ipv4-used": {
+          "description": "Number of allocated IPv4 addresses",
+          "type": "integer"
+        },
+        "ipv6-cidr": {
+          "description": "IPv6 CIDR of the pool",
+          "type": "string"
+        },
+        "ipv6-free": {
+          "description": "Number of available IPv6 addresses",
+          "type": "integer"
+        },
+        "ipv6-used": {
+          "description": "Number of allocated IPv6 addresses",
+          "type": "integer"
+        },
+        "name": {
+          "description": "Name of the pool",
+          "type": "string"
+        }
+      }
+    },
     "IPAMStatus": {
       "description": "Status of IP address management",
       "properties": {
+        "cluster-pool": {
+          "description": "Status of the cluster-pool IPAM mode",
+          "$ref": "#/definitions/IPAMClusterPoolStatus"
+        },
         "ipv4": {
           "type": "array",
           "items": {
@@ -1329,6 +1483,21 @@ func init() {
           "items": {
             "type": "string"
           }
+        },
+        "mode": {
+          "description": "IPAM mode",
+          "type": "string",
+          "enum": [
+            "host-local",
+            "cluster-pool"
+          ]
+        },
+        "pools": {
+          "description": "Usage of the IP pools",
+          "type": "array",
+          "items": {
+            "$ref": "#/definitions/IPAMPoolStatus"
+          }
         }
       }
     },
@@ -1364,6 +1533,14 @@ func init() {
         "from": {
           "$ref": "#/definitions/Labels"
         },
+        "http": {
+          "description": "HTTP request to evaluate against layer 7 policy",
+          "$ref": "#/definitions/TraceHTTPRequest"
+        },
+        "kafka": {
+          "description": "Kafka request to evaluate against layer 7 policy",
+          "$ref": "#/definitions/TraceKafkaRequest"
+        },
         "to": {
           "$ref": "#/definitions/Labels"
         },
@@ -1373,6 +1550,24 @@ func init() {
         }
       }
     },
+    "IdentityGCStatus": {
+      "description": "Status of the identity garbage collector",
+      "type": "object",
+      "properties": {
+        "last-reclaimed": {
+          "description": "Number of identities reclaimed in the last run",
+          "type": "integer"
+        },
+        "reclaimed": {
+          "description": "Total number of identities reclaimed by this node",
+          "type": "integer"
+        },
+        "runs": {
+          "description": "Number of garbage collection runs performed by this node",
+          "type": "integer"
+        }
+      }
+    },
     "K8sStatus": {
       "description": "Status of Kubernetes integration",
       "type": "object",
@@ -1531,13 +1726,79 @@ func init() {
         }
       }
     },
+    "PolicyAccessChange": {
+      "description": "Change in access between two security identities",
+      "type": "object",
+      "properties": {
+        "egress": {
+          "description": "True if the change is caused by the egress policy of the source\nrather than by the ingress policy of the destination\n",
+          "type": "boolean"
+        },
+        "from": {
+          "description": "Numeric identity of the source",
+          "type": "integer"
+        },
+        "gained": {
+          "description": "Ports which become reachable, \"ANY\" denotes all ports",
+          "type": "array",
+          "items": {
+            "type": "string"
+          }
+        },
+        "lost": {
+          "description": "Ports which become unreachable, \"ANY\" denotes all ports",
+          "type": "array",
+          "items": {
+            "type": "string"
+          }
+        },
+        "to": {
+          "description": "Numeric identity of the destination",
+          "type": "integer"
+        },
+        "to-endpoints": {
+          "description": "Local endpoints using the destination identity",
+          "type": "array",
+          "items": {
+            "type": "integer"
+          }
+        }
+      }
+    },
+    "PolicyDiffResult": {
+      "description": "Result of a policy diff computation",
+      "type": "object",
+      "properties": {
+        "changes": {
+          "type": "array",
+          "items": {
+            "$ref": "#/definitions/PolicyAccessChange"
+          }
+        }
+      }
+    },
     "PolicyTraceResult": {
       "description": "Response to a policy resolution process",
       "type": "object",
       "properties": {
+        "l4": {
+          "description": "Resulting L4 filters of the source and destination",
+          "$ref": "#/definitions/L4Policy"
+        },
+        "l7-verdict": {
+          "description": "Verdict of the layer 7 request evaluation",
+          "type": "string"
+        },
         "log": {
           "type": "string"
         },
+        "matched-rules": {
+          "description": "Labels of all rules selecting the source or destination",
+          "type": "array",
+          "items": {
+            "$ref": "#/definitions/Labels"
+          }
+        },
         "verdict": {
           "type": "string"
         }
@@ -1547,6 +1808,10 @@ func init() {
       "description": "Layer 4 port / protocol pair",
       "type": "object",
       "properties": {
+        "name": {
+          "description": "Name of a named port, used instead of the port number",
+          "type": "string"
+        },
         "port": {
           "description": "Layer 4 port number",
           "type": "integer",
@@ -1633,6 +1898,10 @@ func init() {
           "description": "Status of local container runtime",
           "$ref": "#/definitions/Status"
         },
+        "identity-gc": {
+          "description": "Status of the identity garbage collector",
+          "$ref": "#/definitions/IdentityGCStatus"
+        },
         "ipam": {
           "description": "Status of IP address management",
           "$ref": "#/definitions/IPAMStatus"
@@ -1650,6 +1919,53 @@ func init() {
           "$ref": "#/definitions/MonitorStatus"
         }
       }
+    },
+    "TraceHTTPRequest": {
+      "description": "HTTP request to evaluate against layer 7 policy",
+      "type": "object",
+      "properties": {
+        "headers": {
+          "description": "List of headers in the form \"Key: value\"",
+          "type": "array",
+          "items": {
+            "type": "string"
+          }
+        },
+        "host": {
+          "description": "Value of the host header",
+          "type": "string"
+        },
+        "method": {
+          "description": "Request method",
+          "type": "string"
+        },
+        "path": {
+          "description": "Request path",
+          "type": "string"
+        }
+      }
+    },
+    "TraceKafkaRequest": {
+      "description": "Kafka request to evaluate against layer 7 policy",
+      "type": "object",
+      "properties": {
+        "api-key": {
+          "description": "Name of the API key, e.g. \"produce\" or \"fetch\"",
+          "type": "string"
+        },
+        "api-version": {
+          "description": "API version of the request",
+          "type": "integer"
+        },
+        "client-id": {
+          "description": "Client ID of the request",
+          "type": "string"
+        },
+        "topic": {
+          "description": "Topic of the request",
+          "type": "string"
+        }
+      }
     }
   },
   "parameters": {
@@ -1708,6 +2024,18 @@ func init() {
       "in": "path",
       "required": true
     },
+    "ipam-owner": {
+      "type": "string",
+      "description": "Owner of the allocation in the form namespace/pod, used to select the IP pool from annotations\n",
+      "name": "owner",
+      "in": "query"
+    },
+    "ipam-pool": {
+      "type": "string",
+      "description": "Name of the IP pool to allocate from",
+      "name": "pool",
+      "in": "query"
+    },
     "labels": {
       "description": "List of labels\n",
       "name": "labels",
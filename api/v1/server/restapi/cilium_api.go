@@ -78,6 +78,9 @@ func NewCiliumAPI(spec *loads.Document) *CiliumAPI {
 		DaemonGetHealthzHandler: daemon.GetHealthzHandlerFunc(func(params daemon.GetHealthzParams) middleware.Responder {
 			return middleware.NotImplemented("operation DaemonGetHealthz has not yet been implemented")
 		}),
+		IPAMGetIPAMHandler: ipam.GetIPAMHandlerFunc(func(params ipam.GetIPAMParams) middleware.Responder {
+			return middleware.NotImplemented("operation IPAMGetIPAM has not yet been implemented")
+		}),
 		PolicyGetIdentityHandler: policy.GetIdentityHandlerFunc(func(params policy.GetIdentityParams) middleware.Responder {
 			return middleware.NotImplemented("operation PolicyGetIdentity has not yet been implemented")
 		}),
@@ -87,6 +90,9 @@ func NewCiliumAPI(spec *loads.Document) *CiliumAPI {
 		PolicyGetPolicyHandler: policy.GetPolicyHandlerFunc(func(params policy.GetPolicyParams) middleware.Responder {
 			return middleware.NotImplemented("operation PolicyGetPolicy has not yet been implemented")
 		}),
+		PolicyGetPolicyDiffHandler: policy.GetPolicyDiffHandlerFunc(func(params policy.GetPolicyDiffParams) middleware.Responder {
+			return middleware.NotImplemented("operation PolicyGetPolicyDiff has not yet been implemented")
+		}),
 		PolicyGetPolicyResolveHandler: policy.GetPolicyResolveHandlerFunc(func(params policy.GetPolicyResolveParams) middleware.Responder {
 			return middleware.NotImplemented("operation PolicyGetPolicyResolve has not yet been implemented")
 		}),
@@ -182,12 +188,16 @@ type CiliumAPI struct {
 	EndpointGetEndpointIDLogHandler endpoint.GetEndpointIDLogHandler
 	// DaemonGetHealthzHandler sets the operation handler for the get healthz operation
 	DaemonGetHealthzHandler daemon.GetHealthzHandler
+	// IPAMGetIPAMHandler sets the operation handler for the get IP a m operation
+	IPAMGetIPAMHandler ipam.GetIPAMHandler
 	// PolicyGetIdentityHandler sets the operation handler for the get identity operation
 	PolicyGetIdentityHandler policy.GetIdentityHandler
 	// PolicyGetIdentityIDHandler sets the operation handler for the get identity ID operation
 	PolicyGetIdentityIDHandler policy.GetIdentityIDHandler
 	// PolicyGetPolicyHandler sets the operation handler for the get policy operation
 	PolicyGetPolicyHandler policy.GetPolicyHandler
+	// PolicyGetPolicyDiffHandler sets the operation handler for the get policy diff operation
+	PolicyGetPolicyDiffHandler policy.GetPolicyDiffHandler
 	// PolicyGetPolicyResolveHandler sets the operation handler for the get policy resolve operation
 	PolicyGetPolicyResolveHandler policy.GetPolicyResolveHandler
 	// PrefilterGetPrefilterHandler sets the operation handler for the get prefilter operation
@@ -327,6 +337,10 @@ func (o *CiliumAPI) Validate() error {
 		unregistered = append(unregistered, "daemon.GetHealthzHandler")
 	}
 
+	if o.IPAMGetIPAMHandler == nil {
+		unregistered = append(unregistered, "ipam.GetIPAMHandler")
+	}
+
 	if o.PolicyGetIdentityHandler == nil {
 		unregistered = append(unregistered, "policy.GetIdentityHandler")
 	}
@@ -339,6 +353,10 @@ func (o *CiliumAPI) Validate() error {
 		unregistered = append(unregistered, "policy.GetPolicyHandler")
 	}
 
+	if o.PolicyGetPolicyDiffHandler == nil {
+		unregistered = append(unregistered, "policy.GetPolicyDiffHandler")
+	}
+
 	if o.PolicyGetPolicyResolveHandler == nil {
 		unregistered = append(unregistered, "policy.GetPolicyResolveHandler")
 	}
@@ -545,6 +563,11 @@ func (o *CiliumAPI) initHandlerCache() {
 	}
 	o.handlers["GET"]["/healthz"] = daemon.NewGetHealthz(o.context, o.DaemonGetHealthzHandler)
 
+	if o.handlers["GET"] == nil {
+		o.handlers["GET"] = make(map[string]http.Handler)
+	}
+	o.handlers["GET"]["/ipam"] = ipam.NewGetIPAM(o.context, o.IPAMGetIPAMHandler)
+
 	if o.handlers["GET"] == nil {
 		o.handlers["GET"] = make(map[string]http.Handler)
 	}
@@ -560,6 +583,11 @@ func (o *CiliumAPI) initHandlerCache() {
 	}
 	o.handlers["GET"]["/policy"] = policy.NewGetPolicy(o.context, o.PolicyGetPolicyHandler)
 
+	if o.handlers["GET"] == nil {
+		o.handlers["GET"] = make(map[string]http.Handler)
+	}
+	o.handlers["GET"]["/policy/diff"] = policy.NewGetPolicyDiff(o.context, o.PolicyGetPolicyDiffHandler)
+
 	if o.handlers["GET"] == nil {
 		o.handlers["GET"] = make(map[string]http.Handler)
 	}
@@ -14,6 +14,8 @@ import (
 // PostIPAMURL generates an URL for the post IP a m operation
 type PostIPAMURL struct {
 	Family *string
+	Owner  *string
+	Pool   *string
 
 	_basePath string
 	// avoid unkeyed usage
@@ -57,6 +59,22 @@ func (o *PostIPAMURL) Build() (*url.URL, error) {
 		qs.Set("family", family)
 	}
 
+	var owner string
+	if o.Owner != nil {
+		owner = *o.Owner
+	}
+	if owner != "" {
+		qs.Set("owner", owner)
+	}
+
+	var pool string
+	if o.Pool != nil {
+		pool = *o.Pool
+	}
+	if pool != "" {
+		qs.Set("pool", pool)
+	}
+
 	result.RawQuery = qs.Encode()
 
 	return &result, nil
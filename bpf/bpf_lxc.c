@@ -28,6 +28,7 @@
 #include <linux/icmpv6.h>
 
 #include "lib/utils.h"
+#include "lib/static_data.h"
 #include "lib/common.h"
 #include "lib/maps.h"
 #include "lib/arp.h"
@@ -47,6 +48,7 @@
 #include "lib/csum.h"
 #include "lib/conntrack.h"
 #include "lib/encap.h"
+#include "lib/throttle.h"
 
 #define POLICY_ID ((LXC_ID << 16) | SECLABEL)
 
@@ -747,11 +749,18 @@ int handle_ingress(struct __sk_buff *skb)
 
 	cilium_dbg_capture2(skb, DBG_CAPTURE_FROM_LXC, skb->ingress_ifindex, SECLABEL);
 
+	/* ARP is answered locally and not subject to the bandwidth limit */
+	if (skb->protocol != bpf_htons(ETH_P_ARP)) {
+		ret = throttle(skb, LXC_ID, THROTTLE_EGRESS);
+		if (IS_ERR(ret))
+			return send_drop_notify(skb, SECLABEL, 0, 0, 0, ret, TC_ACT_SHOT);
+	}
+
 #ifdef DROP_ALL
 	if (skb->protocol == bpf_htons(ETH_P_ARP)) {
 		ep_tail_call(skb, CILIUM_CALL_ARP);
 		ret = DROP_MISSED_TAIL_CALL;
-	} else if (1) {
+	} else if (policy_audit(skb, DROP_POLICY, SECLABEL, 0) != TC_ACT_OK) {
 		ret = DROP_POLICY;
 	} else {
 #endif
@@ -806,6 +815,7 @@ static inline int __inline__ ipv6_policy(struct __sk_buff *skb, int ifindex, __u
 	struct ct_state ct_state_new = {};
 	bool skip_proxy;
 	union v6addr orig_dip = {};
+	__u8 match_type;
 
 	if (data + sizeof(struct ipv6hdr) + ETH_HLEN > data_end)
 		return DROP_INVALID;
@@ -863,11 +873,15 @@ static inline int __inline__ ipv6_policy(struct __sk_buff *skb, int ifindex, __u
 	 * passed through the allowed consumer. */
 	/* FIXME: Add option to disable policy accounting and avoid policy
 	 * lookup if policy accounting is disabled */
-	verdict = policy_can_access(&POLICY_MAP, skb, src_label, tuple.dport,
-				    tuple.nexthdr, sizeof(tuple.saddr),
-				    &tuple.saddr);
+	verdict = __policy_can_access(&POLICY_MAP, skb, src_label, tuple.dport,
+				      tuple.nexthdr, sizeof(tuple.saddr),
+				      &tuple.saddr, &match_type);
 	if (unlikely(ret == CT_NEW)) {
-		if (verdict != TC_ACT_OK)
+		send_policy_verdict_notify(skb, src_label, SECLABEL, tuple.dport,
+					   tuple.nexthdr, POLICY_INGRESS, verdict,
+					   match_type);
+
+		if (policy_audit(skb, verdict, src_label, SECLABEL) != TC_ACT_OK)
 			return DROP_POLICY;
 
 		ct_state_new.orig_dport = tuple.dport;
@@ -920,6 +934,7 @@ static inline int __inline__ ipv4_policy(struct __sk_buff *skb, int ifindex, __u
 	struct ct_state ct_state_new = {};
 	bool skip_proxy;
 	__be32 orig_dip;
+	__u8 match_type;
 
 	if (data + sizeof(*ip4) + ETH_HLEN > data_end)
 		return DROP_INVALID;
@@ -965,11 +980,15 @@ static inline int __inline__ ipv4_policy(struct __sk_buff *skb, int ifindex, __u
 
 	/* Policy lookup is done on every packet to account for packets that
 	 * passed through the allowed consumer. */
-	verdict = policy_can_access(&POLICY_MAP, skb, src_label, tuple.dport,
-				    tuple.nexthdr, sizeof(tuple.saddr),
-				    &tuple.saddr);
+	verdict = __policy_can_access(&POLICY_MAP, skb, src_label, tuple.dport,
+				      tuple.nexthdr, sizeof(tuple.saddr),
+				      &tuple.saddr, &match_type);
 	if (unlikely(ret == CT_NEW)) {
-		if (verdict != TC_ACT_OK)
+		send_policy_verdict_notify(skb, src_label, SECLABEL, tuple.dport,
+					   tuple.nexthdr, POLICY_INGRESS, verdict,
+					   match_type);
+
+		if (policy_audit(skb, verdict, src_label, SECLABEL) != TC_ACT_OK)
 			return DROP_POLICY;
 
 		ct_state_new.orig_dport = tuple.dport;
@@ -1009,12 +1028,17 @@ static inline int __inline__ ipv4_policy(struct __sk_buff *skb, int ifindex, __u
 }
 #endif
 
-__section_tail(CILIUM_MAP_POLICY, LXC_ID) int handle_policy(struct __sk_buff *skb)
+__section_tail(CILIUM_MAP_POLICY, TEMPLATE_LXC_ID) int handle_policy(struct __sk_buff *skb)
 {
 	int ret, ifindex = skb->cb[CB_IFINDEX];
 	__u32 src_label = skb->cb[CB_SRC_LABEL];
 	int forwarding_reason = 0;
 
+	ret = throttle(skb, LXC_ID, THROTTLE_INGRESS);
+	if (IS_ERR(ret))
+		return send_drop_notify(skb, src_label, SECLABEL, LXC_ID,
+					ifindex, ret, TC_ACT_SHOT);
+
 	switch (skb->protocol) {
 	case bpf_htons(ETH_P_IPV6):
 		ret = ipv6_policy(skb, ifindex, src_label, &forwarding_reason);
@@ -1065,7 +1089,7 @@ __section_tail(CILIUM_MAP_CALLS, CILIUM_CALL_NAT64) int tail_ipv6_to_ipv4(struct
 
 __section_tail(CILIUM_MAP_CALLS, CILIUM_CALL_NAT46) int tail_ipv4_to_ipv6(struct __sk_buff *skb)
 {
-	union v6addr dp = {};
+	union v6addr dp = LXC_IP;
 	void *data = (void *) (long) skb->data;
 	void *data_end = (void *) (long) skb->data_end;
 	struct iphdr *ip4 = data + ETH_HLEN;
@@ -1074,7 +1098,6 @@ __section_tail(CILIUM_MAP_CALLS, CILIUM_CALL_NAT46) int tail_ipv4_to_ipv6(struct
 	if (data + sizeof(*ip4) + ETH_HLEN > data_end)
 		return DROP_INVALID;
 
-	BPF_V6(dp, LXC_IP);
 	ret = ipv4_to_ipv6(skb, ip4, 14, &dp);
 	if (IS_ERR(ret))
 		return ret;
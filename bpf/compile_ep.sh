@@ -1,6 +1,6 @@
 #!/bin/bash
 #
-# Copyright 2016-2017 Authors of Cilium
+# Copyright 2016-2018 Authors of Cilium
 #
 # Licensed under the Apache License, Version 2.0 (the "License");
 # you may not use this file except in compliance with the License.
@@ -14,13 +14,16 @@
 # See the License for the specific language governing permissions and
 # limitations under the License.
 
+# Compiles the endpoint program template for the configuration in
+# $OUTDIR/lxc_config.h. Endpoint specific values are substituted into the
+# compiled template when it is attached to an endpoint.
+
 set -e
 
 LIB=$1
 RUNDIR=$2
-EPDIR=$3
-IFNAME=$4
-DEBUG=$5
+OUTDIR=$3
+DEBUG=$4
 
 function bpf_compile()
 {
@@ -30,13 +33,13 @@ function bpf_compile()
 
 	clang -O2 -target bpf -emit-llvm				\
 	      -Wno-address-of-packed-member -Wno-unknown-warning-option	\
-	      -I$RUNDIR/globals -I$EPDIR -I$LIB/include			\
+	      -I$RUNDIR/globals -I$OUTDIR -I$LIB/include		\
 	      -D__NR_CPUS__=$(nproc)					\
 	      -c $LIB/$IN -o - |					\
-	llc -march=bpf -mcpu=probe -filetype=$TYPE -o $EPDIR/$OUT
+	llc -march=bpf -mcpu=probe -filetype=$TYPE -o $OUTDIR/$OUT
 }
 
-echo "Join EP id=$EPDIR ifname=$IFNAME"
+echo "Compile EP template dir=$OUTDIR"
 
 # Only generate ASM output if debug is enabled.
 if [[ "${DEBUG}" == "true" ]]; then
@@ -46,6 +49,3 @@ if [[ "${DEBUG}" == "true" ]]; then
 fi
 
 bpf_compile bpf_lxc.c bpf_lxc.o obj
-
-tc qdisc replace dev $IFNAME clsact || true
-tc filter replace dev $IFNAME ingress prio 1 handle 1 bpf da obj $EPDIR/bpf_lxc.o sec from-container
@@ -86,17 +86,20 @@ union v6addr {
 #define BPF_L4_MAP_NEXT1(dst, port, hdr, index, map, next) BPF_L4_MAP_NEXT0(dst, port, hdr, index, map, next, 0)
 #define BPF_L4_MAP_NEXT(dst, port, hdr, index, map, next) BPF_L4_MAP_NEXT1 (dst, port, hdr, index, BPF_L4_MAP_GET_END map, next)
 
-#define F(dst, port, hdr, index, map0, map1, map2)				\
+/* map0 and map1 are the first and the last port of the allowed port range,
+ * map1 is 0 if a single port is allowed. */
+#define F(dst, port, hdr, index, map0, map1, map2, map3)			\
 	({									\
-		dst = (dst > -1 ? dst : ((map0 && map0 == port) ?		\
-			((map2 && map2 == hdr) ? map1 : DROP_POLICY_L4) :	\
+		dst = (dst > -1 ? dst : ((map0 && port >= map0 &&		\
+			 port <= (map1 ? map1 : map0)) ?			\
+			((map3 && map3 == hdr) ? map2 : DROP_POLICY_L4) :	\
 			DROP_POLICY_L4));					\
 	});
 
-#define BPF_L4_MAP0(dst, port, hdr, index, map0, map1, map2, next, ...) \
-	F(dst, port, hdr, index, map0, map1, map2) BPF_L4_MAP_NEXT(dst, port, hdr, index, next, BPF_L4_MAP1)(dst, port, hdr, next, __VA_ARGS__)
-#define BPF_L4_MAP1(dst, port, hdr, index, map0, map1, map2, next, ...) \
-	F(dst, port, hdr, index, map0, map1, map2) BPF_L4_MAP_NEXT(dst, port, hdr, index, next, BPF_L4_MAP0)(dst, port, hdr, next, __VA_ARGS__)
+#define BPF_L4_MAP0(dst, port, hdr, index, map0, map1, map2, map3, next, ...) \
+	F(dst, port, hdr, index, map0, map1, map2, map3) BPF_L4_MAP_NEXT(dst, port, hdr, index, next, BPF_L4_MAP1)(dst, port, hdr, next, __VA_ARGS__)
+#define BPF_L4_MAP1(dst, port, hdr, index, map0, map1, map2, map3, next, ...) \
+	F(dst, port, hdr, index, map0, map1, map2, map3) BPF_L4_MAP_NEXT(dst, port, hdr, index, next, BPF_L4_MAP0)(dst, port, hdr, next, __VA_ARGS__)
 
 #define BPF_L4_MAP(dst, port, hdr, ...)				\
 	({							\
@@ -105,7 +108,7 @@ union v6addr {
 
 /* Examples to illustrate how to use BPF_L4_MAP and BPF_V6_16
  *
- * BPF_L4_MAP(my_map, 0, 80, 8080, 0, 1, 80, 8080, 0, (), 0)
+ * BPF_L4_MAP(my_map, 0, 80, 0, 8080, 0, 1, 8000, 8100, 0, 0, (), 0)
  * BPF_V6_16(my_dst, 0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15)
  */
 
@@ -153,6 +156,21 @@ struct endpoint_info {
 	struct portmap  portmap[PORTMAP_MAX];
 };
 
+/* Key of throttle map */
+struct throttle_key {
+	__u16		lxc_id;
+	__u8		direction;
+	__u8		pad;
+};
+
+/* Value of throttle map, token bucket of an endpoint and direction */
+struct throttle_info {
+	__u64		rate;	/* bytes per second */
+	__u64		burst;	/* maximum tokens in bytes */
+	__u64		tokens;	/* available tokens in bytes */
+	__u64		last;	/* time of last update in ns */
+};
+
 struct policy_key {
 	__u32		sec_label;
 	__u16		dport;
@@ -173,6 +191,7 @@ enum {
 	CILIUM_NOTIFY_DBG_MSG,
 	CILIUM_NOTIFY_DBG_CAPTURE,
 	CILIUM_NOTIFY_TRACE,
+	CILIUM_NOTIFY_POLICY_VERDICT,
 };
 
 #define NOTIFY_COMMON_HDR \
@@ -223,6 +242,8 @@ enum {
 #define DROP_NO_SERVICE		-158
 #define DROP_POLICY_L4		-159
 #define DROP_NO_TUNNEL_ENDPOINT -160
+#define DROP_POLICY_AUDIT	-161
+#define DROP_THROTTLED		-162
 
 
 /* Magic skb->mark markers which identify packets originating from the proxy
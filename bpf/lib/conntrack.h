@@ -27,6 +27,8 @@
 #include "dbg.h"
 #include "l4.h"
 #include "nat46.h"
+#include "drop.h"
+#include "policy_log.h"
 
 #define CT_DEFAULT_LIFEIME	360
 #define CT_CLOSE_TIMEOUT	10
@@ -455,6 +457,28 @@ out:
 	return ret;
 }
 
+/* Report the verdict of the L4 egress policy for a new connection. The
+ * egress policy only matches on the port, the destination identity is thus
+ * not known. */
+static inline void __inline__ ct_egress_verdict_notify(struct __sk_buff *skb, __u32 src_label,
+							__be16 dport, __u8 nexthdr, int proxy_port)
+{
+	__u8 match_type = POLICY_MATCH_NONE;
+	int verdict = proxy_port;
+
+	if (!IS_ERR(proxy_port)) {
+		verdict = TC_ACT_OK;
+#ifdef CFG_L4_EGRESS
+		match_type = POLICY_MATCH_L4_ONLY;
+#else
+		match_type = POLICY_MATCH_ALL;
+#endif
+	}
+
+	send_policy_verdict_notify(skb, src_label, 0, dport, nexthdr,
+				   POLICY_EGRESS, verdict, match_type);
+}
+
 /* Offset must point to IPv6 */
 static inline int __inline__ ct_create6(void *map, struct ipv6_ct_tuple *tuple,
 					struct __sk_buff *skb, int dir,
@@ -479,6 +503,8 @@ static inline int __inline__ ct_create6(void *map, struct ipv6_ct_tuple *tuple,
 				proxy_port = 0;
 			} else {
 				proxy_port = l4_ingress_policy(skb, tuple->dport, tuple->nexthdr);
+				proxy_port = policy_audit(skb, proxy_port,
+							  ct_state->src_sec_id, 0);
 				if (IS_ERR(proxy_port))
 					return proxy_port;
 			}
@@ -495,6 +521,10 @@ static inline int __inline__ ct_create6(void *map, struct ipv6_ct_tuple *tuple,
 			 * optionally return a proxy port number to redirect all traffic to.
 			 */
 			proxy_port = l4_egress_policy(skb, tuple->dport, tuple->nexthdr);
+			ct_egress_verdict_notify(skb, ct_state->src_sec_id, tuple->dport,
+						 tuple->nexthdr, proxy_port);
+			proxy_port = policy_audit(skb, proxy_port,
+						  ct_state->src_sec_id, 0);
 			if (IS_ERR(proxy_port))
 				return proxy_port;
 
@@ -569,6 +599,8 @@ static inline int __inline__ ct_create4(void *map, struct ipv4_ct_tuple *tuple,
 				proxy_port = 0;
 			} else {
 				proxy_port = l4_ingress_policy(skb, ct_state->orig_dport, tuple->nexthdr);
+				proxy_port = policy_audit(skb, proxy_port,
+							  ct_state->src_sec_id, 0);
 				if (IS_ERR(proxy_port))
 					return proxy_port;
 			}
@@ -585,6 +617,10 @@ static inline int __inline__ ct_create4(void *map, struct ipv4_ct_tuple *tuple,
 			 * optionally return a proxy port number to redirect all traffic to.
 			 */
 			proxy_port = l4_egress_policy(skb, ct_state->orig_dport, tuple->nexthdr);
+			ct_egress_verdict_notify(skb, ct_state->src_sec_id, ct_state->orig_dport,
+						 tuple->nexthdr, proxy_port);
+			proxy_port = policy_audit(skb, proxy_port,
+						  ct_state->src_sec_id, 0);
 			if (IS_ERR(proxy_port))
 				return proxy_port;
 
@@ -21,6 +21,8 @@
  * API:
  * int send_drop_notify(skb, src, dst, dst_id, ifindex, reason, exitcode)
  * int send_drop_notify_error(skb, error, exitcode)
+ * void send_policy_audit_notify(skb, src, dst)
+ * int policy_audit(skb, verdict, src, dst)
  *
  * If DROP_NOTIFY is not defined, the API will be compiled in as a NOP.
  */
@@ -104,6 +106,37 @@ static inline int send_drop_notify(struct __sk_buff *skb, __u32 src, __u32 dst,
 	return exitcode;
 }
 
+/**
+ * send_policy_audit_notify
+ * @skb:	socket buffer
+ * @src:	source identity
+ * @dst:	destination identity
+ *
+ * Generate a notification to indicate a packet would have been dropped by
+ * policy but was allowed to pass as the endpoint is in policy audit mode.
+ *
+ * Unlike send_drop_notify(), this is not a terminal function.
+ */
+static inline void send_policy_audit_notify(struct __sk_buff *skb, __u32 src,
+					    __u32 dst)
+{
+	uint64_t skb_len = (uint64_t)skb->len, cap_len = min((uint64_t)TRACE_PAYLOAD_LEN, (uint64_t)skb_len);
+	struct drop_notify msg = {
+		.type = CILIUM_NOTIFY_DROP,
+		.subtype = -DROP_POLICY_AUDIT,
+		.source = EVENT_SOURCE,
+		.hash = get_hash_recalc(skb),
+		.len_orig = skb_len,
+		.len_cap = cap_len,
+		.src_label = src,
+		.dst_label = dst,
+	};
+
+	skb_event_output(skb, &cilium_events,
+			 (cap_len << 32) | BPF_F_CURRENT_CPU,
+			 &msg, sizeof(msg));
+}
+
 #else
 
 static inline int send_drop_notify(struct __sk_buff *skb, __u32 src, __u32 dst,
@@ -112,6 +145,11 @@ static inline int send_drop_notify(struct __sk_buff *skb, __u32 src, __u32 dst,
 	return exitcode;
 }
 
+static inline void send_policy_audit_notify(struct __sk_buff *skb, __u32 src,
+					    __u32 dst)
+{
+}
+
 #endif
 
 static inline int send_drop_notify_error(struct __sk_buff *skb, int error, int exitcode)
@@ -119,4 +157,27 @@ static inline int send_drop_notify_error(struct __sk_buff *skb, int error, int e
 	return send_drop_notify(skb, 0, 0, 0, 0, error, exitcode);
 }
 
+/**
+ * policy_audit
+ * @skb:	socket buffer
+ * @verdict:	result of a policy lookup, negative if denied by policy
+ * @src:	source identity
+ * @dst:	destination identity, 0 if unknown
+ *
+ * Returns TC_ACT_OK in place of a DROP_POLICY or DROP_POLICY_L4 verdict if
+ * the endpoint is in policy audit mode and generates an audit notification
+ * for it. All other verdicts are returned unchanged.
+ */
+static inline int policy_audit(struct __sk_buff *skb, int verdict, __u32 src,
+			       __u32 dst)
+{
+#ifdef POLICY_AUDIT_MODE
+	if (verdict == DROP_POLICY || verdict == DROP_POLICY_L4) {
+		send_policy_audit_notify(skb, src, dst);
+		return TC_ACT_OK;
+	}
+#endif
+	return verdict;
+}
+
 #endif /* __LIB_DROP__ */
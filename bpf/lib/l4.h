@@ -125,8 +125,11 @@ static inline int l4_load_port(struct __sk_buff *skb, int off, __be16 *port)
 /* Structure to define an L4 port which may ingress into an endpoint */
 struct l4_allow
 {
-	/* Allowed destination port number */
-	__be16 port;
+	/* First allowed destination port number in host byte order */
+	__u16 port;
+
+	/* Last allowed destination port number in host byte order */
+	__u16 end_port;
 
 	/* If defined, will redirect all traffic to this proxy port */
 	__be16 proxy;
@@ -143,8 +146,16 @@ struct l4_allow
 static inline int __inline__ l4_ingress_embedded(__be16 dport, __u8 nexthdr)
 {
 	int allowed = DROP_POLICY_L4;
+	__u16 port = bpf_ntohs(dport);
+
+	BPF_L4_MAP(allowed, port, nexthdr, CFG_L4_INGRESS);
+
+	/* The ports allowed at ingress are enforced per source identity by
+	 * the policy map, the embedded map only provides the proxy port of
+	 * ports redirected to a proxy. */
+	if (allowed < 0)
+		return 0;
 
-	BPF_L4_MAP(allowed, dport, nexthdr, CFG_L4_INGRESS);
 	return allowed;
 }
 #endif
@@ -153,8 +164,9 @@ static inline int __inline__ l4_ingress_embedded(__be16 dport, __u8 nexthdr)
 static inline int __inline__ l4_egress_embedded(__be16 dport, __u8 nexthdr)
 {
 	int allowed = DROP_POLICY_L4;
+	__u16 port = bpf_ntohs(dport);
 
-	BPF_L4_MAP(allowed, dport, nexthdr, CFG_L4_EGRESS);
+	BPF_L4_MAP(allowed, port, nexthdr, CFG_L4_EGRESS);
 	return allowed;
 }
 #endif
@@ -165,13 +177,12 @@ static inline int __inline__ l4_egress_embedded(__be16 dport, __u8 nexthdr)
  * @arg dport:	 destination port (ingress port on endpoint)
  * @arg nexthdr: next header (IPPROTO_TCP, IPPROTO_UDP, ..)
  *
- * The L4 space defaults to allow all unless CFG_L4_INGRESS is
- * specified in which case only allowed port + protocol pairs
- * will be allowed.
+ * Whether the port + protocol pair is allowed has already been
+ * decided by the policy map lookup in __policy_can_access(), this
+ * only resolves whether the connection must be redirected to a proxy.
  *
  * Returns: 0 if connection is allowed
  *          n > 0 if connection should be proxied to n
- *          n < 0 if connection should be dropped with reason n
  */
 static inline int __inline__
 l4_ingress_policy(struct __sk_buff *skb, __be16 dport, __u8 nexthdr)
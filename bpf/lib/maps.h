@@ -92,6 +92,15 @@ struct bpf_elf_map __section_maps tunnel_endpoint_map = {
 
 #endif
 
+/* Value of CIDR entries whose prefix is only allowed on the ports of the L4
+ * policy, must be kept in sync with pkg/maps/cidrmap */
+#define LPM_FLAG_PORT_RESTRICTED 1
+
+/* Results of the CIDR lookups */
+#define LPM_NO_MATCH			0
+#define LPM_MATCH			1
+#define LPM_MATCH_PORT_RESTRICTED	2
+
 #ifdef POLICY_ENFORCEMENT
 
 #ifdef HAVE_LPM_MAP_TYPE
@@ -112,7 +121,11 @@ struct bpf_lpm_trie_key6 {
 static __always_inline int lpm6_map_lookup(struct bpf_elf_map *map, union v6addr *addr)
 {
 	struct bpf_lpm_trie_key6 key = { { 128 }, *addr };
-	return map_lookup_elem(map, &key) != NULL;
+	__u8 *flags = map_lookup_elem(map, &key);
+
+	if (!flags)
+		return LPM_NO_MATCH;
+	return *flags & LPM_FLAG_PORT_RESTRICTED ? LPM_MATCH_PORT_RESTRICTED : LPM_MATCH;
 }
 
 #ifdef CIDR6_INGRESS_MAP
@@ -151,7 +164,11 @@ struct bpf_lpm_trie_key4 {
 static __always_inline int lpm4_map_lookup(struct bpf_elf_map *map, __be32 addr)
 {
 	struct bpf_lpm_trie_key6 key = { { 32 }, addr };
-	return map_lookup_elem(map, &key) != NULL;
+	__u8 *flags = map_lookup_elem(map, &key);
+
+	if (!flags)
+		return LPM_NO_MATCH;
+	return *flags & LPM_FLAG_PORT_RESTRICTED ? LPM_MATCH_PORT_RESTRICTED : LPM_MATCH;
 }
 
 #ifdef CIDR4_INGRESS_MAP
@@ -183,10 +200,13 @@ struct bpf_elf_map __section_maps CIDR4_EGRESS_MAP = {
 
 #else /* HAVE_LPM_MAP_TYPE */
 /* No LPM map, use an array instead. Since our policies are default
- * deny we can stop at the first match. */
+ * deny we can stop at the first match of a prefix allowed on all ports.
+ * Port restricted prefixes contained in a prefix allowed on all ports
+ * are not flagged, see L3PolicyMap.IsPortRestricted(). */
 
 struct cidr6_entry {
 	union v6addr net, mask;
+	__u32 flags;
 };
 
 #ifdef CIDR6_INGRESS_MAPPINGS
@@ -194,14 +214,18 @@ static __always_inline int lpm6_ingress_lookup(union v6addr *addr)
 {
 	struct cidr6_entry map[] = { CIDR6_INGRESS_MAPPINGS };
 	const int size = (sizeof(map) / sizeof(map[0]));
-	int i;
+	int i, ret = LPM_NO_MATCH;
 
 #pragma unroll
-	for (i = 0; i < size; i++)
-		if (ipv6_addr_in_net(addr, &map[i].net, &map[i].mask))
-			return 1;
+	for (i = 0; i < size; i++) {
+		if (ipv6_addr_in_net(addr, &map[i].net, &map[i].mask)) {
+			if (!(map[i].flags & LPM_FLAG_PORT_RESTRICTED))
+				return LPM_MATCH;
+			ret = LPM_MATCH_PORT_RESTRICTED;
+		}
+	}
 
-	return 0;
+	return ret;
 }
 #else
 #define lpm6_ingress_lookup(ADDR) 0
@@ -227,6 +251,7 @@ static __always_inline int lpm6_egress_lookup(union v6addr *addr)
 
 struct cidr4_entry {
 	__be32 net, mask;
+	__u32 flags;
 };
 
 #ifdef CIDR4_INGRESS_MAPPINGS
@@ -234,14 +259,18 @@ static __always_inline int lpm4_ingress_lookup(__be32 addr)
 {
 	struct cidr4_entry map[] = { CIDR4_INGRESS_MAPPINGS };
 	const int size = (sizeof(map) / sizeof(map[0]));
-	int i;
+	int i, ret = LPM_NO_MATCH;
 
 #pragma unroll
-	for (i = 0; i < size; i++)
-		if ((addr & map[i].mask) == map[i].net)
-			return 1;
+	for (i = 0; i < size; i++) {
+		if ((addr & map[i].mask) == map[i].net) {
+			if (!(map[i].flags & LPM_FLAG_PORT_RESTRICTED))
+				return LPM_MATCH;
+			ret = LPM_MATCH_PORT_RESTRICTED;
+		}
+	}
 
-	return 0;
+	return ret;
 }
 #else
 #define lpm4_ingress_lookup(ADDR) 0
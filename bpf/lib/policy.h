@@ -20,16 +20,48 @@
 
 #include "drop.h"
 #include "maps.h"
+#include "policy_log.h"
+
+static inline void policy_set_match(__u8 *match_type, __u8 type)
+{
+	if (match_type)
+		*match_type = type;
+}
+
+/* Identity of policy map entries allowing a port for all identities, must be
+ * kept in sync with AllIdentities in pkg/maps/policymap/policymap.go */
+#define POLICY_ALL_IDENTITIES 0
+
+/* Identity of policy map entries allowing a port for sources in port
+ * restricted CIDR prefixes, must be kept in sync with CIDRIdentities in
+ * pkg/maps/policymap/policymap.go */
+#define POLICY_CIDR_IDENTITIES 0xffffffff
 
 #ifdef POLICY_ENFORCEMENT
 
-static inline int policy_can_access(void *map, struct __sk_buff *skb, __u32 src_label,
-				    __u16 dport, __u8 proto, size_t cidr_addr_size, void *cidr_addr)
+/**
+ * __policy_can_access
+ * @match_type:	if not NULL, set to the policy entry which matched (POLICY_MATCH_*)
+ *
+ * The policy map is looked up for an entry allowing the port for the source
+ * identity, then for an entry allowing the port for all identities and
+ * finally for an entry allowing the source identity on all ports. Sources in
+ * CIDR prefixes of rules with ports are only allowed on the ports the policy
+ * map allows for POLICY_CIDR_IDENTITIES.
+ *
+ * Returns TC_ACT_OK if the packet is allowed by policy, DROP_POLICY otherwise.
+ */
+static inline int __policy_can_access(void *map, struct __sk_buff *skb, __u32 src_label,
+				      __u16 dport, __u8 proto, size_t cidr_addr_size,
+				      void *cidr_addr, __u8 *match_type)
 {
+	policy_set_match(match_type, POLICY_MATCH_NONE);
+
 #ifdef DROP_ALL
 	return DROP_POLICY;
 #else
 	struct policy_entry *policy;
+	int cidr_match = LPM_NO_MATCH;
 
 	struct policy_key key = {
 		.sec_label = src_label,
@@ -47,8 +79,22 @@ static inline int policy_can_access(void *map, struct __sk_buff *skb, __u32 src_
 		/* FIXME: Use per cpu counters */
 		__sync_fetch_and_add(&policy->packets, 1);
 		__sync_fetch_and_add(&policy->bytes, skb->len);
+		policy_set_match(match_type, POLICY_MATCH_L3_L4);
+		return TC_ACT_OK;
+	}
+
+	/* If the port is not allowed for the source identity, check
+	 * whether it is allowed for all identities. */
+	key.sec_label = POLICY_ALL_IDENTITIES;
+	policy = map_lookup_elem(map, &key);
+	if (policy) {
+		/* FIXME: Use per cpu counters */
+		__sync_fetch_and_add(&policy->packets, 1);
+		__sync_fetch_and_add(&policy->bytes, skb->len);
+		policy_set_match(match_type, POLICY_MATCH_L4_ONLY);
 		return TC_ACT_OK;
 	}
+	key.sec_label = src_label;
 #endif /* HAVE_L4_POLICY */
 
 	/* If L4 policy check misses, fall back to L3. */
@@ -59,29 +105,61 @@ static inline int policy_can_access(void *map, struct __sk_buff *skb, __u32 src_
 		/* FIXME: Use per cpu counters */
 		__sync_fetch_and_add(&policy->packets, 1);
 		__sync_fetch_and_add(&policy->bytes, skb->len);
+		policy_set_match(match_type, POLICY_MATCH_L3_ONLY);
 		return TC_ACT_OK;
 	}
 
 	// cidr_addr_size is a compile time constant so this should all be inlined neatly.
-	if (cidr_addr_size == sizeof(union v6addr) && lpm6_ingress_lookup(cidr_addr))
-		goto allow;
-	if (cidr_addr_size == sizeof(__be32) && lpm4_ingress_lookup(*(__be32 *)cidr_addr))
-		goto allow;
+	if (cidr_addr_size == sizeof(union v6addr))
+		cidr_match = lpm6_ingress_lookup(cidr_addr);
+	else if (cidr_addr_size == sizeof(__be32))
+		cidr_match = lpm4_ingress_lookup(*(__be32 *)cidr_addr);
+
+	if (cidr_match == LPM_MATCH)
+		goto allow_cidr;
 
-	if (skb->cb[CB_POLICY])
+#ifdef HAVE_L4_POLICY
+	if (cidr_match == LPM_MATCH_PORT_RESTRICTED) {
+		key.sec_label = POLICY_CIDR_IDENTITIES;
+		key.dport = dport;
+		key.protocol = proto;
+		policy = map_lookup_elem(map, &key);
+		if (policy) {
+			/* FIXME: Use per cpu counters */
+			__sync_fetch_and_add(&policy->packets, 1);
+			__sync_fetch_and_add(&policy->bytes, skb->len);
+			goto allow_cidr;
+		}
+	}
+#endif /* HAVE_L4_POLICY */
+
+	if (skb->cb[CB_POLICY]) {
+		policy_set_match(match_type, POLICY_MATCH_ALL);
 		goto allow;
+	}
 
 	cilium_dbg(skb, DBG_POLICY_DENIED, src_label, SECLABEL);
 
 #ifndef IGNORE_DROP
 	return DROP_POLICY;
+#else
+	goto allow;
 #endif
 
+allow_cidr:
+	policy_set_match(match_type, POLICY_MATCH_CIDR);
 allow:
 	return TC_ACT_OK;
 #endif /* DROP_ALL */
 }
 
+static inline int policy_can_access(void *map, struct __sk_buff *skb, __u32 src_label,
+				    __u16 dport, __u8 proto, size_t cidr_addr_size, void *cidr_addr)
+{
+	return __policy_can_access(map, skb, src_label, dport, proto,
+				   cidr_addr_size, cidr_addr, NULL);
+}
+
 /**
  * Mark skb to skip policy enforcement
  * @arg skb	packet
@@ -106,6 +184,14 @@ static inline int is_policy_skip(struct __sk_buff *skb)
 
 #else /* POLICY_ENFORCEMENT */
 
+static inline int __policy_can_access(void *map, struct __sk_buff *skb, __u32 src_label,
+				      __u16 dport, __u8 proto, size_t cidr_addr_size,
+				      void *cidr_addr, __u8 *match_type)
+{
+	policy_set_match(match_type, POLICY_MATCH_ALL);
+	return TC_ACT_OK;
+}
+
 static inline int policy_can_access(void *map, struct __sk_buff *skb, __u32 src_label,
 				    __u16 dport, __u8 proto, size_t cidr_addr_size,
 				    void *cidr_addr)
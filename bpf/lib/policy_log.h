@@ -0,0 +1,121 @@
+/*
+ *  Copyright (C) 2016-2017 Authors of Cilium
+ *
+ *  This program is free software; you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation; either version 2 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program; if not, write to the Free Software
+ *  Foundation, Inc., 51 Franklin St, Fifth Floor, Boston, MA  02110-1301  USA
+ */
+/*
+ * Policy verdict notification via perf event ring buffer.
+ *
+ * API:
+ * void send_policy_verdict_notify(skb, src, dst, dport, proto, dir, verdict, match_type)
+ *
+ * If POLICY_VERDICT_NOTIFY is not defined, the API will be compiled in as a NOP.
+ */
+
+#ifndef __LIB_POLICY_LOG__
+#define __LIB_POLICY_LOG__
+
+#include "events.h"
+#include "common.h"
+#include "utils.h"
+
+/* Policy map entry which matched the packet, must be kept in sync with
+ * pkg/bpfdebug/policy_verdict.go */
+enum {
+	POLICY_MATCH_NONE,
+	POLICY_MATCH_L3_ONLY,
+	POLICY_MATCH_L3_L4,
+	POLICY_MATCH_CIDR,
+	POLICY_MATCH_ALL,
+	POLICY_MATCH_L4_ONLY,
+};
+
+/* Policy verdict flags, the direction is passed to
+ * send_policy_verdict_notify() as either POLICY_INGRESS or POLICY_EGRESS. */
+#define POLICY_INGRESS		(1 << 0)
+#define POLICY_EGRESS		(1 << 1)
+#define POLICY_VERDICT_F_AUDIT	(1 << 2)
+
+#ifdef POLICY_AUDIT_MODE
+# define POLICY_VERDICT_AUDIT	POLICY_VERDICT_F_AUDIT
+#else
+# define POLICY_VERDICT_AUDIT	0
+#endif
+
+#ifdef POLICY_VERDICT_NOTIFY
+
+struct policy_verdict_notify {
+	NOTIFY_COMMON_HDR
+	__u32		len_orig;
+	__u32		len_cap;
+	__u32		src_label;
+	__u32		dst_label;
+	__s32		verdict;
+	__u16		dst_port;
+	__u8		proto;
+	__u8		flags;
+};
+
+/**
+ * send_policy_verdict_notify
+ * @skb:	socket buffer
+ * @src:	source identity
+ * @dst:	destination identity
+ * @dport:	destination port in network byte order
+ * @proto:	L4 protocol
+ * @dir:	direction of the connection (POLICY_INGRESS or POLICY_EGRESS)
+ * @verdict:	TC_ACT_OK if the connection is allowed, a DROP_* error otherwise
+ * @match_type:	policy map entry which matched the packet (POLICY_MATCH_*)
+ *
+ * Generate a notification to indicate the policy verdict for the first packet
+ * of a connection.
+ */
+static inline void send_policy_verdict_notify(struct __sk_buff *skb, __u32 src, __u32 dst,
+					      __u16 dport, __u8 proto, __u8 dir,
+					      int verdict, __u8 match_type)
+{
+	uint64_t skb_len = (uint64_t)skb->len, cap_len = min((uint64_t)TRACE_PAYLOAD_LEN, (uint64_t)skb_len);
+	uint32_t hash = get_hash_recalc(skb);
+	struct policy_verdict_notify msg = {
+		.type = CILIUM_NOTIFY_POLICY_VERDICT,
+		.subtype = match_type,
+		.source = EVENT_SOURCE,
+		.hash = hash,
+		.len_orig = skb_len,
+		.len_cap = cap_len,
+		.src_label = src,
+		.dst_label = dst,
+		.verdict = verdict,
+		.dst_port = dport,
+		.proto = proto,
+		.flags = dir | POLICY_VERDICT_AUDIT,
+	};
+
+	skb_event_output(skb, &cilium_events,
+			 (cap_len << 32) | BPF_F_CURRENT_CPU,
+			 &msg, sizeof(msg));
+}
+
+#else
+
+static inline void send_policy_verdict_notify(struct __sk_buff *skb, __u32 src, __u32 dst,
+					      __u16 dport, __u8 proto, __u8 dir,
+					      int verdict, __u8 match_type)
+{
+}
+
+#endif
+
+#endif /* __LIB_POLICY_LOG__ */
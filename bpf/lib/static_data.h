@@ -0,0 +1,60 @@
+/*
+ *  Copyright (C) 2018 Authors of Cilium
+ *
+ *  This program is free software; you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation; either version 2 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program; if not, write to the Free Software
+ *  Foundation, Inc., 51 Franklin St, Fifth Floor, Boston, MA  02110-1301  USA
+ */
+#ifndef __LIB_STATIC_DATA_H_
+#define __LIB_STATIC_DATA_H_
+
+#include <bpf/api.h>
+
+/* Static data is configuration which differs between otherwise identical
+ * programs, e.g. the endpoint ID or addresses. Instead of being compiled in,
+ * it is loaded from a 64 bit immediate of an undefined symbol named after the
+ * data. The agent writes the value into the immediate when instantiating
+ * the program from a template and removes the relocation, see pkg/elf.
+ *
+ * The configuration refers to static data by defining the name to fetch
+ * itself, e.g.:
+ *
+ *   #define LXC_ID fetch_u16(LXC_ID)
+ */
+#define __fetch(x)							\
+	({								\
+		__u64 __tmp;						\
+		asm volatile("%0 = " __stringify(x) " ll" : "=r"(__tmp)); \
+		__tmp;							\
+	})
+
+#define fetch_u8(x)		((__u8) __fetch(x))
+#define fetch_u16(x)		((__u16) __fetch(x))
+#define fetch_u32(x)		((__u32) __fetch(x))
+
+#define fetch_u8_i(x, i)	fetch_u8(x ## _ ## i)
+#define fetch_u16_i(x, i)	fetch_u16(x ## _ ## i)
+#define fetch_u32_i(x, i)	fetch_u32(x ## _ ## i)
+
+/* Initializer of union v6addr, the address is stored as four 32 bit words
+ * x_1 to x_4 in network byte order. */
+#define fetch_ipv6(x)							\
+	{ { fetch_u32_i(x, 1), fetch_u32_i(x, 2),			\
+	    fetch_u32_i(x, 3), fetch_u32_i(x, 4) } }
+
+/* Initializer of union macaddr, the address is stored as a 32 bit word x_1
+ * and a 16 bit word x_2 in the layout of the union. */
+#define fetch_mac(x)							\
+	{ { fetch_u32_i(x, 1), fetch_u16_i(x, 2) } }
+
+#endif /* __LIB_STATIC_DATA_H_ */
@@ -0,0 +1,93 @@
+/*
+ *  Copyright (C) 2018 Authors of Cilium
+ *
+ *  This program is free software; you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation; either version 2 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program; if not, write to the Free Software
+ *  Foundation, Inc., 51 Franklin St, Fifth Floor, Boston, MA  02110-1301  USA
+ */
+#ifndef __LIB_THROTTLE_H_
+#define __LIB_THROTTLE_H_
+
+#include "common.h"
+#include "utils.h"
+
+/* Must be in sync with the directions in pkg/maps/throttlemap */
+#define THROTTLE_INGRESS	1
+#define THROTTLE_EGRESS		2
+
+#ifndef THROTTLE_MAP_SIZE
+#define THROTTLE_MAP_SIZE	65536
+#endif
+
+/* Token buckets limiting the bandwidth of endpoints, indexed by endpoint ID
+ * and direction. Endpoints without entry are not limited. */
+struct bpf_elf_map __section_maps cilium_throttle = {
+	.type		= BPF_MAP_TYPE_HASH,
+	.size_key	= sizeof(struct throttle_key),
+	.size_value	= sizeof(struct throttle_info),
+	.pinning	= PIN_GLOBAL_NS,
+	.max_elem	= THROTTLE_MAP_SIZE,
+};
+
+/**
+ * Consume tokens for the packet from the token bucket of the endpoint
+ * @arg skb:	packet
+ * @arg lxc_id:	endpoint ID
+ * @arg dir:	THROTTLE_INGRESS or THROTTLE_EGRESS
+ *
+ * The bucket is refilled with the configured rate since its last update and
+ * is capped at its burst size. The bucket is updated without synchronization
+ * so concurrent packets on multiple CPUs may exceed the rate slightly.
+ *
+ * Returns 0 if the packet may pass or DROP_THROTTLED if the bucket does not
+ * hold enough tokens.
+ */
+static __always_inline int throttle(struct __sk_buff *skb, __u16 lxc_id, __u8 dir)
+{
+	struct throttle_key key = {
+		.lxc_id = lxc_id,
+		.direction = dir,
+	};
+	struct throttle_info *info;
+	__u64 now, delta, tokens, len = skb->len;
+
+	info = map_lookup_elem(&cilium_throttle, &key);
+	if (!info)
+		return 0;
+
+	now = bpf_ktime_get_nsec();
+	delta = now - info->last;
+
+	/* The bucket is full after a second at most, also avoids overflowing
+	 * the multiplication below. */
+	if (delta >= NSEC_PER_SEC) {
+		tokens = info->burst;
+	} else {
+		tokens = info->tokens + delta * info->rate / NSEC_PER_SEC;
+		if (tokens > info->burst)
+			tokens = info->burst;
+	}
+
+	if (tokens < len) {
+		info->tokens = tokens;
+		info->last = now;
+		return DROP_THROTTLED;
+	}
+
+	info->tokens = tokens - len;
+	info->last = now;
+
+	return 0;
+}
+
+#endif /* __LIB_THROTTLE_H_ */
@@ -17,35 +17,37 @@
  */
 /*
  * This is just a dummy header with dummy values to allow for test
- * compilation without the full code generation engine backend.
+ * compilation without the full code generation engine backend. Endpoint
+ * specific values are static data, see lib/static_data.h.
  */
 
-#define LXC_MAC { .addr = { 0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff } }
-#define LXC_IP 0xbe, 0xef, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0x1, 0x1, 0x65, 0x82, 0xbc
-#define LXC_IPV4 0x10203040
-#define LXC_ID 0x1010
-#define LXC_ID_NB 0x1010
+#define TEMPLATE_LXC_ID 65535
+#define LXC_MAC fetch_mac(LXC_MAC)
+#define LXC_IP fetch_ipv6(LXC_IP)
+#define LXC_IPV4 fetch_u32(LXC_IPV4)
+#define LXC_ID fetch_u16(LXC_ID)
+#define LXC_ID_NB fetch_u16(LXC_ID_NB)
 #define LXC_NAT46
 #ifndef SECLABEL
-#define SECLABEL 0xfffff
-#define SECLABEL_NB 0xfffff
+#define SECLABEL fetch_u32(SECLABEL)
+#define SECLABEL_NB fetch_u32(SECLABEL_NB)
 #endif
-#define POLICY_MAP cilium_policy_foo
-#define NODE_MAC { .addr = { 0xde, 0xad, 0xbe, 0xef, 0xc0, 0xde } }
-#define GENEVE_OPTS { 0xff, 0xff, 0x1, 0x1, 0x0, 0x0, 0x1, 0x1e }
+#define POLICY_MAP cilium_policy_65535
+#define NODE_MAC fetch_mac(NODE_MAC)
+#define GENEVE_OPTS { fetch_u8_i(GENEVE_OPTS, 0), fetch_u8_i(GENEVE_OPTS, 1), fetch_u8_i(GENEVE_OPTS, 2), fetch_u8_i(GENEVE_OPTS, 3), fetch_u8_i(GENEVE_OPTS, 4), fetch_u8_i(GENEVE_OPTS, 5), fetch_u8_i(GENEVE_OPTS, 6), fetch_u8_i(GENEVE_OPTS, 7) }
 #define DROP_NOTIFY
 #define TRACE_NOTIFY
-#define CT_MAP6 cilium_ct6_111
-#define CT_MAP4 cilium_ct4_111
+#define CT_MAP6 cilium_ct6_65535
+#define CT_MAP4 cilium_ct4_65535
 #define CT_MAP_SIZE 4096
-#define CALLS_MAP cilium_calls_111
+#define CALLS_MAP cilium_calls_65535
 #define LB_L3
 #define LB_L4
 #define CONNTRACK
 #define NR_CFG_L4_INGRESS 2
-#define CFG_L4_INGRESS 0, 80, 8080, 0, 1, 80, 8080, 0, (), 0
+#define CFG_L4_INGRESS 0, 80, 0, 8080, 0, 1, 8000, 8100, 0, 0, (), 0
 #define NR_CFG_L4_EGRESS 1
-#define CFG_L4_EGRESS 0, 80, 8080, 0, (), 0
+#define CFG_L4_EGRESS 0, 80, 0, 8080, 0, (), 0
 #define POLICY_ENFORCEMENT
 #define ENABLE_IPv4
 #define ALLOW_TO_WORLD
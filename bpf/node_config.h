@@ -50,3 +50,4 @@
 #define LB_RR_MAX_SEQ 31
 #define TUNNEL_ENDPOINT_MAP_SIZE 65536
 #define ENDPOINTS_MAP_SIZE 65536
+#define THROTTLE_MAP_SIZE 65536
@@ -25,6 +25,7 @@ import (
 	"github.com/cilium/cilium/pkg/maps/policymap"
 	"github.com/cilium/cilium/pkg/policy"
 	"github.com/cilium/cilium/pkg/policy/api"
+	"github.com/cilium/cilium/pkg/u8proto"
 
 	"github.com/spf13/cobra"
 )
@@ -77,13 +78,15 @@ func listMap(cmd *cobra.Command, args []string) {
 	const (
 		labelsIDTitle  = "IDENTITY"
 		labelsDesTitle = "LABELS (source:key[=value])"
+		portTitle      = "PORT/PROTO"
 		actionTitle    = "ACTION"
 		bytesTitle     = "BYTES"
 		packetsTitle   = "PACKETS"
 	)
 
 	for _, stat := range statsMap {
-		if !printIDs {
+		if !printIDs && stat.Key.Identity != policymap.AllIdentities &&
+			stat.Key.Identity != policymap.CIDRIdentities {
 			id := policy.NumericIdentity(stat.Key.Identity)
 			if lbls, err := client.IdentityGet(id.StringID()); err != nil {
 				fmt.Fprintf(os.Stderr, "Was impossible to retrieve label ID %d: %s\n",
@@ -96,27 +99,32 @@ func listMap(cmd *cobra.Command, args []string) {
 	}
 
 	if printIDs {
-		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t\n", labelsIDTitle, actionTitle, bytesTitle, packetsTitle)
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t\n", labelsIDTitle, portTitle, actionTitle, bytesTitle, packetsTitle)
 	} else {
-		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t\n", labelsDesTitle, actionTitle, bytesTitle, packetsTitle)
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t\n", labelsDesTitle, portTitle, actionTitle, bytesTitle, packetsTitle)
 	}
 	for _, stat := range statsMap {
 		id := policy.NumericIdentity(stat.Key.Identity)
 		act := api.Decision(stat.Action)
-		if printIDs {
-			fmt.Fprintf(w, "%d\t%s\t%d\t%d\t\n", id, act.String(), stat.Bytes, stat.Packets)
+		port := formatPolicyPort(stat.Key.GetDestPort(), u8proto.U8proto(stat.Key.Nexthdr))
+		if stat.Key.Identity == policymap.AllIdentities {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%d\t\n", "all", port, act.String(), stat.Bytes, stat.Packets)
+		} else if stat.Key.Identity == policymap.CIDRIdentities {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%d\t\n", "cidr", port, act.String(), stat.Bytes, stat.Packets)
+		} else if printIDs {
+			fmt.Fprintf(w, "%d\t%s\t%s\t%d\t%d\t\n", id, port, act.String(), stat.Bytes, stat.Packets)
 		} else if lbls := labelsID[id]; lbls != nil {
 			first := true
 			for _, lbl := range lbls.Labels {
 				if first {
-					fmt.Fprintf(w, "%s\t%s\t%d\t%d\t\n", lbl, act.String(), stat.Bytes, stat.Packets)
+					fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%d\t\n", lbl, port, act.String(), stat.Bytes, stat.Packets)
 					first = false
 				} else {
 					fmt.Fprintf(w, "%s\t\t\t\t\t\n", lbl)
 				}
 			}
 		} else {
-			fmt.Fprintf(w, "%d\t%s\t%d\t%d\t\n", id, act.String(), stat.Bytes, stat.Packets)
+			fmt.Fprintf(w, "%d\t%s\t%s\t%d\t%d\t\n", id, port, act.String(), stat.Bytes, stat.Packets)
 		}
 	}
 	w.Flush()
@@ -124,3 +132,12 @@ func listMap(cmd *cobra.Command, args []string) {
 		fmt.Printf("Policy stats empty. Perhaps the policy enforcement is disabled?\n")
 	}
 }
+
+// formatPolicyPort returns the port and protocol of a policy map entry, the
+// entries allowing an identity on all ports have the port 0.
+func formatPolicyPort(port uint16, proto u8proto.U8proto) string {
+	if port == 0 {
+		return "ANY"
+	}
+	return fmt.Sprintf("%d/%s", port, proto.String())
+}
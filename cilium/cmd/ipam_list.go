@@ -0,0 +1,62 @@
+// Copyright 2018 Authors of Cilium
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+)
+
+var ipamListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List IP pools and their usage",
+	Run: func(cmd *cobra.Command, args []string) {
+		listIPAMPools(cmd, args)
+	},
+}
+
+func init() {
+	ipamCmd.AddCommand(ipamListCmd)
+	AddMultipleOutput(ipamListCmd)
+}
+
+func listIPAMPools(cmd *cobra.Command, args []string) {
+	status, err := client.IPAMGet()
+	if err != nil {
+		Fatalf("Cannot get IPAM status: %s", err)
+	}
+
+	if len(dumpOutput) > 0 {
+		if err := OutputPrinter(status); err != nil {
+			os.Exit(1)
+		}
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 5, 0, 3, ' ', 0)
+	fmt.Fprintf(w, "POOL\tIPv4 CIDR\tIPv4 USED\tIPv4 FREE\tIPv6 CIDR\tIPv6 USED\tIPv6 FREE\n")
+	for _, p := range status.Pools {
+		ipv6Used, ipv6Free := "", ""
+		if p.IPV6Cidr != "" {
+			ipv6Used, ipv6Free = fmt.Sprintf("%d", p.IPV6Used), fmt.Sprintf("%d", p.IPV6Free)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%s\t%s\t%s\n", p.Name,
+			p.IPV4Cidr, p.IPV4Used, p.IPV4Free, p.IPV6Cidr, ipv6Used, ipv6Free)
+	}
+	w.Flush()
+}
@@ -46,6 +46,7 @@ var monitorCmd = &cobra.Command{
 programs attached to endpoints and devices. This includes:
   * Dropped packet notifications
   * Captured packet traces
+  * Policy verdict notifications
   * Debugging information`,
 	Run: func(cmd *cobra.Command, args []string) {
 		runMonitor()
@@ -93,10 +94,11 @@ var (
 	eventTypeIdx = bpfdebug.MessageTypeUnspec // for integer comparison
 	eventType    = ""
 	eventTypes   = map[string]int{
-		"drop":    bpfdebug.MessageTypeDrop,
-		"debug":   bpfdebug.MessageTypeDebug,
-		"capture": bpfdebug.MessageTypeCapture,
-		"trace":   bpfdebug.MessageTypeTrace,
+		"drop":           bpfdebug.MessageTypeDrop,
+		"debug":          bpfdebug.MessageTypeDebug,
+		"capture":        bpfdebug.MessageTypeCapture,
+		"trace":          bpfdebug.MessageTypeTrace,
+		"policy-verdict": bpfdebug.MessageTypePolicyVerdict,
 	}
 	fromSource     = uint16(0)
 	toDst          = uint16(0)
@@ -169,6 +171,31 @@ func traceEvents(prefix string, data []byte) {
 	}
 }
 
+// policyVerdictEvents prints out all the received policy verdict notifications.
+func policyVerdictEvents(prefix string, data []byte) {
+	pn := bpfdebug.PolicyVerdictNotify{}
+
+	if err := binary.Read(bytes.NewReader(data), byteorder.Native, &pn); err != nil {
+		fmt.Printf("Error while parsing policy verdict notification message: %s\n", err)
+	}
+
+	// The source of the notification is the endpoint enforcing the policy,
+	// which is the destination of ingress connections.
+	src, dst := pn.Source, uint16(0)
+	if pn.IsIngress() {
+		src, dst = 0, pn.Source
+	}
+
+	if match(bpfdebug.MessageTypePolicyVerdict, src, dst) {
+		if verbosity == INFO {
+			pn.DumpInfo(data)
+		} else {
+			fmt.Println(msgSeparator)
+			pn.DumpVerbose(!hex, data, prefix)
+		}
+	}
+}
+
 // debugEvents prints out all the debug messages.
 func debugEvents(prefix string, data []byte) {
 	dm := bpfdebug.DebugMsg{}
@@ -216,6 +243,8 @@ func receiveEvent(data []byte, cpu int) {
 		captureEvents(prefix, data)
 	case bpfdebug.MessageTypeTrace:
 		traceEvents(prefix, data)
+	case bpfdebug.MessageTypePolicyVerdict:
+		policyVerdictEvents(prefix, data)
 	default:
 		fmt.Printf("%s Unknown event: %+v\n", prefix, data)
 	}
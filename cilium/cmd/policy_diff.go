@@ -0,0 +1,95 @@
+// Copyright 2017 Authors of Cilium
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+)
+
+// policyDiffCmd represents the policy_diff command
+var policyDiffCmd = &cobra.Command{
+	Use:   "diff <path>",
+	Short: "Show access changes caused by importing security policy",
+	Long: `Computes which pairs of security identities known to the agent gain or lose
+access if the policy rules in <path> were imported. The policy repository is
+not modified. ANY denotes access on all ports.`,
+	Example: `  cilium policy diff ~/app.policy
+  cilium policy diff ./policies/app/`,
+	PreRun: requirePath,
+	Run: func(cmd *cobra.Command, args []string) {
+		path := args[0]
+		ruleList, err := loadPolicy(path)
+		if err != nil {
+			Fatalf("Cannot parse policy %s: %s\n", path, err)
+		}
+
+		for _, r := range ruleList {
+			if err := r.Sanitize(); err != nil {
+				Fatalf("%s", err)
+			}
+		}
+
+		jsonPolicy, err := json.MarshalIndent(ruleList, "", "  ")
+		if err != nil {
+			Fatalf("Cannot marshal policy: %s\n", err)
+		}
+
+		diff, err := client.PolicyDiffGet(string(jsonPolicy))
+		if err != nil {
+			Fatalf("Cannot compute policy diff: %s\n", err)
+		}
+
+		if len(dumpOutput) > 0 {
+			if err := OutputPrinter(diff); err != nil {
+				os.Exit(1)
+			}
+			return
+		}
+
+		if len(diff.Changes) == 0 {
+			fmt.Println("No access changes")
+			return
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 5, 0, 3, ' ', 0)
+		fmt.Fprintln(w, "FROM\tTO\tENDPOINTS\tDIRECTION\tGAINED\tLOST\t")
+		for _, c := range diff.Changes {
+			direction := "Ingress"
+			if c.Egress {
+				direction = "Egress"
+			}
+			endpoints := make([]string, 0, len(c.ToEndpoints))
+			for _, ep := range c.ToEndpoints {
+				endpoints = append(endpoints, fmt.Sprintf("%d", ep))
+			}
+			fmt.Fprintf(w, "%d\t%d\t%s\t%s\t%s\t%s\t\n", c.From, c.To,
+				strings.Join(endpoints, ","), direction,
+				strings.Join(c.Gained, ","),
+				strings.Join(c.Lost, ","))
+		}
+		w.Flush()
+	},
+}
+
+func init() {
+	policyCmd.AddCommand(policyDiffCmd)
+	AddMultipleOutput(policyDiffCmd)
+}
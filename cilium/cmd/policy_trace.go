@@ -25,6 +25,7 @@ import (
 	"github.com/cilium/cilium/pkg/endpoint"
 	"github.com/cilium/cilium/pkg/k8s"
 	"github.com/cilium/cilium/pkg/policy"
+	"github.com/cilium/cilium/pkg/policy/api"
 	"github.com/cilium/cilium/pkg/policy/trace"
 
 	"github.com/spf13/cobra"
@@ -41,15 +42,22 @@ var src, dst, dports []string
 var srcIdentity, dstIdentity int64
 var srcEndpoint, dstEndpoint, srcK8sPod, dstK8sPod, srcK8sYaml, dstK8sYaml string
 var verbose bool
+var httpMethod, httpPath, httpHost string
+var httpHeaders []string
+var kafkaAPIKey, kafkaClientID, kafkaTopic string
+var kafkaAPIVersion int64
 
 // policyTraceCmd represents the policy_trace command
 var policyTraceCmd = &cobra.Command{
-	Use:   "trace ( -s <label context> | --src-identity <security identity> | --src-endpoint <endpoint ID> | --src-k8s-pod <namespace:pod-name> | --src-k8s-yaml <path to YAML file> ) ( -d <label context> | --dst-identity <security identity> | --dst-endpoint <endpoint ID> | --dst-k8s-pod <namespace:pod-name> | --dst-k8s-yaml <path to YAML file>) [--dport <port>[/<protocol>]",
+	Use:   "trace ( -s <label context> | --src-identity <security identity> | --src-endpoint <endpoint ID> | --src-k8s-pod <namespace:pod-name> | --src-k8s-yaml <path to YAML file> ) ( -d <label context> | --dst-identity <security identity> | --dst-endpoint <endpoint ID> | --dst-k8s-pod <namespace:pod-name> | --dst-k8s-yaml <path to YAML file>) [--dport <port|name>[/<protocol>]",
 	Short: "Trace a policy decision",
 	Long: `Verifies if the source is allowed to consume
 destination. Source / destination can be provided as endpoint ID, security ID, Kubernetes Pod, YAML file, set of LABELs. LABEL is represented as
 SOURCE:KEY[=VALUE].
-dports can be can be for example: 80/tcp, 53 or 23/udp.
+dports can be can be for example: 80/tcp, 53, 23/udp or, for named ports
+of the destination, http/tcp.
+An HTTP or Kafka request can be provided to evaluate it against the L7 rules
+of the destination ports.
 If multiple sources and / or destinations are provided, each source is tested whether there is a policy allowing traffic between it and each destination`,
 	Run: func(cmd *cobra.Command, args []string) {
 
@@ -93,6 +101,31 @@ If multiple sources and / or destinations are provided, each source is tested wh
 			}
 		}
 
+		var httpReq *models.TraceHTTPRequest
+		var kafkaReq *models.TraceKafkaRequest
+		if httpMethod != "" || httpPath != "" || httpHost != "" || len(httpHeaders) > 0 {
+			httpReq = &models.TraceHTTPRequest{
+				Method:  httpMethod,
+				Path:    httpPath,
+				Host:    httpHost,
+				Headers: httpHeaders,
+			}
+		}
+		if kafkaAPIKey != "" || kafkaClientID != "" || kafkaTopic != "" {
+			if httpReq != nil {
+				Usagef(cmd, "HTTP and Kafka requests are mutually exclusive")
+			}
+			if _, ok := api.KafkaAPIKeyMap[strings.ToLower(kafkaAPIKey)]; !ok {
+				Fatalf("Invalid Kafka API key: %q", kafkaAPIKey)
+			}
+			kafkaReq = &models.TraceKafkaRequest{
+				APIKey:     kafkaAPIKey,
+				APIVersion: kafkaAPIVersion,
+				ClientID:   kafkaClientID,
+				Topic:      kafkaTopic,
+			}
+		}
+
 		// Parse security identities.
 		if srcIdentity != defaultSecurityID {
 			srcSlice = appendIdentityLabelsToSlice(srcSlice, policy.NumericIdentity(srcIdentity).StringID())
@@ -162,6 +195,8 @@ If multiple sources and / or destinations are provided, each source is tested wh
 					To:      w,
 					Dports:  dPorts,
 					Verbose: verbose,
+					HTTP:    httpReq,
+					Kafka:   kafkaReq,
 				}
 
 				params := NewGetPolicyResolveParams().WithIdentityContext(&search)
@@ -170,7 +205,11 @@ If multiple sources and / or destinations are provided, each source is tested wh
 				} else if scr != nil && scr.Payload != nil {
 					fmt.Println("----------------------------------------------------------------")
 					fmt.Printf("%s\n", scr.Payload.Log)
+					printTraceAttribution(scr.Payload)
 					fmt.Printf("Final verdict: %s\n", strings.ToUpper(scr.Payload.Verdict))
+					if scr.Payload.L7Verdict != "" {
+						fmt.Printf("L7 verdict: %s\n", strings.ToUpper(scr.Payload.L7Verdict))
+					}
 				}
 			}
 		}
@@ -191,6 +230,38 @@ func init() {
 	policyTraceCmd.Flags().StringVarP(&dstK8sPod, "dst-k8s-pod", "", "", "Destination k8s pod ([namespace:]podname)")
 	policyTraceCmd.Flags().StringVarP(&srcK8sYaml, "src-k8s-yaml", "", "", "Path to YAML file for source")
 	policyTraceCmd.Flags().StringVarP(&dstK8sYaml, "dst-k8s-yaml", "", "", "Path to YAML file for destination")
+	policyTraceCmd.Flags().StringVarP(&httpMethod, "http-method", "", "", "Method of HTTP request to evaluate")
+	policyTraceCmd.Flags().StringVarP(&httpPath, "http-path", "", "", "Path of HTTP request to evaluate")
+	policyTraceCmd.Flags().StringVarP(&httpHost, "http-host", "", "", "Host header of HTTP request to evaluate")
+	policyTraceCmd.Flags().StringSliceVarP(&httpHeaders, "http-header", "", []string{}, "Header of HTTP request to evaluate (\"Key: value\")")
+	policyTraceCmd.Flags().StringVarP(&kafkaAPIKey, "kafka-api-key", "", "", "API key of Kafka request to evaluate, e.g. produce")
+	policyTraceCmd.Flags().Int64VarP(&kafkaAPIVersion, "kafka-api-version", "", 0, "API version of Kafka request to evaluate")
+	policyTraceCmd.Flags().StringVarP(&kafkaClientID, "kafka-client-id", "", "", "Client ID of Kafka request to evaluate")
+	policyTraceCmd.Flags().StringVarP(&kafkaTopic, "kafka-topic", "", "", "Topic of Kafka request to evaluate")
+}
+
+// printTraceAttribution prints the labels of the rules selecting source or
+// destination and the resulting L4 filters of a trace result.
+func printTraceAttribution(result *models.PolicyTraceResult) {
+	if len(result.MatchedRules) > 0 {
+		fmt.Printf("Matching rules:\n")
+		for _, lbls := range result.MatchedRules {
+			if len(lbls) == 0 {
+				fmt.Printf("  [no labels]\n")
+			} else {
+				fmt.Printf("  %s\n", strings.Join(lbls, ", "))
+			}
+		}
+	}
+
+	if result.L4 != nil {
+		for _, f := range result.L4.Ingress {
+			fmt.Printf("Ingress L4 filter:\n%s\n", f)
+		}
+		for _, f := range result.L4.Egress {
+			fmt.Printf("Egress L4 filter:\n%s\n", f)
+		}
+	}
 }
 
 func appendIdentityLabelsToSlice(labelSlice []string, secID string) []string {
@@ -258,8 +329,9 @@ func getSecIDFromK8s(podName string) (string, error) {
 }
 
 // parseL4PortsSlice parses a given `slice` of strings. Each string should be in
-// the form of `<port>[/<protocol>]`, where the `<port>` in an integer and an
-// `<protocol>` is an optional layer 4 protocol `tcp` or `udp`. In case
+// the form of `<port>[/<protocol>]`, where the `<port>` in an integer or the
+// name of a named port and an `<protocol>` is an optional layer 4 protocol
+// `tcp` or `udp`. In case
 // `protocol` is not present, or is set to `any`, the parsed port will be set to
 // `models.PortProtocolAny`.
 func parseL4PortsSlice(slice []string) ([]*models.Port, error) {
@@ -281,13 +353,15 @@ func parseL4PortsSlice(slice []string) ([]*models.Port, error) {
 			return nil, fmt.Errorf("invalid format %q. Should be <port>[/<protocol>]", v)
 		}
 		portStr := vSplit[0]
-		port, err := strconv.Atoi(portStr)
-		if err != nil {
-			return nil, fmt.Errorf("invalid port %q: %s", portStr, err)
-		}
-		l4 := &models.Port{
-			Port:     uint16(port),
-			Protocol: protoStr,
+		l4 := &models.Port{Protocol: protoStr}
+		if pp := (api.PortProtocol{Port: portStr}); pp.IsNamedPort() {
+			l4.Name = portStr
+		} else {
+			port, err := strconv.ParseUint(portStr, 10, 16)
+			if err != nil {
+				return nil, fmt.Errorf("invalid port %q: %s", portStr, err)
+			}
+			l4.Port = uint16(port)
 		}
 		rules = append(rules, l4)
 	}
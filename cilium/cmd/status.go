@@ -71,7 +71,23 @@ func statusDaemon(cmd *cobra.Command, args []string) {
 			fmt.Fprintf(w, "NodeMonitor:\tDisabled\n")
 		}
 
-		if sr.IPAM != nil {
+		if gc := sr.IdentityGc; gc != nil {
+			fmt.Fprintf(w, "IdentityGC:\t%d identities reclaimed in %d runs (%d in last run)\n",
+				gc.Reclaimed, gc.Runs, gc.LastReclaimed)
+		}
+
+		if sr.IPAM != nil && sr.IPAM.ClusterPool != nil {
+			cp := sr.IPAM.ClusterPool
+			fmt.Fprintf(w, "IPAM:\t%s\n", sr.IPAM.Mode)
+			if cp.IPV4NodeCidr != "" {
+				fmt.Fprintf(w, " IPv4 node CIDR:\t%s (cluster pool %s)\n", cp.IPV4NodeCidr, cp.IPV4ClusterCidr)
+			}
+			if cp.IPV6NodeCidr != "" {
+				fmt.Fprintf(w, " IPv6 node CIDR:\t%s (cluster pool %s)\n", cp.IPV6NodeCidr, cp.IPV6ClusterCidr)
+			}
+		}
+
+		if sr.IPAM != nil && (sr.IPAM.IPV4 != nil || sr.IPAM.IPV6 != nil) {
 			fmt.Fprintf(w, "Allocated IPv4 addresses:\n")
 			for _, ipv4 := range sr.IPAM.IPV4 {
 				fmt.Fprintf(w, " %s\n", ipv4)
@@ -26,6 +26,10 @@ const (
 	LabelsKeyPath = OperationalPath + "/Labels/SHA256SUMLabels"
 	// LabelIDKeyPath is the base path where the IDs are stored in the kvstore.
 	LabelIDKeyPath = OperationalPath + "/Labels/IDs"
+	// LabelRefsKeyPath is the base path where the per node references to identities are stored in the kvstore.
+	LabelRefsKeyPath = OperationalPath + "/Labels/Refs"
+	// LabelGCLockPath is the path locked by the identity garbage collector in the kvstore.
+	LabelGCLockPath = OperationalPath + "/Labels/GC"
 	// MaxSetOfLabels is maximum number of set of labels that can be stored in the kvstore.
 	MaxSetOfLabels = uint32(0xFFFF)
 	// LastFreeServiceIDKeyPath is the path where the Last free UUID is stored in the kvstore.
@@ -40,6 +44,8 @@ const (
 	MaxSetOfServiceID = uint32(0xFFFF)
 	// FirstFreeServiceID is the first ID for which the services should be assigned.
 	FirstFreeServiceID = uint32(1)
+	// NodesKeyPath is the base path where the nodes of the cluster register themselves in the kvstore.
+	NodesKeyPath = OperationalPath + "/Nodes"
 
 	// Miscellaneous dedicated constants
 
@@ -0,0 +1,162 @@
+// Copyright 2018 Authors of Cilium
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"time"
+
+	"github.com/cilium/cilium/pkg/endpointmanager"
+	"github.com/cilium/cilium/pkg/k8s"
+	cilium_v2 "github.com/cilium/cilium/pkg/k8s/apis/cilium.io/v2"
+	"github.com/cilium/cilium/pkg/lock"
+	"github.com/cilium/cilium/pkg/logfields"
+	"github.com/cilium/cilium/pkg/node"
+	"github.com/cilium/cilium/pkg/policy/api"
+
+	log "github.com/sirupsen/logrus"
+	"k8s.io/client-go/tools/cache"
+)
+
+var (
+	// cnpEnforcementInterval is the initial interval in which the
+	// realization of a CiliumNetworkPolicy by the local endpoints is
+	// checked. The interval is doubled after each check.
+	cnpEnforcementInterval = time.Second
+
+	// cnpEnforcementMaxInterval is the maximum interval between two checks
+	// of the realization of a CiliumNetworkPolicy
+	cnpEnforcementMaxInterval = 30 * time.Second
+
+	// cnpEnforcementTimeout is the time after which waiting for the
+	// realization of a CiliumNetworkPolicy is given up
+	cnpEnforcementTimeout = 10 * time.Minute
+
+	errCNPSuperseded         = errors.New("policy superseded or deleted")
+	errCNPEnforcementTimeout = errors.New("timeout while waiting for endpoints to enforce policy")
+
+	// cnpRevisionsMU protects cnpRevisions
+	cnpRevisionsMU lock.Mutex
+
+	// cnpRevisions is the policy revision of the most recent import of
+	// each CiliumNetworkPolicy, indexed by namespace/name
+	cnpRevisions = map[string]uint64{}
+)
+
+// cnpKey returns the key of a CiliumNetworkPolicy in cnpRevisions
+func cnpKey(cnp *cilium_v2.CiliumNetworkPolicy) string {
+	return cnp.ObjectMeta.Namespace + "/" + cnp.ObjectMeta.Name
+}
+
+// setCNPRevision records rev as the most recent policy revision of cnp
+func setCNPRevision(cnp *cilium_v2.CiliumNetworkPolicy, rev uint64) {
+	cnpRevisionsMU.Lock()
+	cnpRevisions[cnpKey(cnp)] = rev
+	cnpRevisionsMU.Unlock()
+}
+
+// forgetCNPRevision stops tracking the enforcement of cnp
+func forgetCNPRevision(cnp *cilium_v2.CiliumNetworkPolicy) {
+	cnpRevisionsMU.Lock()
+	delete(cnpRevisions, cnpKey(cnp))
+	cnpRevisionsMU.Unlock()
+}
+
+// isCurrentCNPRevision returns true if rev is still the most recent policy
+// revision of cnp
+func isCurrentCNPRevision(cnp *cilium_v2.CiliumNetworkPolicy, rev uint64) bool {
+	cnpRevisionsMU.Lock()
+	defer cnpRevisionsMU.Unlock()
+	current, ok := cnpRevisions[cnpKey(cnp)]
+	return ok && current == rev
+}
+
+// waitForCNPRealization calls realized with an exponential backoff until it
+// returns true. Returns errCNPSuperseded if rev is no longer the most recent
+// revision of cnp, e.g. because cnp has been modified or deleted, and
+// errCNPEnforcementTimeout if cnpEnforcementTimeout has passed.
+func waitForCNPRealization(cnp *cilium_v2.CiliumNetworkPolicy, rev uint64, realized func() bool) error {
+	deadline := time.Now().Add(cnpEnforcementTimeout)
+	interval := cnpEnforcementInterval
+
+	for {
+		if !isCurrentCNPRevision(cnp, rev) {
+			return errCNPSuperseded
+		}
+		if realized() {
+			return nil
+		}
+		if !time.Now().Before(deadline) {
+			return errCNPEnforcementTimeout
+		}
+
+		time.Sleep(interval)
+		interval *= 2
+		if interval > cnpEnforcementMaxInterval {
+			interval = cnpEnforcementMaxInterval
+		}
+	}
+}
+
+// waitForCNPEnforcement waits until all local endpoints selected by rules,
+// the rules of cnp imported with policy revision rev, run at least that
+// revision and then reports the policy as enforced in the node status of cnp.
+// Gives up if cnp is modified or deleted in the meantime. If the policy is not
+// enforced within cnpEnforcementTimeout, the timeout is reported as error in
+// the node status of cnp.
+func (d *Daemon) waitForCNPEnforcement(store cache.Store, cnp *cilium_v2.CiliumNetworkPolicy, rules api.Rules, rev uint64) {
+	scopedLog := log.WithFields(log.Fields{
+		logfields.CiliumNetworkPolicyName: cnp.ObjectMeta.Name,
+		logfields.K8sNamespace:            cnp.ObjectMeta.Namespace,
+		"policyRevision":                  rev,
+	})
+
+	var selected int
+	err := waitForCNPRealization(cnp, rev, func() bool {
+		var realized bool
+		selected, realized = endpointmanager.GetPolicyRealization(rules, rev)
+		return realized
+	})
+	switch err {
+	case nil:
+	case errCNPSuperseded:
+		scopedLog.Debug("CiliumNetworkPolicy superseded before being enforced")
+		return
+	default:
+		scopedLog.WithError(err).Warn("CiliumNetworkPolicy not enforced by all selected endpoints")
+		k8s.UpdateCNPStatusV2(ciliumNPClient.CiliumV2(), store,
+			k8s.BackOffLoopTimeout, node.GetName(), cnp,
+			cilium_v2.CiliumNetworkPolicyNodeStatus{
+				OK:                false,
+				Error:             err.Error(),
+				Revision:          rev,
+				SelectedEndpoints: selected,
+				LastUpdated:       cilium_v2.NewTimestamp(),
+			})
+		return
+	}
+
+	scopedLog.WithField("selectedEndpoints", selected).Debug("CiliumNetworkPolicy enforced by all endpoints")
+
+	k8s.UpdateCNPStatusV2(ciliumNPClient.CiliumV2(), store,
+		k8s.BackOffLoopTimeout, node.GetName(), cnp,
+		cilium_v2.CiliumNetworkPolicyNodeStatus{
+			OK:                true,
+			Enforcing:         true,
+			Revision:          rev,
+			SelectedEndpoints: selected,
+			LastUpdated:       cilium_v2.NewTimestamp(),
+		})
+}
@@ -0,0 +1,112 @@
+// Copyright 2018 Authors of Cilium
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"time"
+
+	cilium_v2 "github.com/cilium/cilium/pkg/k8s/apis/cilium.io/v2"
+
+	. "gopkg.in/check.v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+type CNPStatusSuite struct {
+	interval, maxInterval, timeout time.Duration
+}
+
+var _ = Suite(&CNPStatusSuite{})
+
+func (s *CNPStatusSuite) SetUpTest(c *C) {
+	s.interval, s.maxInterval, s.timeout = cnpEnforcementInterval, cnpEnforcementMaxInterval, cnpEnforcementTimeout
+	cnpEnforcementInterval = time.Millisecond
+	cnpEnforcementMaxInterval = 2 * time.Millisecond
+	cnpEnforcementTimeout = time.Minute
+}
+
+func (s *CNPStatusSuite) TearDownTest(c *C) {
+	cnpEnforcementInterval, cnpEnforcementMaxInterval, cnpEnforcementTimeout = s.interval, s.maxInterval, s.timeout
+}
+
+func newTestCNP() *cilium_v2.CiliumNetworkPolicy {
+	return &cilium_v2.CiliumNetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "rule1"},
+	}
+}
+
+func (s *CNPStatusSuite) TestWaitForCNPRealization(c *C) {
+	cnp := newTestCNP()
+	setCNPRevision(cnp, 10)
+	defer forgetCNPRevision(cnp)
+
+	calls := 0
+	err := waitForCNPRealization(cnp, 10, func() bool {
+		calls++
+		return calls == 5
+	})
+	c.Assert(err, IsNil)
+	c.Assert(calls, Equals, 5)
+}
+
+func (s *CNPStatusSuite) TestWaitForCNPRealizationSuperseded(c *C) {
+	cnp := newTestCNP()
+	setCNPRevision(cnp, 10)
+	defer forgetCNPRevision(cnp)
+
+	// Modification of the policy
+	calls := 0
+	err := waitForCNPRealization(cnp, 10, func() bool {
+		calls++
+		setCNPRevision(cnp, 11)
+		return false
+	})
+	c.Assert(err, Equals, errCNPSuperseded)
+	c.Assert(calls, Equals, 1)
+
+	// Deletion of the policy
+	calls = 0
+	err = waitForCNPRealization(cnp, 11, func() bool {
+		calls++
+		forgetCNPRevision(cnp)
+		return false
+	})
+	c.Assert(err, Equals, errCNPSuperseded)
+	c.Assert(calls, Equals, 1)
+
+	err = waitForCNPRealization(cnp, 11, func() bool {
+		c.Fatal("realization of a deleted policy must not be checked")
+		return true
+	})
+	c.Assert(err, Equals, errCNPSuperseded)
+}
+
+func (s *CNPStatusSuite) TestWaitForCNPRealizationTimeout(c *C) {
+	cnp := newTestCNP()
+	setCNPRevision(cnp, 10)
+	defer forgetCNPRevision(cnp)
+
+	cnpEnforcementTimeout = 20 * time.Millisecond
+
+	calls := 0
+	start := time.Now()
+	err := waitForCNPRealization(cnp, 10, func() bool {
+		calls++
+		return false
+	})
+	c.Assert(err, Equals, errCNPEnforcementTimeout)
+	c.Assert(time.Since(start) >= cnpEnforcementTimeout, Equals, true)
+	// The interval is capped at cnpEnforcementMaxInterval
+	c.Assert(calls > 5, Equals, true)
+}
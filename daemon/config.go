@@ -67,6 +67,10 @@ type Config struct {
 	KeepConfig    bool // Keep configuration of existing endpoints when starting up.
 	KeepTemplates bool // Do not overwrite the template files
 
+	// AllowPodPolicyOverrides allows pods to enable the policy audit mode
+	// and to disable connection tracking via annotations
+	AllowPodPolicyOverrides bool
+
 	// AllowLocalhost defines when to allows the local stack to local endpoints
 	// values: { auto | always | policy }
 	AllowLocalhost string
@@ -18,7 +18,10 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"io/ioutil"
 	"net"
 	"os"
 	"os/exec"
@@ -43,6 +46,7 @@ import (
 	"github.com/cilium/cilium/pkg/endpointmanager"
 	"github.com/cilium/cilium/pkg/ipam"
 	"github.com/cilium/cilium/pkg/k8s"
+	"github.com/cilium/cilium/pkg/kvstore"
 	"github.com/cilium/cilium/pkg/labels"
 	"github.com/cilium/cilium/pkg/lock"
 	"github.com/cilium/cilium/pkg/logfields"
@@ -50,6 +54,7 @@ import (
 	"github.com/cilium/cilium/pkg/maps/lbmap"
 	"github.com/cilium/cilium/pkg/maps/lxcmap"
 	"github.com/cilium/cilium/pkg/maps/policymap"
+	"github.com/cilium/cilium/pkg/maps/throttlemap"
 	"github.com/cilium/cilium/pkg/maps/tunnel"
 	"github.com/cilium/cilium/pkg/node"
 	"github.com/cilium/cilium/pkg/policy"
@@ -95,14 +100,13 @@ type Daemon struct {
 	policy            *policy.Repository
 	preFilter         *policy.PreFilter
 
-	maxCachedLabelIDMU lock.RWMutex
-	maxCachedLabelID   policy.NumericIdentity
-
 	uniqueIDMU lock.Mutex
 	uniqueID   map[uint64]bool
 
 	nodeMonitor *monitor.NodeMonitor
 
+	identityGC *identityGC
+
 	// k8sAPIs is a set of k8s API in use. They are setup in EnableK8sWatcher,
 	// and may be disabled while the agent runs.
 	// This is on this object, instead of a global, because EnableK8sWatcher is
@@ -112,6 +116,10 @@ type Daemon struct {
 	// Used to synchronize generation of daemon's BPF programs and endpoint BPF
 	// programs.
 	compilationMutex *lock.RWMutex
+
+	// bpfSHA is the hash over the BPF sources and the node configuration
+	// the base programs were compiled with. Protected by compilationMutex.
+	bpfSHA string
 }
 
 // UpdateProxyRedirect updates the redirect rules in the proxy for a particular
@@ -583,6 +591,41 @@ func (d *Daemon) GetCompilationLock() *lock.RWMutex {
 	return d.compilationMutex
 }
 
+// GetBPFSHA returns the hash of the base program endpoint programs are
+// compiled against. Must be called with the compilation lock held.
+func (d *Daemon) GetBPFSHA() string {
+	return d.bpfSHA
+}
+
+// hashBPFSources returns the SHA256 sum over all BPF sources in the given
+// directories. Compiled objects are ignored.
+func hashBPFSources(dirs ...string) (string, error) {
+	hash := sha256.New()
+	for _, dir := range dirs {
+		err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if !info.Mode().IsRegular() || filepath.Ext(path) == ".o" {
+				return nil
+			}
+
+			data, err := ioutil.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(hash, "%s:%d\n", path, len(data))
+			hash.Write(data)
+			return nil
+		})
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
 func (d *Daemon) compileBase() error {
 	var args []string
 	var mode string
@@ -679,6 +722,22 @@ func (d *Daemon) compileBase() error {
 		return err
 	}
 
+	// The node configuration is amended by init.sh, hash it afterwards
+	oldBPFSHA := d.bpfSHA
+	d.bpfSHA, err = hashBPFSources(d.conf.BpfDir, filepath.Join(d.conf.StateDir, "globals"))
+	if err != nil {
+		log.WithError(err).Warn("Unable to hash BPF sources, endpoint programs will always be recompiled")
+		d.bpfSHA = ""
+	}
+
+	// Endpoint program templates compiled against a different base
+	// program are stale
+	if d.bpfSHA == "" || d.bpfSHA != oldBPFSHA {
+		if err := endpoint.RemoveTemplates(d.conf.StateDir); err != nil {
+			log.WithError(err).Warn("Unable to remove endpoint program templates")
+		}
+	}
+
 	ipam.ReserveLocalRoutes()
 	node.InstallHostRoutes()
 
@@ -767,6 +826,7 @@ func (d *Daemon) init() error {
 
 	fmt.Fprintf(fw, "#define TUNNEL_ENDPOINT_MAP_SIZE %d\n", tunnel.MaxEntries)
 	fmt.Fprintf(fw, "#define ENDPOINTS_MAP_SIZE %d\n", lxcmap.MaxKeys)
+	fmt.Fprintf(fw, "#define THROTTLE_MAP_SIZE %d\n", throttlemap.MaxEntries)
 
 	fmt.Fprintf(fw, "#define TRACE_PAYLOAD_LEN %dULL\n", tracePayloadLen)
 
@@ -955,6 +1015,12 @@ func NewDaemon(c *Config) (*Daemon, error) {
 		node.AddAuxPrefix(ipnet)
 	}
 
+	if ipam.GetMode() == ipam.ModeClusterPool {
+		if err := leaseClusterPoolCIDRs(); err != nil {
+			log.WithError(err).Fatal("Unable to lease node CIDR from cluster pool")
+		}
+	}
+
 	if err := node.AutoComplete(); err != nil {
 		log.WithError(err).Fatal("Cannot autocomplete node IPv6 address")
 	}
@@ -972,6 +1038,21 @@ func NewDaemon(c *Config) (*Daemon, error) {
 		log.WithError(err).Fatal("IPAM init failed")
 	}
 
+	for name, prefix := range ipamPools {
+		_, cidr, err := net.ParseCIDR(prefix)
+		if err != nil {
+			log.WithError(err).WithField("pool", name).Fatal("Invalid IP pool prefix")
+		}
+
+		if err := ipam.AddPool(name, cidr); err != nil {
+			log.WithError(err).Fatal("Unable to add IP pool")
+		}
+	}
+
+	if err := ipam.InitJournal(c.StateDir, c.RestoreState); err != nil {
+		log.WithError(err).Warning("Unable to restore IP address reservations")
+	}
+
 	if err := node.ValidatePostInit(); err != nil {
 		log.WithError(err).Fatal("postinit failed")
 	}
@@ -988,15 +1069,44 @@ func NewDaemon(c *Config) (*Daemon, error) {
 	log.Infof("IPv4 allocation prefix: %s", node.GetIPv4AllocRange())
 	log.Debugf("IPv6 router address: %s", node.GetIPv6Router())
 
+	if identityAllocMode == identityAllocModeCRD {
+		backend, err := newCRDIdentityBackend(&d)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to initialize CRD identity allocation: %s", err)
+		}
+		identityStore = backend
+	} else {
+		d.EnableKVStoreWatcher()
+		kvstore.OnNewLease(refreshIdentityRefs)
+	}
+
 	// Populate list of nodes with local node entry
 	ni, n := node.GetLocalNode()
 	node.UpdateNode(ni, n, node.TunnelRoute, nil)
 
+	// Without Kubernetes, nodes discover each other via the kvstore
+	if !k8s.IsEnabled() {
+		d.EnableKVStoreNodeDiscovery()
+	}
+
 	if !d.conf.IPv4Disabled {
-		// Allocate IPv4 service loopback IP
-		loopbackIPv4, _, err := ipam.AllocateNext("ipv4")
-		if err != nil {
-			return nil, fmt.Errorf("Unable to reserve IPv4 loopback address: %s", err)
+		// Reuse the IPv4 service loopback IP restored from the journal
+		// to keep it stable across restarts, allocate it otherwise
+		var loopbackIPv4 net.IP
+		for _, ip := range ipam.OwnedIPs("loopback") {
+			if ip.To4() != nil {
+				loopbackIPv4 = ip
+				break
+			}
+		}
+		if loopbackIPv4 == nil {
+			loopbackIPv4, _, err = ipam.AllocateNext("ipv4", ipam.DefaultPool, "loopback")
+			if err != nil {
+				return nil, fmt.Errorf("Unable to reserve IPv4 loopback address: %s", err)
+			}
+		}
+		if err = ipam.ClaimIP(loopbackIPv4, "loopback"); err != nil {
+			return nil, fmt.Errorf("Unable to claim IPv4 loopback address: %s", err)
 		}
 		d.loopbackIPv4 = loopbackIPv4
 	}
@@ -1025,6 +1135,8 @@ func NewDaemon(c *Config) (*Daemon, error) {
 
 	d.collectStaleMapGarbage()
 
+	startIPAMOrphanGC()
+
 	return &d, nil
 }
 
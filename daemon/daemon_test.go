@@ -40,7 +40,6 @@ type DaemonSuite struct {
 	OnAlwaysAllowLocalhost            func() bool
 	OnGetCachedLabelList              func(id policy.NumericIdentity) (labels.LabelArray, error)
 	OnGetPolicyRepository             func() *policy.Repository
-	OnGetCachedMaxLabelID             func() (policy.NumericIdentity, error)
 	OnUpdateProxyRedirect             func(e *e.Endpoint, l4 *policy.L4Filter) (uint16, error)
 	OnRemoveProxyRedirect             func(e *e.Endpoint, l4 *policy.L4Filter) error
 	OnGetStateDir                     func() string
@@ -49,7 +48,9 @@ type DaemonSuite struct {
 	OnRemoveFromEndpointQueue         func(epID uint64)
 	OnDebugEnabled                    func() bool
 	OnAnnotateEndpoint                func(e *e.Endpoint, annotationKey, annotationValue string)
+	OnUpdateCiliumEndpoint            func(e *e.Endpoint)
 	OnGetCompilationLock              func() *lock.RWMutex
+	OnGetBPFSHA                       func() string
 }
 
 var _ = Suite(&DaemonSuite{})
@@ -81,6 +82,14 @@ func (ds *DaemonSuite) AnnotateEndpoint(e *e.Endpoint, annotationKey, annotation
 
 }
 
+func (ds *DaemonSuite) UpdateCiliumEndpoint(e *e.Endpoint) {
+	if ds.OnUpdateCiliumEndpoint != nil {
+		ds.OnUpdateCiliumEndpoint(e)
+		return
+	}
+	panic("UpdateCiliumEndpoint should not have been called")
+}
+
 func (ds *DaemonSuite) EnableEndpointPolicyEnforcement(e *e.Endpoint) bool {
 	if ds.OnEnableEndpointPolicyEnforcement != nil {
 		return ds.OnEnableEndpointPolicyEnforcement(e)
@@ -116,13 +125,6 @@ func (ds *DaemonSuite) GetPolicyRepository() *policy.Repository {
 	panic("GetPolicyRepository should not have been called")
 }
 
-func (ds *DaemonSuite) GetCachedMaxLabelID() (policy.NumericIdentity, error) {
-	if ds.OnGetCachedMaxLabelID != nil {
-		return ds.OnGetCachedMaxLabelID()
-	}
-	panic("GetCachedMaxLabelID should not have been called")
-}
-
 func (ds *DaemonSuite) UpdateProxyRedirect(e *e.Endpoint, l4 *policy.L4Filter) (uint16, error) {
 	if ds.OnUpdateProxyRedirect != nil {
 		return ds.OnUpdateProxyRedirect(e, l4)
@@ -180,3 +182,10 @@ func (ds *DaemonSuite) GetCompilationLock() *lock.RWMutex {
 	}
 	panic("GetCompilationLock should not have been called")
 }
+
+func (ds *DaemonSuite) GetBPFSHA() string {
+	if ds.OnGetBPFSHA != nil {
+		return ds.OnGetBPFSHA()
+	}
+	panic("GetBPFSHA should not have been called")
+}
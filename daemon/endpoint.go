@@ -25,9 +25,11 @@ import (
 	"github.com/cilium/cilium/pkg/endpoint"
 	"github.com/cilium/cilium/pkg/endpointmanager"
 	"github.com/cilium/cilium/pkg/ipam"
+	"github.com/cilium/cilium/pkg/k8s"
 	"github.com/cilium/cilium/pkg/labels"
 	"github.com/cilium/cilium/pkg/logfields"
 	"github.com/cilium/cilium/pkg/maps/lxcmap"
+	"github.com/cilium/cilium/pkg/maps/throttlemap"
 	"github.com/cilium/cilium/pkg/policy"
 
 	"github.com/go-openapi/runtime/middleware"
@@ -145,6 +147,22 @@ func (h *putEndpointID) Handle(params PutEndpointIDParams) middleware.Responder
 	alwaysEnforce := policy.GetPolicyEnabled() == endpoint.AlwaysEnforce
 	ep.Opts.Set(endpoint.OptionPolicy, alwaysEnforce)
 
+	if epTemplate.K8sPodName != "" {
+		ep.PodName = fmt.Sprintf("%s:%s", epTemplate.K8sNamespace, epTemplate.K8sPodName)
+
+		// Apply the annotations of the pod before the endpoint is
+		// built for the first time. Invalid annotations reject the
+		// creation of the endpoint.
+		if k8s.IsEnabled() {
+			cfg, err := fetchPodEndpointConfig(epTemplate.K8sNamespace, epTemplate.K8sPodName, h.d.conf.AllowPodPolicyOverrides)
+			if err != nil {
+				return apierror.Error(PutEndpointIDInvalidCode, err)
+			} else if cfg != nil {
+				cfg.apply(ep)
+			}
+		}
+	}
+
 	endpointmanager.Mutex.Lock()
 	defer endpointmanager.Mutex.Unlock()
 
@@ -183,6 +201,7 @@ func (h *putEndpointID) Handle(params PutEndpointIDParams) middleware.Responder
 	}
 
 	endpointmanager.Insert(ep)
+	h.d.claimEndpointIPs(ep)
 
 	add := labels.NewLabelsFromModel(params.Endpoint.Labels)
 
@@ -337,6 +356,8 @@ func (d *Daemon) deleteEndpoint(ep *endpoint.Endpoint) int {
 		return 0
 	}
 
+	d.deleteCiliumEndpoint(ep.PodName)
+
 	sha256sum := ep.OpLabels.IdentityLabels().SHA256Sum()
 	if err := d.DeleteIdentityBySHA256(sha256sum, ep.StringID()); err != nil {
 		log.WithError(err).WithFields(log.Fields{
@@ -361,6 +382,12 @@ func (d *Daemon) deleteEndpoint(ep *endpoint.Endpoint) int {
 			errors++
 		}
 
+		// Remove bandwidth limits
+		if err := throttlemap.DeleteLimits(ep.ID); err != nil {
+			scopedLog.WithError(err).Warn("Unable to remove bandwidth limits")
+			errors++
+		}
+
 		// Remove calls BPF map
 		if err := os.RemoveAll(ep.CallsMapPathLocked()); err != nil {
 			scopedLog.WithError(err).WithField(logfields.Path, ep.CallsMapPathLocked()).Warn("Unable to remove calls map file")
@@ -0,0 +1,680 @@
+// Copyright 2018 Authors of Cilium
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cilium/cilium/pkg/endpointmanager"
+	"github.com/cilium/cilium/pkg/k8s"
+	cilium_v2 "github.com/cilium/cilium/pkg/k8s/apis/cilium.io/v2"
+	clientset "github.com/cilium/cilium/pkg/k8s/client/clientset/versioned"
+	cilium_client_v2 "github.com/cilium/cilium/pkg/k8s/client/clientset/versioned/typed/cilium/v2"
+	"github.com/cilium/cilium/pkg/labels"
+	"github.com/cilium/cilium/pkg/lock"
+	"github.com/cilium/cilium/pkg/logfields"
+	"github.com/cilium/cilium/pkg/node"
+	"github.com/cilium/cilium/pkg/policy"
+
+	log "github.com/sirupsen/logrus"
+	"k8s.io/api/core/v1"
+	apiextensionsclient "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	// crdIdentitySHA256Index is the name of the index of the identity
+	// cache by the SHA256 sum of the identity labels
+	crdIdentitySHA256Index = "labelsSHA256"
+
+	// crdIdentityMaxAttempts is the number of times an update of an
+	// identity is retried on conflicting concurrent updates
+	crdIdentityMaxAttempts = 16
+
+	// crdIdentityAllocMaxAttempts is the number of numeric identities
+	// tried when allocating a new identity before giving up
+	crdIdentityAllocMaxAttempts = 64
+
+	// crdIdentityGCInterval is the interval in which unused identities
+	// are garbage collected
+	crdIdentityGCInterval = 5 * time.Minute
+
+	// crdIdentityGCGracePeriod is the minimal age of an identity before
+	// it is garbage collected. It prevents the removal of identities
+	// which have just been allocated but not yet associated.
+	crdIdentityGCGracePeriod = 10 * time.Minute
+
+	// crdIdentityRefreshInterval is the minimal age of an association of
+	// a local endpoint with an identity before it is refreshed
+	crdIdentityRefreshInterval = 5 * time.Minute
+
+	// crdIdentityRefTimeout is the age after which an association which
+	// has not been refreshed expires, e.g. because the node of the
+	// endpoint has disappeared
+	crdIdentityRefTimeout = 30 * time.Minute
+)
+
+// crdIdentityBackend allocates identities as CiliumIdentity custom resources.
+// Concurrent allocations by multiple agents are resolved with optimistic
+// concurrency: numeric identities are claimed by creating the resource named
+// after the numeric identity and endpoint associations are updated based on
+// the resource version.
+type crdIdentityBackend struct {
+	client cilium_client_v2.CiliumIdentityInterface
+
+	// store is the cache of all identities, indexed by crdIdentitySHA256Index
+	store cache.Indexer
+
+	// mutex serializes identity updates of this agent
+	mutex lock.Mutex
+
+	// isLocalEndpoint returns true if clusterEndpointID refers to an
+	// existing endpoint of this node
+	isLocalEndpoint func(clusterEndpointID string) bool
+}
+
+// crdSecurityLabels returns lbls in the form stored in a CiliumIdentity
+func crdSecurityLabels(lbls labels.Labels) map[string]string {
+	securityLabels := make(map[string]string, len(lbls))
+	for _, lbl := range lbls {
+		securityLabels[lbl.Source+":"+lbl.Key] = lbl.Value
+	}
+	return securityLabels
+}
+
+// crdIdentityLabels returns the labels of the identity
+func crdIdentityLabels(obj *cilium_v2.CiliumIdentity) labels.Labels {
+	lbls := make(labels.Labels, len(obj.SecurityLabels))
+	for sourceKey, value := range obj.SecurityLabels {
+		source, key := labels.LabelSourceUnspec, sourceKey
+		if i := strings.Index(sourceKey, ":"); i >= 0 {
+			source, key = sourceKey[:i], sourceKey[i+1:]
+		}
+		lbls[key] = labels.NewLabel(key, value, source)
+	}
+	return lbls
+}
+
+// crdIdentitySHA256 returns the SHA256 sum of the labels of the identity
+func crdIdentitySHA256(obj *cilium_v2.CiliumIdentity) string {
+	return crdIdentityLabels(obj).SHA256Sum()
+}
+
+func crdIdentitySHA256IndexFunc(obj interface{}) ([]string, error) {
+	id, ok := obj.(*cilium_v2.CiliumIdentity)
+	if !ok {
+		return nil, fmt.Errorf("unexpected object type %T", obj)
+	}
+	return []string{crdIdentitySHA256(id)}, nil
+}
+
+// identityFromCRD converts the custom resource obj into an identity. Returns
+// nil if the resource name is not a valid numeric identity.
+func identityFromCRD(obj *cilium_v2.CiliumIdentity) *policy.Identity {
+	nid, err := policy.ParseNumericIdentity(obj.Name)
+	if err != nil {
+		return nil
+	}
+
+	id := policy.NewIdentity()
+	id.ID = nid
+	id.Labels = crdIdentityLabels(obj)
+	id.LabelsSHA256 = id.Labels.SHA256Sum()
+	for ep, ts := range obj.Status.Endpoints {
+		id.Endpoints[ep] = ts.Time
+	}
+
+	return id
+}
+
+// upsertCRDIdentity adds the identity represented by the CiliumIdentity obj to
+// the cluster identity cache or removes it if it is no longer in use. Returns
+// the identity if the cache has changed.
+func upsertCRDIdentity(obj interface{}) *policy.Identity {
+	crdID, ok := obj.(*cilium_v2.CiliumIdentity)
+	if !ok {
+		return nil
+	}
+
+	id := identityFromCRD(crdID)
+	if id == nil {
+		return nil
+	}
+
+	if len(id.Endpoints) == 0 {
+		return removeCRDIdentity(obj)
+	}
+
+	if policy.GetConsumableCache().UpsertIdentity(id) {
+		return id
+	}
+
+	return nil
+}
+
+// removeCRDIdentity removes the identity represented by the CiliumIdentity obj
+// from the cluster identity cache. Returns the removed identity if the cache
+// has changed.
+func removeCRDIdentity(obj interface{}) *policy.Identity {
+	if deleted, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = deleted.Obj
+	}
+
+	crdID, ok := obj.(*cilium_v2.CiliumIdentity)
+	if !ok {
+		return nil
+	}
+
+	nid, err := policy.ParseNumericIdentity(crdID.Name)
+	if err != nil {
+		return nil
+	}
+
+	if old := policy.GetConsumableCache().RemoveIdentity(nid); old != nil {
+		return old
+	}
+
+	return nil
+}
+
+// newCRDIdentityBackend registers the CiliumIdentity custom resource
+// definition and returns a backend with a synchronized identity cache. All
+// identities in use are mirrored into the cluster identity cache and changes
+// to them trigger a policy recalculation of the affected endpoints of d.
+func newCRDIdentityBackend(d *Daemon) (*crdIdentityBackend, error) {
+	restConfig, err := k8s.CreateConfig()
+	if err != nil {
+		return nil, fmt.Errorf("unable to create rest configuration: %s", err)
+	}
+
+	apiextensionsclientset, err := apiextensionsclient.NewForConfig(restConfig)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create rest configuration for k8s CRD: %s", err)
+	}
+
+	if err := cilium_v2.CreateCustomResourceDefinitions(apiextensionsclientset); err != nil {
+		return nil, fmt.Errorf("unable to create custom resource definitions: %s", err)
+	}
+
+	ciliumClient, err := clientset.NewForConfig(restConfig)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create cilium identity client: %s", err)
+	}
+
+	b := &crdIdentityBackend{
+		client:          ciliumClient.CiliumV2().CiliumIdentities(),
+		isLocalEndpoint: isLocalClusterEndpoint,
+	}
+
+	upsert := func(obj interface{}) {
+		if id := upsertCRDIdentity(obj); id != nil {
+			d.updatePolicyForIdentity(id)
+		}
+	}
+
+	store, controller := cache.NewIndexerInformer(
+		cache.NewListWatchFromClient(ciliumClient.CiliumV2().RESTClient(),
+			cilium_v2.IdentityPluralName, v1.NamespaceAll, fields.Everything()),
+		&cilium_v2.CiliumIdentity{},
+		5*time.Minute,
+		cache.ResourceEventHandlerFuncs{
+			AddFunc:    upsert,
+			UpdateFunc: func(oldObj, newObj interface{}) { upsert(newObj) },
+			DeleteFunc: func(obj interface{}) {
+				if id := removeCRDIdentity(obj); id != nil {
+					d.updatePolicyForIdentity(id)
+				}
+			},
+		},
+		cache.Indexers{crdIdentitySHA256Index: crdIdentitySHA256IndexFunc},
+	)
+	b.store = store
+
+	go controller.Run(wait.NeverStop)
+	if !cache.WaitForCacheSync(wait.NeverStop, controller.HasSynced) {
+		return nil, fmt.Errorf("unable to synchronize identity cache")
+	}
+
+	d.k8sAPIGroups.addAPI(k8sAPIGroupCiliumIdentityV2)
+
+	go b.runGC()
+
+	log.WithField("identities", len(store.ListKeys())).Info("Allocating identities via CiliumIdentity custom resources")
+
+	return b, nil
+}
+
+// nextFreeID returns the numeric identity following the highest numeric
+// identity in the cache
+func (b *crdIdentityBackend) nextFreeID() policy.NumericIdentity {
+	next := policy.MinimalNumericIdentity
+	for _, obj := range b.store.List() {
+		if id, ok := obj.(*cilium_v2.CiliumIdentity); ok {
+			if nid, err := policy.ParseNumericIdentity(id.Name); err == nil && nid >= next {
+				next = nid + 1
+			}
+		}
+	}
+	return next
+}
+
+// cachedBySHA256 returns the cached identity for the labels with the given
+// SHA256 sum. If multiple identities exist for the same labels, the one with
+// the lowest numeric identity is returned.
+func (b *crdIdentityBackend) cachedBySHA256(sha256sum string) *cilium_v2.CiliumIdentity {
+	objs, err := b.store.ByIndex(crdIdentitySHA256Index, sha256sum)
+	if err != nil {
+		return nil
+	}
+
+	return lowestCRDIdentity(objs)
+}
+
+// lowestCRDIdentity returns the identity with the lowest numeric identity,
+// ignoring deleted identities
+func lowestCRDIdentity(objs []interface{}) *cilium_v2.CiliumIdentity {
+	var (
+		lowest    *cilium_v2.CiliumIdentity
+		lowestNID policy.NumericIdentity
+	)
+
+	for _, obj := range objs {
+		id, ok := obj.(*cilium_v2.CiliumIdentity)
+		if !ok || id.Status.Deleted {
+			continue
+		}
+
+		nid, err := policy.ParseNumericIdentity(id.Name)
+		if err != nil {
+			continue
+		}
+
+		if lowest == nil || nid < lowestNID {
+			lowest, lowestNID = id, nid
+		}
+	}
+
+	return lowest
+}
+
+// allocate claims a new numeric identity for lbls associated with
+// clusterEndpointID. If another agent has concurrently allocated an identity
+// for the same labels, the identity with the lowest numeric identity wins and
+// is returned instead, in which case false is returned.
+func (b *crdIdentityBackend) allocate(lbls labels.Labels, clusterEndpointID string) (*cilium_v2.CiliumIdentity, bool, error) {
+	sha256sum := lbls.SHA256Sum()
+	nid := b.nextFreeID()
+
+	var created *cilium_v2.CiliumIdentity
+	for attempt := 0; attempt < crdIdentityAllocMaxAttempts; attempt, nid = attempt+1, nid+1 {
+		obj := &cilium_v2.CiliumIdentity{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: nid.StringID(),
+			},
+			SecurityLabels: crdSecurityLabels(lbls),
+			Status: cilium_v2.CiliumIdentityStatus{
+				Endpoints: map[string]cilium_v2.Timestamp{
+					clusterEndpointID: cilium_v2.NewTimestamp(),
+				},
+			},
+		}
+
+		var err error
+		created, err = b.client.Create(obj)
+		if errors.IsAlreadyExists(err) {
+			continue
+		} else if err != nil {
+			return nil, false, err
+		}
+		break
+	}
+
+	if created == nil {
+		return nil, false, fmt.Errorf("no free numeric identity found after %d attempts", crdIdentityAllocMaxAttempts)
+	}
+
+	// Identities allocated concurrently by other agents for the same
+	// labels are resolved against the identity cache. Duplicates which
+	// have not reached the cache yet are resolved by later allocations,
+	// the unused duplicates are garbage collected.
+	objs, err := b.store.ByIndex(crdIdentitySHA256Index, sha256sum)
+	if err != nil {
+		return nil, false, err
+	}
+
+	winner := lowestCRDIdentity(append(objs, created))
+	if winner == nil || winner.Name == created.Name {
+		b.store.Update(created)
+		return created, true, nil
+	}
+
+	log.WithFields(log.Fields{
+		logfields.Identity:       created.Name,
+		logfields.IdentityLabels: lbls.String(),
+		"winner":                 winner.Name,
+	}).Debug("Identity was allocated concurrently, releasing duplicate")
+
+	if err := b.client.Delete(created.Name, &metav1.DeleteOptions{
+		Preconditions: &metav1.Preconditions{UID: &created.UID},
+	}); err != nil && !errors.IsNotFound(err) {
+		log.WithError(err).WithField(logfields.Identity, created.Name).Warning("Unable to release duplicate identity")
+	}
+
+	return winner, false, nil
+}
+
+func (b *crdIdentityBackend) createOrUpdate(lbls labels.Labels, clusterEndpointID string) (*policy.Identity, bool, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	obj := b.cachedBySHA256(lbls.SHA256Sum())
+
+	for attempt := 0; attempt < crdIdentityMaxAttempts; attempt++ {
+		if obj == nil {
+			created, isNew, err := b.allocate(lbls, clusterEndpointID)
+			if err != nil {
+				return nil, false, err
+			}
+			if isNew {
+				log.WithFields(log.Fields{
+					logfields.EndpointID:     clusterEndpointID,
+					logfields.Identity:       created.Name,
+					logfields.IdentityLabels: lbls.String(),
+				}).Debug("Created new identity")
+				return identityFromCRD(created), true, nil
+			}
+			obj = created
+		}
+
+		update := obj.DeepCopy()
+		if update.Status.Endpoints == nil {
+			update.Status.Endpoints = map[string]cilium_v2.Timestamp{}
+		}
+		update.Status.Endpoints[clusterEndpointID] = cilium_v2.NewTimestamp()
+
+		updated, err := b.client.Update(update)
+		switch {
+		case err == nil:
+			b.store.Update(updated)
+			return identityFromCRD(updated), false, nil
+
+		case errors.IsNotFound(err):
+			// The identity has been garbage collected in the
+			// meantime, allocate a new one
+			obj = nil
+
+		case errors.IsConflict(err):
+			obj, err = b.client.Get(obj.Name, metav1.GetOptions{})
+			if errors.IsNotFound(err) {
+				obj = nil
+			} else if err != nil {
+				return nil, false, err
+			} else if obj.Status.Deleted {
+				// The identity is about to be garbage
+				// collected, allocate a new one
+				obj = nil
+			}
+
+		default:
+			return nil, false, err
+		}
+	}
+
+	return nil, false, fmt.Errorf("unable to update identity after %d attempts", crdIdentityMaxAttempts)
+}
+
+func (b *crdIdentityBackend) lookup(id policy.NumericIdentity) (*policy.Identity, error) {
+	obj, exists, err := b.store.GetByKey(id.StringID())
+	if err != nil || !exists {
+		return nil, err
+	}
+
+	return identityFromCRD(obj.(*cilium_v2.CiliumIdentity)), nil
+}
+
+func (b *crdIdentityBackend) lookupBySHA256(sha256sum string) (*policy.Identity, error) {
+	if obj := b.cachedBySHA256(sha256sum); obj != nil {
+		return identityFromCRD(obj), nil
+	}
+
+	return nil, nil
+}
+
+func (b *crdIdentityBackend) list() ([]*policy.Identity, error) {
+	identities := []*policy.Identity{}
+	for _, obj := range b.store.List() {
+		if id := identityFromCRD(obj.(*cilium_v2.CiliumIdentity)); id != nil {
+			identities = append(identities, id)
+		}
+	}
+
+	return identities, nil
+}
+
+func (b *crdIdentityBackend) release(sha256sum, clusterEndpointID string) error {
+	if clusterEndpointID == "" {
+		return nil
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	obj := b.cachedBySHA256(sha256sum)
+	if obj == nil {
+		return fmt.Errorf("identity not found")
+	}
+
+	for attempt := 0; attempt < crdIdentityMaxAttempts; attempt++ {
+		if _, ok := obj.Status.Endpoints[clusterEndpointID]; !ok {
+			return fmt.Errorf("Association not found")
+		}
+
+		update := obj.DeepCopy()
+		delete(update.Status.Endpoints, clusterEndpointID)
+
+		updated, err := b.client.Update(update)
+		switch {
+		case err == nil:
+			b.store.Update(updated)
+			log.WithFields(log.Fields{
+				logfields.EndpointID: clusterEndpointID,
+				logfields.Identity:   updated.Name,
+				"count":              len(updated.Status.Endpoints),
+			}).Debug("Decremented label ref-count")
+			return nil
+
+		case errors.IsConflict(err):
+			obj, err = b.client.Get(obj.Name, metav1.GetOptions{})
+			if err != nil {
+				return err
+			}
+
+		default:
+			return err
+		}
+	}
+
+	return fmt.Errorf("unable to update identity after %d attempts", crdIdentityMaxAttempts)
+}
+
+// isLocalClusterEndpoint returns true if clusterEndpointID refers to an
+// existing endpoint of this node
+func isLocalClusterEndpoint(clusterEndpointID string) bool {
+	prefix := node.GetExternalIPv4().String() + ":"
+	if !strings.HasPrefix(clusterEndpointID, prefix) {
+		return false
+	}
+
+	id, err := strconv.ParseUint(strings.TrimPrefix(clusterEndpointID, prefix), 10, 16)
+	return err == nil && endpointmanager.LookupCiliumID(uint16(id)) != nil
+}
+
+// updateEndpoints updates the endpoint associations of the identity obj with
+// modify, retrying on conflicting concurrent updates. modify returns false if
+// the associations are unchanged. Must be called with b.mutex held.
+func (b *crdIdentityBackend) updateEndpoints(obj *cilium_v2.CiliumIdentity, modify func(map[string]cilium_v2.Timestamp) bool) (*cilium_v2.CiliumIdentity, error) {
+	for attempt := 0; attempt < crdIdentityMaxAttempts; attempt++ {
+		update := obj.DeepCopy()
+		if update.Status.Endpoints == nil {
+			update.Status.Endpoints = map[string]cilium_v2.Timestamp{}
+		}
+		if !modify(update.Status.Endpoints) {
+			return obj, nil
+		}
+
+		updated, err := b.client.Update(update)
+		switch {
+		case err == nil:
+			b.store.Update(updated)
+			return updated, nil
+
+		case errors.IsConflict(err):
+			obj, err = b.client.Get(obj.Name, metav1.GetOptions{})
+			if err != nil {
+				return nil, err
+			}
+
+		default:
+			return nil, err
+		}
+	}
+
+	return nil, fmt.Errorf("unable to update identity after %d attempts", crdIdentityMaxAttempts)
+}
+
+// refreshRefs renews the associations of the endpoints of this node which
+// are older than crdIdentityRefreshInterval so that they do not expire
+func (b *crdIdentityBackend) refreshRefs() {
+	deadline := time.Now().Add(-crdIdentityRefreshInterval)
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	for _, obj := range b.store.List() {
+		id, ok := obj.(*cilium_v2.CiliumIdentity)
+		if !ok {
+			continue
+		}
+
+		_, err := b.updateEndpoints(id, func(endpoints map[string]cilium_v2.Timestamp) bool {
+			refreshed := false
+			for ep, ts := range endpoints {
+				if ts.Before(deadline) && b.isLocalEndpoint(ep) {
+					endpoints[ep] = cilium_v2.NewTimestamp()
+					refreshed = true
+				}
+			}
+			return refreshed
+		})
+		if err != nil && !errors.IsNotFound(err) {
+			log.WithError(err).WithField(logfields.Identity, id.Name).Warning("Unable to refresh identity references")
+		}
+	}
+}
+
+// expireRefs removes the associations of the identity obj which have not been
+// refreshed within crdIdentityRefTimeout and returns the updated identity
+func (b *crdIdentityBackend) expireRefs(obj *cilium_v2.CiliumIdentity) (*cilium_v2.CiliumIdentity, error) {
+	deadline := time.Now().Add(-crdIdentityRefTimeout)
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return b.updateEndpoints(obj, func(endpoints map[string]cilium_v2.Timestamp) bool {
+		expired := false
+		for ep, ts := range endpoints {
+			if ts.Before(deadline) {
+				log.WithFields(log.Fields{
+					logfields.EndpointID: ep,
+					logfields.Identity:   obj.Name,
+				}).Debug("Expiring stale identity reference")
+				delete(endpoints, ep)
+				expired = true
+			}
+		}
+		return expired
+	})
+}
+
+// gc deletes identities which are not associated with any endpoint after
+// expiring stale associations. Before an identity is deleted, it is marked
+// as deleted with an update guarded by its resource version, which fails if
+// an endpoint has been associated concurrently. Deleted identities are never
+// associated with endpoints again.
+func (b *crdIdentityBackend) gc() {
+	deadline := time.Now().Add(-crdIdentityGCGracePeriod)
+	for _, obj := range b.store.List() {
+		id, ok := obj.(*cilium_v2.CiliumIdentity)
+		if !ok || id.CreationTimestamp.After(deadline) {
+			continue
+		}
+
+		scopedLog := log.WithField(logfields.Identity, id.Name)
+
+		id, err := b.expireRefs(id)
+		if err != nil {
+			if !errors.IsNotFound(err) {
+				scopedLog.WithError(err).Warning("Unable to expire identity references")
+			}
+			continue
+		}
+		if len(id.Status.Endpoints) > 0 {
+			continue
+		}
+
+		if !id.Status.Deleted {
+			tombstone := id.DeepCopy()
+			tombstone.Status.Deleted = true
+			id, err = b.client.Update(tombstone)
+			if err != nil {
+				if !errors.IsNotFound(err) && !errors.IsConflict(err) {
+					scopedLog.WithError(err).Warning("Unable to mark unused identity as deleted")
+				}
+				continue
+			}
+			b.store.Update(id)
+		}
+
+		err = b.client.Delete(id.Name, &metav1.DeleteOptions{
+			Preconditions: &metav1.Preconditions{UID: &id.UID},
+		})
+		switch {
+		case err == nil:
+			scopedLog.Debug("Deleted unused identity")
+		case errors.IsNotFound(err), errors.IsConflict(err):
+		default:
+			scopedLog.WithError(err).Warning("Unable to delete unused identity")
+		}
+	}
+}
+
+// runGC periodically refreshes the identity references of this node and
+// garbage collects unused identities. Every agent runs the garbage
+// collector.
+func (b *crdIdentityBackend) runGC() {
+	for {
+		time.Sleep(crdIdentityGCInterval)
+
+		b.refreshRefs()
+		b.gc()
+	}
+}
@@ -0,0 +1,188 @@
+// Copyright 2018 Authors of Cilium
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"time"
+
+	cilium_v2 "github.com/cilium/cilium/pkg/k8s/apis/cilium.io/v2"
+	"github.com/cilium/cilium/pkg/k8s/client/clientset/versioned/fake"
+	"github.com/cilium/cilium/pkg/policy"
+
+	. "gopkg.in/check.v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+type CRDIdentitySuite struct{}
+
+var _ = Suite(&CRDIdentitySuite{})
+
+func newTestCRDIdentityBackend() *crdIdentityBackend {
+	return &crdIdentityBackend{
+		client: fake.NewSimpleClientset().CiliumV2().CiliumIdentities(),
+		store: cache.NewIndexer(cache.MetaNamespaceKeyFunc,
+			cache.Indexers{crdIdentitySHA256Index: crdIdentitySHA256IndexFunc}),
+		isLocalEndpoint: func(string) bool { return false },
+	}
+}
+
+// setRefTimestamps sets the time of all endpoint associations of the
+// identity nid to ts
+func setRefTimestamps(c *C, b *crdIdentityBackend, nid policy.NumericIdentity, ts time.Time) {
+	obj, err := b.client.Get(nid.StringID(), metav1.GetOptions{})
+	c.Assert(err, IsNil)
+	for ep := range obj.Status.Endpoints {
+		obj.Status.Endpoints[ep] = cilium_v2.Timestamp{Time: ts}
+	}
+	obj, err = b.client.Update(obj)
+	c.Assert(err, IsNil)
+	c.Assert(b.store.Update(obj), IsNil)
+}
+
+func (s *CRDIdentitySuite) TestCreateOrUpdate(c *C) {
+	b := newTestCRDIdentityBackend()
+
+	id, isNew, err := b.createOrUpdate(lbls, "10.0.0.1:1")
+	c.Assert(err, IsNil)
+	c.Assert(isNew, Equals, true)
+	c.Assert(id.ID, Equals, policy.MinimalNumericIdentity)
+	c.Assert(id.RefCount(), Equals, 1)
+
+	id2, isNew, err := b.createOrUpdate(lbls, "10.0.0.2:1")
+	c.Assert(err, IsNil)
+	c.Assert(isNew, Equals, false)
+	c.Assert(id2.ID, Equals, id.ID)
+	c.Assert(id2.RefCount(), Equals, 2)
+
+	id3, isNew, err := b.createOrUpdate(lbls2, "10.0.0.1:2")
+	c.Assert(err, IsNil)
+	c.Assert(isNew, Equals, true)
+	c.Assert(id3.ID, Equals, id.ID+1)
+
+	found, err := b.lookup(id.ID)
+	c.Assert(err, IsNil)
+	c.Assert(found.Labels.SHA256Sum(), Equals, lbls.SHA256Sum())
+
+	found, err = b.lookupBySHA256(lbls2.SHA256Sum())
+	c.Assert(err, IsNil)
+	c.Assert(found.ID, Equals, id3.ID)
+
+	list, err := b.list()
+	c.Assert(err, IsNil)
+	c.Assert(len(list), Equals, 2)
+
+	c.Assert(b.release(lbls.SHA256Sum(), "10.0.0.1:1"), IsNil)
+	c.Assert(b.release(lbls.SHA256Sum(), "10.0.0.1:1"), Not(IsNil))
+
+	found, err = b.lookup(id.ID)
+	c.Assert(err, IsNil)
+	c.Assert(found.RefCount(), Equals, 1)
+}
+
+func (s *CRDIdentitySuite) TestLabelsRoundTrip(c *C) {
+	obj := &cilium_v2.CiliumIdentity{SecurityLabels: crdSecurityLabels(lbls)}
+	c.Assert(crdIdentityLabels(obj), DeepEquals, lbls)
+	c.Assert(crdIdentitySHA256(obj), Equals, lbls.SHA256Sum())
+}
+
+func (s *CRDIdentitySuite) TestAllocateDuplicate(c *C) {
+	b := newTestCRDIdentityBackend()
+
+	// Another agent has allocated an identity for the same labels
+	existing, err := b.client.Create(&cilium_v2.CiliumIdentity{
+		ObjectMeta:     metav1.ObjectMeta{Name: policy.MinimalNumericIdentity.StringID()},
+		SecurityLabels: crdSecurityLabels(lbls),
+	})
+	c.Assert(err, IsNil)
+	c.Assert(b.store.Add(existing), IsNil)
+
+	winner, isNew, err := b.allocate(lbls, "10.0.0.1:1")
+	c.Assert(err, IsNil)
+	c.Assert(isNew, Equals, false)
+	c.Assert(winner.Name, Equals, existing.Name)
+
+	// The duplicate has been released
+	_, err = b.client.Get((policy.MinimalNumericIdentity + 1).StringID(), metav1.GetOptions{})
+	c.Assert(errors.IsNotFound(err), Equals, true)
+}
+
+func (s *CRDIdentitySuite) TestRefreshAndExpireRefs(c *C) {
+	b := newTestCRDIdentityBackend()
+	local := true
+	b.isLocalEndpoint = func(ep string) bool { return local && ep == "10.0.0.1:1" }
+
+	id, _, err := b.createOrUpdate(lbls, "10.0.0.1:1")
+	c.Assert(err, IsNil)
+	_, _, err = b.createOrUpdate(lbls, "10.0.0.2:1")
+	c.Assert(err, IsNil)
+
+	// Recent associations are neither refreshed nor expired
+	b.refreshRefs()
+	b.gc()
+	found, err := b.lookup(id.ID)
+	c.Assert(err, IsNil)
+	c.Assert(found.RefCount(), Equals, 2)
+
+	// The association of the local endpoint is refreshed, the one of the
+	// disappeared node expires
+	stale := time.Now().Add(-2 * crdIdentityRefTimeout)
+	setRefTimestamps(c, b, id.ID, stale)
+	b.refreshRefs()
+	b.gc()
+	found, err = b.lookup(id.ID)
+	c.Assert(err, IsNil)
+	c.Assert(found.RefCount(), Equals, 1)
+	c.Assert(found.Endpoints["10.0.0.1:1"].After(stale), Equals, true)
+
+	// Once the local endpoint is gone the identity is garbage collected
+	local = false
+	setRefTimestamps(c, b, id.ID, stale)
+	b.refreshRefs()
+	b.gc()
+	_, err = b.client.Get(id.ID.StringID(), metav1.GetOptions{})
+	c.Assert(errors.IsNotFound(err), Equals, true)
+}
+
+func (s *CRDIdentitySuite) TestDeletedIdentity(c *C) {
+	b := newTestCRDIdentityBackend()
+
+	// Another agent is about to garbage collect the identity
+	deleted, err := b.client.Create(&cilium_v2.CiliumIdentity{
+		ObjectMeta:     metav1.ObjectMeta{Name: policy.MinimalNumericIdentity.StringID()},
+		SecurityLabels: crdSecurityLabels(lbls),
+		Status:         cilium_v2.CiliumIdentityStatus{Deleted: true},
+	})
+	c.Assert(err, IsNil)
+	c.Assert(b.store.Add(deleted), IsNil)
+
+	// A deleted identity is never associated with an endpoint again
+	id, isNew, err := b.createOrUpdate(lbls, "10.0.0.1:1")
+	c.Assert(err, IsNil)
+	c.Assert(isNew, Equals, true)
+	c.Assert(id.ID, Equals, policy.MinimalNumericIdentity+1)
+
+	obj, err := b.client.Get(deleted.Name, metav1.GetOptions{})
+	c.Assert(err, IsNil)
+	c.Assert(len(obj.Status.Endpoints), Equals, 0)
+
+	// The garbage collector finishes the deletion
+	b.gc()
+	_, err = b.client.Get(deleted.Name, metav1.GetOptions{})
+	c.Assert(errors.IsNotFound(err), Equals, true)
+	_, err = b.client.Get(id.ID.StringID(), metav1.GetOptions{})
+	c.Assert(err, IsNil)
+}
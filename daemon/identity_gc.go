@@ -0,0 +1,399 @@
+// Copyright 2018 Authors of Cilium
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/cilium/cilium/api/v1/models"
+	"github.com/cilium/cilium/common"
+	"github.com/cilium/cilium/pkg/kvstore"
+	"github.com/cilium/cilium/pkg/lock"
+	"github.com/cilium/cilium/pkg/logfields"
+	"github.com/cilium/cilium/pkg/metrics"
+	"github.com/cilium/cilium/pkg/node"
+	"github.com/cilium/cilium/pkg/policy"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	// identityRefsMU protects identityRefs
+	identityRefsMU lock.Mutex
+
+	// identityRefs is the set of SHA256 sums of the identities referenced
+	// by the local node in the kvstore
+	identityRefs = map[string]struct{}{}
+)
+
+// identityRefKey returns the kvstore key of the reference of the local node
+// to the identity of the labels with the given SHA256 sum
+func identityRefKey(sha256sum string) string {
+	return path.Join(common.LabelRefsKeyPath, sha256sum, node.GetName())
+}
+
+// identityRefValue returns the value of the references of the local node. It
+// is the IPv4 address prefixing the cluster wide IDs of the endpoints of the
+// node so that the endpoints of an identity can be mapped to the referencing
+// nodes.
+func identityRefValue() []byte {
+	return []byte(node.GetExternalIPv4().String())
+}
+
+// acquireIdentityRef references the identity of the labels with the given
+// SHA256 sum from the local node. The reference is attached to the kvstore
+// lease of the agent and is thus released automatically when the node stops
+// renewing it. Must be called with the kvstore lock of the identity held.
+func acquireIdentityRef(sha256sum string) error {
+	identityRefsMU.Lock()
+	defer identityRefsMU.Unlock()
+
+	if _, ok := identityRefs[sha256sum]; ok {
+		return nil
+	}
+
+	// The reference of a previous incarnation of this node is still
+	// attached to the old kvstore lease, take it over by re-creating it.
+	key := identityRefKey(sha256sum)
+	kvstore.Delete(key)
+
+	if err := kvstore.CreateOnly(key, identityRefValue(), true); err != nil {
+		return err
+	}
+
+	identityRefs[sha256sum] = struct{}{}
+	return nil
+}
+
+// releaseIdentityRef removes the reference of the local node to the identity
+// of the labels with the given SHA256 sum. Must be called with the kvstore lock
+// of the identity held.
+func releaseIdentityRef(sha256sum string) error {
+	identityRefsMU.Lock()
+	defer identityRefsMU.Unlock()
+
+	if _, ok := identityRefs[sha256sum]; !ok {
+		return nil
+	}
+
+	if err := kvstore.Delete(identityRefKey(sha256sum)); err != nil {
+		return err
+	}
+
+	delete(identityRefs, sha256sum)
+	return nil
+}
+
+// refreshIdentityRefs re-creates all references of the local node to
+// identities. Used to attach the references to a new kvstore lease after the
+// previous lease has been lost.
+func refreshIdentityRefs() {
+	identityRefsMU.Lock()
+	refs := make([]string, 0, len(identityRefs))
+	for sha256sum := range identityRefs {
+		refs = append(refs, sha256sum)
+	}
+	identityRefsMU.Unlock()
+
+	for _, sha256sum := range refs {
+		kvstore.QueueSet(identityRefKey(sha256sum), identityRefValue(), true)
+	}
+}
+
+// hasLocalEndpoints returns true if any endpoint of the local node is
+// associated with the identity
+func hasLocalEndpoints(id *policy.Identity) bool {
+	prefix := node.GetExternalIPv4().String() + ":"
+	for ep := range id.Endpoints {
+		if strings.HasPrefix(ep, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// identityGC removes identities from the kvstore which are no longer
+// referenced by any node
+type identityGC struct {
+	mutex  lock.Mutex
+	status models.IdentityGCStatus
+
+	// candidates is the set of SHA256 sums of identities found without
+	// any reference in the previous run. An identity is only reclaimed if
+	// it has not been referenced in two consecutive runs to give nodes
+	// which have not created their references yet, e.g. while restoring
+	// endpoints, a chance to do so.
+	candidates map[string]struct{}
+}
+
+// EnableIdentityGC starts the identity garbage collector which runs every
+// interval. All nodes run the garbage collector but only one node at a time
+// is collecting as the collector holds common.LabelGCLockPath in the kvstore.
+func (d *Daemon) EnableIdentityGC(interval time.Duration) {
+	gc := &identityGC{candidates: map[string]struct{}{}}
+	d.identityGC = gc
+
+	go func() {
+		for {
+			time.Sleep(interval)
+
+			if err := gc.run(); err != nil {
+				metrics.IdentityGCFailures.Add(1)
+				log.WithError(err).Warning("Unable to garbage collect identities")
+			}
+		}
+	}()
+}
+
+// getStatus returns the status of the garbage collector
+func (gc *identityGC) getStatus() *models.IdentityGCStatus {
+	gc.mutex.Lock()
+	status := gc.status
+	gc.mutex.Unlock()
+	return &status
+}
+
+// run performs a single garbage collection run
+func (gc *identityGC) run() error {
+	gcLock, err := kvstore.LockPath(common.LabelGCLockPath)
+	if err != nil {
+		return err
+	}
+	defer gcLock.Unlock()
+
+	identities, err := kvstore.ListPrefix(common.LabelsKeyPath)
+	if err != nil {
+		return err
+	}
+
+	refs, err := kvstore.ListPrefix(common.LabelRefsKeyPath)
+	if err != nil {
+		return err
+	}
+
+	gc.collect(identities, refs, reclaimIdentity, markRefTracked)
+	return nil
+}
+
+// isRefTracked returns true if the identity stored as value is referenced by
+// all nodes using it. Identities used by agents which do not reference
+// identities must never be garbage collected.
+func isRefTracked(value []byte) bool {
+	var id policy.Identity
+	if err := json.Unmarshal(value, &id); err != nil {
+		return false
+	}
+	return id.RefTracked
+}
+
+// refNodes returns the addresses of the nodes referencing each identity in
+// refs, keyed by the SHA256 sum of the identity labels
+func refNodes(refs kvstore.KeyValuePairs) map[string]map[string]struct{} {
+	nodes := map[string]map[string]struct{}{}
+	for key, value := range refs {
+		sha256sum := strings.SplitN(strings.TrimPrefix(key, common.LabelRefsKeyPath+"/"), "/", 2)[0]
+		if nodes[sha256sum] == nil {
+			nodes[sha256sum] = map[string]struct{}{}
+		}
+		nodes[sha256sum][string(value)] = struct{}{}
+	}
+	return nodes
+}
+
+// isReferencedByAllNodes returns true if every endpoint associated with the
+// identity stored as value belongs to one of the referencing nodes. An
+// identity used by an agent which does not reference identities is never
+// referenced by all nodes.
+func isReferencedByAllNodes(value []byte, nodes map[string]struct{}) bool {
+	var id policy.Identity
+	if err := json.Unmarshal(value, &id); err != nil {
+		return false
+	}
+
+	for ep := range id.Endpoints {
+		i := strings.LastIndex(ep, ":")
+		if i < 0 {
+			return false
+		}
+		if _, ok := nodes[ep[:i]]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// collect reclaims the identities not referenced by any node in refs for two
+// consecutive runs with reclaim and returns the number of reclaimed
+// identities. Identities which are not tracked yet are marked as tracked with
+// track once all nodes using them reference them.
+func (gc *identityGC) collect(identities, refs kvstore.KeyValuePairs, reclaim, track func(sha256sum string) (bool, error)) int {
+	referenced := refNodes(refs)
+
+	gc.mutex.Lock()
+	defer gc.mutex.Unlock()
+
+	reclaimed := 0
+	tracked := 0
+	candidates := map[string]struct{}{}
+	for key, value := range identities {
+		sha256sum := path.Base(key)
+		nodes, ok := referenced[sha256sum]
+		if !isRefTracked(value) {
+			// Identities are only tracked in this run, collected
+			// after two more runs at the earliest
+			if isReferencedByAllNodes(value, nodes) {
+				if ok, err := track(sha256sum); err != nil {
+					log.WithError(err).WithField("labelsSHA256", sha256sum).Warning("Unable to mark identity as tracked")
+				} else if ok {
+					tracked++
+				}
+			}
+			continue
+		}
+		if ok {
+			continue
+		}
+
+		if _, ok := gc.candidates[sha256sum]; !ok {
+			candidates[sha256sum] = struct{}{}
+			continue
+		}
+
+		if ok, err := reclaim(sha256sum); err != nil {
+			log.WithError(err).WithField("labelsSHA256", sha256sum).Warning("Unable to reclaim identity")
+			candidates[sha256sum] = struct{}{}
+		} else if ok {
+			reclaimed++
+		}
+	}
+
+	gc.candidates = candidates
+	gc.status.Runs++
+	gc.status.LastReclaimed = int64(reclaimed)
+	gc.status.Reclaimed += int64(reclaimed)
+
+	metrics.IdentityGCRuns.Add(1)
+	metrics.IdentitiesReclaimed.Add(int64(reclaimed))
+	metrics.IdentitiesRefTracked.Add(int64(tracked))
+
+	log.WithFields(log.Fields{
+		"reclaimed":  reclaimed,
+		"tracked":    tracked,
+		"candidates": len(candidates),
+	}).Debug("Identity garbage collection completed")
+
+	return reclaimed
+}
+
+// reclaimIdentity removes the identity of the labels with the given SHA256
+// sum from the kvstore if it is still not referenced by any node. Returns true
+// if the identity has been removed.
+func reclaimIdentity(sha256sum string) (bool, error) {
+	lblPath := path.Join(common.LabelsKeyPath, sha256sum)
+
+	// Lock the identity to serialize with createOrUpdate
+	lockKey, err := kvstore.LockPath(lblPath)
+	if err != nil {
+		return false, err
+	}
+	defer lockKey.Unlock()
+
+	refs, err := kvstore.ListPrefix(path.Join(common.LabelRefsKeyPath, sha256sum) + "/")
+	if err != nil {
+		return false, err
+	}
+	if len(refs) > 0 {
+		return false, nil
+	}
+
+	rmsg, err := kvstore.Client().GetValue(lblPath)
+	if err != nil || rmsg == nil {
+		return false, err
+	}
+
+	var id policy.Identity
+	if err := json.Unmarshal(rmsg, &id); err != nil {
+		return false, err
+	}
+
+	// The identity may have been taken over by an agent which does not
+	// reference identities in the meantime
+	if !id.RefTracked {
+		return false, nil
+	}
+
+	if err := kvstore.Delete(path.Join(common.LabelIDKeyPath, id.StringID())); err != nil {
+		return false, err
+	}
+
+	if err := kvstore.Delete(lblPath); err != nil {
+		return false, err
+	}
+
+	log.WithFields(log.Fields{
+		logfields.Identity:       id.StringID(),
+		logfields.IdentityLabels: id.Labels.String(),
+	}).Info("Reclaimed identity without references")
+
+	return true, nil
+}
+
+// markRefTracked marks the identity of the labels with the given SHA256 sum as
+// tracked if all endpoints associated with it still belong to nodes
+// referencing it. Returns true if the identity has been marked.
+func markRefTracked(sha256sum string) (bool, error) {
+	lblPath := path.Join(common.LabelsKeyPath, sha256sum)
+
+	// Lock the identity to serialize with createOrUpdate of all agents
+	lockKey, err := kvstore.LockPath(lblPath)
+	if err != nil {
+		return false, err
+	}
+	defer lockKey.Unlock()
+
+	refs, err := kvstore.ListPrefix(path.Join(common.LabelRefsKeyPath, sha256sum) + "/")
+	if err != nil {
+		return false, err
+	}
+
+	rmsg, err := kvstore.Client().GetValue(lblPath)
+	if err != nil || rmsg == nil {
+		return false, err
+	}
+
+	if isRefTracked(rmsg) || !isReferencedByAllNodes(rmsg, refNodes(refs)[sha256sum]) {
+		return false, nil
+	}
+
+	var id policy.Identity
+	if err := json.Unmarshal(rmsg, &id); err != nil {
+		return false, err
+	}
+	id.RefTracked = true
+
+	if err := kvstore.Client().SetValue(lblPath, id); err != nil {
+		return false, err
+	}
+
+	log.WithFields(log.Fields{
+		logfields.Identity:       id.StringID(),
+		logfields.IdentityLabels: id.Labels.String(),
+	}).Info("Marked identity as tracked, all nodes using it reference it")
+
+	return true, nil
+}
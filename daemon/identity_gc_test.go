@@ -0,0 +1,145 @@
+// Copyright 2018 Authors of Cilium
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+
+	"github.com/cilium/cilium/common"
+	"github.com/cilium/cilium/pkg/kvstore"
+	"github.com/cilium/cilium/pkg/policy"
+
+	. "gopkg.in/check.v1"
+)
+
+type IdentityGCSuite struct{}
+
+var _ = Suite(&IdentityGCSuite{})
+
+func identityValue(c *C, refTracked bool) []byte {
+	id := policy.NewIdentity()
+	id.RefTracked = refTracked
+	value, err := json.Marshal(id)
+	c.Assert(err, IsNil)
+	return value
+}
+
+// untrackedIdentityValue returns an identity created by an agent which does
+// not reference identities, associated with the endpoints eps
+func untrackedIdentityValue(c *C, eps ...string) []byte {
+	id := policy.NewIdentity()
+	for _, ep := range eps {
+		id.AssociateEndpoint(ep)
+	}
+	value, err := json.Marshal(id)
+	c.Assert(err, IsNil)
+	return value
+}
+
+func (s *IdentityGCSuite) TestIsRefTracked(c *C) {
+	c.Assert(isRefTracked(identityValue(c, true)), Equals, true)
+	c.Assert(isRefTracked(identityValue(c, false)), Equals, false)
+
+	// Identities written by agents which do not reference identities
+	c.Assert(isRefTracked([]byte(`{"id":256,"labels":{},"containers":{}}`)), Equals, false)
+	c.Assert(isRefTracked([]byte("invalid")), Equals, false)
+}
+
+func (s *IdentityGCSuite) TestCollect(c *C) {
+	identities := kvstore.KeyValuePairs{
+		path.Join(common.LabelsKeyPath, "referenced"):   identityValue(c, true),
+		path.Join(common.LabelsKeyPath, "unreferenced"): identityValue(c, true),
+		path.Join(common.LabelsKeyPath, "untracked"):    untrackedIdentityValue(c, "10.0.0.3:1"),
+		path.Join(common.LabelsKeyPath, "failing"):      identityValue(c, true),
+	}
+	refs := kvstore.KeyValuePairs{
+		path.Join(common.LabelRefsKeyPath, "referenced", "node1"): []byte("node1"),
+	}
+
+	reclaimed := map[string]bool{}
+	reclaim := func(sha256sum string) (bool, error) {
+		if sha256sum == "failing" {
+			return false, fmt.Errorf("failed")
+		}
+		reclaimed[sha256sum] = true
+		return true, nil
+	}
+
+	track := func(sha256sum string) (bool, error) {
+		c.Errorf("identity %s unexpectedly tracked", sha256sum)
+		return false, nil
+	}
+
+	gc := &identityGC{candidates: map[string]struct{}{}}
+
+	// Unreferenced identities are only candidates in the first run
+	c.Assert(gc.collect(identities, refs, reclaim, track), Equals, 0)
+	c.Assert(gc.candidates, DeepEquals, map[string]struct{}{
+		"unreferenced": {},
+		"failing":      {},
+	})
+
+	// Identities which are referenced again are no longer candidates
+	refs[path.Join(common.LabelRefsKeyPath, "failing", "node2")] = []byte("node2")
+	c.Assert(gc.collect(identities, refs, reclaim, track), Equals, 1)
+	c.Assert(reclaimed, DeepEquals, map[string]bool{"unreferenced": true})
+	delete(identities, path.Join(common.LabelsKeyPath, "unreferenced"))
+
+	// Failures to reclaim an identity are retried in the next run
+	delete(refs, path.Join(common.LabelRefsKeyPath, "failing", "node2"))
+	c.Assert(gc.collect(identities, refs, reclaim, track), Equals, 0)
+	c.Assert(gc.collect(identities, refs, reclaim, track), Equals, 0)
+	c.Assert(gc.candidates, DeepEquals, map[string]struct{}{"failing": {}})
+
+	status := gc.getStatus()
+	c.Assert(status.Runs, Equals, int64(4))
+	c.Assert(status.Reclaimed, Equals, int64(1))
+	c.Assert(status.LastReclaimed, Equals, int64(0))
+}
+
+func (s *IdentityGCSuite) TestTrackUntracked(c *C) {
+	identities := kvstore.KeyValuePairs{
+		path.Join(common.LabelsKeyPath, "upgraded"): untrackedIdentityValue(c, "10.0.0.1:1", "10.0.0.2:1"),
+		path.Join(common.LabelsKeyPath, "unused"):   untrackedIdentityValue(c),
+	}
+	refs := kvstore.KeyValuePairs{
+		path.Join(common.LabelRefsKeyPath, "upgraded", "node1"): []byte("10.0.0.1"),
+	}
+
+	tracked := map[string]bool{}
+	track := func(sha256sum string) (bool, error) {
+		tracked[sha256sum] = true
+		return true, nil
+	}
+	reclaim := func(sha256sum string) (bool, error) {
+		c.Errorf("identity %s unexpectedly reclaimed", sha256sum)
+		return false, nil
+	}
+
+	gc := &identityGC{candidates: map[string]struct{}{}}
+
+	// The identity is still used on a node which does not reference it
+	c.Assert(gc.collect(identities, refs, reclaim, track), Equals, 0)
+	c.Assert(tracked, DeepEquals, map[string]bool{"unused": true})
+	c.Assert(gc.candidates, HasLen, 0)
+
+	// Once all nodes using it reference it, it is tracked
+	refs[path.Join(common.LabelRefsKeyPath, "upgraded", "node2")] = []byte("10.0.0.2")
+	c.Assert(gc.collect(identities, refs, reclaim, track), Equals, 0)
+	c.Assert(tracked, DeepEquals, map[string]bool{"unused": true, "upgraded": true})
+	c.Assert(gc.candidates, HasLen, 0)
+}
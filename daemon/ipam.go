@@ -15,15 +15,24 @@
 package main
 
 import (
+	"fmt"
+	"net"
 	"strings"
+	"time"
 
 	"github.com/cilium/cilium/api/v1/models"
 	ipamapi "github.com/cilium/cilium/api/v1/server/restapi/ipam"
 	"github.com/cilium/cilium/pkg/apierror"
+	"github.com/cilium/cilium/pkg/endpoint"
 	"github.com/cilium/cilium/pkg/ipam"
+	"github.com/cilium/cilium/pkg/k8s"
+	"github.com/cilium/cilium/pkg/logfields"
+	"github.com/cilium/cilium/pkg/node"
 
 	"github.com/go-openapi/runtime/middleware"
 	"github.com/go-openapi/swag"
+	log "github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 type postIPAM struct {
@@ -42,7 +51,12 @@ func (h *postIPAM) Handle(params ipamapi.PostIPAMParams) middleware.Responder {
 		Endpoint:       &models.EndpointAddressing{},
 	}
 
-	ipv4, ipv6, err := ipam.AllocateNext(strings.ToLower(swag.StringValue(params.Family)))
+	pool := swag.StringValue(params.Pool)
+	if pool == "" {
+		pool = ipamPoolForOwner(swag.StringValue(params.Owner))
+	}
+
+	ipv4, ipv6, err := ipam.AllocateNext(strings.ToLower(swag.StringValue(params.Family)), pool, swag.StringValue(params.Owner))
 	if err != nil {
 		return apierror.Error(ipamapi.PostIPAMFailureCode, err)
 	}
@@ -58,6 +72,39 @@ func (h *postIPAM) Handle(params ipamapi.PostIPAMParams) middleware.Responder {
 	return ipamapi.NewPostIPAMCreated().WithPayload(resp)
 }
 
+// ipamPoolForOwner returns the IP pool selected by the annotation of the pod
+// or, if the pod is not annotated, of the namespace of owner, given in the
+// form namespace/pod. An empty string is returned if no pool is selected or
+// if owner is not a pod, e.g. a container.
+func ipamPoolForOwner(owner string) string {
+	i := strings.Index(owner, "/")
+	if i < 0 || !k8s.IsEnabled() {
+		return ""
+	}
+
+	namespace, podName := owner[:i], owner[i+1:]
+
+	scopedLog := log.WithFields(log.Fields{
+		logfields.K8sNamespace: namespace,
+		logfields.K8sPodName:   podName,
+	})
+
+	pod, err := k8s.Client().CoreV1().Pods(namespace).Get(podName, metav1.GetOptions{})
+	if err != nil {
+		scopedLog.WithError(err).Warning("Unable to retrieve pod to select IP pool")
+	} else if pool, ok := pod.GetAnnotations()[k8s.AnnotationIPAMPool]; ok {
+		return pool
+	}
+
+	ns, err := k8s.Client().CoreV1().Namespaces().Get(namespace, metav1.GetOptions{})
+	if err != nil {
+		scopedLog.WithError(err).Warning("Unable to retrieve namespace to select IP pool")
+		return ""
+	}
+
+	return ns.GetAnnotations()[k8s.AnnotationIPAMPool]
+}
+
 type postIPAMIP struct{}
 
 // NewPostIPAMIPHandler creates a new postIPAM from the daemon.
@@ -67,7 +114,7 @@ func NewPostIPAMIPHandler(d *Daemon) ipamapi.PostIPAMIPHandler {
 
 // Handle incoming requests address allocation requests for the daemon.
 func (h *postIPAMIP) Handle(params ipamapi.PostIPAMIPParams) middleware.Responder {
-	if err := ipam.AllocateIPString(params.IP); err != nil {
+	if err := ipam.AllocateIPString(params.IP, ""); err != nil {
 		return apierror.Error(ipamapi.PostIPAMIPFailureCode, err)
 	}
 
@@ -89,12 +136,109 @@ func (h *deleteIPAMIP) Handle(params ipamapi.DeleteIPAMIPParams) middleware.Resp
 	return ipamapi.NewDeleteIPAMIPOK()
 }
 
+type getIPAM struct {
+	daemon *Daemon
+}
+
+// NewGetIPAMHandler returns a handler reporting the IPAM status.
+func NewGetIPAMHandler(d *Daemon) ipamapi.GetIPAMHandler {
+	return &getIPAM{daemon: d}
+}
+
+func (h *getIPAM) Handle(params ipamapi.GetIPAMParams) middleware.Responder {
+	status := h.daemon.DumpIPAM()
+	status.ClusterPool = ipam.ClusterPoolStatus(true)
+	status.Pools = ipam.PoolStatus()
+	return ipamapi.NewGetIPAMOK().WithPayload(status)
+}
+
 // DumpIPAM dumps in the form of a map, and only if debug is enabled, the list of
 // reserved IPv4 and IPv6 addresses.
 func (d *Daemon) DumpIPAM() *models.IPAMStatus {
 	allocv4, allocv6 := ipam.Dump()
 	return &models.IPAMStatus{
-		IPV4: allocv4,
-		IPV6: allocv6,
+		Mode:        ipam.GetMode(),
+		IPV4:        allocv4,
+		IPV6:        allocv6,
+		ClusterPool: ipam.ClusterPoolStatus(false),
+	}
+}
+
+// leaseClusterPoolCIDRs leases the per node allocation prefixes out of the
+// cluster wide prefixes configured for the cluster-pool IPAM mode and
+// configures them as node allocation ranges.
+func leaseClusterPoolCIDRs() error {
+	if v4ClusterPoolPrefix != "" {
+		_, clusterCIDR, err := net.ParseCIDR(v4ClusterPoolPrefix)
+		if err != nil {
+			return fmt.Errorf("invalid IPv4 cluster pool prefix %q: %s", v4ClusterPoolPrefix, err)
+		}
+
+		cidr, err := ipam.AllocateNodeCIDR(clusterCIDR, v4ClusterPoolMaskSize, node.GetName())
+		if err != nil {
+			return err
+		}
+
+		node.SetIPv4AllocRange(cidr)
+	}
+
+	if v6ClusterPoolPrefix != "" {
+		_, clusterCIDR, err := net.ParseCIDR(v6ClusterPoolPrefix)
+		if err != nil {
+			return fmt.Errorf("invalid IPv6 cluster pool prefix %q: %s", v6ClusterPoolPrefix, err)
+		}
+
+		cidr, err := ipam.AllocateNodeCIDR(clusterCIDR, node.IPv6NodePrefixLen, node.GetName())
+		if err != nil {
+			return err
+		}
+
+		if err := node.SetIPv6NodeRange(cidr); err != nil {
+			return err
+		}
 	}
+
+	return nil
+}
+
+// ipamOrphanGCInterval is the interval in which IP addresses which have not
+// been claimed by an endpoint are garbage collected
+const ipamOrphanGCInterval = time.Minute
+
+// ipamOwner returns the owner of the IP addresses of an endpoint as recorded
+// in the IPAM journal
+func ipamOwner(ep *endpoint.Endpoint) string {
+	return "endpoint:" + ep.StringID()
+}
+
+// claimEndpointIPs marks the IP addresses of the endpoint as in use so they
+// are not garbage collected as orphans.
+func (d *Daemon) claimEndpointIPs(ep *endpoint.Endpoint) {
+	ips := []net.IP{ep.IPv6.IP()}
+	if !d.conf.IPv4Disabled && ep.IPv4 != nil {
+		ips = append(ips, ep.IPv4.IP())
+	}
+
+	for _, ip := range ips {
+		if err := ipam.ClaimIP(ip, ipamOwner(ep)); err != nil {
+			log.WithError(err).WithFields(log.Fields{
+				logfields.EndpointID: ep.ID,
+				logfields.IPAddr:     ip,
+			}).Debug("Unable to claim IP address of endpoint")
+		}
+	}
+}
+
+// startIPAMOrphanGC starts a goroutine which periodically releases IP
+// addresses which have been allocated but not claimed by an endpoint within
+// the grace period, e.g. because the CNI plugin failed after allocation.
+func startIPAMOrphanGC() {
+	go func() {
+		for {
+			time.Sleep(ipamOrphanGCInterval)
+			if n := ipam.ReleaseOrphans(ipam.OrphanGracePeriod); n > 0 {
+				log.WithField("count", n).Info("Released orphaned IP addresses")
+			}
+		}
+	}()
 }
@@ -0,0 +1,290 @@
+// Copyright 2018 Authors of Cilium
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"strings"
+
+	"github.com/cilium/cilium/pkg/endpoint"
+	"github.com/cilium/cilium/pkg/endpointmanager"
+	"github.com/cilium/cilium/pkg/k8s"
+	cilium_v2 "github.com/cilium/cilium/pkg/k8s/apis/cilium.io/v2"
+	cilium_client_v2 "github.com/cilium/cilium/pkg/k8s/client/clientset/versioned/typed/cilium/v2"
+	"github.com/cilium/cilium/pkg/lock"
+	"github.com/cilium/cilium/pkg/logfields"
+	"github.com/cilium/cilium/pkg/node"
+
+	log "github.com/sirupsen/logrus"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// ciliumEndpointMaxLogs is the maximum number of status log entries
+	// published in a CiliumEndpoint resource
+	ciliumEndpointMaxLogs = 10
+
+	// ciliumEndpointMaxRetries is the number of attempts to update a
+	// CiliumEndpoint resource before giving up
+	ciliumEndpointMaxRetries = 5
+)
+
+var (
+	// ciliumEndpointsMU protects ciliumEndpointsClient and
+	// ciliumEndpointLocks
+	ciliumEndpointsMU lock.Mutex
+
+	// ciliumEndpointsClient is the client used to publish CiliumEndpoint
+	// resources. It is nil if the resources are not available.
+	ciliumEndpointsClient cilium_client_v2.CiliumEndpointsGetter
+
+	// ciliumEndpointLocks serializes all changes to the CiliumEndpoint
+	// resource of a pod, indexed by namespace/name
+	ciliumEndpointLocks = map[string]*lock.Mutex{}
+)
+
+// enableCiliumEndpoints starts publishing the state of all endpoints managed
+// by pods as CiliumEndpoint resources using client
+func (d *Daemon) enableCiliumEndpoints(client cilium_client_v2.CiliumEndpointsGetter) {
+	ciliumEndpointsMU.Lock()
+	ciliumEndpointsClient = client
+	ciliumEndpointsMU.Unlock()
+
+	for _, ep := range endpointmanager.GetEndpoints() {
+		d.UpdateCiliumEndpoint(ep)
+	}
+}
+
+// getCiliumEndpointLock returns the client and the lock serializing changes
+// to the CiliumEndpoint resource of the pod namespace/name. Returns nil if
+// CiliumEndpoint resources are not available.
+func getCiliumEndpointLock(namespace, name string) (cilium_client_v2.CiliumEndpointsGetter, *lock.Mutex) {
+	ciliumEndpointsMU.Lock()
+	defer ciliumEndpointsMU.Unlock()
+
+	if ciliumEndpointsClient == nil {
+		return nil, nil
+	}
+
+	key := namespace + "/" + name
+	l, ok := ciliumEndpointLocks[key]
+	if !ok {
+		l = &lock.Mutex{}
+		ciliumEndpointLocks[key] = l
+	}
+
+	return ciliumEndpointsClient, l
+}
+
+// splitPodName returns the namespace and name of the pod of an endpoint
+// PodName in the format namespace:pod-name
+func splitPodName(podName string) (string, string, bool) {
+	split := strings.Split(podName, ":")
+	if len(split) < 2 || split[0] == "" || split[1] == "" {
+		return "", "", false
+	}
+	return split[0], split[1], true
+}
+
+// getCiliumEndpointStatus returns the status of e as published in its
+// CiliumEndpoint resource. e.Mutex must be RLocked.
+func getCiliumEndpointStatus(e *endpoint.Endpoint) cilium_v2.EndpointStatus {
+	model := e.GetModelRLocked()
+
+	status := cilium_v2.EndpointStatus{
+		ID:             model.ID,
+		Node:           node.GetName(),
+		PolicyRevision: model.PolicyRevision,
+		State:          string(model.State),
+		Health:         e.Status.CurrentStatus().String(),
+	}
+
+	if model.PolicyEnabled != nil {
+		status.PolicyEnabled = *model.PolicyEnabled
+	}
+
+	if model.Identity != nil {
+		status.Identity = model.Identity.ID
+		status.IdentityLabels = model.Identity.Labels
+	}
+
+	if model.Addressing != nil {
+		status.IPv4 = model.Addressing.IPV4
+		status.IPv6 = model.Addressing.IPV6
+	}
+
+	for _, change := range e.Status.GetModel() {
+		if len(status.Log) == ciliumEndpointMaxLogs {
+			break
+		}
+		status.Log = append(status.Log, cilium_v2.EndpointStatusChange{
+			Timestamp: change.Timestamp,
+			Code:      change.Code,
+			Message:   change.Message,
+			State:     string(change.State),
+		})
+	}
+
+	return status
+}
+
+// UpdateCiliumEndpoint mirrors the state of endpoint e into the
+// CiliumEndpoint resource named after its pod. The resource is created if it
+// does not exist yet. Endpoints not managed by a pod are ignored.
+func (d *Daemon) UpdateCiliumEndpoint(e *endpoint.Endpoint) {
+	if !k8s.IsEnabled() {
+		return
+	}
+
+	e.Mutex.RLock()
+	podName := e.PodName
+	e.Mutex.RUnlock()
+
+	namespace, name, ok := splitPodName(podName)
+	if !ok {
+		return
+	}
+
+	client, l := getCiliumEndpointLock(namespace, name)
+	if client == nil {
+		return
+	}
+
+	go func() {
+		l.Lock()
+		defer l.Unlock()
+
+		scopedLog := log.WithFields(log.Fields{
+			logfields.EndpointID:   e.ID,
+			logfields.K8sNamespace: namespace,
+			logfields.K8sPodName:   name,
+		})
+
+		for n := 0; n < ciliumEndpointMaxRetries; n++ {
+			// The status is retrieved while holding the resource
+			// lock so the most recent status is always written last
+			e.Mutex.RLock()
+			state := e.GetStateLocked()
+			status := getCiliumEndpointStatus(e)
+			e.Mutex.RUnlock()
+
+			if state == endpoint.StateDisconnecting || state == endpoint.StateDisconnected {
+				return
+			}
+
+			err := updateCiliumEndpoint(client, getK8sPod, namespace, name, status)
+			if err == nil {
+				scopedLog.Debug("Updated CiliumEndpoint")
+				return
+			}
+
+			if !errors.IsConflict(err) && !errors.IsAlreadyExists(err) {
+				scopedLog.WithError(err).Warning("Unable to update CiliumEndpoint")
+				return
+			}
+		}
+
+		scopedLog.Warning("Unable to update CiliumEndpoint, giving up")
+	}()
+}
+
+// getK8sPod returns the pod namespace/name from the Kubernetes apiserver
+func getK8sPod(namespace, name string) (*v1.Pod, error) {
+	return k8s.Client().CoreV1().Pods(namespace).Get(name, meta_v1.GetOptions{})
+}
+
+// updateCiliumEndpoint writes status into the CiliumEndpoint resource
+// namespace/name. If the resource does not exist yet, it is created and owned
+// by the pod of the same name, as returned by getPod, so it is removed
+// together with the pod if the agent is not able to remove it.
+func updateCiliumEndpoint(getter cilium_client_v2.CiliumEndpointsGetter, getPod func(namespace, name string) (*v1.Pod, error),
+	namespace, name string, status cilium_v2.EndpointStatus) error {
+	client := getter.CiliumEndpoints(namespace)
+
+	cep, err := client.Get(name, meta_v1.GetOptions{})
+	if err == nil {
+		cep.Status = status
+		_, err = client.Update(cep)
+		return err
+	}
+
+	if !errors.IsNotFound(err) {
+		return err
+	}
+
+	cep = &cilium_v2.CiliumEndpoint{
+		ObjectMeta: meta_v1.ObjectMeta{
+			Name: name,
+		},
+		Status: status,
+	}
+
+	if pod, err := getPod(namespace, name); err == nil {
+		cep.OwnerReferences = []meta_v1.OwnerReference{{
+			APIVersion: "v1",
+			Kind:       "Pod",
+			Name:       pod.Name,
+			UID:        pod.UID,
+		}}
+	}
+
+	_, err = client.Create(cep)
+	return err
+}
+
+// deleteCiliumEndpoint deletes the CiliumEndpoint resource of the pod
+// podName in the format namespace:pod-name
+func (d *Daemon) deleteCiliumEndpoint(podName string) {
+	if !k8s.IsEnabled() {
+		return
+	}
+
+	namespace, name, ok := splitPodName(podName)
+	if !ok {
+		return
+	}
+
+	client, l := getCiliumEndpointLock(namespace, name)
+	if client == nil {
+		return
+	}
+
+	go func() {
+		l.Lock()
+		defer l.Unlock()
+
+		if err := deleteCiliumEndpointResource(client, namespace, name); err != nil {
+			log.WithError(err).WithFields(log.Fields{
+				logfields.K8sNamespace: namespace,
+				logfields.K8sPodName:   name,
+			}).Warning("Unable to delete CiliumEndpoint")
+		}
+
+		ciliumEndpointsMU.Lock()
+		delete(ciliumEndpointLocks, namespace+"/"+name)
+		ciliumEndpointsMU.Unlock()
+	}()
+}
+
+// deleteCiliumEndpointResource deletes the CiliumEndpoint resource
+// namespace/name. A resource which does not exist is not an error.
+func deleteCiliumEndpointResource(getter cilium_client_v2.CiliumEndpointsGetter, namespace, name string) error {
+	err := getter.CiliumEndpoints(namespace).Delete(name, &meta_v1.DeleteOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
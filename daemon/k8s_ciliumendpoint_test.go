@@ -0,0 +1,121 @@
+// Copyright 2018 Authors of Cilium
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+
+	cilium_v2 "github.com/cilium/cilium/pkg/k8s/apis/cilium.io/v2"
+	"github.com/cilium/cilium/pkg/k8s/client/clientset/versioned/fake"
+
+	. "gopkg.in/check.v1"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+type CiliumEndpointSuite struct{}
+
+var _ = Suite(&CiliumEndpointSuite{})
+
+func noPod(namespace, name string) (*v1.Pod, error) {
+	return nil, errors.NewNotFound(schema.GroupResource{Resource: "pods"}, name)
+}
+
+func (s *CiliumEndpointSuite) TestSplitPodName(c *C) {
+	namespace, name, ok := splitPodName("default:app1")
+	c.Assert(ok, Equals, true)
+	c.Assert(namespace, Equals, "default")
+	c.Assert(name, Equals, "app1")
+
+	for _, podName := range []string{"", "app1", ":app1", "default:"} {
+		_, _, ok = splitPodName(podName)
+		c.Assert(ok, Equals, false, Commentf("%q", podName))
+	}
+}
+
+func (s *CiliumEndpointSuite) TestUpdateCiliumEndpoint(c *C) {
+	client := fake.NewSimpleClientset().CiliumV2()
+
+	getPod := func(namespace, name string) (*v1.Pod, error) {
+		return &v1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name, UID: types.UID("1234")}}, nil
+	}
+
+	// Created with an owner reference to the pod
+	err := updateCiliumEndpoint(client, getPod, "default", "app1", cilium_v2.EndpointStatus{ID: 1, State: "creating"})
+	c.Assert(err, IsNil)
+
+	cep, err := client.CiliumEndpoints("default").Get("app1", metav1.GetOptions{})
+	c.Assert(err, IsNil)
+	c.Assert(cep.Status.ID, Equals, int64(1))
+	c.Assert(cep.Status.State, Equals, "creating")
+	c.Assert(cep.OwnerReferences, DeepEquals, []metav1.OwnerReference{{
+		APIVersion: "v1",
+		Kind:       "Pod",
+		Name:       "app1",
+		UID:        types.UID("1234"),
+	}})
+
+	// Updated in place, the owner reference is kept
+	err = updateCiliumEndpoint(client, noPod, "default", "app1", cilium_v2.EndpointStatus{ID: 1, State: "ready"})
+	c.Assert(err, IsNil)
+
+	cep, err = client.CiliumEndpoints("default").Get("app1", metav1.GetOptions{})
+	c.Assert(err, IsNil)
+	c.Assert(cep.Status.State, Equals, "ready")
+	c.Assert(cep.OwnerReferences, HasLen, 1)
+
+	// Created without an owner reference if the pod is not found
+	err = updateCiliumEndpoint(client, noPod, "kube-system", "app2", cilium_v2.EndpointStatus{ID: 2})
+	c.Assert(err, IsNil)
+
+	cep, err = client.CiliumEndpoints("kube-system").Get("app2", metav1.GetOptions{})
+	c.Assert(err, IsNil)
+	c.Assert(cep.Status.ID, Equals, int64(2))
+	c.Assert(cep.OwnerReferences, HasLen, 0)
+}
+
+func (s *CiliumEndpointSuite) TestUpdateCiliumEndpointConflict(c *C) {
+	clientset := fake.NewSimpleClientset()
+	client := clientset.CiliumV2()
+
+	c.Assert(updateCiliumEndpoint(client, noPod, "default", "app1", cilium_v2.EndpointStatus{ID: 1}), IsNil)
+
+	// A conflict is returned to the caller to retry with the current
+	// version of the resource
+	clientset.PrependReactor("update", "ciliumendpoints", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.NewConflict(schema.GroupResource{Resource: "ciliumendpoints"}, "app1", fmt.Errorf("conflict"))
+	})
+
+	err := updateCiliumEndpoint(client, noPod, "default", "app1", cilium_v2.EndpointStatus{ID: 1})
+	c.Assert(errors.IsConflict(err), Equals, true)
+}
+
+func (s *CiliumEndpointSuite) TestDeleteCiliumEndpointResource(c *C) {
+	client := fake.NewSimpleClientset().CiliumV2()
+
+	c.Assert(updateCiliumEndpoint(client, noPod, "default", "app1", cilium_v2.EndpointStatus{ID: 1}), IsNil)
+
+	c.Assert(deleteCiliumEndpointResource(client, "default", "app1"), IsNil)
+	_, err := client.CiliumEndpoints("default").Get("app1", metav1.GetOptions{})
+	c.Assert(errors.IsNotFound(err), Equals, true)
+
+	// Deleting a resource which does not exist is not an error
+	c.Assert(deleteCiliumEndpointResource(client, "default", "app1"), IsNil)
+}
@@ -24,6 +24,9 @@ import (
 	"time"
 
 	"github.com/cilium/cilium/common/types"
+	"github.com/cilium/cilium/pkg/endpoint"
+	"github.com/cilium/cilium/pkg/endpointmanager"
+	"github.com/cilium/cilium/pkg/ipam"
 	"github.com/cilium/cilium/pkg/k8s"
 	cilium_api "github.com/cilium/cilium/pkg/k8s/apis/cilium.io"
 	cilium_v1 "github.com/cilium/cilium/pkg/k8s/apis/cilium.io/v1"
@@ -54,6 +57,7 @@ const (
 	k8sAPIGroupCRD               = "CustomResourceDefinition"
 	k8sAPIGroupTPR               = "ThirdPartyResource"
 	k8sAPIGroupNodeV1Core        = "core/v1::Node"
+	k8sAPIGroupNamespaceV1Core   = "core/v1::Namespace"
 	k8sAPIGroupServiceV1Core     = "core/v1::Service"
 	k8sAPIGroupEndpointV1Core    = "core/v1::Endpoint"
 	k8sAPIGroupNetworkingV1Core  = "networking.k8s.io/v1::NetworkPolicy"
@@ -61,6 +65,8 @@ const (
 	k8sAPIGroupIngressV1Beta1    = "extensions/v1beta1::Ingress"
 	k8sAPIGroupCiliumV1          = "cilium/v1::CiliumNetworkPolicy"
 	k8sAPIGroupCiliumV2          = "cilium/v2::CiliumNetworkPolicy"
+	k8sAPIGroupCiliumIdentityV2  = "cilium/v2::CiliumIdentity"
+	k8sAPIGroupCiliumEndpointV2  = "cilium/v2::CiliumEndpoint"
 )
 
 var (
@@ -242,6 +248,11 @@ func (d *Daemon) EnableK8sWatcher(reSyncPeriod time.Duration) error {
 		return fmt.Errorf("Unable to create cilium network policy client: %s", err)
 	}
 
+	if ciliumCLIVersion == cilium_api.V2 {
+		d.k8sAPIGroups.addAPI(k8sAPIGroupCiliumEndpointV2)
+		d.enableCiliumEndpoints(ciliumNPClient.CiliumV2())
+	}
+
 	_, policyControllerDeprecated := cache.NewInformer(
 		cache.NewListWatchFromClient(k8s.Client().ExtensionsV1beta1().RESTClient(),
 			"networkpolicies", v1.NamespaceAll, fields.Everything()),
@@ -372,6 +383,19 @@ func (d *Daemon) EnableK8sWatcher(reSyncPeriod time.Duration) error {
 	go nodesController.Run(wait.NeverStop)
 	d.k8sAPIGroups.addAPI(k8sAPIGroupNodeV1Core)
 
+	_, namespaceController := cache.NewInformer(
+		cache.NewListWatchFromClient(k8s.Client().CoreV1().RESTClient(),
+			"namespaces", v1.NamespaceAll, fields.Everything()),
+		&v1.Namespace{},
+		reSyncPeriod,
+		cache.ResourceEventHandlerFuncs{
+			AddFunc:    d.addK8sNamespaceV1,
+			UpdateFunc: d.updateK8sNamespaceV1,
+		},
+	)
+	go namespaceController.Run(wait.NeverStop)
+	d.k8sAPIGroups.addAPI(k8sAPIGroupNamespaceV1Core)
+
 	return nil
 }
 
@@ -1460,16 +1484,18 @@ func (d *Daemon) addCiliumNetworkPolicyV2(ciliumV2Store cache.Store, obj interfa
 
 	scopedLog.Debug("Adding CiliumNetworkPolicy")
 
+	var rev uint64
 	rules, err := ruleCpy.Parse()
 	if err == nil && len(rules) > 0 {
 		err = k8s.PreprocessRules(rules, d.loadBalancer.K8sEndpoints, d.loadBalancer.K8sServices)
 		if err == nil {
-			_, err = d.PolicyAdd(rules, &AddOptions{Replace: true})
+			rev, err = d.PolicyAdd(rules, &AddOptions{Replace: true})
 		}
 	}
 
 	var cnpns cilium_v2.CiliumNetworkPolicyNodeStatus
 	if err != nil {
+		forgetCNPRevision(ruleCpy)
 		cnpns = cilium_v2.CiliumNetworkPolicyNodeStatus{
 			OK:          false,
 			Error:       fmt.Sprintf("%s", err),
@@ -1477,16 +1503,26 @@ func (d *Daemon) addCiliumNetworkPolicyV2(ciliumV2Store cache.Store, obj interfa
 		}
 		scopedLog.WithError(err).Warn("Unable to add CiliumNetworkPolicy")
 	} else {
+		setCNPRevision(ruleCpy, rev)
+		selected, _ := endpointmanager.GetPolicyRealization(rules, rev)
 		cnpns = cilium_v2.CiliumNetworkPolicyNodeStatus{
-			OK:          true,
-			LastUpdated: cilium_v2.NewTimestamp(),
+			OK:                true,
+			Revision:          rev,
+			SelectedEndpoints: selected,
+			LastUpdated:       cilium_v2.NewTimestamp(),
 		}
-		scopedLog.Info("Imported CiliumNetworkPolicy")
+		scopedLog.WithField("policyRevision", rev).Info("Imported CiliumNetworkPolicy")
 	}
 
 	go func() {
 		k8s.UpdateCNPStatusV2(ciliumNPClient.CiliumV2(), ciliumV2Store,
 			k8s.BackOffLoopTimeout, node.GetName(), ruleCpy, cnpns)
+
+		// Once the policy has been imported, report when all selected
+		// endpoints have been regenerated and enforce it
+		if err == nil {
+			d.waitForCNPEnforcement(ciliumV2Store, ruleCpy, rules, rev)
+		}
 	}()
 }
 
@@ -1507,6 +1543,8 @@ func (d *Daemon) deleteCiliumNetworkPolicyV2(obj interface{}) {
 
 	scopedLog.Debug("Deleting CiliumNetworkPolicy")
 
+	forgetCNPRevision(ruleCpy)
+
 	rules, err := ruleCpy.Parse()
 	if err == nil {
 		if len(rules) > 0 {
@@ -1665,8 +1703,110 @@ func (d *Daemon) deleteK8sNodeV1(obj interface{}) {
 
 	node.DeleteNode(ni, node.TunnelRoute|node.DirectRoute)
 
+	if ipam.GetMode() == ipam.ModeClusterPool {
+		ipam.ReleaseNodeCIDRs(ni.Name)
+	}
+
 	log.WithFields(log.Fields{
 		logfields.K8sNodeID:     ni,
 		logfields.K8sAPIVersion: k8sNode.TypeMeta.APIVersion,
 	}).Debug("Removed node")
 }
+
+func (d *Daemon) addK8sNamespaceV1(obj interface{}) {
+	ns, ok := obj.(*v1.Namespace)
+	if !ok {
+		log.WithField(logfields.Object, logfields.Repr(obj)).
+			Warn("Ignoring invalid k8s v1.Namespace addition")
+		return
+	}
+
+	d.syncK8sNamespaceLabels(ns)
+}
+
+func (d *Daemon) updateK8sNamespaceV1(oldObj interface{}, newObj interface{}) {
+	_, ok := oldObj.(*v1.Namespace)
+	if !ok {
+		log.WithField(logfields.Object+".old", logfields.Repr(oldObj)).
+			Warn("Ignoring invalid k8s v1.Namespace modification")
+		return
+	}
+	newNS, ok := newObj.(*v1.Namespace)
+	if !ok {
+		log.WithField(logfields.Object+".new", logfields.Repr(newObj)).
+			Warn("Ignoring invalid k8s v1.Namespace modification")
+		return
+	}
+
+	// Resyncs are not skipped, the labels of the namespace may not have
+	// been available when the endpoints were created.
+	d.syncK8sNamespaceLabels(newNS)
+}
+
+// syncK8sNamespaceLabels updates the identity of all endpoints in the
+// namespace ns whose labels derived from the namespace differ from the
+// current labels of the namespace.
+func (d *Daemon) syncK8sNamespaceLabels(ns *v1.Namespace) {
+	scopedLog := log.WithField(logfields.K8sNamespace, ns.ObjectMeta.Name)
+
+	nsLabels := labels.Map2Labels(k8s.GetNamespaceMetaLabels(ns.GetLabels()), labels.LabelSourceK8s)
+	nsLabels, _ = labels.FilterLabels(nsLabels)
+	prefix := ns.ObjectMeta.Name + ":"
+
+	for _, ep := range endpointmanager.GetEndpoints() {
+		ep.Mutex.RLock()
+		if !strings.HasPrefix(ep.PodName, prefix) {
+			ep.Mutex.RUnlock()
+			continue
+		}
+
+		identityLabels, changed := replaceNamespaceLabels(ep.OpLabels.OrchestrationIdentity, ep.OpLabels.Disabled, nsLabels)
+		if !changed {
+			ep.Mutex.RUnlock()
+			continue
+		}
+		infoLabels := ep.OpLabels.OrchestrationInfo.DeepCopy()
+		ep.Mutex.RUnlock()
+
+		scopedLog.WithFields(log.Fields{
+			logfields.EndpointID: ep.StringID(),
+			logfields.Labels:     logfields.Repr(ns.GetLabels()),
+		}).Debug("Namespace labels changed, updating identity of endpoint")
+
+		go func(ep *endpoint.Endpoint) {
+			if err := d.EndpointLabelsUpdate(ep, identityLabels, infoLabels); err != nil {
+				scopedLog.WithError(err).WithField(logfields.EndpointID, ep.StringID()).
+					Warn("Unable to update identity of endpoint after namespace labels changed")
+			}
+		}(ep)
+	}
+}
+
+// replaceNamespaceLabels returns the identity labels of an endpoint with the
+// labels derived from its namespace replaced by nsLabels. Disabled labels are
+// passed on to keep them disabled. Returns false if the identity labels
+// already contain exactly nsLabels.
+func replaceNamespaceLabels(identity, disabled, nsLabels labels.Labels) (labels.Labels, bool) {
+	current := labels.Labels{}
+	result := labels.Labels{}
+	for _, l := range []labels.Labels{identity, disabled} {
+		for k, v := range l {
+			if v.Source == labels.LabelSourceK8s && k8s.IsNamespaceMetaLabel(v.Key) {
+				continue
+			}
+			result[k] = v.DeepCopy()
+		}
+	}
+	// A disabled namespace label is still part of the current labels,
+	// otherwise it would be reported as changed on every update.
+	for _, l := range []labels.Labels{identity, disabled} {
+		for k, v := range l {
+			if v.Source == labels.LabelSourceK8s && k8s.IsNamespaceMetaLabel(v.Key) {
+				current[k] = v
+			}
+		}
+	}
+
+	result.MergeLabels(nsLabels)
+	return result, current.SHA256Sum() != nsLabels.SHA256Sum()
+}
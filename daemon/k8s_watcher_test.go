@@ -17,9 +17,16 @@ package main
 import (
 	"time"
 
+	"github.com/cilium/cilium/pkg/k8s"
+	"github.com/cilium/cilium/pkg/labels"
+
 	. "gopkg.in/check.v1"
 )
 
+type K8sWatcherSuite struct{}
+
+var _ = Suite(&K8sWatcherSuite{})
+
 func (ds *DaemonSuite) TestK8sErrorLogTimeout(c *C) {
 	errstr := "I am an error string"
 
@@ -40,3 +47,43 @@ func (ds *DaemonSuite) TestK8sErrorLogTimeout(c *C) {
 	shouldLogTime := startTime.Add(k8sErrLogTimeout).Add(time.Nanosecond)
 	c.Assert(k8sErrorUpdateCheckUnmuteTime(errstr, shouldLogTime), Equals, true)
 }
+
+func (s *K8sWatcherSuite) TestReplaceNamespaceLabels(c *C) {
+	nsLabels := func(m map[string]string) labels.Labels {
+		return labels.Map2Labels(k8s.GetNamespaceMetaLabels(m), labels.LabelSourceK8s)
+	}
+
+	identity := labels.Map2Labels(map[string]string{"app": "db"}, labels.LabelSourceK8s)
+	identity.MergeLabels(nsLabels(map[string]string{"team": "payments"}))
+	disabled := labels.Map2Labels(map[string]string{"version": "1"}, labels.LabelSourceK8s)
+
+	// Unchanged namespace labels, e.g. on resync
+	_, changed := replaceNamespaceLabels(identity, disabled, nsLabels(map[string]string{"team": "payments"}))
+	c.Assert(changed, Equals, false)
+
+	// Unchanged namespace labels of which one is disabled
+	disabledNs := nsLabels(map[string]string{"env": "prod"})
+	disabledNs.MergeLabels(disabled)
+	_, changed = replaceNamespaceLabels(identity, disabledNs, nsLabels(map[string]string{"team": "payments", "env": "prod"}))
+	c.Assert(changed, Equals, false)
+
+	// Changed namespace labels replace the old ones, disabled labels are
+	// passed on
+	result, changed := replaceNamespaceLabels(identity, disabled, nsLabels(map[string]string{"team": "billing"}))
+	c.Assert(changed, Equals, true)
+	expected := labels.Map2Labels(map[string]string{"app": "db", "version": "1"}, labels.LabelSourceK8s)
+	expected.MergeLabels(nsLabels(map[string]string{"team": "billing"}))
+	c.Assert(result, DeepEquals, expected)
+
+	// Namespace labels which were not available when the endpoint was
+	// created are added
+	identity = labels.Map2Labels(map[string]string{"app": "db"}, labels.LabelSourceK8s)
+	result, changed = replaceNamespaceLabels(identity, labels.Labels{}, nsLabels(map[string]string{"team": "payments"}))
+	c.Assert(changed, Equals, true)
+	c.Assert(result, HasLen, 2)
+
+	// Removed namespace labels are removed
+	result, changed = replaceNamespaceLabels(expected, labels.Labels{}, labels.Labels{})
+	c.Assert(changed, Equals, true)
+	c.Assert(result, DeepEquals, labels.Map2Labels(map[string]string{"app": "db", "version": "1"}, labels.LabelSourceK8s))
+}
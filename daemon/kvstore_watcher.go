@@ -1,4 +1,4 @@
-// Copyright 2016-2017 Authors of Cilium
+// Copyright 2016-2018 Authors of Cilium
 //
 // Licensed under the Apache License, Version 2.0 (the "License");
 // you may not use this file except in compliance with the License.
@@ -15,9 +15,11 @@
 package main
 
 import (
-	"time"
+	"encoding/json"
+	"path"
 
 	"github.com/cilium/cilium/common"
+	"github.com/cilium/cilium/pkg/endpointmanager"
 	"github.com/cilium/cilium/pkg/kvstore"
 	"github.com/cilium/cilium/pkg/logfields"
 	"github.com/cilium/cilium/pkg/policy"
@@ -25,47 +27,84 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
-// EnableKVStoreWatcher watches for kvstore changes in the common.LastFreeIDKeyPath key.
-// Triggers policy updates every time the value of that key is changed.
-func (d *Daemon) EnableKVStoreWatcher(maxSeconds time.Duration) {
-	if maxID, err := GetMaxLabelID(); err == nil {
-		d.setCachedMaxLabelID(maxID)
+const (
+	// identityWatcherChanSize is the size of the events channel of the
+	// kvstore identity watcher
+	identityWatcherChanSize = 1024
+)
+
+// EnableKVStoreWatcher populates the cluster identity cache with all
+// identities stored in the kvstore and then watches common.LabelIDKeyPath for
+// identities being allocated or released. The policy of the endpoints
+// affected by a changed identity is updated incrementally.
+func (d *Daemon) EnableKVStoreWatcher() {
+	pairs, err := kvstore.ListPrefix(common.LabelIDKeyPath)
+	if err != nil {
+		log.WithError(err).WithField(logfields.Path, common.LabelIDKeyPath).Warning("Unable to list identities")
+	}
+
+	// Endpoints are not restored yet, populate the cache without
+	// triggering policy updates
+	for key, value := range pairs {
+		d.handleIdentityEvent(kvstore.KeyValueEvent{
+			Typ:   kvstore.EventTypeCreate,
+			Key:   key,
+			Value: value,
+		})
 	}
-	ch := kvstore.Client().GetWatcher(common.LastFreeLabelIDKeyPath, maxSeconds)
+
+	w := kvstore.ListAndWatch("identities", common.LabelIDKeyPath, identityWatcherChanSize)
 	go func() {
-		for {
-			select {
-			case updates, updateOk := <-ch:
-				if !updateOk {
-					log.WithField(logfields.Path, common.LastFreeLabelIDKeyPath).Debug("Watcher for path closed, reacquiring it")
-					ch = kvstore.Client().GetWatcher(common.LastFreeLabelIDKeyPath, maxSeconds)
-				}
-				if len(updates) != 0 {
-					d.setCachedMaxLabelID(updates[0])
-				}
-				d.TriggerPolicyUpdates(true)
+		for event := range w.Events {
+			if id := d.handleIdentityEvent(event); id != nil {
+				d.updatePolicyForIdentity(id)
 			}
 		}
 	}()
 }
 
-// GetCachedMaxLabelID returns the cached max label ID from the last event
-// received from the KVStore.
-func (d *Daemon) GetCachedMaxLabelID() (policy.NumericIdentity, error) {
-	d.maxCachedLabelIDMU.RLock()
-	id := d.maxCachedLabelID
-	d.maxCachedLabelIDMU.RUnlock()
-	if id == 0 {
-		// FIXME: KVStore might not set up the watcher at this point
-		// If that's the case, we should ask directly the KVStore
-		// What's the maxLabelID value.
-		return policy.MinimalNumericIdentity, nil
+// handleIdentityEvent applies the kvstore event on the cluster identity cache.
+// Returns the changed identity, or the removed identity, or nil if the cache
+// has not changed.
+func (d *Daemon) handleIdentityEvent(event kvstore.KeyValueEvent) *policy.Identity {
+	scopedLog := log.WithFields(log.Fields{
+		logfields.Path: event.Key,
+		"event":        event.Typ,
+	})
+
+	id, err := policy.ParseNumericIdentity(path.Base(event.Key))
+	if err != nil {
+		scopedLog.WithError(err).Debug("Ignoring kvstore key which is not an identity")
+		return nil
 	}
-	return id, nil
+
+	if event.Typ != kvstore.EventTypeDelete {
+		identity := policy.NewIdentity()
+		if err := json.Unmarshal(event.Value, identity); err != nil {
+			scopedLog.WithError(err).Warning("Unable to unmarshal identity")
+			return nil
+		}
+
+		// Identities without any endpoints are about to be released
+		if len(identity.Endpoints) > 0 {
+			if policy.GetConsumableCache().UpsertIdentity(identity) {
+				scopedLog.WithField(logfields.Identity, id).Debug("Identity added to cache")
+				return identity
+			}
+			return nil
+		}
+	}
+
+	if old := policy.GetConsumableCache().RemoveIdentity(id); old != nil {
+		scopedLog.WithField(logfields.Identity, id).Debug("Identity removed from cache")
+		return old
+	}
+
+	return nil
 }
 
-func (d *Daemon) setCachedMaxLabelID(id policy.NumericIdentity) {
-	d.maxCachedLabelIDMU.Lock()
-	d.maxCachedLabelID = id
-	d.maxCachedLabelIDMU.Unlock()
+// updatePolicyForIdentity incrementally updates the policy of all endpoints
+// affected by the changed or removed identity id.
+func (d *Daemon) updatePolicyForIdentity(id *policy.Identity) {
+	endpointmanager.UpdatePolicyForIdentity(d, id.ID, id.Labels.ToSlice())
 }
@@ -35,6 +35,47 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
+const (
+	// identityAllocModeKVStore allocates identities in the kvstore
+	identityAllocModeKVStore = "kvstore"
+
+	// identityAllocModeCRD allocates identities as CiliumIdentity custom
+	// resources in Kubernetes
+	identityAllocModeCRD = "crd"
+)
+
+// identityBackend is the storage backend in which security identities are
+// allocated
+type identityBackend interface {
+	// createOrUpdate associates the endpoint with the cluster wide ID
+	// clusterEndpointID with the identity of lbls. A new identity is
+	// allocated if none exists yet in which case true is returned.
+	createOrUpdate(lbls labels.Labels, clusterEndpointID string) (*policy.Identity, bool, error)
+
+	// lookup returns the identity with the numeric identity id or nil if
+	// the identity does not exist
+	lookup(id policy.NumericIdentity) (*policy.Identity, error)
+
+	// lookupBySHA256 returns the identity of the labels with the given
+	// SHA256 sum or nil if the identity does not exist
+	lookupBySHA256(sha256sum string) (*policy.Identity, error)
+
+	// list returns all identities which are in use
+	list() ([]*policy.Identity, error)
+
+	// release disassociates the endpoint with the cluster wide ID
+	// clusterEndpointID from the identity of the labels with the given
+	// SHA256 sum
+	release(sha256sum, clusterEndpointID string) error
+}
+
+// identityStore is the backend used to allocate identities. It is replaced
+// with the CRD backend in CRD identity allocation mode.
+var identityStore identityBackend = kvstoreIdentityBackend{}
+
+// kvstoreIdentityBackend allocates identities in the kvstore
+type kvstoreIdentityBackend struct{}
+
 func updateSecLabelIDRef(id policy.Identity) error {
 	key := path.Join(common.LabelIDKeyPath, strconv.FormatUint(uint64(id.ID), 10))
 	return kvstore.Client().SetValue(key, id)
@@ -58,6 +99,10 @@ func (d *Daemon) CreateOrUpdateIdentity(lbls labels.Labels, epid string) (*polic
 		logfields.IdentityLabels: lbls.String(),
 	}).Debug("Associating endpoint with identity")
 
+	return identityStore.createOrUpdate(lbls, clusterEndpointID)
+}
+
+func (kvstoreIdentityBackend) createOrUpdate(lbls labels.Labels, clusterEndpointID string) (*policy.Identity, bool, error) {
 	isNew := false
 
 	// Calculate hash over identity labels and generate path
@@ -94,6 +139,13 @@ func (d *Daemon) CreateOrUpdateIdentity(lbls labels.Labels, epid string) (*polic
 		}
 	}
 
+	// Only identities which have been referenced since their creation
+	// can be garbage collected, an existing identity may be in use by
+	// agents which do not reference identities
+	if isNew {
+		identity.RefTracked = true
+	}
+
 	// Refresh timestamp of endpoint association
 	identity.AssociateEndpoint(clusterEndpointID)
 
@@ -104,7 +156,7 @@ func (d *Daemon) CreateOrUpdateIdentity(lbls labels.Labels, epid string) (*polic
 
 	if isNew {
 		log.WithFields(log.Fields{
-			logfields.EndpointID:     epid,
+			logfields.EndpointID:     clusterEndpointID,
 			logfields.IdentityLabels: lbls.String(),
 		}).Debug("Creating new identity")
 
@@ -113,7 +165,7 @@ func (d *Daemon) CreateOrUpdateIdentity(lbls labels.Labels, epid string) (*polic
 		}
 	} else {
 		log.WithFields(log.Fields{
-			logfields.EndpointID:     epid,
+			logfields.EndpointID:     clusterEndpointID,
 			logfields.Identity:       identity.StringID(),
 			logfields.IdentityLabels: lbls.String(),
 			"refCount":               identity.RefCount(),
@@ -129,6 +181,10 @@ func (d *Daemon) CreateOrUpdateIdentity(lbls labels.Labels, epid string) (*polic
 		return nil, false, err
 	}
 
+	if err := acquireIdentityRef(lbls.SHA256Sum()); err != nil {
+		return nil, false, fmt.Errorf("unable to reference identity: %s", err)
+	}
+
 	return identity, isNew, nil
 }
 
@@ -200,6 +256,10 @@ func (d *Daemon) LookupIdentity(id policy.NumericIdentity) (*policy.Identity, er
 		return secLbl, nil
 	}
 
+	return identityStore.lookup(id)
+}
+
+func (kvstoreIdentityBackend) lookup(id policy.NumericIdentity) (*policy.Identity, error) {
 	strID := strconv.FormatUint(uint64(id), 10)
 	rmsg, err := kvstore.Client().GetValue(path.Join(common.LabelIDKeyPath, strID))
 	if err != nil {
@@ -210,6 +270,10 @@ func (d *Daemon) LookupIdentity(id policy.NumericIdentity) (*policy.Identity, er
 }
 
 func LookupIdentityBySHA256(sha256sum string) (*policy.Identity, error) {
+	return identityStore.lookupBySHA256(sha256sum)
+}
+
+func (kvstoreIdentityBackend) lookupBySHA256(sha256sum string) (*policy.Identity, error) {
 	rmsg, err := kvstore.Client().GetValue(path.Join(common.LabelsKeyPath, sha256sum))
 	if err != nil {
 		return nil, apierror.Error(GetIdentityUnreachableCode, err)
@@ -218,6 +282,25 @@ func LookupIdentityBySHA256(sha256sum string) (*policy.Identity, error) {
 	return parseIdentityResponse(rmsg)
 }
 
+func (kvstoreIdentityBackend) list() ([]*policy.Identity, error) {
+	outputList, err := kvstore.Client().ListPrefix(common.LabelIDKeyPath)
+	if err != nil {
+		return nil, err
+	}
+
+	identities := []*policy.Identity{}
+	for _, v := range outputList {
+		id, err := parseIdentityResponse(v)
+		if err != nil {
+			return nil, err
+		} else if id != nil {
+			identities = append(identities, id)
+		}
+	}
+
+	return identities, nil
+}
+
 type getIdentity struct {
 	daemon *Daemon
 }
@@ -231,18 +314,14 @@ func (h *getIdentity) Handle(params GetIdentityParams) middleware.Responder {
 
 	identities := []*models.Identity{}
 	if params.Labels == nil {
-		// if labels is nil, return all identities from the kvstore
-		// This is in response to "identity list" command
-		outputList, err := kvstore.Client().ListPrefix(common.LabelIDKeyPath)
+		// if labels is nil, return all identities from the identity
+		// store. This is in response to "identity list" command
+		list, err := identityStore.list()
 		if err != nil {
 			return apierror.Error(GetIdentityIDInvalidStorageFormatCode, err)
 		}
-		for _, v := range outputList {
-			if id, err := parseIdentityResponse(v); err != nil {
-				return apierror.Error(GetIdentityIDInvalidStorageFormatCode, err)
-			} else if id != nil {
-				identities = append(identities, id.GetModel())
-			}
+		for _, id := range list {
+			identities = append(identities, id.GetModel())
 		}
 	} else {
 		lbls := labels.NewLabelsFromModel(params.Labels)
@@ -312,6 +391,11 @@ func (d *Daemon) DeleteIdentityBySHA256(sha256Sum string, epid string) error {
 	if sha256Sum == "" {
 		return nil
 	}
+
+	return identityStore.release(sha256Sum, epid)
+}
+
+func (kvstoreIdentityBackend) release(sha256Sum, epid string) error {
 	lblPath := path.Join(common.LabelsKeyPath, sha256Sum)
 	// Lock that sha256Sum
 	lockKey, err := kvstore.LockPath(lblPath)
@@ -354,7 +438,15 @@ func (d *Daemon) DeleteIdentityBySHA256(sha256Sum string, epid string) error {
 		"count":                  dbSecCtxLbls.RefCount(),
 	}).Debug("Decremented label ref-count")
 
-	return kvstore.Client().SetValue(lblPath, dbSecCtxLbls)
+	if err := kvstore.Client().SetValue(lblPath, dbSecCtxLbls); err != nil {
+		return err
+	}
+
+	if !hasLocalEndpoints(&dbSecCtxLbls) {
+		return releaseIdentityRef(sha256Sum)
+	}
+
+	return nil
 }
 
 // GetMaxLabelID returns the maximum possible free UUID stored in consul.
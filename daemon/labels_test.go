@@ -82,9 +82,6 @@ func (ds *DaemonSuite) SetUpTest(c *C) {
 	c.Assert(err, IsNil)
 	ds.d = d
 	kvstore.Client().DeleteTree(common.OperationalPath)
-	// Needs to be less than 1 second otherwise GetCachedMaxLabelID might
-	// not work properly
-	d.EnableKVStoreWatcher(time.Nanosecond)
 }
 
 func (ds *DaemonSuite) TearDownTest(c *C) {
@@ -37,10 +37,12 @@ import (
 	"github.com/cilium/cilium/pkg/bpf"
 	"github.com/cilium/cilium/pkg/endpoint"
 	"github.com/cilium/cilium/pkg/endpointmanager"
+	"github.com/cilium/cilium/pkg/ipam"
 	"github.com/cilium/cilium/pkg/k8s"
 	"github.com/cilium/cilium/pkg/kvstore"
 	"github.com/cilium/cilium/pkg/labels"
 	"github.com/cilium/cilium/pkg/logfields"
+	"github.com/cilium/cilium/pkg/metrics"
 	"github.com/cilium/cilium/pkg/node"
 	"github.com/cilium/cilium/pkg/option"
 	"github.com/cilium/cilium/pkg/policy"
@@ -77,6 +79,8 @@ var (
 	disableConntrack      bool
 	enableTracing         bool
 	enableLogstash        bool
+	identityAllocMode     string
+	identityGCInterval    time.Duration
 	kvStore               string
 	validLabels           []string
 	labelPrefixFile       string
@@ -92,6 +96,10 @@ var (
 	v6Address             string
 	masquerade            bool
 	v4ClusterCidrMaskSize int
+	ipamMode              string
+	v4ClusterPoolPrefix   string
+	v6ClusterPoolPrefix   string
+	v4ClusterPoolMaskSize int
 	v4ServicePrefix       string
 	v6ServicePrefix       string
 	k8sAPIServer          string
@@ -102,6 +110,7 @@ var (
 
 var logOpts = make(map[string]string)
 var kvStoreOpts = make(map[string]string)
+var ipamPools = make(map[string]string)
 
 var cfgFile string
 
@@ -291,6 +300,8 @@ func init() {
 		"access-log", "", "Path to access log of supported L7 requests observed")
 	flags.StringSlice(
 		"agent-labels", []string{}, "Additional labels to identify this agent")
+	flags.BoolVar(&config.AllowPodPolicyOverrides,
+		"allow-pod-policy-overrides", false, "Allow pods to enable the policy audit mode and to disable connection tracking via annotations")
 	flags.StringVar(&config.AllowLocalhost,
 		"allow-localhost", AllowLocalhostAuto, "Policy when to allow local stack to reach local endpoints { auto | always | policy } ")
 	flags.Bool(
@@ -318,12 +329,23 @@ func init() {
 	flags.StringVarP(&dockerEndpoint,
 		"docker", "e", "unix:///var/run/docker.sock", "Path to docker runtime socket")
 	flags.String("enable-policy", endpoint.DefaultEnforcement, "Enable policy enforcement")
+	flags.Bool("policy-audit-mode", false, "Report policy denials but do not drop the traffic")
 	flags.BoolVar(&enableTracing,
 		"enable-tracing", false, "Enable tracing while determining policy (debugging)")
 	flags.StringVar(&v4Prefix,
 		"ipv4-range", AutoCIDR, "Per-node IPv4 endpoint prefix, e.g. 10.16.0.0/16")
 	flags.StringVar(&v6Prefix,
 		"ipv6-range", AutoCIDR, "Per-node IPv6 endpoint prefix, must be /96, e.g. fd02:1:1::/96")
+	flags.StringVar(&ipamMode,
+		"ipam", ipam.ModeHostLocal, "IP address management mode { "+ipam.ModeHostLocal+" | "+ipam.ModeClusterPool+" }")
+	flags.Var(option.NewNamedMapOptions("ipam-pools", &ipamPools, nil),
+		"ipam-pool", "Additional named IPv4 pool, e.g. routable=192.168.10.0/24")
+	flags.StringVar(&v4ClusterPoolPrefix,
+		"cluster-pool-ipv4-cidr", "", "Cluster wide IPv4 prefix out of which per-node prefixes are leased in cluster-pool IPAM mode")
+	flags.IntVar(&v4ClusterPoolMaskSize,
+		"cluster-pool-ipv4-mask-size", 24, "Mask size of the per-node IPv4 prefix leased in cluster-pool IPAM mode")
+	flags.StringVar(&v6ClusterPoolPrefix,
+		"cluster-pool-ipv6-cidr", "", "Cluster wide IPv6 prefix out of which per-node /96 prefixes are leased in cluster-pool IPAM mode")
 	flags.StringVar(&v4ServicePrefix,
 		"ipv4-service-range", AutoCIDR, "Kubernetes IPv4 services CIDR if not inside cluster prefix")
 	flags.StringVar(&v6ServicePrefix,
@@ -336,6 +358,10 @@ func init() {
 		"keep-config", false, "When restoring state, keeps containers' configuration in place")
 	flags.BoolVar(&config.KeepTemplates,
 		"keep-bpf-templates", false, "Do not restore BPF template files from binary")
+	flags.StringVar(&identityAllocMode,
+		"identity-allocation-mode", identityAllocModeKVStore, "Method used to allocate security identities { "+identityAllocModeKVStore+" | "+identityAllocModeCRD+" }")
+	flags.DurationVar(&identityGCInterval,
+		"identity-gc-interval", 5*time.Minute, "Interval in which identities without references are removed from the kvstore (0 to disable)")
 	flags.StringVar(&kvStore,
 		"kvstore", "", "Key-value store type")
 	flags.Var(option.NewNamedMapOptions("kvstore-opts", &kvStoreOpts, nil),
@@ -382,6 +408,8 @@ func init() {
 		"version", false, "Print version information")
 	flags.Bool(
 		"pprof", false, "Enable serving the pprof debugging API")
+	flags.String(
+		"metrics-address", "", "Address to serve metrics on, e.g. localhost:9090 (disabled if empty)")
 
 	viper.BindPFlags(flags)
 }
@@ -442,6 +470,10 @@ func initConfig() {
 		pprof.Enable()
 	}
 
+	if addr := viper.GetString("metrics-address"); addr != "" {
+		metrics.Enable(addr)
+	}
+
 	if config.IPv4Disabled {
 		endpoint.IPv4Enabled = false
 		node.EnableIPv4 = false
@@ -533,15 +565,36 @@ func initEnv() {
 
 	config.Opts.Set(endpoint.OptionDropNotify, true)
 	config.Opts.Set(endpoint.OptionTraceNotify, true)
+	config.Opts.Set(endpoint.OptionPolicyVerdictNotify, true)
 	config.Opts.Set(options.PolicyTracing, enableTracing)
 	config.Opts.Set(endpoint.OptionConntrack, !disableConntrack)
 	config.Opts.Set(endpoint.OptionConntrackAccounting, !disableConntrack)
 	config.Opts.Set(endpoint.OptionConntrackLocal, false)
+	config.Opts.Set(endpoint.OptionPolicyAuditMode, viper.GetBool("policy-audit-mode"))
 
 	policy.SetPolicyEnabled(strings.ToLower(viper.GetString("enable-policy")))
 
-	if err := kvstore.Setup(kvStore, kvStoreOpts); err != nil {
-		log.WithError(err).Fatal("Unable to setup kvstore")
+	// Identities allocated via CRDs do not need a kvstore, only set it up
+	// if one was configured or identities are allocated in the kvstore
+	if kvStore != "" || identityAllocMode != identityAllocModeCRD {
+		if err := kvstore.Setup(kvStore, kvStoreOpts); err != nil {
+			log.WithError(err).Fatal("Unable to setup kvstore")
+		}
+	} else {
+		log.Info("No kvstore configured, running without kvstore")
+	}
+
+	if err := ipam.SetMode(ipamMode); err != nil {
+		log.WithError(err).Fatal("Invalid IPAM mode")
+	}
+
+	if ipamMode == ipam.ModeClusterPool {
+		if v4ClusterPoolPrefix == "" && v6ClusterPoolPrefix == "" {
+			log.Fatal("cluster-pool IPAM mode requires --cluster-pool-ipv4-cidr or --cluster-pool-ipv6-cidr")
+		}
+		if !kvstore.IsEnabled() {
+			log.Fatal("cluster-pool IPAM mode requires a kvstore, please specify --kvstore")
+		}
 	}
 
 	if err := labels.ParseLabelPrefixCfg(validLabels, labelPrefixFile); err != nil {
@@ -582,6 +635,16 @@ func initEnv() {
 	}
 
 	k8s.Configure(k8sAPIServer, k8sKubeConfigPath)
+
+	switch identityAllocMode {
+	case identityAllocModeKVStore:
+	case identityAllocModeCRD:
+		if !k8s.IsEnabled() {
+			log.Fatal("CRD identity allocation mode requires Kubernetes")
+		}
+	default:
+		log.WithField("mode", identityAllocMode).Fatal("Unknown identity allocation mode")
+	}
 }
 
 func runDaemon() {
@@ -608,7 +671,9 @@ func runDaemon() {
 		log.WithError(err).Fatal("Error while enabling containerd event watcher")
 	}
 
-	d.EnableKVStoreWatcher(30 * time.Second)
+	if identityAllocMode == identityAllocModeKVStore && identityGCInterval != 0 {
+		d.EnableIdentityGC(identityGCInterval)
+	}
 
 	if err := d.EnableK8sWatcher(5 * time.Minute); err != nil {
 		log.WithError(err).Warn("Error while enabling k8s watcher")
@@ -661,6 +726,7 @@ func runDaemon() {
 
 	// /policy/resolve/
 	api.PolicyGetPolicyResolveHandler = NewGetPolicyResolveHandler(d)
+	api.PolicyGetPolicyDiffHandler = NewGetPolicyDiffHandler(d)
 
 	// /service/{id}/
 	api.ServiceGetServiceIDHandler = NewGetServiceIDHandler(d)
@@ -676,6 +742,7 @@ func runDaemon() {
 	api.PrefilterDeletePrefilterHandler = NewDeletePrefilterHandler(d)
 
 	// /ipam/{ip}/
+	api.IPAMGetIPAMHandler = NewGetIPAMHandler(d)
 	api.IPAMPostIPAMHandler = NewPostIPAMHandler(d)
 	api.IPAMPostIPAMIPHandler = NewPostIPAMIPHandler(d)
 	api.IPAMDeleteIPAMIPHandler = NewDeleteIPAMIPHandler(d)
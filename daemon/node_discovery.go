@@ -0,0 +1,120 @@
+// Copyright 2018 Authors of Cilium
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"net"
+	"path"
+
+	"github.com/cilium/cilium/common"
+	"github.com/cilium/cilium/pkg/kvstore"
+	"github.com/cilium/cilium/pkg/logfields"
+	"github.com/cilium/cilium/pkg/node"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// nodeWatcherChanSize is the size of the events channel of the
+	// kvstore node watcher
+	nodeWatcherChanSize = 128
+)
+
+// nodeKey returns the kvstore key under which the node with the given name
+// is registered
+func nodeKey(name string) string {
+	return path.Join(common.NodesKeyPath, name)
+}
+
+// registerNode registers the local node in the kvstore. The key is attached
+// to the kvstore lease of the agent and is thus removed automatically when
+// the agent stops renewing it. If the kvstore is unavailable, the registration
+// is queued until the kvstore has recovered.
+func registerNode() error {
+	_, n := node.GetLocalNode()
+
+	value, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+
+	kvstore.QueueSet(nodeKey(n.Name), value, true)
+	return nil
+}
+
+// EnableKVStoreNodeDiscovery registers the local node in the kvstore and then
+// watches common.NodesKeyPath for other nodes joining or leaving the cluster.
+// This provides node discovery to deployments without Kubernetes.
+func (d *Daemon) EnableKVStoreNodeDiscovery() {
+	if err := registerNode(); err != nil {
+		log.WithError(err).Warning("Unable to register node in kvstore")
+	}
+
+	w := kvstore.ListAndWatch("nodes", common.NodesKeyPath, nodeWatcherChanSize)
+	go func() {
+		for event := range w.Events {
+			d.handleNodeEvent(event)
+		}
+	}()
+}
+
+// handleNodeEvent applies the kvstore event on the list of nodes
+func (d *Daemon) handleNodeEvent(event kvstore.KeyValueEvent) {
+	name := path.Base(event.Key)
+	ni := node.Identity{Name: name}
+
+	scopedLog := log.WithFields(log.Fields{
+		logfields.NodeName: name,
+		"event":            event.Typ,
+	})
+
+	if name == node.GetName() {
+		// The registration of the local node has been lost, e.g.
+		// because the kvstore lease expired, re-register
+		if event.Typ == kvstore.EventTypeDelete {
+			scopedLog.Info("Registration of local node removed from kvstore, re-registering")
+			if err := registerNode(); err != nil {
+				scopedLog.WithError(err).Warning("Unable to register node in kvstore")
+			}
+		}
+		return
+	}
+
+	if event.Typ == kvstore.EventTypeDelete {
+		node.DeleteNode(ni, node.TunnelRoute|node.DirectRoute)
+		scopedLog.Info("Node removed from cluster")
+		return
+	}
+
+	var n node.Node
+	if err := json.Unmarshal(event.Value, &n); err != nil {
+		scopedLog.WithError(err).Warning("Unable to unmarshal node")
+		return
+	}
+
+	routeTypes := node.TunnelRoute
+
+	// Add IPv6 routing only in non encap. With encap we do it with bpf tunnel
+	var ownAddr net.IP
+	if autoIPv6NodeRoutes && d.conf.Device != "undefined" {
+		ownAddr = node.GetIPv6()
+		routeTypes |= node.DirectRoute
+	}
+
+	node.UpdateNode(ni, &n, routeTypes, ownAddr)
+
+	scopedLog.WithField(logfields.Node, logfields.Repr(n)).Debug("Node discovered via kvstore")
+}
@@ -39,7 +39,9 @@ var (
 		endpoint.OptionDebug:               &endpoint.OptionSpecDebug,
 		endpoint.OptionDropNotify:          &endpoint.OptionSpecDropNotify,
 		endpoint.OptionTraceNotify:         &endpoint.OptionSpecTraceNotify,
+		endpoint.OptionPolicyVerdictNotify: &endpoint.OptionSpecPolicyVerdictNotify,
 		endpoint.OptionNAT46:               &endpoint.OptionSpecNAT46,
+		endpoint.OptionPolicyAuditMode:     &endpoint.OptionSpecPolicyAuditMode,
 	}
 )
 
@@ -0,0 +1,210 @@
+// Copyright 2018 Authors of Cilium
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/cilium/cilium/api/v1/models"
+	"github.com/cilium/cilium/pkg/endpoint"
+	"github.com/cilium/cilium/pkg/k8s"
+	"github.com/cilium/cilium/pkg/logfields"
+	"github.com/cilium/cilium/pkg/option"
+	"github.com/cilium/cilium/pkg/policy"
+	"github.com/cilium/cilium/pkg/policy/api"
+
+	log "github.com/sirupsen/logrus"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// podEndpointConfig is the endpoint configuration derived from the
+// annotations and the containers of a pod
+type podEndpointConfig struct {
+	// opts are the endpoint options overridden by the pod
+	opts models.ConfigurationMap
+
+	// ingressBandwidth and egressBandwidth are the bandwidth limits in
+	// bits per second, 0 if unlimited
+	ingressBandwidth uint64
+	egressBandwidth  uint64
+
+	// namedPorts are the named container ports of the pod
+	namedPorts policy.NamedPortMap
+}
+
+// optionValue returns the value of an enabled or disabled option in a
+// configuration map
+func optionValue(enabled bool) string {
+	if enabled {
+		return "enabled"
+	}
+	return "disabled"
+}
+
+// parseBandwidth parses a bandwidth annotation in the resource quantity
+// format, e.g. "10M", into bits per second
+func parseBandwidth(annotation, value string) (uint64, error) {
+	q, err := resource.ParseQuantity(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q of annotation %s: %s", value, annotation, err)
+	}
+
+	bps := q.Value()
+	if bps <= 0 {
+		return 0, fmt.Errorf("invalid value %q of annotation %s: bandwidth must be positive", value, annotation)
+	}
+
+	return uint64(bps), nil
+}
+
+// policyOverrideAllowed returns an error if the option would weaken the policy
+// enforcement of the endpoint and policy overrides are not allowed. The audit
+// mode lets traffic denied by policy pass and policy is only enforced on
+// connections tracked by conntrack.
+func policyOverrideAllowed(name string, enabled, allowPolicyOverrides bool, annotation string) error {
+	if allowPolicyOverrides {
+		return nil
+	}
+
+	switch {
+	case name == endpoint.OptionPolicyAuditMode,
+		name == endpoint.OptionConntrack && !enabled:
+		return fmt.Errorf("option %s cannot be set in annotation %s unless --allow-pod-policy-overrides is enabled", name, annotation)
+	}
+	return nil
+}
+
+// parsePodAnnotations returns the endpoint configuration derived from the
+// annotations of a pod. The annotations are validated as a whole so that
+// either all or none of them are applied to the endpoint. Options weakening
+// policy enforcement are rejected unless allowPolicyOverrides is set.
+func parsePodAnnotations(annotations map[string]string, allowPolicyOverrides bool) (*podEndpointConfig, error) {
+	cfg := &podEndpointConfig{opts: models.ConfigurationMap{}}
+
+	if value, ok := annotations[k8s.AnnotationEndpointOptions]; ok {
+		for _, arg := range strings.Split(value, ",") {
+			arg = strings.TrimSpace(arg)
+			if arg == "" {
+				continue
+			}
+
+			name, enabled, err := option.ParseOption(arg, &endpoint.EndpointMutableOptionLibrary)
+			if err != nil {
+				return nil, fmt.Errorf("invalid option %q in annotation %s: %s", arg, k8s.AnnotationEndpointOptions, err)
+			}
+
+			// Policy enforcement is governed by the enforcement mode
+			// of the agent and must not be disabled by a pod
+			if name == endpoint.OptionPolicy {
+				return nil, fmt.Errorf("option %s cannot be set in annotation %s", name, k8s.AnnotationEndpointOptions)
+			}
+
+			if err := policyOverrideAllowed(name, enabled, allowPolicyOverrides, k8s.AnnotationEndpointOptions); err != nil {
+				return nil, err
+			}
+
+			if err := endpoint.EndpointMutableOptionLibrary.Validate(name, enabled); err != nil {
+				return nil, fmt.Errorf("invalid option %q in annotation %s: %s", arg, k8s.AnnotationEndpointOptions, err)
+			}
+
+			cfg.opts[name] = optionValue(enabled)
+		}
+	}
+
+	if value, ok := annotations[k8s.AnnotationPolicyAuditMode]; ok {
+		enabled, err := option.NormalizeBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value %q of annotation %s: %s", value, k8s.AnnotationPolicyAuditMode, err)
+		}
+		if err := policyOverrideAllowed(endpoint.OptionPolicyAuditMode, enabled, allowPolicyOverrides, k8s.AnnotationPolicyAuditMode); err != nil {
+			return nil, err
+		}
+		cfg.opts[endpoint.OptionPolicyAuditMode] = optionValue(enabled)
+	}
+
+	var err error
+	if value, ok := annotations[k8s.AnnotationIngressBandwidth]; ok {
+		if cfg.ingressBandwidth, err = parseBandwidth(k8s.AnnotationIngressBandwidth, value); err != nil {
+			return nil, err
+		}
+	}
+
+	if value, ok := annotations[k8s.AnnotationEgressBandwidth]; ok {
+		if cfg.egressBandwidth, err = parseBandwidth(k8s.AnnotationEgressBandwidth, value); err != nil {
+			return nil, err
+		}
+	}
+
+	return cfg, nil
+}
+
+// parseNamedPorts returns the named ports of the containers of a pod. Ports
+// without protocol default to TCP.
+func parseNamedPorts(containers []v1.Container) policy.NamedPortMap {
+	namedPorts := policy.NamedPortMap{}
+	for _, container := range containers {
+		for _, port := range container.Ports {
+			if port.Name == "" {
+				continue
+			}
+
+			protocol := api.ProtoTCP
+			if port.Protocol != "" {
+				protocol = api.L4Proto(port.Protocol)
+			}
+
+			namedPorts[port.Name] = policy.NamedPort{
+				Port:     uint16(port.ContainerPort),
+				Protocol: protocol,
+			}
+		}
+	}
+
+	return namedPorts
+}
+
+// fetchPodEndpointConfig retrieves the pod with the given name and returns
+// the endpoint configuration derived from its annotations and containers.
+// Returns nil if the pod cannot be retrieved.
+func fetchPodEndpointConfig(namespace, podName string, allowPolicyOverrides bool) (*podEndpointConfig, error) {
+	pod, err := k8s.Client().CoreV1().Pods(namespace).Get(podName, metav1.GetOptions{})
+	if err != nil {
+		log.WithError(err).WithFields(log.Fields{
+			logfields.K8sNamespace: namespace,
+			logfields.K8sPodName:   podName,
+		}).Warning("Unable to retrieve pod, endpoint configuration annotations are ignored")
+		return nil, nil
+	}
+
+	cfg, err := parsePodAnnotations(pod.GetAnnotations(), allowPolicyOverrides)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg.namedPorts = parseNamedPorts(pod.Spec.Containers)
+	return cfg, nil
+}
+
+// apply applies the configuration to ep. Must be called before ep is exposed
+// to other users.
+func (cfg *podEndpointConfig) apply(ep *endpoint.Endpoint) {
+	ep.Opts.Apply(cfg.opts, func(string, bool, interface{}) {}, nil)
+	ep.IngressBandwidth = cfg.ingressBandwidth
+	ep.EgressBandwidth = cfg.egressBandwidth
+	ep.NamedPorts = cfg.namedPorts
+}
@@ -0,0 +1,115 @@
+// Copyright 2018 Authors of Cilium
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"github.com/cilium/cilium/api/v1/models"
+	"github.com/cilium/cilium/pkg/endpoint"
+	"github.com/cilium/cilium/pkg/k8s"
+	"github.com/cilium/cilium/pkg/policy"
+	"github.com/cilium/cilium/pkg/policy/api"
+
+	. "gopkg.in/check.v1"
+	"k8s.io/api/core/v1"
+)
+
+type PodAnnotationsSuite struct{}
+
+var _ = Suite(&PodAnnotationsSuite{})
+
+func (s *PodAnnotationsSuite) TestParsePodAnnotations(c *C) {
+	cfg, err := parsePodAnnotations(map[string]string{
+		k8s.AnnotationEndpointOptions:  "Debug, !ConntrackAccounting,TraceNotification=disabled",
+		k8s.AnnotationPolicyAuditMode:  "true",
+		k8s.AnnotationIngressBandwidth: "10M",
+		k8s.AnnotationEgressBandwidth:  "1G",
+	}, true)
+	c.Assert(err, IsNil)
+	c.Assert(cfg.opts, DeepEquals, models.ConfigurationMap{
+		endpoint.OptionDebug:               "enabled",
+		endpoint.OptionConntrackAccounting: "disabled",
+		endpoint.OptionTraceNotify:         "disabled",
+		endpoint.OptionPolicyAuditMode:     "enabled",
+	})
+	c.Assert(cfg.ingressBandwidth, Equals, uint64(10000000))
+	c.Assert(cfg.egressBandwidth, Equals, uint64(1000000000))
+
+	cfg, err = parsePodAnnotations(map[string]string{"foo": "bar"}, false)
+	c.Assert(err, IsNil)
+	c.Assert(cfg.opts, DeepEquals, models.ConfigurationMap{})
+	c.Assert(cfg.ingressBandwidth, Equals, uint64(0))
+	c.Assert(cfg.egressBandwidth, Equals, uint64(0))
+}
+
+func (s *PodAnnotationsSuite) TestParsePodAnnotationsInvalid(c *C) {
+	for _, annotations := range []map[string]string{
+		{k8s.AnnotationEndpointOptions: "Unknown"},
+		{k8s.AnnotationEndpointOptions: "Debug=maybe"},
+		{k8s.AnnotationEndpointOptions: "!Policy"},
+		{k8s.AnnotationPolicyAuditMode: "maybe"},
+		{k8s.AnnotationIngressBandwidth: "fast"},
+		{k8s.AnnotationEgressBandwidth: "0"},
+		{k8s.AnnotationEgressBandwidth: "-10M"},
+	} {
+		_, err := parsePodAnnotations(annotations, true)
+		c.Assert(err, Not(IsNil), Commentf("%v", annotations))
+	}
+}
+
+func (s *PodAnnotationsSuite) TestParsePodAnnotationsPolicyOverrides(c *C) {
+	for _, annotations := range []map[string]string{
+		{k8s.AnnotationPolicyAuditMode: "true"},
+		{k8s.AnnotationPolicyAuditMode: "false"},
+		{k8s.AnnotationEndpointOptions: "PolicyAuditMode"},
+		{k8s.AnnotationEndpointOptions: "Debug,!Conntrack"},
+		{k8s.AnnotationEndpointOptions: "Conntrack=disabled"},
+	} {
+		_, err := parsePodAnnotations(annotations, false)
+		c.Assert(err, Not(IsNil), Commentf("%v", annotations))
+
+		_, err = parsePodAnnotations(annotations, true)
+		c.Assert(err, IsNil, Commentf("%v", annotations))
+	}
+
+	// Options not weakening policy enforcement are always allowed
+	cfg, err := parsePodAnnotations(map[string]string{
+		k8s.AnnotationEndpointOptions: "Conntrack,!ConntrackAccounting",
+	}, false)
+	c.Assert(err, IsNil)
+	c.Assert(cfg.opts, DeepEquals, models.ConfigurationMap{
+		endpoint.OptionConntrack:           "enabled",
+		endpoint.OptionConntrackAccounting: "disabled",
+	})
+}
+
+func (s *PodAnnotationsSuite) TestParseNamedPorts(c *C) {
+	namedPorts := parseNamedPorts([]v1.Container{
+		{
+			Ports: []v1.ContainerPort{
+				{Name: "http", ContainerPort: 8080},
+				{ContainerPort: 9090},
+			},
+		},
+		{
+			Ports: []v1.ContainerPort{
+				{Name: "dns", ContainerPort: 53, Protocol: v1.ProtocolUDP},
+			},
+		},
+	})
+	c.Assert(namedPorts, DeepEquals, policy.NamedPortMap{
+		"http": {Port: 8080, Protocol: api.ProtoTCP},
+		"dns":  {Port: 53, Protocol: api.ProtoUDP},
+	})
+}
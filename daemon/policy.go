@@ -18,6 +18,8 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"net/http"
+	"strings"
 	"sync"
 
 	"github.com/cilium/cilium/api/v1/models"
@@ -45,6 +47,11 @@ func (d *Daemon) GetCachedLabelList(ID policy.NumericIdentity) (labels.LabelArra
 		return c.LabelArray, nil
 	}
 
+	// Check if the identity is known to the cluster identity cache
+	if id := policy.GetConsumableCache().LookupIdentity(ID); id != nil {
+		return id.Labels.ToSlice(), nil
+	}
+
 	// No cache entry or labels not available, do full lookup of labels
 	// via KV store
 	lbls, err := d.LookupIdentity(ID)
@@ -172,6 +179,7 @@ func (h *getPolicyResolve) Handle(params GetPolicyResolveParams) middleware.Resp
 		To:      labels.NewSelectLabelArrayFromModel(ctx.To),
 		DPorts:  ctx.Dports,
 	}
+	searchCtx.NamedPorts = namedPortsOfLabels(searchCtx.To)
 	if ctx.Verbose {
 		searchCtx.Trace = policy.TRACE_VERBOSE
 	}
@@ -180,16 +188,242 @@ func (h *getPolicyResolve) Handle(params GetPolicyResolveParams) middleware.Resp
 
 	verdict := d.policy.AllowsRLocked(&searchCtx)
 
-	d.policy.Mutex.RUnlock()
-
 	result := models.PolicyTraceResult{
 		Verdict: verdict.String(),
-		Log:     buffer.String(),
 	}
+	d.traceRulesRLocked(&searchCtx, ctx, verdict, &result)
+
+	d.policy.Mutex.RUnlock()
+
+	result.Log = buffer.String()
 
 	return NewGetPolicyResolveOK().WithPayload(&result)
 }
 
+// traceRulesRLocked adds the labels of all rules selecting the source or
+// destination and the resulting L4 filters to the trace result. If the
+// identity context contains a layer 7 request, the request is evaluated
+// against the L7 rules of the ingress filters. A request is only allowed if
+// verdict, the L3/L4 verdict of the trace, allows it. The policy repository
+// mutex must be held.
+func (d *Daemon) traceRulesRLocked(searchCtx *policy.SearchContext, ctx *models.IdentityContext, verdict api.Decision, result *models.PolicyTraceResult) {
+	result.MatchedRules = []models.Labels{}
+	seen := map[*api.Rule]struct{}{}
+	for _, lbls := range []labels.LabelArray{searchCtx.To, searchCtx.From} {
+		for _, r := range d.policy.GetRulesSelectingRLocked(lbls) {
+			if _, ok := seen[r]; ok {
+				continue
+			}
+			seen[r] = struct{}{}
+			result.MatchedRules = append(result.MatchedRules, r.Labels.GetModel())
+		}
+	}
+
+	ingressCtx := policy.SearchContext{To: searchCtx.To, IngressL4Only: true}
+	ingress, err := d.policy.ResolveL4Policy(&ingressCtx)
+	if err != nil {
+		searchCtx.PolicyTrace("Unable to resolve L4 ingress policy: %s\n", err)
+		return
+	}
+
+	egressCtx := policy.SearchContext{To: searchCtx.From, EgressL4Only: true}
+	egress, err := d.policy.ResolveL4Policy(&egressCtx)
+	if err != nil {
+		searchCtx.PolicyTrace("Unable to resolve L4 egress policy: %s\n", err)
+		return
+	}
+
+	l4 := policy.L4Policy{
+		Ingress: ingress.Ingress.FilterPorts(ctx.Dports, searchCtx.NamedPorts),
+		Egress:  egress.Egress.FilterPorts(ctx.Dports, nil),
+	}
+	result.L4 = l4.GetModel()
+
+	if ctx.HTTP == nil && ctx.Kafka == nil {
+		return
+	}
+
+	var httpReq *http.Request
+	var apiKey int16
+	if ctx.HTTP != nil {
+		httpReq, err = http.NewRequest(ctx.HTTP.Method, ctx.HTTP.Path, nil)
+		if err != nil {
+			searchCtx.PolicyTrace("Invalid HTTP request: %s\n", err)
+			result.L7Verdict = api.Denied.String()
+			return
+		}
+		httpReq.Host = ctx.HTTP.Host
+		for _, hdr := range ctx.HTTP.Headers {
+			s := strings.SplitN(hdr, ":", 2)
+			if len(s) == 2 {
+				httpReq.Header.Add(s[0], strings.TrimSpace(s[1]))
+			} else {
+				httpReq.Header.Add(s[0], "")
+			}
+		}
+	} else {
+		var ok bool
+		apiKey, ok = api.KafkaAPIKeyMap[strings.ToLower(ctx.Kafka.APIKey)]
+		if !ok {
+			searchCtx.PolicyTrace("Unknown Kafka API key %q\n", ctx.Kafka.APIKey)
+			result.L7Verdict = api.Denied.String()
+			return
+		}
+	}
+
+	// Without destination ports, the L3/L4 verdict does not take L4 rules
+	// into account. It is then derived for each port of the ingress filters
+	// instead.
+	derivePorts := len(ctx.Dports) == 0 && verdict != api.Allowed && len(l4.Ingress) > 0
+
+	// A request denied at L3/L4 never reaches the L7 rules
+	if verdict != api.Allowed && !derivePorts {
+		searchCtx.PolicyTrace("L7 request denied, L3/L4 verdict: %s\n", verdict.String())
+		result.L7Verdict = api.Denied.String()
+		return
+	}
+
+	// The request is allowed if any of the covered ingress ports allows
+	// it. Without ingress L4 policy, no L7 rules apply.
+	if len(l4.Ingress) > 0 {
+		verdict = api.Denied
+	}
+	for port, filter := range l4.Ingress {
+		if derivePorts {
+			portCtx := *searchCtx
+			portCtx.Trace = policy.TRACE_DISABLED
+			portCtx.DPorts = []*models.Port{{
+				Port:     uint16(filter.Port),
+				Name:     filter.PortName,
+				Protocol: string(filter.Protocol),
+			}}
+			if v := d.policy.AllowsRLocked(&portCtx); v != api.Allowed {
+				searchCtx.PolicyTrace("L7 request denied on port %s, L3/L4 verdict: %s\n", port, v.String())
+				continue
+			}
+		}
+
+		var allowed bool
+		if httpReq != nil {
+			allowed = filter.AllowsHTTPRequest(searchCtx.From, httpReq)
+		} else {
+			allowed = filter.AllowsKafkaRequest(searchCtx.From, apiKey,
+				int16(ctx.Kafka.APIVersion), ctx.Kafka.ClientID, ctx.Kafka.Topic)
+		}
+
+		if allowed {
+			searchCtx.PolicyTrace("L7 request allowed on port %s\n", port)
+			verdict = api.Allowed
+		} else {
+			searchCtx.PolicyTrace("L7 request denied on port %s\n", port)
+		}
+	}
+
+	searchCtx.PolicyTrace("L7 verdict: %s\n", verdict.String())
+	result.L7Verdict = verdict.String()
+}
+
+type getPolicyDiff struct {
+	daemon *Daemon
+}
+
+// NewGetPolicyDiffHandler returns the handler computing the access changes
+// caused by importing policy rules
+func NewGetPolicyDiffHandler(d *Daemon) GetPolicyDiffHandler {
+	return &getPolicyDiff{daemon: d}
+}
+
+// namedPortsOfLabels returns the named ports of all local endpoints whose
+// security identity carries all labels in lbls. If several endpoints use the
+// same port name, the first one found is returned.
+func namedPortsOfLabels(lbls labels.LabelArray) policy.NamedPortMap {
+	result := policy.NamedPortMap{}
+	if len(lbls) == 0 {
+		return result
+	}
+
+	endpointmanager.Mutex.RLock()
+	for _, ep := range endpointmanager.Endpoints {
+		ep.RLock()
+		if ep.Consumable != nil && ep.Consumable.LabelArray.Contains(lbls) {
+			for name, port := range ep.NamedPorts {
+				if _, ok := result[name]; !ok {
+					result[name] = port
+				}
+			}
+		}
+		ep.RUnlock()
+	}
+	endpointmanager.Mutex.RUnlock()
+
+	return result
+}
+
+// endpointsByIdentity returns the IDs of all local endpoints grouped by their
+// security identity
+func endpointsByIdentity() map[policy.NumericIdentity][]int64 {
+	result := map[policy.NumericIdentity][]int64{}
+
+	endpointmanager.Mutex.RLock()
+	for _, ep := range endpointmanager.Endpoints {
+		ep.RLock()
+		id := ep.GetIdentity()
+		result[id] = append(result[id], int64(ep.ID))
+		ep.RUnlock()
+	}
+	endpointmanager.Mutex.RUnlock()
+
+	return result
+}
+
+func (h *getPolicyDiff) Handle(params GetPolicyDiffParams) middleware.Responder {
+	d := h.daemon
+
+	var rules api.Rules
+	if err := json.Unmarshal([]byte(*params.Policy), &rules); err != nil {
+		return apierror.Error(GetPolicyDiffInvalidPolicyCode, err)
+	}
+
+	for _, r := range rules {
+		if err := r.Sanitize(); err != nil {
+			return apierror.Error(GetPolicyDiffInvalidPolicyCode, err)
+		}
+	}
+
+	result := &models.PolicyDiffResult{Changes: []*models.PolicyAccessChange{}}
+
+	// Without policy enforcement, importing rules cannot change access
+	if policy.GetPolicyEnabled() == endpoint.NeverEnforce {
+		return NewGetPolicyDiffOK().WithPayload(result)
+	}
+
+	d.policy.Mutex.RLock()
+	newRepo := d.policy.CopyRLocked()
+	if _, err := newRepo.AddListLocked(rules); err != nil {
+		d.policy.Mutex.RUnlock()
+		return apierror.Error(GetPolicyDiffInvalidPolicyCode, err)
+	}
+
+	identities := policy.GetConsumableCache().GetIdentityLabels()
+	alwaysEnforce := policy.GetPolicyEnabled() == endpoint.AlwaysEnforce
+	changes := policy.DiffAccessRLocked(d.policy, newRepo, identities, alwaysEnforce)
+	d.policy.Mutex.RUnlock()
+
+	endpoints := endpointsByIdentity()
+	for _, c := range changes {
+		result.Changes = append(result.Changes, &models.PolicyAccessChange{
+			From:        int64(c.From),
+			To:          int64(c.To),
+			ToEndpoints: endpoints[c.To],
+			Egress:      c.Egress,
+			Gained:      c.Gained,
+			Lost:        c.Lost,
+		})
+	}
+
+	return NewGetPolicyDiffOK().WithPayload(result)
+}
+
 // AddOptions are options which can be passed to PolicyAdd
 type AddOptions struct {
 	// Replace if true indicates that existing rules with identical labels should be replaced
@@ -250,8 +484,8 @@ func (d *Daemon) PolicyAdd(rules api.Rules, opts *AddOptions) (uint64, error) {
 		return 0, apierror.Error(PutPolicyFailureCode, err)
 	}
 
-	log.Info("New policy imported, regenerating...")
-	d.TriggerPolicyUpdates(false)
+	log.Info("New policy imported, updating endpoints...")
+	endpointmanager.UpdatePolicyForRules(d)
 
 	return rev, nil
 }
@@ -274,7 +508,7 @@ func (d *Daemon) PolicyDelete(labels labels.LabelArray) (uint64, error) {
 		// to check which consumables were removed with the new policy.
 		oldConsumables := policy.GetConsumableCache().GetConsumables()
 
-		wg := d.TriggerPolicyUpdates(false)
+		wg := endpointmanager.UpdatePolicyForRules(d)
 
 		// If daemon doesn't enforce policy then skip the cleanup
 		// of CT entries.
@@ -18,10 +18,12 @@ import (
 	"os"
 	"time"
 
+	"github.com/cilium/cilium/api/v1/models"
 	"github.com/cilium/cilium/common/addressing"
 	"github.com/cilium/cilium/pkg/endpoint"
 	"github.com/cilium/cilium/pkg/labels"
 	"github.com/cilium/cilium/pkg/mac"
+	"github.com/cilium/cilium/pkg/policy"
 	"github.com/cilium/cilium/pkg/policy/api"
 
 	. "gopkg.in/check.v1"
@@ -173,3 +175,59 @@ func (ds *DaemonSuite) TestReplacePolicy(c *C) {
 	c.Assert(len(ds.d.policy.SearchRLocked(lbls)), Equals, 2)
 	ds.d.policy.Mutex.RUnlock()
 }
+
+type PolicyTraceSuite struct{}
+
+var _ = Suite(&PolicyTraceSuite{})
+
+func (s *PolicyTraceSuite) TestTraceRulesL7Verdict(c *C) {
+	d := &Daemon{policy: policy.NewPolicyRepository()}
+	_, err := d.policy.AddList(api.Rules{{
+		EndpointSelector: api.NewESFromLabels(labels.ParseSelectLabel("app=db")),
+		Ingress: []api.IngressRule{{
+			ToPorts: []api.PortRule{{
+				Ports: []api.PortProtocol{{Port: "80", Protocol: api.ProtoTCP}},
+				Rules: &api.L7Rules{
+					HTTP: []api.PortRuleHTTP{{Method: "GET", Path: "/public"}},
+				},
+			}},
+		}},
+	}})
+	c.Assert(err, IsNil)
+
+	port80 := []*models.Port{{Port: 80, Protocol: models.PortProtocolTCP}}
+	trace := func(path string, verdict api.Decision, dports []*models.Port) string {
+		ctx := &models.IdentityContext{
+			From:   []string{"app=api"},
+			To:     []string{"app=db"},
+			Dports: dports,
+			HTTP:   &models.TraceHTTPRequest{Method: "GET", Path: path},
+		}
+		searchCtx := &policy.SearchContext{
+			From: labels.NewSelectLabelArrayFromModel(ctx.From),
+			To:   labels.NewSelectLabelArrayFromModel(ctx.To),
+		}
+		result := &models.PolicyTraceResult{}
+
+		d.policy.Mutex.RLock()
+		d.traceRulesRLocked(searchCtx, ctx, verdict, result)
+		d.policy.Mutex.RUnlock()
+
+		c.Assert(result.L4, Not(IsNil))
+		return result.L7Verdict
+	}
+
+	c.Assert(trace("/public", api.Allowed, port80), Equals, api.Allowed.String())
+	c.Assert(trace("/private", api.Allowed, port80), Equals, api.Denied.String())
+	c.Assert(trace("/public/index.html", api.Allowed, port80), Equals, api.Denied.String())
+
+	// A request allowed by the L7 rules is denied if the L3/L4 policy
+	// denies the connection
+	c.Assert(trace("/public", api.Denied, port80), Equals, api.Denied.String())
+	c.Assert(trace("/public", api.Undecided, port80), Equals, api.Denied.String())
+
+	// Without destination ports, the L3/L4 verdict does not cover the L4
+	// rules and is derived from the ports of the ingress filters
+	c.Assert(trace("/public", api.Denied, nil), Equals, api.Allowed.String())
+	c.Assert(trace("/private", api.Denied, nil), Equals, api.Denied.String())
+}
@@ -16,17 +16,61 @@ package main
 
 import (
 	"encoding/json"
+	"fmt"
 	"path"
 	"strconv"
 
 	"github.com/cilium/cilium/common"
 	"github.com/cilium/cilium/common/types"
 	"github.com/cilium/cilium/pkg/kvstore"
+	"github.com/cilium/cilium/pkg/lock"
 	"github.com/cilium/cilium/pkg/logfields"
 
 	log "github.com/sirupsen/logrus"
 )
 
+// localServiceIDs allocates service IDs when no kvstore is configured. The
+// IDs are then only unique on the local node which is sufficient as each
+// node translates services on its own.
+var localServiceIDs = struct {
+	mutex lock.Mutex
+	bySHA map[string]types.L3n4AddrID
+	byID  map[types.ServiceID]string
+}{
+	bySHA: map[string]types.L3n4AddrID{},
+	byID:  map[types.ServiceID]string{},
+}
+
+// putLocalL3n4Addr is the local equivalent of PutL3n4Addr
+func putLocalL3n4Addr(l3n4Addr types.L3n4Addr, baseID uint32) (*types.L3n4AddrID, error) {
+	localServiceIDs.mutex.Lock()
+	defer localServiceIDs.mutex.Unlock()
+
+	sha256Sum := l3n4Addr.SHA256Sum()
+	if sl4, ok := localServiceIDs.bySHA[sha256Sum]; ok {
+		return &sl4, nil
+	}
+
+	id := types.ServiceID(baseID)
+	if _, ok := localServiceIDs.byID[id]; ok || baseID == 0 {
+		id = types.ServiceID(common.FirstFreeServiceID)
+		for {
+			if _, ok := localServiceIDs.byID[id]; !ok {
+				break
+			}
+			id++
+			if id == 0 {
+				return nil, fmt.Errorf("no service ID available")
+			}
+		}
+	}
+
+	sl4 := types.L3n4AddrID{L3n4Addr: l3n4Addr, ID: id}
+	localServiceIDs.bySHA[sha256Sum] = sl4
+	localServiceIDs.byID[id] = sha256Sum
+	return &sl4, nil
+}
+
 func updateL3n4AddrIDRef(id types.ServiceID, l3n4AddrID types.L3n4AddrID) error {
 	key := path.Join(common.ServiceIDKeyPath, strconv.FormatUint(uint64(id), 10))
 	return kvstore.Client().SetValue(key, l3n4AddrID)
@@ -52,6 +96,10 @@ func gasNewL3n4AddrID(l3n4AddrID *types.L3n4AddrID, baseID uint32) error {
 func PutL3n4Addr(l3n4Addr types.L3n4Addr, baseID uint32) (*types.L3n4AddrID, error) {
 	log.WithField(logfields.L3n4Addr, logfields.Repr(l3n4Addr)).Debug("Resolving service")
 
+	if !kvstore.IsEnabled() {
+		return putLocalL3n4Addr(l3n4Addr, baseID)
+	}
+
 	// Retrieve unique SHA256Sum for service
 	sha256Sum := l3n4Addr.SHA256Sum()
 	svcPath := path.Join(common.ServicesKeyPath, sha256Sum)
@@ -108,11 +156,30 @@ func GetL3n4AddrID(id uint32) (*types.L3n4AddrID, error) {
 	strID := strconv.FormatUint(uint64(id), 10)
 	log.WithField(logfields.L3n4AddrID, strID).Debug("getting L3n4AddrID for ID")
 
+	if !kvstore.IsEnabled() {
+		localServiceIDs.mutex.Lock()
+		defer localServiceIDs.mutex.Unlock()
+		if sha256Sum, ok := localServiceIDs.byID[types.ServiceID(id)]; ok {
+			sl4 := localServiceIDs.bySHA[sha256Sum]
+			return &sl4, nil
+		}
+		return nil, nil
+	}
+
 	return getL3n4AddrID(path.Join(common.ServiceIDKeyPath, strID))
 }
 
 // GetL3n4AddrIDBySHA256 returns the L3n4AddrID that have the given SHA256SUM.
 func GetL3n4AddrIDBySHA256(sha256sum string) (*types.L3n4AddrID, error) {
+	if !kvstore.IsEnabled() {
+		localServiceIDs.mutex.Lock()
+		defer localServiceIDs.mutex.Unlock()
+		if sl4, ok := localServiceIDs.bySHA[sha256sum]; ok {
+			return &sl4, nil
+		}
+		return nil, nil
+	}
+
 	return getL3n4AddrID(path.Join(common.ServicesKeyPath, sha256sum))
 }
 
@@ -137,6 +204,17 @@ func DeleteL3n4AddrIDBySHA256(sha256Sum string) error {
 	if sha256Sum == "" {
 		return nil
 	}
+
+	if !kvstore.IsEnabled() {
+		localServiceIDs.mutex.Lock()
+		if sl4, ok := localServiceIDs.bySHA[sha256Sum]; ok {
+			delete(localServiceIDs.byID, sl4.ID)
+			delete(localServiceIDs.bySHA, sha256Sum)
+		}
+		localServiceIDs.mutex.Unlock()
+		return nil
+	}
+
 	svcPath := path.Join(common.ServicesKeyPath, sha256Sum)
 	// Lock that sha256Sum
 	lockKey, err := kvstore.LockPath(svcPath)
@@ -146,3 +146,33 @@ func (ds *DaemonSuite) TestGetMaxServiceID(c *C) {
 	c.Assert(err, Equals, nil)
 	c.Assert(id, Equals, (common.MaxSetOfServiceID - 1))
 }
+
+type LocalServiceIDSuite struct{}
+
+var _ = Suite(&LocalServiceIDSuite{})
+
+func (s *LocalServiceIDSuite) TestPutLocalL3n4Addr(c *C) {
+	ffsIDu16 := types.ServiceID(uint16(common.FirstFreeServiceID))
+
+	l3n4AddrID, err := putLocalL3n4Addr(l3n4Addr1, 0)
+	c.Assert(err, IsNil)
+	c.Assert(l3n4AddrID.ID, Equals, ffsIDu16)
+
+	// The same service always resolves to the same ID
+	l3n4AddrID, err = putLocalL3n4Addr(l3n4Addr1, 99)
+	c.Assert(err, IsNil)
+	c.Assert(l3n4AddrID.ID, Equals, ffsIDu16)
+
+	// A free base ID is used, a taken one is not
+	l3n4AddrID, err = putLocalL3n4Addr(l3n4Addr2, 99)
+	c.Assert(err, IsNil)
+	c.Assert(l3n4AddrID.ID, Equals, types.ServiceID(99))
+
+	l3n4Addr4 := types.L3n4Addr{
+		IP:     net.IPv6loopback,
+		L4Addr: types.L4Addr{Port: 2, Protocol: "TCP"},
+	}
+	l3n4AddrID, err = putLocalL3n4Addr(l3n4Addr4, 99)
+	c.Assert(err, IsNil)
+	c.Assert(l3n4AddrID.ID, Equals, ffsIDu16+1)
+}
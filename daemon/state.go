@@ -147,11 +147,16 @@ func (d *Daemon) SyncState(dir string, clean bool) error {
 		"count.total":    total,
 	}).Info("Found endpoints of which some were restored")
 
+	// Templates of endpoints which were not restored are stale
+	if err := endpoint.RemoveUnusedTemplates(d.conf.StateDir); err != nil {
+		log.WithError(err).Warn("Unable to remove unused endpoint program templates")
+	}
+
 	return nil
 }
 
 func (d *Daemon) allocateIPsLocked(ep *endpoint.Endpoint) error {
-	err := ipam.AllocateIP(ep.IPv6.IP())
+	err := ipam.ClaimIP(ep.IPv6.IP(), ipamOwner(ep))
 	if err != nil {
 		// TODO if allocation failed reallocate a new IP address and setup veth
 		// pair accordingly
@@ -166,7 +171,7 @@ func (d *Daemon) allocateIPsLocked(ep *endpoint.Endpoint) error {
 
 	if !d.conf.IPv4Disabled {
 		if ep.IPv4 != nil {
-			if err = ipam.AllocateIP(ep.IPv4.IP()); err != nil {
+			if err = ipam.ClaimIP(ep.IPv4.IP(), ipamOwner(ep)); err != nil {
 				return fmt.Errorf("unable to reallocate IPv4 address: %s", err)
 			}
 		}
@@ -115,9 +115,7 @@ func (ds *DaemonSuite) generateEPs(baseDir string, epsWanted []*e.Endpoint, epsM
 			<-r.Done
 		}(r)
 	}
-	ds.OnGetCachedMaxLabelID = func() (policy.NumericIdentity, error) {
-		return policy.NumericIdentity(259), nil
-	}
+	ds.OnUpdateCiliumEndpoint = func(e *e.Endpoint) {}
 	ds.OnTracingEnabled = func() bool {
 		return false
 	}
@@ -16,9 +16,11 @@ package main
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/cilium/cilium/api/v1/models"
 	. "github.com/cilium/cilium/api/v1/server/restapi/daemon"
+	"github.com/cilium/cilium/pkg/ipam"
 	"github.com/cilium/cilium/pkg/k8s"
 	"github.com/cilium/cilium/pkg/kvstore"
 	"github.com/cilium/cilium/pkg/workloads/containerd"
@@ -70,6 +72,34 @@ func (d *Daemon) getK8sStatus() *models.K8sStatus {
 	return k8sStatus
 }
 
+// getKVStoreStatus returns the status of the connection to the kvstore. While
+// the kvstore is degraded, the agent keeps serving cached state and thus only
+// reports a warning.
+func getKVStoreStatus() *models.Status {
+	if !kvstore.IsEnabled() {
+		return &models.Status{State: models.StatusStateOk, Msg: "Disabled"}
+	}
+
+	cs := kvstore.GetConnectionStatus()
+
+	switch cs.State {
+	case kvstore.StateConnected:
+		msg := cs.Info
+		if cs.QueuedWrites > 0 {
+			msg = fmt.Sprintf("%s (%d queued writes)", msg, cs.QueuedWrites)
+		}
+		return &models.Status{State: models.StatusStateOk, Msg: msg}
+	case kvstore.StateDegraded:
+		return &models.Status{
+			State: models.StatusStateWarning,
+			Msg: fmt.Sprintf("Degraded since %s, %d failed health checks, %d queued writes: %s",
+				cs.Since.Format(time.RFC3339), cs.Failures, cs.QueuedWrites, cs.LastError),
+		}
+	default:
+		return &models.Status{State: models.StatusStateWarning, Msg: string(cs.State)}
+	}
+}
+
 type getHealthz struct {
 	daemon *Daemon
 }
@@ -82,11 +112,7 @@ func (h *getHealthz) Handle(params GetHealthzParams) middleware.Responder {
 	d := h.daemon
 	sr := models.StatusResponse{}
 
-	if info, err := kvstore.Client().Status(); err != nil {
-		sr.Kvstore = &models.Status{State: models.StatusStateFailure, Msg: fmt.Sprintf("Err: %s - %s", err, info)}
-	} else {
-		sr.Kvstore = &models.Status{State: models.StatusStateOk, Msg: info}
-	}
+	sr.Kvstore = getKVStoreStatus()
 
 	sr.ContainerRuntime = containerd.Status()
 
@@ -113,11 +139,20 @@ func (h *getHealthz) Handle(params GetHealthzParams) middleware.Responder {
 
 	if d.DebugEnabled() {
 		sr.IPAM = d.DumpIPAM()
+	} else if cp := ipam.ClusterPoolStatus(false); cp != nil {
+		sr.IPAM = &models.IPAMStatus{
+			Mode:        ipam.GetMode(),
+			ClusterPool: cp,
+		}
 	}
 
 	if nm := d.nodeMonitor; nm != nil {
 		sr.NodeMonitor = d.nodeMonitor.State()
 	}
 
+	if gc := d.identityGC; gc != nil {
+		sr.IdentityGc = gc.getStatus()
+	}
+
 	return NewGetHealthzOK().WithPayload(&sr)
 }
@@ -0,0 +1,317 @@
+// Copyright 2018 Authors of Cilium
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bpf
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// Section names as used by iproute2, see bpf/include/iproute2/bpf_elf.h
+	elfSectionLicense = "license"
+	elfSectionMaps    = "maps"
+
+	// elfMapSize is the size of struct bpf_elf_map
+	elfMapSize = 7 * 4
+
+	// insnSize is the size of a BPF instruction
+	insnSize = 8
+
+	// opLdImm64 is the opcode of the instruction loading a 64 bit
+	// immediate (BPF_LD | BPF_IMM | BPF_DW)
+	opLdImm64 = 0x18
+
+	// pseudoMapFd is the source register of a 64 bit immediate load
+	// marking the immediate as file descriptor of a map
+	pseudoMapFd = 1
+)
+
+// Pinning of maps. Must match PIN_* in bpf/include/iproute2/bpf_elf.h
+const (
+	// PinNone maps are not pinned and private to the object
+	PinNone = 0
+	// PinObjectNS maps are pinned in the namespace of the object
+	PinObjectNS = 1
+	// PinGlobalNS maps are pinned in the global namespace of the BPF
+	// filesystem, see MapPath()
+	PinGlobalNS = 2
+)
+
+// ELFMap is a map defined in the maps section of an ELF object. It
+// represents struct bpf_elf_map in bpf/include/iproute2/bpf_elf.h.
+type ELFMap struct {
+	Name       string
+	Type       MapType
+	KeySize    uint32
+	ValueSize  uint32
+	MaxEntries uint32
+	Flags      uint32
+	ID         uint32
+	Pinning    uint32
+}
+
+// mapRelocation is a reference of an instruction to a map
+type mapRelocation struct {
+	// offset is the offset of the instruction in the program
+	offset  uint64
+	mapName string
+}
+
+// ELFProgram is a program in a section of an ELF object
+type ELFProgram struct {
+	Section string
+	Insns   []byte
+
+	relocations []mapRelocation
+}
+
+// TailCall returns the ID of the program array map and the key the program
+// is installed at if the program is a tail call, i.e. if its section is
+// named "ID/KEY".
+func (p *ELFProgram) TailCall() (mapID, key uint32, ok bool) {
+	parts := strings.Split(p.Section, "/")
+	if len(parts) != 2 {
+		return 0, 0, false
+	}
+
+	id, err := strconv.ParseUint(parts[0], 10, 32)
+	if err != nil {
+		return 0, 0, false
+	}
+	k, err := strconv.ParseUint(parts[1], 10, 32)
+	if err != nil {
+		return 0, 0, false
+	}
+
+	return uint32(id), uint32(k), true
+}
+
+// ELFObject is an object file containing BPF programs and the definitions of
+// the maps used by the programs, in the format understood by iproute2
+type ELFObject struct {
+	License  string
+	Maps     []*ELFMap
+	Programs []*ELFProgram
+
+	byteOrder binary.ByteOrder
+}
+
+// OpenELF parses the ELF object at path
+func OpenELF(path string) (*ELFObject, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ParseELF(f)
+}
+
+// ParseELF parses the ELF object in r
+func ParseELF(r io.ReaderAt) (*ELFObject, error) {
+	f, err := elf.NewFile(r)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if f.Class != elf.ELFCLASS64 || f.Machine != elf.Machine(247) {
+		return nil, fmt.Errorf("unsupported ELF object: %s %s", f.Class, f.Machine)
+	}
+
+	o := &ELFObject{byteOrder: f.ByteOrder}
+
+	symbols, err := f.Symbols()
+	if err != nil {
+		return nil, fmt.Errorf("unable to read symbols: %s", err)
+	}
+
+	programs := map[int]*ELFProgram{}
+	for i, s := range f.Sections {
+		switch {
+		case s.Name == elfSectionLicense:
+			data, err := s.Data()
+			if err != nil {
+				return nil, fmt.Errorf("unable to read license: %s", err)
+			}
+			o.License = string(bytes.TrimRight(data, "\x00"))
+
+		case s.Name == elfSectionMaps:
+			if err := o.parseMaps(f, i, symbols); err != nil {
+				return nil, err
+			}
+
+		case s.Type == elf.SHT_PROGBITS && s.Flags&elf.SHF_EXECINSTR != 0 && s.Size > 0:
+			data, err := s.Data()
+			if err != nil {
+				return nil, fmt.Errorf("unable to read section %s: %s", s.Name, err)
+			}
+			p := &ELFProgram{Section: s.Name, Insns: data}
+			programs[i] = p
+			o.Programs = append(o.Programs, p)
+		}
+	}
+
+	for _, s := range f.Sections {
+		if s.Type != elf.SHT_REL {
+			continue
+		}
+		p, ok := programs[int(s.Info)]
+		if !ok {
+			continue
+		}
+		if err := o.parseRelocations(f, s, p, symbols); err != nil {
+			return nil, err
+		}
+	}
+
+	return o, nil
+}
+
+// parseMaps parses the definitions of all maps in the maps section with the
+// index idx
+func (o *ELFObject) parseMaps(f *elf.File, idx int, symbols []elf.Symbol) error {
+	data, err := f.Sections[idx].Data()
+	if err != nil {
+		return fmt.Errorf("unable to read map definitions: %s", err)
+	}
+
+	// Keep the maps in the order of their definition
+	var defs []elf.Symbol
+	for _, sym := range symbols {
+		if int(sym.Section) == idx && elf.ST_TYPE(sym.Info) != elf.STT_SECTION {
+			defs = append(defs, sym)
+		}
+	}
+	sort.Slice(defs, func(i, j int) bool {
+		return defs[i].Value < defs[j].Value
+	})
+
+	for _, sym := range defs {
+		if sym.Value+elfMapSize > uint64(len(data)) {
+			return fmt.Errorf("definition of map %s exceeds maps section", sym.Name)
+		}
+
+		def := data[sym.Value:]
+		o.Maps = append(o.Maps, &ELFMap{
+			Name:       sym.Name,
+			Type:       MapType(o.byteOrder.Uint32(def[0:])),
+			KeySize:    o.byteOrder.Uint32(def[4:]),
+			ValueSize:  o.byteOrder.Uint32(def[8:]),
+			MaxEntries: o.byteOrder.Uint32(def[12:]),
+			Flags:      o.byteOrder.Uint32(def[16:]),
+			ID:         o.byteOrder.Uint32(def[20:]),
+			Pinning:    o.byteOrder.Uint32(def[24:]),
+		})
+	}
+
+	return nil
+}
+
+// parseRelocations parses the relocations in section s of the program p.
+// Only references to maps are supported.
+func (o *ELFObject) parseRelocations(f *elf.File, s *elf.Section, p *ELFProgram, symbols []elf.Symbol) error {
+	data, err := s.Data()
+	if err != nil {
+		return fmt.Errorf("unable to read relocations of section %s: %s", p.Section, err)
+	}
+
+	var rel elf.Rel64
+	r := bytes.NewReader(data)
+	for {
+		if err := binary.Read(r, o.byteOrder, &rel); err == io.EOF {
+			break
+		} else if err != nil {
+			return fmt.Errorf("unable to read relocations of section %s: %s", p.Section, err)
+		}
+
+		// Symbols() omits the null symbol at index 0
+		symIdx := int(elf.R_SYM64(rel.Info))
+		if symIdx == 0 || symIdx > len(symbols) {
+			return fmt.Errorf("invalid symbol index %d in relocations of section %s", symIdx, p.Section)
+		}
+		sym := symbols[symIdx-1]
+
+		if sym.Section == elf.SHN_UNDEF {
+			return fmt.Errorf("relocation against undefined symbol %s in section %s", sym.Name, p.Section)
+		}
+		if int(sym.Section) >= len(f.Sections) || f.Sections[sym.Section].Name != elfSectionMaps {
+			return fmt.Errorf("unsupported relocation against symbol %s in section %s", sym.Name, p.Section)
+		}
+		if rel.Off+2*insnSize > uint64(len(p.Insns)) || p.Insns[rel.Off] != opLdImm64 {
+			return fmt.Errorf("reference to map %s at offset %d in section %s is not a 64 bit immediate load",
+				sym.Name, rel.Off, p.Section)
+		}
+
+		p.relocations = append(p.relocations, mapRelocation{offset: rel.Off, mapName: sym.Name})
+	}
+
+	return nil
+}
+
+// Map returns the definition of the map with the given name
+func (o *ELFObject) Map(name string) *ELFMap {
+	for _, m := range o.Maps {
+		if m.Name == name {
+			return m
+		}
+	}
+	return nil
+}
+
+// Program returns the program in the given section
+func (o *ELFObject) Program(section string) *ELFProgram {
+	for _, p := range o.Programs {
+		if p.Section == section {
+			return p
+		}
+	}
+	return nil
+}
+
+// relocate returns the instructions of p with all references to maps
+// replaced by the file descriptors in fds
+func (o *ELFObject) relocate(p *ELFProgram, fds map[string]int) ([]byte, error) {
+	insns := make([]byte, len(p.Insns))
+	copy(insns, p.Insns)
+
+	for _, rel := range p.relocations {
+		fd, ok := fds[rel.mapName]
+		if !ok {
+			return nil, fmt.Errorf("map %s referenced by section %s is not defined", rel.mapName, p.Section)
+		}
+
+		// The source register is the upper nibble of the second byte
+		// on little endian and the lower nibble on big endian
+		regs := insns[rel.offset+1]
+		if o.byteOrder == binary.LittleEndian {
+			regs = regs&0x0f | pseudoMapFd<<4
+		} else {
+			regs = regs&0xf0 | pseudoMapFd
+		}
+		insns[rel.offset+1] = regs
+		o.byteOrder.PutUint32(insns[rel.offset+4:], uint32(fd))
+	}
+
+	return insns, nil
+}
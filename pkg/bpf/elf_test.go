@@ -0,0 +1,170 @@
+// Copyright 2018 Authors of Cilium
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bpf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+	"unsafe"
+
+	. "gopkg.in/check.v1"
+)
+
+// Hook up gocheck into the "go test" runner.
+func Test(t *testing.T) { TestingT(t) }
+
+type ELFSuite struct{}
+
+var _ = Suite(&ELFSuite{})
+
+func (s *ELFSuite) TestOpenELF(c *C) {
+	o, err := OpenELF("testdata/object.o")
+	c.Assert(err, IsNil)
+
+	c.Assert(o.License, Equals, "GPL")
+
+	c.Assert(o.Maps, HasLen, 2)
+	c.Assert(*o.Maps[0], DeepEquals, ELFMap{
+		Name:       "cilium_calls_42",
+		Type:       MapTypeProgArray,
+		KeySize:    4,
+		ValueSize:  4,
+		MaxEntries: 16,
+		ID:         1,
+		Pinning:    PinGlobalNS,
+	})
+	c.Assert(o.Maps[1].Name, Equals, "cilium_policy_42")
+	c.Assert(o.Map("cilium_policy_42"), Equals, o.Maps[1])
+	c.Assert(o.Map("foo"), IsNil)
+
+	c.Assert(o.Programs, HasLen, 2)
+	prog := o.Program("from-container")
+	c.Assert(prog, Not(IsNil))
+	c.Assert(prog.relocations, DeepEquals, []mapRelocation{{offset: 0, mapName: "cilium_calls_42"}})
+	_, _, ok := prog.TailCall()
+	c.Assert(ok, Equals, false)
+
+	tail := o.Program("1/42")
+	c.Assert(tail, Not(IsNil))
+	c.Assert(tail.relocations, DeepEquals, []mapRelocation{{offset: 8, mapName: "cilium_policy_42"}})
+	mapID, key, ok := tail.TailCall()
+	c.Assert(ok, Equals, true)
+	c.Assert(mapID, Equals, uint32(1))
+	c.Assert(key, Equals, uint32(42))
+
+	c.Assert(o.Program("2/42"), IsNil)
+
+	_, err = ParseELF(bytes.NewReader([]byte("not an object")))
+	c.Assert(err, Not(IsNil))
+}
+
+func (s *ELFSuite) TestRelocate(c *C) {
+	o, err := OpenELF("testdata/object.o")
+	c.Assert(err, IsNil)
+
+	prog := o.Program("1/42")
+	insns, err := o.relocate(prog, map[string]int{"cilium_policy_42": 7})
+	c.Assert(err, IsNil)
+
+	// r3 = map fd 7
+	c.Assert(insns[8], Equals, byte(opLdImm64))
+	c.Assert(insns[9], Equals, byte(pseudoMapFd<<4|3))
+	c.Assert(binary.LittleEndian.Uint32(insns[12:]), Equals, uint32(7))
+
+	// The program itself is not modified
+	c.Assert(prog.Insns[9], Equals, byte(3))
+
+	_, err = o.relocate(prog, map[string]int{})
+	c.Assert(err, Not(IsNil))
+}
+
+func (s *ELFSuite) TestVerifierError(c *C) {
+	err := &VerifierError{
+		Section: "from-container",
+		Err:     errors.New("permission denied"),
+		Log:     "0: (b7) r0 = 0\n1: (95) exit\nR0 !read_ok\n",
+	}
+
+	c.Assert(err.Tail(1), DeepEquals, []string{"R0 !read_ok"})
+	c.Assert(err.Tail(5), HasLen, 3)
+	c.Assert(err.Error(), Equals, "program in section from-container rejected by verifier: "+
+		"permission denied: 0: (b7) r0 = 0 1: (95) exit R0 !read_ok")
+}
+
+func (s *ELFSuite) TestLoadUnknownSection(c *C) {
+	o, err := OpenELF("testdata/object.o")
+	c.Assert(err, IsNil)
+
+	// Fails before any map is opened
+	_, err = o.Load("2/42", ProgTypeSchedCls)
+	c.Assert(err, ErrorMatches, "section 2/42 not found")
+}
+
+func (s *ELFSuite) TestProgArrayByID(c *C) {
+	o, err := OpenELF("testdata/object.o")
+	c.Assert(err, IsNil)
+
+	calls := &Map{}
+	maps := map[string]*Map{"cilium_calls_42": calls, "cilium_policy_42": {}}
+	c.Assert(o.progArrayByID(maps, 1), Equals, calls)
+	// cilium_policy_42 is not a program array
+	c.Assert(o.progArrayByID(maps, 0), IsNil)
+	c.Assert(o.progArrayByID(maps, 2), IsNil)
+}
+
+func (s *ELFSuite) TestLoad(c *C) {
+	if !IsBpffs("/sys/fs/bpf") {
+		c.Skip("BPF filesystem not mounted at /sys/fs/bpf")
+	}
+
+	root, err := ioutil.TempDir("/sys/fs/bpf", "cilium-test")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(root)
+	SetMapRoot(root)
+
+	o, err := OpenELF("testdata/object.o")
+	c.Assert(err, IsNil)
+
+	fd, err := o.Load("from-container", ProgTypeSchedCls)
+	c.Assert(err, IsNil)
+	c.Assert(fd > 0, Equals, true)
+	c.Assert(ObjClose(fd), IsNil)
+
+	// All maps are pinned
+	for _, name := range []string{"cilium_calls_42", "cilium_policy_42"} {
+		_, err := os.Stat(MapPath(name))
+		c.Assert(err, IsNil, Commentf("map %s not pinned", name))
+	}
+
+	// The tail call is installed at its key in the program array
+	calls, err := ObjGet(MapPath("cilium_calls_42"))
+	c.Assert(err, IsNil)
+	defer ObjClose(calls)
+
+	var value uint32
+	key := uint32(42)
+	c.Assert(LookupElement(calls, unsafe.Pointer(&key), unsafe.Pointer(&value)), IsNil)
+	key = 0
+	c.Assert(LookupElement(calls, unsafe.Pointer(&key), unsafe.Pointer(&value)), Not(IsNil))
+
+	// Loading again reuses the pinned maps
+	fd, err = o.Load("from-container", ProgTypeSchedCls)
+	c.Assert(err, IsNil)
+	c.Assert(ObjClose(fd), IsNil)
+}
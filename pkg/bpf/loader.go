@@ -0,0 +1,245 @@
+// Copyright 2018 Authors of Cilium
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bpf
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"unsafe"
+
+	"github.com/cilium/cilium/pkg/logfields"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// verifierLogSizeMin and verifierLogSizeMax are the bounds of the
+	// size of the buffer the verifier log is written to
+	verifierLogSizeMin = 64 * 1024
+	verifierLogSizeMax = 16 * 1024 * 1024
+
+	// verifierErrorLines is the number of lines at the end of the
+	// verifier log included in VerifierError.Error()
+	verifierErrorLines = 3
+)
+
+// VerifierError is returned if the kernel rejects a program
+type VerifierError struct {
+	// Section is the ELF section of the rejected program
+	Section string
+
+	// Err is the error returned by the bpf(2) system call
+	Err error
+
+	// Log is the log of the verifier
+	Log string
+}
+
+// Tail returns the last n lines of the verifier log. These lines usually
+// explain why the program has been rejected.
+func (e *VerifierError) Tail(n int) []string {
+	lines := strings.Split(strings.TrimRight(e.Log, "\n"), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return lines
+}
+
+func (e *VerifierError) Error() string {
+	msg := fmt.Sprintf("program in section %s rejected by verifier: %s", e.Section, e.Err)
+	if e.Log != "" {
+		msg += ": " + strings.Join(e.Tail(verifierErrorLines), " ")
+	}
+	return msg
+}
+
+// loadProgram loads the instructions insns as program of type progType.
+// If the program is rejected, the returned error is a *VerifierError.
+func loadProgram(section string, progType ProgType, insns []byte, license string) (int, error) {
+	if len(insns) == 0 {
+		return 0, fmt.Errorf("section %s is empty", section)
+	}
+
+	lic := append([]byte(license), 0)
+
+	// This struct must be in sync with union bpf_attr's anonymous struct
+	// used by the BPF_PROG_LOAD command
+	attr := struct {
+		progType    uint32
+		insnCnt     uint32
+		insns       uint64
+		license     uint64
+		logLevel    uint32
+		logSize     uint32
+		logBuf      uint64
+		kernVersion uint32
+	}{
+		progType: uint32(progType),
+		insnCnt:  uint32(len(insns) / insnSize),
+		insns:    uint64(uintptr(unsafe.Pointer(&insns[0]))),
+		license:  uint64(uintptr(unsafe.Pointer(&lic[0]))),
+	}
+
+	fd, _, errno := unix.Syscall(unix.SYS_BPF, BPF_PROG_LOAD,
+		uintptr(unsafe.Pointer(&attr)), unsafe.Sizeof(attr))
+	if errno == 0 {
+		return int(fd), nil
+	}
+	loadErr := error(errno)
+
+	// Load the program again with the verifier log enabled to explain
+	// why it has been rejected. The log buffer is grown as long as the
+	// log does not fit.
+	for size := verifierLogSizeMin; size <= verifierLogSizeMax; size *= 2 {
+		logBuf := make([]byte, size)
+		attr.logLevel = 1
+		attr.logSize = uint32(size)
+		attr.logBuf = uint64(uintptr(unsafe.Pointer(&logBuf[0])))
+
+		fd, _, errno = unix.Syscall(unix.SYS_BPF, BPF_PROG_LOAD,
+			uintptr(unsafe.Pointer(&attr)), unsafe.Sizeof(attr))
+		if errno == 0 {
+			// The program only failed to load without the log
+			return int(fd), nil
+		}
+		if errno == unix.ENOSPC && size < verifierLogSizeMax {
+			continue
+		}
+
+		if n := bytes.IndexByte(logBuf, 0); n >= 0 {
+			logBuf = logBuf[:n]
+		}
+		return 0, &VerifierError{Section: section, Err: errno, Log: string(logBuf)}
+	}
+
+	return 0, &VerifierError{Section: section, Err: loadErr}
+}
+
+// openMaps opens or creates all maps defined in the object and returns
+// them by name
+func (o *ELFObject) openMaps() (map[string]*Map, error) {
+	maps := map[string]*Map{}
+
+	for _, def := range o.Maps {
+		m := NewMap(def.Name, def.Type, int(def.KeySize), int(def.ValueSize), int(def.MaxEntries), def.Flags)
+
+		switch def.Pinning {
+		case PinGlobalNS:
+			if _, err := m.OpenOrCreate(); err != nil {
+				closeMaps(maps)
+				return nil, fmt.Errorf("unable to open map %s: %s", def.Name, err)
+			}
+		case PinNone:
+			fd, err := CreateMap(int(def.Type), def.KeySize, def.ValueSize, def.MaxEntries, def.Flags)
+			if err != nil {
+				closeMaps(maps)
+				return nil, fmt.Errorf("unable to create map %s: %s", def.Name, err)
+			}
+			m.fd = fd
+		default:
+			closeMaps(maps)
+			return nil, fmt.Errorf("unsupported pinning %d of map %s", def.Pinning, def.Name)
+		}
+
+		maps[def.Name] = m
+	}
+
+	return maps, nil
+}
+
+func closeMaps(maps map[string]*Map) {
+	for _, m := range maps {
+		m.Close()
+	}
+}
+
+// progArrayByID returns the program array map in maps with the given ID
+func (o *ELFObject) progArrayByID(maps map[string]*Map, id uint32) *Map {
+	for _, def := range o.Maps {
+		if def.ID == id && def.Type == MapTypeProgArray {
+			return maps[def.Name]
+		}
+	}
+	return nil
+}
+
+// loadSection relocates and loads the program p
+func (o *ELFObject) loadSection(p *ELFProgram, progType ProgType, fds map[string]int) (int, error) {
+	insns, err := o.relocate(p, fds)
+	if err != nil {
+		return 0, err
+	}
+
+	return loadProgram(p.Section, progType, insns, o.License)
+}
+
+// Load opens or creates all maps of the object, loads all tail call
+// programs into the program array maps and loads the program in section.
+// References to maps are relocated to the maps pinned in the BPF
+// filesystem. The returned file descriptor of the program in section must
+// be closed by the caller. If a program is rejected by the verifier, the
+// returned error is a *VerifierError.
+func (o *ELFObject) Load(section string, progType ProgType) (int, error) {
+	prog := o.Program(section)
+	if prog == nil {
+		return 0, fmt.Errorf("section %s not found", section)
+	}
+
+	maps, err := o.openMaps()
+	if err != nil {
+		return 0, err
+	}
+	defer closeMaps(maps)
+
+	fds := map[string]int{}
+	for name, m := range maps {
+		fds[name] = m.GetFd()
+	}
+
+	// Tail calls are installed before the program in section is loaded
+	// so that it never calls into a missing or stale tail call
+	for _, p := range o.Programs {
+		mapID, key, ok := p.TailCall()
+		if !ok {
+			continue
+		}
+
+		progArray := o.progArrayByID(maps, mapID)
+		if progArray == nil {
+			return 0, fmt.Errorf("no program array with ID %d for section %s", mapID, p.Section)
+		}
+
+		fd, err := o.loadSection(p, progType, fds)
+		if err != nil {
+			return 0, err
+		}
+
+		value := uint32(fd)
+		err = UpdateElement(progArray.GetFd(), unsafe.Pointer(&key), unsafe.Pointer(&value), BPF_ANY)
+		ObjClose(fd)
+		if err != nil {
+			return 0, fmt.Errorf("unable to install tail call %s: %s", p.Section, err)
+		}
+
+		log.WithFields(log.Fields{
+			logfields.Path: progArray.path,
+			"section":      p.Section,
+		}).Debug("Installed tail call")
+	}
+
+	return o.loadSection(prog, progType, fds)
+}
@@ -0,0 +1,129 @@
+// Copyright 2018 Authors of Cilium
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bpf
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netlink/nl"
+	"golang.org/x/sys/unix"
+)
+
+// TCHook is a hook of the clsact qdisc programs can be attached to
+type TCHook uint32
+
+const (
+	// TCIngress is the hook for packets received by the interface
+	TCIngress TCHook = netlink.HANDLE_MIN_INGRESS
+	// TCEgress is the hook for packets transmitted by the interface
+	TCEgress TCHook = netlink.HANDLE_MIN_EGRESS
+
+	// tcFilterPrio and tcFilterHandle identify the filter programs are
+	// attached as so that attaching replaces the previous program
+	tcFilterPrio   = 1
+	tcFilterHandle = 1
+)
+
+func (h TCHook) String() string {
+	switch h {
+	case TCIngress:
+		return "ingress"
+	case TCEgress:
+		return "egress"
+	}
+	return "unknown"
+}
+
+// ensureClsact adds the clsact qdisc to link unless it exists already
+func ensureClsact(link netlink.Link) error {
+	qdiscs, err := netlink.QdiscList(link)
+	if err != nil {
+		return err
+	}
+	for _, q := range qdiscs {
+		if q.Type() == "clsact" {
+			return nil
+		}
+	}
+
+	return netlink.QdiscAdd(&netlink.GenericQdisc{
+		QdiscAttrs: netlink.QdiscAttrs{
+			LinkIndex: link.Attrs().Index,
+			Handle:    netlink.MakeHandle(0xffff, 0),
+			Parent:    netlink.HANDLE_CLSACT,
+		},
+		QdiscType: "clsact",
+	})
+}
+
+// AttachSchedCls attaches the sched_cls program fd in direct action mode to
+// hook of the interface ifName, replacing any program attached before.
+// Equivalent to:
+//
+//	tc qdisc replace dev $ifName clsact
+//	tc filter replace dev $ifName $hook prio 1 handle 1 bpf da fd $fd
+func AttachSchedCls(ifName string, hook TCHook, fd int, name string) error {
+	link, err := netlink.LinkByName(ifName)
+	if err != nil {
+		return fmt.Errorf("unable to find interface %s: %s", ifName, err)
+	}
+
+	if err := ensureClsact(link); err != nil {
+		return fmt.Errorf("unable to add clsact qdisc to %s: %s", ifName, err)
+	}
+
+	// The vendored netlink library can only add but not replace filters
+	req := nl.NewNetlinkRequest(unix.RTM_NEWTFILTER, unix.NLM_F_CREATE|unix.NLM_F_REPLACE|unix.NLM_F_ACK)
+	req.AddData(&nl.TcMsg{
+		Family:  nl.FAMILY_ALL,
+		Ifindex: int32(link.Attrs().Index),
+		Handle:  tcFilterHandle,
+		Parent:  uint32(hook),
+		Info:    netlink.MakeHandle(tcFilterPrio, nl.Swap16(unix.ETH_P_ALL)),
+	})
+	req.AddData(nl.NewRtAttr(nl.TCA_KIND, nl.ZeroTerminated("bpf")))
+
+	options := nl.NewRtAttr(nl.TCA_OPTIONS, nil)
+	nl.NewRtAttrChild(options, nl.TCA_BPF_FD, nl.Uint32Attr(uint32(fd)))
+	nl.NewRtAttrChild(options, nl.TCA_BPF_NAME, nl.ZeroTerminated(name))
+	nl.NewRtAttrChild(options, nl.TCA_BPF_FLAGS, nl.Uint32Attr(nl.TCA_BPF_FLAG_ACT_DIRECT))
+	req.AddData(options)
+
+	if _, err := req.Execute(unix.NETLINK_ROUTE, 0); err != nil {
+		return fmt.Errorf("unable to attach program %s to %s of %s: %s", name, hook, ifName, err)
+	}
+
+	return nil
+}
+
+// LoadAndAttachSchedCls loads the program in section of the ELF object at
+// path as described in ELFObject.Load() and attaches it to hook of the
+// interface ifName.
+func LoadAndAttachSchedCls(path, section, ifName string, hook TCHook) error {
+	obj, err := OpenELF(path)
+	if err != nil {
+		return fmt.Errorf("unable to parse %s: %s", path, err)
+	}
+
+	fd, err := obj.Load(section, ProgTypeSchedCls)
+	if err != nil {
+		return err
+	}
+	defer ObjClose(fd)
+
+	return AttachSchedCls(ifName, hook, fd, fmt.Sprintf("%s:[%s]", filepath.Base(path), section))
+}
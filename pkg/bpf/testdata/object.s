@@ -0,0 +1,47 @@
+# Object used by the tests of pkg/bpf, assemble with:
+#   llvm-mc -triple bpf -filetype=obj object.s -o object.o
+
+	.section	from-container,"ax",@progbits
+	.globl	handle_ingress
+handle_ingress:
+	r1 = cilium_calls_42 ll
+	r2 = 0
+	r0 = 0
+	exit
+
+	.section	1/42,"ax",@progbits
+	.globl	handle_policy
+handle_policy:
+	r0 = 0
+	r3 = cilium_policy_42 ll
+	exit
+
+	.section	maps,"aw",@progbits
+	.globl	cilium_calls_42
+	.p2align	2
+cilium_calls_42:
+	.long	3
+	.long	4
+	.long	4
+	.long	16
+	.long	0
+	.long	1
+	.long	2
+	.size	cilium_calls_42, 28
+
+	.globl	cilium_policy_42
+	.p2align	2
+cilium_policy_42:
+	.long	1
+	.long	8
+	.long	24
+	.long	1024
+	.long	0
+	.long	0
+	.long	2
+	.size	cilium_policy_42, 28
+
+	.section	license,"aw",@progbits
+	.globl	__license
+__license:
+	.asciz	"GPL"
@@ -28,6 +28,7 @@ const (
 	MessageTypeDebug
 	MessageTypeCapture
 	MessageTypeTrace
+	MessageTypePolicyVerdict
 )
 
 // must be in sync with <bpf/lib/dbg.h>
@@ -72,6 +72,8 @@ var errors = map[uint8]string{
 	158: "Service backend not found",
 	159: "Policy denied (L4)",
 	160: "No tunnel/encapsulation endpoint (datapath BUG!)",
+	161: "Policy denied (audit mode, allowed)",
+	162: "Bandwidth limit exceeded",
 }
 
 func dropReason(reason uint8) string {
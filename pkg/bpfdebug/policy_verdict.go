@@ -0,0 +1,140 @@
+// Copyright 2017 Authors of Cilium
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bpfdebug
+
+import (
+	"fmt"
+
+	"github.com/cilium/cilium/pkg/byteorder"
+	"github.com/cilium/cilium/pkg/u8proto"
+)
+
+const (
+	// PolicyVerdictNotifyLen is the amount of packet data provided in a
+	// policy verdict notification
+	PolicyVerdictNotifyLen = 32
+)
+
+// PolicyVerdictNotify is the message format of a policy verdict notification
+// in the BPF ring buffer
+type PolicyVerdictNotify struct {
+	Type      uint8
+	MatchType uint8
+	Source    uint16
+	Hash      uint32
+	OrigLen   uint32
+	CapLen    uint32
+	SrcLabel  uint32
+	DstLabel  uint32
+	Verdict   int32
+	DstPort   uint16
+	Proto     uint8
+	Flags     uint8
+	// data
+}
+
+// Policy map entries which can match a packet, must be in sync with
+// <bpf/lib/policy_log.h>
+const (
+	PolicyMatchNone = iota
+	PolicyMatchL3Only
+	PolicyMatchL3L4
+	PolicyMatchCIDR
+	PolicyMatchAll
+	PolicyMatchL4Only
+)
+
+var policyMatchTypes = map[uint8]string{
+	PolicyMatchNone:   "none",
+	PolicyMatchL3Only: "L3-Only",
+	PolicyMatchL3L4:   "L3-L4",
+	PolicyMatchCIDR:   "CIDR",
+	PolicyMatchAll:    "all",
+	PolicyMatchL4Only: "L4-Only",
+}
+
+func policyMatchType(matchType uint8) string {
+	if str, ok := policyMatchTypes[matchType]; ok {
+		return str
+	}
+	return fmt.Sprintf("%d", matchType)
+}
+
+// Policy verdict flags, must be in sync with <bpf/lib/policy_log.h>
+const (
+	PolicyIngress = 1 << iota
+	PolicyEgress
+	PolicyVerdictAudit
+)
+
+// IsIngress returns true if the verdict was made for an ingress connection
+func (n *PolicyVerdictNotify) IsIngress() bool {
+	return n.Flags&PolicyIngress != 0
+}
+
+// IsAudit returns true if the verdict was made while the endpoint was in
+// policy audit mode
+func (n *PolicyVerdictNotify) IsAudit() bool {
+	return n.Flags&PolicyVerdictAudit != 0
+}
+
+func (n *PolicyVerdictNotify) direction() string {
+	switch {
+	case n.Flags&PolicyIngress != 0:
+		return "ingress"
+	case n.Flags&PolicyEgress != 0:
+		return "egress"
+	}
+	return "unknown"
+}
+
+func (n *PolicyVerdictNotify) verdict() string {
+	switch {
+	case n.Verdict == 0:
+		return "allow"
+	case n.IsAudit():
+		return "audit"
+	}
+	return "deny"
+}
+
+func (n *PolicyVerdictNotify) port() string {
+	proto := u8proto.U8proto(n.Proto)
+	return fmt.Sprintf("%d/%s", byteorder.NetworkToHost(n.DstPort), proto.String())
+}
+
+// DumpInfo prints a summary of the policy verdict messages.
+func (n *PolicyVerdictNotify) DumpInfo(data []byte) {
+	fmt.Printf("Policy verdict log: %s, match %s, %s %s, identity %d->%d: %s\n",
+		n.verdict(), policyMatchType(n.MatchType), n.direction(), n.port(),
+		n.SrcLabel, n.DstLabel, GetConnectionSummary(data[PolicyVerdictNotifyLen:]))
+}
+
+// DumpVerbose prints the policy verdict notification in human readable form
+func (n *PolicyVerdictNotify) DumpVerbose(dissect bool, data []byte, prefix string) {
+	fmt.Printf("%s MARK %#x FROM %d POLICY VERDICT: %d bytes, %s, match %s, %s %s, identity %d->%d",
+		prefix, n.Hash, n.Source, n.OrigLen, n.verdict(), policyMatchType(n.MatchType),
+		n.direction(), n.port(), n.SrcLabel, n.DstLabel)
+
+	if n.Verdict != 0 {
+		fmt.Printf(", reason %s\n", dropReason(uint8(-n.Verdict)))
+	} else {
+		fmt.Printf("\n")
+	}
+
+	if n.CapLen > 0 && len(data) > PolicyVerdictNotifyLen {
+		Dissect(dissect, data[PolicyVerdictNotifyLen:])
+	}
+}
@@ -25,13 +25,23 @@ const (
 )
 
 // IPAMAllocate allocates an IP address out of address family specific pool.
-func (c *Client) IPAMAllocate(family string) (*models.IPAM, error) {
+// If pool is empty, the pool is selected based on the annotations of the
+// owner, given in the form namespace/pod, or the default pool is used.
+func (c *Client) IPAMAllocate(family, pool, owner string) (*models.IPAM, error) {
 	params := ipam.NewPostIPAMParams()
 
 	if family != "" {
 		params.SetFamily(&family)
 	}
 
+	if pool != "" {
+		params.SetPool(&pool)
+	}
+
+	if owner != "" {
+		params.SetOwner(&owner)
+	}
+
 	resp, err := c.IPAM.PostIPAM(params)
 	if err != nil {
 		return nil, Hint(err)
@@ -52,3 +62,12 @@ func (c *Client) IPAMReleaseIP(ip string) error {
 	_, err := c.IPAM.DeleteIPAMIP(params)
 	return Hint(err)
 }
+
+// IPAMGet returns the IP address management status.
+func (c *Client) IPAMGet() (*models.IPAMStatus, error) {
+	resp, err := c.IPAM.GetIPAM(nil)
+	if err != nil {
+		return nil, Hint(err)
+	}
+	return resp.Payload, nil
+}
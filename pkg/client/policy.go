@@ -58,3 +58,14 @@ func (c *Client) PolicyResolveGet(context *models.IdentityContext) (*models.Poli
 	}
 	return resp.Payload, nil
 }
+
+// PolicyDiffGet returns the access changes which importing `policyJSON`
+// would cause.
+func (c *Client) PolicyDiffGet(policyJSON string) (*models.PolicyDiffResult, error) {
+	params := policy.NewGetPolicyDiffParams().WithPolicy(&policyJSON)
+	resp, err := c.Policy.GetPolicyDiff(params)
+	if err != nil {
+		return nil, Hint(err)
+	}
+	return resp.Payload, nil
+}
@@ -0,0 +1,311 @@
+// Copyright 2018 Authors of Cilium
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package elf substitutes static data and strings in compiled BPF programs so
+// that a program compiled once can be instantiated for many endpoints.
+//
+// Static data is accessed by the BPF program through 64 bit immediate loads
+// of an undefined symbol, see fetch_u32() in <bpf/lib/static_data.h>. The
+// value of the symbol is written into the immediate of each load and the
+// relocation is removed so that the loader does not need to know about it.
+package elf
+
+import (
+	"bytes"
+	goelf "debug/elf"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+)
+
+const (
+	// emBPF is the ELF machine type of BPF programs
+	emBPF = goelf.Machine(247)
+
+	// ldImm64 is the opcode of the BPF instruction loading a 64 bit
+	// immediate (BPF_LD | BPF_IMM | BPF_DW)
+	ldImm64 = 0x18
+
+	// Sizes and offsets of the ELF64 structures accessed directly
+	symSize            = 24
+	relSize            = 16
+	shdrSizeOffset     = 0x20
+	ehdrShoffOffset    = 0x28
+	ehdrShentsOffset   = 0x3a
+	ehdrShstrndxOffset = 0x3e
+)
+
+// symbol is an entry of the symbol table
+type symbol struct {
+	name  string
+	shndx goelf.SectionIndex
+}
+
+// nameRef is a reference to a name in a string table
+type nameRef struct {
+	table *goelf.Section
+	off   uint32
+	name  string
+}
+
+// ELF is a compiled BPF program which can be written with substituted static
+// data and strings
+type ELF struct {
+	data      []byte
+	file      *goelf.File
+	byteOrder binary.ByteOrder
+
+	shoff     uint64
+	shentsize uint64
+
+	symbols []symbol
+	names   []nameRef
+}
+
+// Open reads the compiled BPF program at path
+func Open(path string) (*ELF, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return parse(data)
+}
+
+func parse(data []byte) (*ELF, error) {
+	f, err := goelf.NewFile(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	if f.Class != goelf.ELFCLASS64 || f.Machine != emBPF {
+		return nil, fmt.Errorf("unsupported ELF object: %s %s", f.Class, f.Machine)
+	}
+
+	e := &ELF{
+		data:      data,
+		file:      f,
+		byteOrder: f.ByteOrder,
+		shoff:     f.ByteOrder.Uint64(data[ehdrShoffOffset:]),
+		shentsize: uint64(f.ByteOrder.Uint16(data[ehdrShentsOffset:])),
+	}
+
+	if err := e.parseNames(); err != nil {
+		return nil, err
+	}
+
+	return e, nil
+}
+
+// sectionData returns the content of the section s in the original object
+func (e *ELF) sectionData(s *goelf.Section) ([]byte, error) {
+	if s.Type == goelf.SHT_NOBITS {
+		return nil, nil
+	}
+	end := s.Offset + s.Size
+	if end < s.Offset || end > uint64(len(e.data)) {
+		return nil, fmt.Errorf("section %s exceeds object", s.Name)
+	}
+	return e.data[s.Offset:end], nil
+}
+
+// stringAt returns the string at offset off of the string table s
+func (e *ELF) stringAt(s *goelf.Section, off uint32) (string, error) {
+	table, err := e.sectionData(s)
+	if err != nil {
+		return "", err
+	}
+	if uint64(off) >= uint64(len(table)) {
+		return "", fmt.Errorf("invalid offset %d in string table %s", off, s.Name)
+	}
+
+	end := bytes.IndexByte(table[off:], 0)
+	if end < 0 {
+		return "", fmt.Errorf("unterminated string at offset %d in string table %s", off, s.Name)
+	}
+
+	return string(table[off : int(off)+end]), nil
+}
+
+// parseNames collects the symbols and the references to the names of all
+// sections and symbols
+func (e *ELF) parseNames() error {
+	shstrndx := int(e.byteOrder.Uint16(e.data[ehdrShstrndxOffset:]))
+	if shstrndx >= len(e.file.Sections) {
+		return fmt.Errorf("invalid section name table index %d", shstrndx)
+	}
+	shstrtab := e.file.Sections[shstrndx]
+
+	for i := range e.file.Sections {
+		hdr := e.shoff + uint64(i)*e.shentsize
+		off := e.byteOrder.Uint32(e.data[hdr:])
+		name, err := e.stringAt(shstrtab, off)
+		if err != nil {
+			return err
+		}
+		e.names = append(e.names, nameRef{table: shstrtab, off: off, name: name})
+	}
+
+	for _, s := range e.file.Sections {
+		if s.Type != goelf.SHT_SYMTAB {
+			continue
+		}
+		if int(s.Link) >= len(e.file.Sections) {
+			return fmt.Errorf("invalid string table index %d of symbol table", s.Link)
+		}
+		strtab := e.file.Sections[s.Link]
+
+		table, err := e.sectionData(s)
+		if err != nil {
+			return err
+		}
+
+		for i := 0; i+symSize <= len(table); i += symSize {
+			off := e.byteOrder.Uint32(table[i:])
+			name, err := e.stringAt(strtab, off)
+			if err != nil {
+				return err
+			}
+
+			e.symbols = append(e.symbols, symbol{
+				name:  name,
+				shndx: goelf.SectionIndex(e.byteOrder.Uint16(table[i+6:])),
+			})
+			e.names = append(e.names, nameRef{table: strtab, off: off, name: name})
+		}
+	}
+
+	return nil
+}
+
+// writeStrings replaces the names of all sections and symbols which are
+// keys of strOptions with the respective value. The new names are padded so
+// that the string tables keep their layout.
+func (e *ELF) writeStrings(out []byte, strOptions map[string]string) error {
+	for _, ref := range e.names {
+		newName, ok := strOptions[ref.name]
+		if !ok || newName == ref.name {
+			continue
+		}
+
+		if len(newName) > len(ref.name) {
+			return fmt.Errorf("substitution %s of %s exceeds the length of the original string", newName, ref.name)
+		}
+
+		// Names referring to the inside of the replaced name, or names
+		// the replaced name is the tail of, would be altered as well.
+		// Only the name of the relocation section of a section is
+		// meant to change along with the name of the section.
+		end := ref.off + uint32(len(ref.name))
+		for _, other := range e.names {
+			if other.table != ref.table {
+				continue
+			}
+			if other.off < ref.off && other.name == ".rel"+ref.name {
+				continue
+			}
+			otherEnd := other.off + uint32(len(other.name))
+			if (other.off > ref.off && other.off < end) ||
+				(other.off < ref.off && otherEnd > ref.off) {
+				return fmt.Errorf("unable to substitute %s, string table entry is shared with %s", ref.name, other.name)
+			}
+		}
+
+		start := ref.table.Offset + uint64(ref.off)
+		n := copy(out[start:], newName)
+		for i := n; i < len(ref.name); i++ {
+			out[start+uint64(i)] = 0
+		}
+	}
+
+	return nil
+}
+
+// writeValues writes the values of intOptions into all loads of the static
+// data of the same name and removes the respective relocations
+func (e *ELF) writeValues(out []byte, intOptions map[string]uint32) error {
+	for idx, s := range e.file.Sections {
+		if s.Type != goelf.SHT_REL {
+			continue
+		}
+		if int(s.Info) >= len(e.file.Sections) {
+			return fmt.Errorf("invalid target section %d of relocation section %s", s.Info, s.Name)
+		}
+		target := e.file.Sections[s.Info]
+
+		rels, err := e.sectionData(s)
+		if err != nil {
+			return err
+		}
+
+		kept := 0
+		for i := 0; i+relSize <= len(rels); i += relSize {
+			off := e.byteOrder.Uint64(rels[i:])
+			symIdx := e.byteOrder.Uint64(rels[i+8:]) >> 32
+			if symIdx >= uint64(len(e.symbols)) {
+				return fmt.Errorf("invalid symbol index %d in relocation section %s", symIdx, s.Name)
+			}
+			sym := e.symbols[symIdx]
+
+			if sym.shndx != goelf.SHN_UNDEF {
+				copy(out[s.Offset+uint64(kept*relSize):], rels[i:i+relSize])
+				kept++
+				continue
+			}
+
+			value, ok := intOptions[sym.name]
+			if !ok {
+				return fmt.Errorf("no value for static data %s", sym.name)
+			}
+
+			insn := target.Offset + off
+			if off+2*8 > target.Size || out[insn] != ldImm64 {
+				return fmt.Errorf("relocation of static data %s at offset %d of section %s is not a 64 bit immediate load",
+					sym.name, off, target.Name)
+			}
+
+			e.byteOrder.PutUint32(out[insn+4:], value)
+			e.byteOrder.PutUint32(out[insn+12:], 0)
+		}
+
+		// Clear the removed relocations and shrink the section
+		for i := s.Offset + uint64(kept*relSize); i < s.Offset+s.Size; i++ {
+			out[i] = 0
+		}
+		hdr := e.shoff + uint64(idx)*e.shentsize
+		e.byteOrder.PutUint64(out[hdr+shdrSizeOffset:], uint64(kept*relSize))
+	}
+
+	return nil
+}
+
+// Write writes the program to path with all static data substituted by the
+// values in intOptions and all section and symbol names which are keys of
+// strOptions replaced with the respective value. Substituted names must not
+// be longer than the original names. All static data referenced by the
+// program must be present in intOptions.
+func (e *ELF) Write(path string, intOptions map[string]uint32, strOptions map[string]string) error {
+	out := make([]byte, len(e.data))
+	copy(out, e.data)
+
+	if err := e.writeStrings(out, strOptions); err != nil {
+		return err
+	}
+
+	if err := e.writeValues(out, intOptions); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, out, 0644)
+}
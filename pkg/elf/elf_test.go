@@ -0,0 +1,157 @@
+// Copyright 2018 Authors of Cilium
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package elf
+
+import (
+	goelf "debug/elf"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "gopkg.in/check.v1"
+)
+
+// Hook up gocheck into the "go test" runner.
+func Test(t *testing.T) { TestingT(t) }
+
+type ELFSuite struct {
+	dir string
+}
+
+var _ = Suite(&ELFSuite{})
+
+func (s *ELFSuite) SetUpTest(c *C) {
+	dir, err := ioutil.TempDir("", "cilium-elf")
+	c.Assert(err, IsNil)
+	s.dir = dir
+}
+
+func (s *ELFSuite) TearDownTest(c *C) {
+	os.RemoveAll(s.dir)
+}
+
+var (
+	testIntOptions = map[string]uint32{
+		"LXC_ID":   0x1234,
+		"SECLABEL": 0xabcdef,
+	}
+	testStrOptions = map[string]string{
+		"2/65535":            "2/42",
+		"cilium_calls_65535": "cilium_calls_42",
+	}
+)
+
+func (s *ELFSuite) TestWrite(c *C) {
+	e, err := Open("testdata/template.o")
+	c.Assert(err, IsNil)
+
+	path := filepath.Join(s.dir, "bpf_lxc.o")
+	c.Assert(e.Write(path, testIntOptions, testStrOptions), IsNil)
+
+	f, err := goelf.Open(path)
+	c.Assert(err, IsNil)
+	defer f.Close()
+
+	prog := f.Section("2/42")
+	c.Assert(prog, NotNil)
+	insns, err := prog.Data()
+	c.Assert(err, IsNil)
+
+	imm := func(insn int) uint64 {
+		return uint64(f.ByteOrder.Uint32(insns[insn*8+4:])) |
+			uint64(f.ByteOrder.Uint32(insns[insn*8+12:]))<<32
+	}
+	c.Assert(imm(0), Equals, uint64(0x1234))
+	c.Assert(imm(2), Equals, uint64(0xabcdef))
+	c.Assert(imm(6), Equals, uint64(0x1234))
+
+	// Only the relocation of the map remains
+	rel := f.Section(".rel2/42")
+	c.Assert(rel, NotNil)
+	c.Assert(rel.Size, Equals, uint64(relSize))
+
+	syms, err := f.Symbols()
+	c.Assert(err, IsNil)
+	names := map[string]bool{}
+	for _, sym := range syms {
+		names[sym.Name] = true
+	}
+	c.Assert(names["cilium_calls_42"], Equals, true)
+	c.Assert(names["cilium_calls_65535"], Equals, false)
+
+	// The original template is unchanged
+	c.Assert(e.Write(filepath.Join(s.dir, "bpf_lxc2.o"), testIntOptions, nil), IsNil)
+	f2, err := goelf.Open(filepath.Join(s.dir, "bpf_lxc2.o"))
+	c.Assert(err, IsNil)
+	defer f2.Close()
+	c.Assert(f2.Section("2/65535"), NotNil)
+}
+
+func (s *ELFSuite) TestWriteInvalid(c *C) {
+	e, err := Open("testdata/template.o")
+	c.Assert(err, IsNil)
+
+	path := filepath.Join(s.dir, "bpf_lxc.o")
+
+	// Missing static data
+	err = e.Write(path, map[string]uint32{"LXC_ID": 1}, testStrOptions)
+	c.Assert(err, Not(IsNil))
+
+	// Substitution longer than the original name
+	err = e.Write(path, testIntOptions, map[string]string{"2/65535": "2/655350"})
+	c.Assert(err, Not(IsNil))
+
+	_, err = Open("testdata/template.s")
+	c.Assert(err, Not(IsNil))
+}
+
+func (s *ELFSuite) TestWriteStringsShared(c *C) {
+	// The linker merges names which are the tail of another name
+	table := &goelf.Section{}
+	strtab := []byte("\x00cilium_calls_65535\x00")
+	e := &ELF{names: []nameRef{
+		{table: table, off: 1, name: "cilium_calls_65535"},
+		{table: table, off: 14, name: "65535"},
+	}}
+
+	out := make([]byte, len(strtab))
+	copy(out, strtab)
+	err := e.writeStrings(out, map[string]string{"cilium_calls_65535": "cilium_calls_42"})
+	c.Assert(err, Not(IsNil))
+
+	copy(out, strtab)
+	err = e.writeStrings(out, map[string]string{"65535": "42"})
+	c.Assert(err, Not(IsNil))
+
+	// Names in other string tables are unaffected
+	e.names[1].table = &goelf.Section{}
+	copy(out, strtab)
+	err = e.writeStrings(out, map[string]string{"cilium_calls_65535": "cilium_calls_42"})
+	c.Assert(err, IsNil)
+	c.Assert(string(out), Equals, "\x00cilium_calls_42\x00\x00\x00\x00")
+
+	// The relocation section is renamed along with its section
+	strtab = []byte("\x00.rel2/65535\x00")
+	e = &ELF{names: []nameRef{
+		{table: table, off: 1, name: ".rel2/65535"},
+		{table: table, off: 5, name: "2/65535"},
+	}}
+	out = make([]byte, len(strtab))
+	copy(out, strtab)
+	err = e.writeStrings(out, map[string]string{"2/65535": "2/42"})
+	c.Assert(err, IsNil)
+	c.Assert(string(out), Equals, "\x00.rel2/42\x00\x00\x00\x00")
+}
@@ -0,0 +1,30 @@
+# Template used by the tests of pkg/elf, assemble with:
+#   llvm-mc -triple bpf -filetype=obj template.s -o template.o
+
+	.section	2/65535,"ax",@progbits
+	.globl	handle_policy
+handle_policy:
+	r1 = LXC_ID ll
+	r2 = SECLABEL ll
+	r3 = cilium_calls_65535 ll
+	r4 = LXC_ID ll
+	r0 = 0
+	exit
+
+	.section	maps,"aw",@progbits
+	.globl	cilium_calls_65535
+	.p2align	2
+cilium_calls_65535:
+	.long	3
+	.long	4
+	.long	4
+	.long	1
+	.long	0
+	.long	1
+	.long	0
+	.size	cilium_calls_65535, 28
+
+	.section	license,"aw",@progbits
+	.globl	__license
+__license:
+	.asciz	"GPL"
@@ -18,17 +18,22 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
 	"os/exec"
 	"path"
 	"path/filepath"
-	"reflect"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/cilium/cilium/common"
+	"github.com/cilium/cilium/pkg/bpf"
 	"github.com/cilium/cilium/pkg/byteorder"
 	"github.com/cilium/cilium/pkg/geneve"
 	"github.com/cilium/cilium/pkg/logfields"
@@ -36,6 +41,7 @@ import (
 	"github.com/cilium/cilium/pkg/maps/ctmap"
 	"github.com/cilium/cilium/pkg/maps/lxcmap"
 	"github.com/cilium/cilium/pkg/maps/policymap"
+	"github.com/cilium/cilium/pkg/maps/throttlemap"
 	"github.com/cilium/cilium/pkg/policy"
 	"github.com/cilium/cilium/pkg/u8proto"
 	"github.com/cilium/cilium/pkg/version"
@@ -44,22 +50,61 @@ import (
 )
 
 const (
-	// ExecTimeout is the execution timeout to use in join_ep.sh executions
+	// ExecTimeout is the execution timeout to use in compile_ep.sh
+	// executions
 	ExecTimeout = 60 * time.Second
+
+	// programFileName is the name of the compiled BPF program of an
+	// endpoint as instantiated from its template
+	programFileName = "bpf_lxc.o"
+
+	// programSection is the section of the program attached to the
+	// interface of an endpoint
+	programSection = "from-container"
+
+	// bpfSHAFileName is the name of the file in the endpoint directory
+	// holding the hash of the base program the endpoint program was
+	// compiled against
+	bpfSHAFileName = "bpf.sha"
 )
 
-func (e *Endpoint) writeL4Map(fw *bufio.Writer, owner Owner, m policy.L4PolicyMap, config string) error {
+// writeL4Map writes the filters of m as the L4 map config. The ports,
+// proxy redirect ports and protocols of the filters are static data stored
+// in staticData so that the template only depends on the number of filters.
+func (e *Endpoint) writeL4Map(fw *bufio.Writer, owner Owner, m policy.L4PolicyMap, config string, staticData map[string]uint32) error {
 	array := ""
 	index := 0
 
-	for _, l4 := range m {
+	// Write the filters in a stable order so that the configuration, and
+	// with it the template the endpoint program is instantiated from,
+	// only changes if the policy does. The first matching entry wins, so
+	// redirects come first to not be shadowed by port ranges covering them.
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		fi, fj := m[keys[i]], m[keys[j]]
+		if fi.IsRedirect() != fj.IsRedirect() {
+			return fi.IsRedirect()
+		}
+		return keys[i] < keys[j]
+	})
+
+	for _, k := range keys {
+		l4 := m[k]
 		// Represents struct l4_allow in bpf/lib/l4.h
 		protoNum, err := u8proto.ParseProtocol(string(l4.Protocol))
 		if err != nil {
 			return fmt.Errorf("invalid protocol %s", l4.Protocol)
 		}
 
-		dport := byteorder.HostToNetwork(uint16(l4.Port))
+		// Named ports which the endpoint does not have are omitted,
+		// the port is not allowed
+		port, endPort, ok := l4.Resolve(e.NamedPorts)
+		if !ok {
+			continue
+		}
 
 		redirect := uint16(l4.L7RedirectPort)
 		if l4.IsRedirect() && redirect == 0 {
@@ -69,8 +114,15 @@ func (e *Endpoint) writeL4Map(fw *bufio.Writer, owner Owner, m policy.L4PolicyMa
 			}
 		}
 
-		redirect = byteorder.HostToNetwork(redirect).(uint16)
-		entry := fmt.Sprintf("%d,%d,%d,%d", index, dport, redirect, protoNum)
+		suffix := "_" + strconv.Itoa(index)
+		staticData[config+"_PORT"+suffix] = uint32(port)
+		staticData[config+"_END_PORT"+suffix] = uint32(endPort)
+		staticData[config+"_PROXY_PORT"+suffix] = uint32(byteorder.HostToNetwork(redirect).(uint16))
+		staticData[config+"_PROTO"+suffix] = uint32(protoNum)
+
+		entry := fmt.Sprintf("%d,fetch_u16_i(%s_PORT, %d),fetch_u16_i(%s_END_PORT, %d),"+
+			"fetch_u16_i(%s_PROXY_PORT, %d),fetch_u8_i(%s_PROTO, %d)",
+			index, config, index, config, index, config, index, config, index)
 		if array != "" {
 			array = array + "," + entry
 		} else {
@@ -84,13 +136,13 @@ func (e *Endpoint) writeL4Map(fw *bufio.Writer, owner Owner, m policy.L4PolicyMa
 		fmt.Fprintf(fw, "#undef %s\n", config)
 	} else {
 		fmt.Fprintf(fw, "#define %s %s, (), 0\n", config, array)
-		fmt.Fprintf(fw, "#define NR_%s %d\n", config, len(m))
+		fmt.Fprintf(fw, "#define NR_%s %d\n", config, index)
 	}
 
 	return nil
 }
 
-func (e *Endpoint) writeL4Policy(fw *bufio.Writer, owner Owner) error {
+func (e *Endpoint) writeL4Policy(fw *bufio.Writer, owner Owner, staticData map[string]uint32) error {
 	if e.Consumable == nil {
 		return nil
 	}
@@ -104,18 +156,34 @@ func (e *Endpoint) writeL4Policy(fw *bufio.Writer, owner Owner) error {
 
 	fmt.Fprintf(fw, "#define HAVE_L4_POLICY\n")
 
-	if err := e.writeL4Map(fw, owner, l4policy.Ingress, "CFG_L4_INGRESS"); err != nil {
+	if err := e.writeL4Map(fw, owner, l4policy.Ingress, "CFG_L4_INGRESS", staticData); err != nil {
 		return err
 	}
 
-	return e.writeL4Map(fw, owner, l4policy.Egress, "CFG_L4_EGRESS")
+	return e.writeL4Map(fw, owner, l4policy.Egress, "CFG_L4_EGRESS", staticData)
 }
 
-func (e *Endpoint) writeHeaderfile(prefix string, owner Owner) error {
+// writeHeaderfile writes the header file of the endpoint to prefix. The
+// header file consists of a description of the endpoint followed by the
+// configuration of the template the endpoint program is instantiated from.
+// Must be called with e.Mutex held.
+func (e *Endpoint) writeHeaderfile(prefix string, owner Owner) (*programInstance, error) {
+	geneveOpts, err := writeGeneve(prefix, e)
+	if err != nil {
+		return nil, err
+	}
+
+	staticData := map[string]uint32{}
+	config, err := e.templateConfig(owner, len(geneveOpts), staticData)
+	if err != nil {
+		return nil, err
+	}
+	program := e.newProgramInstance(config, geneveOpts, staticData)
+
 	headerPath := filepath.Join(prefix, common.CHeaderFileName)
 	f, err := os.Create(headerPath)
 	if err != nil {
-		return fmt.Errorf("failed to open file %s for writing: %s", headerPath, err)
+		return nil, fmt.Errorf("failed to open file %s for writing: %s", headerPath, err)
 
 	}
 	defer f.Close()
@@ -177,55 +245,82 @@ func (e *Endpoint) writeHeaderfile(prefix string, owner Owner) error {
 	}
 	fw.WriteString(" */\n\n")
 
+	// The static data is not part of the configuration but must change the
+	// header file for the program to be instantiated again
+	fw.WriteString("/*\n")
+	fw.WriteString(" * Static data:\n")
+	names := make([]string, 0, len(program.intOptions))
+	for name := range program.intOptions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(fw, " * - %s: %#x\n", name, program.intOptions[name])
+	}
+	fw.WriteString(" */\n\n")
+
+	fw.Write(config)
+
+	if err := fw.Flush(); err != nil {
+		return nil, err
+	}
+
+	return program, nil
+}
+
+// templateConfig returns the configuration of the template the endpoint
+// program is instantiated from. Endpoint specific values are static data so
+// that endpoints with the same configuration share a template, the values of
+// the L4 policy are added to staticData.
+// Must be called with e.Mutex held.
+func (e *Endpoint) templateConfig(owner Owner, geneveOptsLen int, staticData map[string]uint32) ([]byte, error) {
+	var config bytes.Buffer
+	fw := bufio.NewWriter(&config)
+
 	// If there hasn't been a policy calculated yet, we need to be sure we drop all packets, but only if policy enforcement is enabled for the endpoint / daemon.
 	if !e.PolicyCalculated && e.Opts.IsEnabled(OptionPolicy) && owner.PolicyEnforcement() != NeverEnforce {
 		fw.WriteString("#define DROP_ALL\n")
 	}
 
-	fw.WriteString(common.FmtDefineAddress("LXC_MAC", e.LXCMAC))
-	fw.WriteString(common.FmtDefineComma("LXC_IP", e.IPv6))
+	fmt.Fprintf(fw, "#define TEMPLATE_LXC_ID %d\n", templateLxcID)
+	fw.WriteString("#define LXC_MAC fetch_mac(LXC_MAC)\n")
+	fw.WriteString("#define LXC_IP fetch_ipv6(LXC_IP)\n")
 	if e.IPv4 != nil {
-		fmt.Fprintf(fw, "#define LXC_IPV4 %#x\n", byteorder.HostSliceToNetwork(e.IPv4, reflect.Uint32))
+		fw.WriteString("#define LXC_IPV4 fetch_u32(LXC_IPV4)\n")
 	}
-	fw.WriteString(common.FmtDefineAddress("NODE_MAC", e.NodeMAC))
+	fw.WriteString("#define NODE_MAC fetch_mac(NODE_MAC)\n")
 
-	geneveOpts, err := writeGeneve(prefix, e)
-	if err != nil {
-		return err
+	geneveOpts := make([]string, 0, geneveOptsLen)
+	for i := 0; i < geneveOptsLen; i++ {
+		geneveOpts = append(geneveOpts, fmt.Sprintf("fetch_u8_i(GENEVE_OPTS, %d)", i))
 	}
-	fw.WriteString(common.FmtDefineArray("GENEVE_OPTS", geneveOpts))
+	fmt.Fprintf(fw, "#define GENEVE_OPTS { %s }\n", strings.Join(geneveOpts, ", "))
 
-	fmt.Fprintf(fw, "#define LXC_ID %#x\n", e.ID)
-	fmt.Fprintf(fw, "#define LXC_ID_NB %#x\n", byteorder.HostToNetwork(e.ID))
-	if e.SecLabel != nil {
-		fmt.Fprintf(fw, "#define SECLABEL %s\n", e.SecLabel.ID.StringID())
-		fmt.Fprintf(fw, "#define SECLABEL_NB %#x\n", byteorder.HostToNetwork(e.SecLabel.ID.Uint32()))
-	} else {
-		invalid := policy.InvalidIdentity
-		fmt.Fprintf(fw, "#define SECLABEL %s\n", invalid.StringID())
-		fmt.Fprintf(fw, "#define SECLABEL_NB %#x\n", byteorder.HostToNetwork(invalid.Uint32()))
-	}
-	fmt.Fprintf(fw, "#define POLICY_MAP %s\n", path.Base(e.PolicyMapPathLocked()))
+	fw.WriteString("#define LXC_ID fetch_u16(LXC_ID)\n")
+	fw.WriteString("#define LXC_ID_NB fetch_u16(LXC_ID_NB)\n")
+	fw.WriteString("#define SECLABEL fetch_u32(SECLABEL)\n")
+	fw.WriteString("#define SECLABEL_NB fetch_u32(SECLABEL_NB)\n")
+	fmt.Fprintf(fw, "#define POLICY_MAP %s\n", templateMapName(policymap.MapName))
 	if e.L3Policy != nil {
 		fmt.Fprintf(fw, "#define LPM_MAP_VALUE_SIZE %s\n", strconv.Itoa(cidrmap.LPM_MAP_VALUE_SIZE))
 		if e.L3Policy.Ingress.IPv6Count > 0 {
-			fmt.Fprintf(fw, "#define CIDR6_INGRESS_MAP %s\n", path.Base(e.IPv6IngressMapPathLocked()))
+			fmt.Fprintf(fw, "#define CIDR6_INGRESS_MAP %s\n", templateMapName(cidrmap.MapName+"ingress6_"))
 		}
 		if e.L3Policy.Egress.IPv6Count > 0 {
-			fmt.Fprintf(fw, "#define CIDR6_EGRESS_MAP %s\n", path.Base(e.IPv6EgressMapPathLocked()))
+			fmt.Fprintf(fw, "#define CIDR6_EGRESS_MAP %s\n", templateMapName(cidrmap.MapName+"egress6_"))
 		}
 		if e.L3Policy.Ingress.IPv4Count > 0 {
-			fmt.Fprintf(fw, "#define CIDR4_INGRESS_MAP %s\n", path.Base(e.IPv4IngressMapPathLocked()))
+			fmt.Fprintf(fw, "#define CIDR4_INGRESS_MAP %s\n", templateMapName(cidrmap.MapName+"ingress4_"))
 		}
 		if e.L3Policy.Egress.IPv4Count > 0 {
-			fmt.Fprintf(fw, "#define CIDR4_EGRESS_MAP %s\n", path.Base(e.IPv4EgressMapPathLocked()))
+			fmt.Fprintf(fw, "#define CIDR4_EGRESS_MAP %s\n", templateMapName(cidrmap.MapName+"egress4_"))
 		}
 	}
-	fmt.Fprintf(fw, "#define CALLS_MAP %s\n", path.Base(e.CallsMapPathLocked()))
+	fmt.Fprintf(fw, "#define CALLS_MAP %s\n", templateMapName(CallsMapName))
 	if e.Opts.IsEnabled(OptionConntrackLocal) {
 		fmt.Fprintf(fw, "#define CT_MAP_SIZE %s\n", strconv.Itoa(ctmap.MapNumEntriesLocal))
-		fmt.Fprintf(fw, "#define CT_MAP6 %s\n", ctmap.MapName6+strconv.Itoa(int(e.ID)))
-		fmt.Fprintf(fw, "#define CT_MAP4 %s\n", ctmap.MapName4+strconv.Itoa(int(e.ID)))
+		fmt.Fprintf(fw, "#define CT_MAP6 %s\n", templateMapName(ctmap.MapName6))
+		fmt.Fprintf(fw, "#define CT_MAP4 %s\n", templateMapName(ctmap.MapName4))
 	} else {
 		fmt.Fprintf(fw, "#define CT_MAP_SIZE %s\n", strconv.Itoa(ctmap.MapNumEntriesGlobal))
 		fmt.Fprintf(fw, "#define CT_MAP6 %s\n", ctmap.MapName6Global)
@@ -247,8 +342,8 @@ func (e *Endpoint) writeHeaderfile(prefix string, owner Owner) error {
 	}
 	fw.WriteString("\n")
 
-	if err := e.writeL4Policy(fw, owner); err != nil {
-		return err
+	if err := e.writeL4Policy(fw, owner, staticData); err != nil {
+		return nil, err
 	}
 
 	if e.L3Policy != nil {
@@ -285,7 +380,11 @@ func (e *Endpoint) writeHeaderfile(prefix string, owner Owner) error {
 		}
 	}
 
-	return fw.Flush()
+	if err := fw.Flush(); err != nil {
+		return nil, err
+	}
+
+	return config.Bytes(), nil
 }
 
 // FIXME: Clean this function up
@@ -306,10 +405,31 @@ func writeGeneve(prefix string, e *Endpoint) ([]byte, error) {
 	return rawData, nil
 }
 
-func (e *Endpoint) runInit(libdir, rundir, epdir, ifName, debug string) error {
-	args := []string{libdir, rundir, epdir, ifName, debug}
-	prog := filepath.Join(libdir, "join_ep.sh")
+// attachProgram loads the program in epdir and attaches it to the interface
+// ifName. If the program is rejected, the full log of the verifier is logged
+// at debug level and a summary is added to the status of the endpoint.
+func (e *Endpoint) attachProgram(epdir, ifName string) error {
+	err := bpf.LoadAndAttachSchedCls(filepath.Join(epdir, programFileName), programSection, ifName, bpf.TCIngress)
+	if verr, ok := err.(*bpf.VerifierError); ok {
+		e.Mutex.RLock()
+		scopedLog := e.getLogger() // must be called with e.Mutex held
+		e.Mutex.RUnlock()
+
+		scopedLog = scopedLog.WithField("section", verr.Section)
+		scopedLog.WithError(verr.Err).Warn("Program rejected by verifier")
+		scanner := bufio.NewScanner(strings.NewReader(verr.Log))
+		for scanner.Scan() {
+			scopedLog.Debug(scanner.Text())
+		}
+
+		e.LogStatus(BPF, Failure, verr.Error())
+	}
 
+	return err
+}
+
+// runScript runs the script prog with args, logging its output on failure
+func (e *Endpoint) runScript(prog string, args ...string) error {
 	e.Mutex.RLock()
 	scopedLog := e.getLogger() // must be called with e.Mutex held
 	e.Mutex.RUnlock()
@@ -346,11 +466,21 @@ type epInfoCache struct {
 	value    *lxcmap.EndpointInfo
 	ifName   string
 	revision uint64
+
+	// ingressBandwidth and egressBandwidth are the bandwidth limits of
+	// the endpoint in bits per second
+	ingressBandwidth uint64
+	egressBandwidth  uint64
 }
 
 // Must be called when endpoint is still locked.
 func (e *Endpoint) createEpInfoCache() *epInfoCache {
-	ep := &epInfoCache{ifName: e.IfName, revision: e.nextPolicyRevision}
+	ep := &epInfoCache{
+		ifName:           e.IfName,
+		revision:         e.nextPolicyRevision,
+		ingressBandwidth: e.IngressBandwidth,
+		egressBandwidth:  e.EgressBandwidth,
+	}
 	var err error
 	ep.keys = e.GetBPFKeys()
 	ep.value, err = e.GetBPFValue()
@@ -397,11 +527,6 @@ func (e *Endpoint) regenerateBPF(owner Owner, epdir, reason string) error {
 		return fmt.Errorf("Skipping build due to invalid state: %s", e.state)
 	}
 
-	if err = e.writeHeaderfile(epdir, owner); err != nil {
-		e.Mutex.Unlock()
-		return fmt.Errorf("Unable to write header file: %s", err)
-	}
-
 	// If dry mode is enabled, no further changes to BPF maps are performed
 	if owner.DryModeEnabled() {
 		// Regenerate policy and apply any options resulting in the
@@ -411,6 +536,10 @@ func (e *Endpoint) regenerateBPF(owner Owner, epdir, reason string) error {
 			e.Mutex.Unlock()
 			return fmt.Errorf("Unable to regenerate policy: %s", err)
 		}
+		if _, err = e.writeHeaderfile(epdir, owner); err != nil {
+			e.Mutex.Unlock()
+			return fmt.Errorf("Unable to write header file: %s", err)
+		}
 		e.Mutex.Unlock()
 
 		log.WithField(logfields.EndpointID, e.ID).Debug("Skipping bpf updates due to dry mode")
@@ -460,12 +589,16 @@ func (e *Endpoint) regenerateBPF(owner Owner, epdir, reason string) error {
 	}()
 
 	// Create the policymap on the first pass
+	reusedPolicyMap := false
 	if e.PolicyMap == nil {
 		e.PolicyMap, createdPolicyMap, err = policymap.OpenMap(e.PolicyMapPathLocked())
 		if err != nil {
 			e.Mutex.Unlock()
 			return err
 		}
+		// A policy map which already exists was pinned by a previous
+		// instance of the agent and may contain stale entries.
+		reusedPolicyMap = !createdPolicyMap
 	}
 
 	// Only generate & populate policy map if a seclabel and consumer model is set up
@@ -480,6 +613,22 @@ func (e *Endpoint) regenerateBPF(owner Owner, epdir, reason string) error {
 			return fmt.Errorf("Unable to regenerate policy for '%s': %s",
 				e.PolicyMap.String(), err)
 		}
+
+		if reusedPolicyMap && e.PolicyCalculated {
+			if err = e.syncPolicyMapLocked(); err != nil {
+				e.Mutex.Unlock()
+				return fmt.Errorf("Unable to synchronize policy map '%s': %s",
+					e.PolicyMap.String(), err)
+			}
+		}
+	}
+
+	// The header file is written after the policy has been computed so
+	// that it reflects the policy the program is compiled for.
+	program, err := e.writeHeaderfile(epdir, owner)
+	if err != nil {
+		e.Mutex.Unlock()
+		return fmt.Errorf("Unable to write header file: %s", err)
 	}
 
 	epInfoCache := e.createEpInfoCache()
@@ -521,11 +670,31 @@ func (e *Endpoint) regenerateBPF(owner Owner, epdir, reason string) error {
 	}
 	e.Mutex.Unlock()
 
-	libdir := owner.GetBpfDir()
 	rundir := owner.GetStateDir()
-	debug := strconv.FormatBool(owner.DebugEnabled())
+	origDir := filepath.Join(rundir, e.StringID())
+	bpfSHA := owner.GetBPFSHA()
+
+	// The program attached to the endpoint can only be kept if it still
+	// refers to the same maps, i.e. none of them has been recreated.
+	createdMaps := createdPolicyMap || createdIPv6IngressMap || createdIPv6EgressMap ||
+		createdIPv4IngressMap || createdIPv4EgressMap
 
-	err = e.runInit(libdir, rundir, epdir, epInfoCache.ifName, debug)
+	if !createdMaps && isProgramUpToDate(origDir, epdir, bpfSHA) {
+		log.WithField(logfields.EndpointID, e.ID).Debug("Header file and base program unchanged, reusing compiled program")
+		err = reuseProgram(origDir, epdir)
+	} else {
+		err = e.instantiateProgram(owner, program, epdir)
+		if err == nil {
+			err = e.attachProgram(epdir, epInfoCache.ifName)
+		}
+		if err == nil {
+			err = writeBPFSHA(epdir, bpfSHA)
+		}
+	}
+	if err == nil {
+		// Install the bandwidth limits before the endpoint is exposed
+		err = throttlemap.SetLimits(e.ID, epInfoCache.ingressBandwidth, epInfoCache.egressBandwidth)
+	}
 	if err == nil {
 		// The last operation hooks the endpoint into the endpoint table and exposes it
 		err = lxcmap.WriteEndpoint(epInfoCache)
@@ -540,3 +709,104 @@ func (e *Endpoint) regenerateBPF(owner Owner, epdir, reason string) error {
 
 	return err
 }
+
+// instantiateProgram writes the program of the endpoint to epdir, compiling
+// the template it is instantiated from if needed.
+func (e *Endpoint) instantiateProgram(owner Owner, program *programInstance, epdir string) error {
+	tmpl, hash, err := e.getTemplate(owner, program)
+	if err != nil {
+		return fmt.Errorf("unable to compile template: %s", err)
+	}
+
+	if err := program.write(tmpl, epdir); err != nil {
+		releaseTemplate(owner.GetStateDir(), hash)
+		return fmt.Errorf("unable to instantiate template: %s", err)
+	}
+
+	e.setTemplate(owner.GetStateDir(), hash)
+
+	return nil
+}
+
+// hashHeaderfile returns the SHA256 sum of the header file at path. The
+// serialized endpoint is excluded as it changes with every regeneration
+// without affecting the compiled program.
+func hashHeaderfile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	r := bufio.NewReader(f)
+	for {
+		line, err := r.ReadBytes('\n')
+		if !bytes.Contains(line, []byte(common.CiliumCHeaderPrefix)) {
+			hash.Write(line)
+		}
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return "", err
+		}
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// isProgramUpToDate returns true if the program compiled in origDir can be
+// used for the header file written to epdir, i.e. if both header files are
+// equal and the program was compiled against the base program bpfSHA.
+func isProgramUpToDate(origDir, epdir, bpfSHA string) bool {
+	if bpfSHA == "" {
+		return false
+	}
+
+	if _, err := os.Stat(filepath.Join(origDir, programFileName)); err != nil {
+		return false
+	}
+
+	oldSHA, err := ioutil.ReadFile(filepath.Join(origDir, bpfSHAFileName))
+	if err != nil || string(oldSHA) != bpfSHA {
+		return false
+	}
+
+	oldHash, err := hashHeaderfile(filepath.Join(origDir, common.CHeaderFileName))
+	if err != nil {
+		return false
+	}
+
+	newHash, err := hashHeaderfile(filepath.Join(epdir, common.CHeaderFileName))
+	if err != nil {
+		return false
+	}
+
+	return oldHash == newHash
+}
+
+// reuseProgram copies the compiled program and the hash of the base program
+// it was compiled against from origDir to epdir.
+func reuseProgram(origDir, epdir string) error {
+	for _, name := range []string{programFileName, bpfSHAFileName} {
+		data, err := ioutil.ReadFile(filepath.Join(origDir, name))
+		if err != nil {
+			return fmt.Errorf("unable to reuse compiled program: %s", err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(epdir, name), data, 0644); err != nil {
+			return fmt.Errorf("unable to reuse compiled program: %s", err)
+		}
+	}
+
+	return nil
+}
+
+// writeBPFSHA records the hash of the base program bpfSHA the program in
+// epdir has been compiled against.
+func writeBPFSHA(epdir, bpfSHA string) error {
+	if bpfSHA == "" {
+		return nil
+	}
+
+	return ioutil.WriteFile(filepath.Join(epdir, bpfSHAFileName), []byte(bpfSHA), 0644)
+}
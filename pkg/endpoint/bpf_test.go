@@ -0,0 +1,158 @@
+// Copyright 2018 Authors of Cilium
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package endpoint
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/cilium/cilium/common"
+	"github.com/cilium/cilium/pkg/byteorder"
+	"github.com/cilium/cilium/pkg/policy"
+	"github.com/cilium/cilium/pkg/policy/api"
+
+	. "gopkg.in/check.v1"
+)
+
+func writeTestHeaderfile(c *C, dir, serialized, body string) {
+	header := "/*\n * " + common.CiliumCHeaderPrefix + serialized + "\n * \n */\n\n" + body
+	err := ioutil.WriteFile(filepath.Join(dir, common.CHeaderFileName), []byte(header), 0644)
+	c.Assert(err, IsNil)
+}
+
+func (s *EndpointSuite) TestIsProgramUpToDate(c *C) {
+	origDir, err := ioutil.TempDir("", "cilium-endpoint-orig")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(origDir)
+
+	epdir, err := ioutil.TempDir("", "cilium-endpoint-next")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(epdir)
+
+	writeTestHeaderfile(c, origDir, "old", "#define LXC_ID 0x1\n")
+	writeTestHeaderfile(c, epdir, "new", "#define LXC_ID 0x1\n")
+
+	// No compiled program
+	c.Assert(isProgramUpToDate(origDir, epdir, "sha"), Equals, false)
+
+	err = ioutil.WriteFile(filepath.Join(origDir, programFileName), []byte("prog"), 0644)
+	c.Assert(err, IsNil)
+
+	// Base program of the compiled program unknown
+	c.Assert(isProgramUpToDate(origDir, epdir, "sha"), Equals, false)
+
+	c.Assert(writeBPFSHA(origDir, "sha"), IsNil)
+
+	// Only the serialized endpoint differs
+	c.Assert(isProgramUpToDate(origDir, epdir, "sha"), Equals, true)
+
+	// Base program changed or unknown
+	c.Assert(isProgramUpToDate(origDir, epdir, "sha2"), Equals, false)
+	c.Assert(isProgramUpToDate(origDir, epdir, ""), Equals, false)
+
+	// Header file changed
+	writeTestHeaderfile(c, epdir, "new", "#define LXC_ID 0x2\n")
+	c.Assert(isProgramUpToDate(origDir, epdir, "sha"), Equals, false)
+}
+
+func (s *EndpointSuite) TestReuseProgram(c *C) {
+	origDir, err := ioutil.TempDir("", "cilium-endpoint-orig")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(origDir)
+
+	epdir, err := ioutil.TempDir("", "cilium-endpoint-next")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(epdir)
+
+	c.Assert(reuseProgram(origDir, epdir), Not(IsNil))
+
+	err = ioutil.WriteFile(filepath.Join(origDir, programFileName), []byte("prog"), 0644)
+	c.Assert(err, IsNil)
+	c.Assert(writeBPFSHA(origDir, "sha"), IsNil)
+
+	c.Assert(reuseProgram(origDir, epdir), IsNil)
+
+	data, err := ioutil.ReadFile(filepath.Join(epdir, programFileName))
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "prog")
+
+	data, err = ioutil.ReadFile(filepath.Join(epdir, bpfSHAFileName))
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "sha")
+}
+
+func (s *EndpointSuite) TestWriteL4MapNamedPorts(c *C) {
+	m := policy.L4PolicyMap{
+		"80/TCP":    {Port: 80, Protocol: api.ProtoTCP, Ingress: true},
+		"http/TCP":  {PortName: "http", Protocol: api.ProtoTCP, Ingress: true},
+		"https/TCP": {PortName: "https", Protocol: api.ProtoTCP, Ingress: true},
+	}
+	e := &Endpoint{NamedPorts: policy.NamedPortMap{
+		"http": {Port: 8080, Protocol: api.ProtoTCP},
+	}}
+
+	var buf bytes.Buffer
+	fw := bufio.NewWriter(&buf)
+	staticData := map[string]uint32{}
+	c.Assert(e.writeL4Map(fw, nil, m, "CFG_L4_INGRESS", staticData), IsNil)
+	c.Assert(fw.Flush(), IsNil)
+
+	// The unresolved named port is omitted and not counted
+	c.Assert(buf.String(), Equals,
+		"#define CFG_L4_INGRESS "+
+			"0,fetch_u16_i(CFG_L4_INGRESS_PORT, 0),fetch_u16_i(CFG_L4_INGRESS_END_PORT, 0),"+
+			"fetch_u16_i(CFG_L4_INGRESS_PROXY_PORT, 0),fetch_u8_i(CFG_L4_INGRESS_PROTO, 0),"+
+			"1,fetch_u16_i(CFG_L4_INGRESS_PORT, 1),fetch_u16_i(CFG_L4_INGRESS_END_PORT, 1),"+
+			"fetch_u16_i(CFG_L4_INGRESS_PROXY_PORT, 1),fetch_u8_i(CFG_L4_INGRESS_PROTO, 1), (), 0\n"+
+			"#define NR_CFG_L4_INGRESS 2\n")
+	c.Assert(staticData, DeepEquals, map[string]uint32{
+		"CFG_L4_INGRESS_PORT_0":       80,
+		"CFG_L4_INGRESS_END_PORT_0":   80,
+		"CFG_L4_INGRESS_PROXY_PORT_0": 0,
+		"CFG_L4_INGRESS_PROTO_0":      6,
+		"CFG_L4_INGRESS_PORT_1":       8080,
+		"CFG_L4_INGRESS_END_PORT_1":   8080,
+		"CFG_L4_INGRESS_PROXY_PORT_1": 0,
+		"CFG_L4_INGRESS_PROTO_1":      6,
+	})
+}
+
+func (s *EndpointSuite) TestWriteL4MapPortsAreStaticData(c *C) {
+	writeMap := func(port uint16) (string, map[string]uint32) {
+		m := policy.L4PolicyMap{
+			"port/TCP": {Port: int(port), Protocol: api.ProtoTCP, Ingress: true, L7RedirectPort: 10000 + int(port)},
+		}
+		e := &Endpoint{}
+
+		var buf bytes.Buffer
+		fw := bufio.NewWriter(&buf)
+		staticData := map[string]uint32{}
+		c.Assert(e.writeL4Map(fw, nil, m, "CFG_L4_INGRESS", staticData), IsNil)
+		c.Assert(fw.Flush(), IsNil)
+		return buf.String(), staticData
+	}
+
+	// Endpoints allowing different ports share the template
+	config80, data80 := writeMap(80)
+	config443, data443 := writeMap(443)
+	c.Assert(config80, Equals, config443)
+
+	c.Assert(data80["CFG_L4_INGRESS_PORT_0"], Equals, uint32(80))
+	c.Assert(data443["CFG_L4_INGRESS_PORT_0"], Equals, uint32(443))
+	c.Assert(data80["CFG_L4_INGRESS_PROXY_PORT_0"], Equals, uint32(byteorder.HostToNetwork(uint16(10080)).(uint16)))
+}
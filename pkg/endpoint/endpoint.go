@@ -65,8 +65,10 @@ const (
 	OptionDebug               = "Debug"
 	OptionDropNotify          = "DropNotification"
 	OptionTraceNotify         = "TraceNotification"
+	OptionPolicyVerdictNotify = "PolicyVerdictNotification"
 	OptionNAT46               = "NAT46"
 	OptionPolicy              = "Policy"
+	OptionPolicyAuditMode     = "PolicyAuditMode"
 	AlwaysEnforce             = "always"
 	NeverEnforce              = "never"
 	DefaultEnforcement        = "default"
@@ -119,6 +121,11 @@ var (
 		Description: "Enable trace notifications",
 	}
 
+	OptionSpecPolicyVerdictNotify = option.Option{
+		Define:      "POLICY_VERDICT_NOTIFY",
+		Description: "Enable policy verdict notifications",
+	}
+
 	OptionSpecNAT46 = option.Option{
 		Define:      "ENABLE_NAT46",
 		Description: "Enable automatic NAT46 translation",
@@ -136,6 +143,12 @@ var (
 		Description: "Enable policy enforcement",
 	}
 
+	OptionSpecPolicyAuditMode = option.Option{
+		Define:      "POLICY_AUDIT_MODE",
+		Description: "Report policy denials but allow the traffic",
+		Requires:    []string{OptionDropNotify},
+	}
+
 	EndpointMutableOptionLibrary = option.OptionLibrary{
 		OptionConntrackAccounting: &OptionSpecConntrackAccounting,
 		OptionConntrackLocal:      &OptionSpecConntrackLocal,
@@ -143,8 +156,10 @@ var (
 		OptionDebug:               &OptionSpecDebug,
 		OptionDropNotify:          &OptionSpecDropNotify,
 		OptionTraceNotify:         &OptionSpecTraceNotify,
+		OptionPolicyVerdictNotify: &OptionSpecPolicyVerdictNotify,
 		OptionNAT46:               &OptionSpecNAT46,
 		OptionPolicy:              &OptionSpecPolicy,
+		OptionPolicyAuditMode:     &OptionSpecPolicyAuditMode,
 	}
 
 	EndpointOptionLibrary = option.OptionLibrary{
@@ -277,6 +292,9 @@ type Endpoint struct {
 	// reference to all policy related BPF
 	PolicyMap *policymap.PolicyMap `json:"-"`
 
+	// l4PolicyKeys are the PolicyMap entries installed for L4Policy
+	l4PolicyKeys map[policyMapKey]struct{}
+
 	// L3Policy is the CIDR based policy configuration of the endpoint
 	L3Policy *policy.L3Policy `json:"-"`
 
@@ -302,6 +320,18 @@ type Endpoint struct {
 	// by Kubernetes
 	PodName string
 
+	// IngressBandwidth is the rate limit in bits per second of the traffic
+	// received by the endpoint, 0 if unlimited
+	IngressBandwidth uint64
+
+	// EgressBandwidth is the rate limit in bits per second of the traffic
+	// sent by the endpoint, 0 if unlimited
+	EgressBandwidth uint64
+
+	// NamedPorts are the named container ports of the Kubernetes pod
+	// which named ports in the ingress policy are resolved against
+	NamedPorts policy.NamedPortMap
+
 	// policyRevision is the policy revision this endpoint is currently on
 	policyRevision uint64
 
@@ -321,6 +351,11 @@ type Endpoint struct {
 	// `pkg/endpoint`
 	BuildMutex lock.Mutex
 
+	// templateHash identifies the template the program of the endpoint is
+	// instantiated from. You must hold Endpoint.BuildMutex to read or write
+	// it.
+	templateHash string
+
 	// logger is a logrus object with fields set to report an endpoints information.
 	// You must hold Endpoint.Mutex to read or write it (but not to log with it).
 	logger *log.Entry
@@ -419,8 +454,17 @@ func (e *Endpoint) GetModelRLocked() *models.Endpoint {
 		statusLog = statusLog[:1]
 	}
 
+	var bandwidth *models.EndpointBandwidth
+	if e.IngressBandwidth != 0 || e.EgressBandwidth != 0 {
+		bandwidth = &models.EndpointBandwidth{
+			Ingress: int64(e.IngressBandwidth),
+			Egress:  int64(e.EgressBandwidth),
+		}
+	}
+
 	return &models.Endpoint{
 		ID:               int64(e.ID),
+		Bandwidth:        bandwidth,
 		ContainerID:      e.DockerID,
 		ContainerName:    e.ContainerName,
 		DockerEndpointID: e.DockerEndpointID,
@@ -534,6 +578,12 @@ func (e *Endpoint) GetIPv6Address() string {
 	return e.IPv6.String()
 }
 
+// PolicyAuditModeEnabled returns true if policy denials of the endpoint are
+// only reported while the traffic is allowed to pass.
+func (e *Endpoint) PolicyAuditModeEnabled() bool {
+	return e.Opts.IsEnabled(OptionPolicyAuditMode)
+}
+
 // statusLogMsg represents a log message.
 type statusLogMsg struct {
 	Status    Status    `json:"status"`
@@ -1138,6 +1188,10 @@ func (e *Endpoint) LeaveLocked(owner Owner) {
 		c.Mutex.RUnlock()
 	}
 
+	if e.L4Policy != nil {
+		policy.GetSelectorCache().RemoveSelectors(e.L4Policy.IngressSelectors())
+	}
+
 	if e.PolicyMap != nil {
 		if err := e.PolicyMap.Close(); err != nil {
 			e.getLogger().WithError(err).WithField(logfields.Path, e.PolicyMapPathLocked()).Warn("Unable to close policy map")
@@ -1146,6 +1200,8 @@ func (e *Endpoint) LeaveLocked(owner Owner) {
 
 	e.L3Maps.Close()
 
+	e.setTemplate(owner.GetStateDir(), "")
+
 	e.removeDirectory()
 
 	e.SetStateLocked(StateDisconnected, "Endpoint removed")
@@ -1365,6 +1421,12 @@ OKState:
 	return true
 }
 
+// GetPolicyRevisionLocked returns the policy revision the endpoint is
+// currently running. endpoint.Mutex may only be RLock()ed
+func (e *Endpoint) GetPolicyRevisionLocked() uint64 {
+	return e.policyRevision
+}
+
 // bumpPolicyRevision marks the endpoint to be running the next scheduled
 // policy revision as setup by e.regenerate(). endpoint.Mutex should not be held.
 func (e *Endpoint) bumpPolicyRevision(revision uint64) {
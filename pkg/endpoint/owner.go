@@ -45,9 +45,6 @@ type Owner interface {
 	// Must return the policy repository
 	GetPolicyRepository() *policy.Repository
 
-	// Return the next available global identity
-	GetCachedMaxLabelID() (policy.NumericIdentity, error)
-
 	// UpdateProxyRedirect must update the redirect configuration of an endpoint in the proxy
 	UpdateProxyRedirect(e *Endpoint, l4 *policy.L4Filter) (uint16, error)
 
@@ -72,9 +69,18 @@ type Owner interface {
 	// Annotates endpoint e with an annotation with key annotationKey, and value annotationValue.
 	AnnotateEndpoint(e *Endpoint, annotationKey, annotationValue string)
 
+	// UpdateCiliumEndpoint mirrors the state of endpoint e into its
+	// CiliumEndpoint resource if Kubernetes is being utilized.
+	UpdateCiliumEndpoint(e *Endpoint)
+
 	// GetCompilationLock returns the mutex responsible for synchronizing compilation
 	// of BPF programs.
 	GetCompilationLock() *lock.RWMutex
+
+	// GetBPFSHA returns the hash of the base program endpoint programs are
+	// compiled against or an empty string if unknown. Must be called with
+	// the compilation lock held.
+	GetBPFSHA() string
 }
 
 // Request is used to create the endpoint's request and send it to the endpoints
@@ -23,6 +23,7 @@ import (
 	"github.com/cilium/cilium/api/v1/models"
 	"github.com/cilium/cilium/pkg/labels"
 	"github.com/cilium/cilium/pkg/logfields"
+	"github.com/cilium/cilium/pkg/maps/policymap"
 	"github.com/cilium/cilium/pkg/policy"
 	"github.com/cilium/cilium/pkg/policy/api"
 
@@ -95,92 +96,161 @@ func (e *Endpoint) cleanUnusedRedirects(owner Owner, oldMap policy.L4PolicyMap,
 	}
 }
 
-func getSecurityIdentities(labelsMap *LabelsMap, selector *api.EndpointSelector) []policy.NumericIdentity {
-	identities := []policy.NumericIdentity{}
-	for idx, labels := range *labelsMap {
-		if selector.Matches(labels) {
-			log.WithFields(log.Fields{
-				logfields.IdentityLabels: labels,
-				logfields.L4PolicyID:     idx,
-			}).Debug("L4 Policy matches")
-			identities = append(identities, idx)
-		}
+// l4PolicyMap is the part of the BPF PolicyMap the L4 policy is installed
+// into
+type l4PolicyMap interface {
+	AllowL4(id uint32, dport uint16, proto uint8) error
+	DeleteL4(id uint32, dport uint16, proto uint8) error
+}
+
+// Looks for mismatches between the PolicyMap entries installed for the
+// previous L4 policy and the entries required by 'newPolicy', and fixes up
+// the PolicyMap 'pm' of this Endpoint to reflect the new L3+L4 combined
+// policy. The identities selected by the filters are resolved via the
+// selector cache so that only the delta is applied to the PolicyMap.
+func (e *Endpoint) applyL4PolicyLocked(pm l4PolicyMap, newPolicy *policy.L4Policy) error {
+	desired := l4PolicyMapKeys(newPolicy, e.NamedPorts)
+	if e.l4PolicyKeys == nil {
+		e.l4PolicyKeys = map[policyMapKey]struct{}{}
 	}
 
-	return identities
-}
+	for key := range e.l4PolicyKeys {
+		if _, ok := desired[key]; ok {
+			continue
+		}
+		if err := pm.DeleteL4(key.identity, key.dport, key.proto); err != nil {
+			// The entry may have been removed already, e.g.
+			// by the L3 policy
+			e.getLogger().WithError(err).WithField(logfields.L4PolicyID, key.identity).Debug("Delete old l4 policy failed")
+		}
+		delete(e.l4PolicyKeys, key)
+	}
 
-func (e *Endpoint) removeOldFilter(labelsMap *LabelsMap, filter *policy.L4Filter) {
-	port := uint16(filter.Port)
-	proto := uint8(filter.U8Proto)
-
-	for _, sel := range filter.FromEndpoints {
-		for _, id := range getSecurityIdentities(labelsMap, &sel) {
-			srcID := id.Uint32()
-			if err := e.PolicyMap.DeleteL4(srcID, port, proto); err != nil {
-				// This happens when the policy would add
-				// multiple copies of the same L4 policy. Only
-				// one of them is actually added, but we'll
-				// still try to remove it multiple times.
-				e.getLogger().WithError(err).WithField(logfields.L4PolicyID, srcID).Debug("Delete old l4 policy failed")
-			}
+	errors := 0
+	for key := range desired {
+		if _, ok := e.l4PolicyKeys[key]; ok {
+			continue
 		}
+		if err := pm.AllowL4(key.identity, key.dport, key.proto); err != nil {
+			e.getLogger().WithError(err).Warn("Update of l4 policy map failed")
+			errors++
+			continue
+		}
+		e.l4PolicyKeys[key] = struct{}{}
+	}
+
+	if errors > 0 {
+		return fmt.Errorf("Some Label+L4 policy updates failed.")
 	}
+	return nil
 }
 
-func (e *Endpoint) applyNewFilter(labelsMap *LabelsMap, filter *policy.L4Filter) int {
-	port := uint16(filter.Port)
-	proto := uint8(filter.U8Proto)
+// policyMapKey identifies an entry of the BPF PolicyMap, dport is in host
+// byte-order.
+type policyMapKey struct {
+	identity uint32
+	dport    uint16
+	proto    uint8
+}
 
-	errors := 0
-	for _, sel := range filter.FromEndpoints {
-		for _, id := range getSecurityIdentities(labelsMap, &sel) {
-			srcID := id.Uint32()
-			if e.PolicyMap.L4Exists(srcID, port, proto) {
-				e.getLogger().WithField("l4Filter", filter).Debug("L4 filter exists")
-				continue
+// l4PolicyMapKeys returns the keys of all PolicyMap entries required by the
+// ingress filters of l4 for the identities selected by the filters. Filters
+// restricted to CIDRs allow the port for the port restricted CIDR prefixes of
+// the L3 policy, filters without any sources allow the port for all
+// identities. Port ranges
+// require an entry for each port of the range, named ports are resolved
+// against namedPorts and skipped if the endpoint does not have them.
+func l4PolicyMapKeys(l4 *policy.L4Policy, namedPorts policy.NamedPortMap) map[policyMapKey]struct{} {
+	keys := map[policyMapKey]struct{}{}
+	if l4 == nil {
+		return keys
+	}
+
+	sc := policy.GetSelectorCache()
+	for _, filter := range l4.Ingress {
+		start, end, ok := filter.Resolve(namedPorts)
+		if !ok {
+			continue
+		}
+
+		identities := []uint32{}
+		if filter.AllowsAllSources() {
+			identities = append(identities, policymap.AllIdentities)
+		}
+		if len(filter.FromCIDRs) > 0 {
+			identities = append(identities, policymap.CIDRIdentities)
+		}
+		for _, sel := range filter.FromEndpoints {
+			for _, id := range sc.GetSelections(sel) {
+				identities = append(identities, id.Uint32())
 			}
-			if err := e.PolicyMap.AllowL4(srcID, port, proto); err != nil {
-				e.getLogger().WithError(err).Warn("Update of l4 policy map failed")
-				errors++
+		}
+
+		for _, id := range identities {
+			// Iterate using an int to not overflow at port 65535
+			for port := int(start); port <= int(end); port++ {
+				keys[policyMapKey{
+					identity: id,
+					dport:    uint16(port),
+					proto:    uint8(filter.U8Proto),
+				}] = struct{}{}
 			}
 		}
 	}
 
-	return errors
+	return keys
 }
 
-// Looks for mismatches between 'oldPolicy' and 'newPolicy', and fixes up
-// this Endpoint's BPF PolicyMap to reflect the new L3+L4 combined policy.
-func (e *Endpoint) applyL4PolicyLocked(labelsMap *LabelsMap, oldPolicy *policy.L4Policy, newPolicy *policy.L4Policy) error {
-	if oldPolicy != nil {
-		for _, filter := range oldPolicy.Ingress {
-			e.removeOldFilter(labelsMap, &filter)
-		}
-	}
+// syncPolicyMapLocked removes all entries from the BPF PolicyMap of the
+// endpoint which are neither allowed by the L3 nor by the L4 policy of the
+// endpoint. This is required if the PolicyMap was pinned by a previous
+// instance of the agent as the policy computation only removes entries it
+// has installed itself.
+//
+// Must be called with e.Mutex held and after the policy has been calculated.
+func (e *Endpoint) syncPolicyMapLocked() error {
+	desired := map[policyMapKey]struct{}{}
 
-	if newPolicy == nil {
-		return nil
+	c := e.Consumable
+	c.Mutex.RLock()
+	for _, consumer := range c.Consumers {
+		desired[policyMapKey{identity: consumer.ID.Uint32()}] = struct{}{}
+	}
+	for id := range c.ReverseRules {
+		desired[policyMapKey{identity: id.Uint32()}] = struct{}{}
 	}
+	c.Mutex.RUnlock()
 
-	errors := 0
+	for key := range e.l4PolicyKeys {
+		desired[key] = struct{}{}
+	}
 
-	for _, filter := range newPolicy.Ingress {
-		errors += e.applyNewFilter(labelsMap, &filter)
+	entries, err := e.PolicyMap.DumpToSlice()
+	if err != nil {
+		return err
 	}
 
-	if errors > 0 {
-		return fmt.Errorf("Some Label+L4 policy updates failed.")
+	for i := range entries {
+		entry := &entries[i]
+		key := policyMapKey{
+			identity: entry.Key.Identity,
+			dport:    entry.Key.GetDestPort(),
+			proto:    entry.Key.Nexthdr,
+		}
+		if _, ok := desired[key]; ok {
+			continue
+		}
+
+		e.getLogger().WithField(logfields.PolicyID, key.identity).Debug("Removing stale policy map entry")
+		if err := e.PolicyMap.DeleteEntry(entry); err != nil {
+			return err
+		}
 	}
+
 	return nil
 }
 
 func getLabelsMap(owner Owner) (*LabelsMap, error) {
-	maxID, err := owner.GetCachedMaxLabelID()
-	if err != nil {
-		return nil, err
-	}
-
 	labelsMap := LabelsMap{}
 
 	reservedIDs := policy.GetConsumableCache().GetReservedIDs()
@@ -197,21 +267,213 @@ func getLabelsMap(owner Owner) (*LabelsMap, error) {
 		labelsMap[idx] = lbls
 	}
 
-	for idx = policy.MinimalNumericIdentity; idx < maxID; idx++ {
-		lbls, err := owner.GetCachedLabelList(idx)
-		if err != nil {
-			return nil, err
-		}
-		// Skip currently unused IDs
-		if lbls == nil || len(lbls) == 0 {
-			continue
-		}
+	for idx, lbls := range policy.GetConsumableCache().GetClusterIdentities() {
 		labelsMap[idx] = lbls
 	}
 
 	return &labelsMap, nil
 }
 
+// IsAffectedByIdentityLocked returns true if the policy of the endpoint
+// depends on the identity with the labels lbls, i.e. if the identity is
+// allowed to reach the endpoint or is selected by one of the L4 filters of
+// the endpoint.
+//
+// Must be called with e.Mutex and repo.Mutex held.
+func (e *Endpoint) IsAffectedByIdentityLocked(repo *policy.Repository, lbls labels.LabelArray) bool {
+	if e.Consumable == nil {
+		return false
+	}
+
+	e.Consumable.Mutex.RLock()
+	ctx := policy.SearchContext{
+		From: lbls,
+		To:   e.Consumable.LabelArray,
+	}
+	e.Consumable.Mutex.RUnlock()
+
+	if repo.AllowsLabelAccess(&ctx) == api.Allowed {
+		return true
+	}
+
+	if e.L4Policy != nil {
+		for _, filter := range e.L4Policy.Ingress {
+			for _, sel := range filter.FromEndpoints {
+				if sel.Matches(lbls) {
+					return true
+				}
+			}
+		}
+	}
+
+	return false
+}
+
+// ApplyIdentityChangeLocked incrementally updates the policy of the endpoint
+// after the cluster identity id has been added, changed or removed. The
+// identity is allowed or denied as consumer according to its current labels
+// and the PolicyMap entries of the L4 policy are updated with the identities
+// now selected by the filters. Neither the policy is recalculated nor the
+// program regenerated. Returns false if the policy of the endpoint has not
+// been calculated yet, in which case a full policy regeneration is required.
+//
+// Must be called with e.Mutex and repo.Mutex held.
+func (e *Endpoint) ApplyIdentityChangeLocked(owner Owner, repo *policy.Repository, id policy.NumericIdentity) bool {
+	if e.PolicyMap == nil {
+		return false
+	}
+	return e.applyIdentityChangeLocked(owner, repo, id, e.PolicyMap)
+}
+
+// applyIdentityChangeLocked implements ApplyIdentityChangeLocked with the L4
+// policy installed into pm.
+func (e *Endpoint) applyIdentityChangeLocked(owner Owner, repo *policy.Repository, id policy.NumericIdentity, pm l4PolicyMap) bool {
+	if e.Consumable == nil || e.LabelsMap == nil || !e.PolicyCalculated {
+		return false
+	}
+
+	var lbls labels.LabelArray
+	if identity := policy.GetConsumableCache().LookupIdentity(id); identity != nil {
+		lbls = identity.Labels.ToSlice()
+	}
+
+	// Keep the set of labels in sync so that the next policy
+	// calculation does not consider the identities changed
+	labelsMap := make(LabelsMap, len(*e.LabelsMap)+1)
+	for k, v := range *e.LabelsMap {
+		labelsMap[k] = v
+	}
+	if lbls != nil {
+		labelsMap[id] = lbls
+	} else {
+		delete(labelsMap, id)
+	}
+	e.LabelsMap = &labelsMap
+
+	c := e.Consumable
+	c.Mutex.Lock()
+	ctx := policy.SearchContext{
+		From: lbls,
+		To:   c.LabelArray,
+	}
+	if owner.TracingEnabled() {
+		ctx.Trace = policy.TRACE_ENABLED
+	}
+	if lbls != nil && repo.AllowsLabelAccess(&ctx) == api.Allowed {
+		e.allowConsumer(owner, id)
+	} else {
+		c.BanConsumerLocked(id)
+	}
+	c.Mutex.Unlock()
+
+	if err := e.applyL4PolicyLocked(pm, e.L4Policy); err != nil {
+		e.getLogger().WithError(err).WithField(logfields.Identity, id).Warn("Unable to apply identity change to L4 policy")
+	}
+
+	return true
+}
+
+// ApplyRuleChangeLocked incrementally updates the policy of the endpoint
+// after rules have been added to or deleted from repo. If the new L4 policy
+// only differs in the sources selected by its filters, the consumers are
+// recalculated and only the delta of the selected identities is applied to
+// the PolicyMap, the program is not regenerated. Returns false if the policy
+// of the endpoint has not been calculated yet or if the rules change more
+// than the selected identities, e.g. the ports, the CIDR policy or the
+// policy enforcement of the endpoint, in which case the endpoint must be
+// regenerated.
+//
+// Must be called with e.Mutex and repo.Mutex held.
+func (e *Endpoint) ApplyRuleChangeLocked(owner Owner, repo *policy.Repository) bool {
+	if e.PolicyMap == nil || owner.DryModeEnabled() {
+		return false
+	}
+	return e.applyRuleChangeLocked(owner, repo, e.PolicyMap)
+}
+
+// applyRuleChangeLocked implements ApplyRuleChangeLocked with the L4 policy
+// installed into pm.
+func (e *Endpoint) applyRuleChangeLocked(owner Owner, repo *policy.Repository, pm l4PolicyMap) bool {
+	// A pending regeneration must not be skipped
+	if e.Consumable == nil || e.LabelsMap == nil || !e.PolicyCalculated ||
+		e.forcePolicyCompute || e.nextPolicyRevision > e.policyRevision {
+		return false
+	}
+
+	revision := repo.GetRevision()
+
+	c := e.Consumable
+	c.Mutex.Lock()
+	defer c.Mutex.Unlock()
+
+	if c.ID == 0 {
+		return false
+	}
+
+	// The L4 policy is shared by all endpoints of the consumable
+	if c.Iteration != revision {
+		if err := e.resolveL4Policy(owner, repo, c); err != nil {
+			return false
+		}
+		c.Iteration = revision
+	}
+
+	if !c.L4Policy.EqualsExceptSources(e.L4Policy) {
+		return false
+	}
+	if n := len(l4PolicyMapKeys(c.L4Policy, e.NamedPorts)); n > policymap.MAX_KEYS {
+		return false
+	}
+
+	ctx := policy.SearchContext{
+		To: c.LabelArray,
+	}
+	if owner.TracingEnabled() {
+		ctx.Trace = policy.TRACE_ENABLED
+	}
+	if !reflect.DeepEqual(e.L3Policy, repo.ResolveL3Policy(&ctx)) {
+		return false
+	}
+
+	// The options are part of the program
+	opts := make(models.ConfigurationMap)
+	e.checkEgressAccess(owner, (*e.LabelsMap)[policy.ReservedIdentityHost], opts, OptionAllowToHost)
+	e.checkEgressAccess(owner, (*e.LabelsMap)[policy.ReservedIdentityWorld], opts, OptionAllowToWorld)
+	if owner.EnableEndpointPolicyEnforcement(e) {
+		opts[OptionPolicy] = "enabled"
+	} else {
+		opts[OptionPolicy] = "disabled"
+	}
+	for k, v := range opts {
+		if e.Opts.IsEnabled(k) != (v == "enabled") {
+			return false
+		}
+	}
+
+	if e.L4Policy != c.L4Policy {
+		sc := policy.GetSelectorCache()
+		sc.AddSelectors(c.L4Policy.IngressSelectors())
+		sc.RemoveSelectors(e.L4Policy.IngressSelectors())
+		e.L4Policy = c.L4Policy
+	}
+
+	e.updateConsumersLocked(owner, e.LabelsMap, repo, c)
+
+	if err := e.applyL4PolicyLocked(pm, e.L4Policy); err != nil {
+		e.getLogger().WithError(err).Warn("Unable to apply rule change to L4 policy")
+		// Forget the set of labels to reapply the L4 policy on the
+		// regeneration
+		e.LabelsMap = nil
+		return false
+	}
+
+	e.nextPolicyRevision = revision
+	e.policyRevision = revision
+	e.updateLogger()
+
+	return true
+}
+
 // Must be called with global endpoint.Mutex held
 func (e *Endpoint) resolveL4Policy(owner Owner, repo *policy.Repository, c *policy.Consumable) error {
 	ctx := policy.SearchContext{
@@ -234,19 +496,34 @@ func (e *Endpoint) resolveL4Policy(owner Owner, repo *policy.Repository, c *poli
 	return nil
 }
 
+// regenerateConsumable updates the consumers of the consumable c and the
+// PolicyMap of the endpoint. Returns true if the L4 policy has changed and
+// the program of the endpoint needs to be regenerated. If the L4 policy
+// could not be applied to the PolicyMap, the error is returned after the
+// consumers have been updated and the L4 policy is reapplied on the next
+// regeneration.
+//
 // Must be called with global endpoint.Mutex held
-func (e *Endpoint) regenerateConsumable(owner Owner, labelsMap *LabelsMap, repo *policy.Repository, c *policy.Consumable) bool {
+func (e *Endpoint) regenerateConsumable(owner Owner, labelsMap *LabelsMap, repo *policy.Repository, c *policy.Consumable) (bool, error) {
+	var l4Err error
 	changed := false
 
-	// Mark all entries unused by denying them
-	for k := range c.Consumers {
-		c.Consumers[k].DeletionMark = true
-	}
-
 	// L4 policy needs to be applied on two conditions
 	// 1. The L4 policy has changed
 	// 2. The set of applicable security identities has changed.
+	// Only a change of the L4 policy itself requires the program to be
+	// regenerated, changes of the selected identities are applied to the
+	// PolicyMap.
 	if e.L4Policy != c.L4Policy || e.LabelsMap != labelsMap {
+		if e.L4Policy != c.L4Policy {
+			// Add the new selectors first to keep the selections
+			// of selectors shared by both policies cached
+			sc := policy.GetSelectorCache()
+			sc.AddSelectors(c.L4Policy.IngressSelectors())
+			sc.RemoveSelectors(e.L4Policy.IngressSelectors())
+			changed = true
+		}
+
 		// PolicyMap can't be created in dry mode.
 		if !owner.DryModeEnabled() {
 			// Update Endpoint's L4Policy
@@ -255,20 +532,42 @@ func (e *Endpoint) regenerateConsumable(owner Owner, labelsMap *LabelsMap, repo
 				e.cleanUnusedRedirects(owner, e.L4Policy.Egress, c.L4Policy.Egress)
 			}
 
-			err := e.applyL4PolicyLocked(labelsMap, e.L4Policy, c.L4Policy)
-			if err != nil {
-				// This should not happen, and we can't fail at this stage anyway.
-				e.getLogger().Fatal("L4 Policy application failed")
-			}
+			l4Err = e.applyL4PolicyLocked(e.PolicyMap, c.L4Policy)
 		}
 		e.L4Policy = c.L4Policy // Reuse the common policy
 		e.LabelsMap = labelsMap // Remember the set of labels used
-		changed = true
+		if l4Err != nil {
+			// Forget the set of labels to reapply the L4 policy
+			// on the next regeneration
+			e.LabelsMap = nil
+		}
+	}
+
+	// Changes of the consumers are applied to the PolicyMap directly and
+	// do not require the program to be regenerated.
+	e.updateConsumersLocked(owner, labelsMap, repo, c)
+
+	if l4Err != nil {
+		return changed, fmt.Errorf("L4 policy application failed: %s", l4Err)
+	}
+	return changed, nil
+}
+
+// updateConsumersLocked allows all identities in labelsMap which may reach
+// the consumable c according to repo as consumers and bans all others.
+// Returns the number of consumers which have changed.
+//
+// Must be called with global endpoint.Mutex, repo.Mutex and c.Mutex held
+func (e *Endpoint) updateConsumersLocked(owner Owner, labelsMap *LabelsMap, repo *policy.Repository, c *policy.Consumable) int {
+	// Mark all entries unused by denying them
+	for k := range c.Consumers {
+		c.Consumers[k].DeletionMark = true
 	}
 
+	consumersChanged := 0
 	if owner.AlwaysAllowLocalhost() || c.L4Policy.HasRedirect() {
 		if e.allowConsumer(owner, policy.ReservedIdentityHost) {
-			changed = true
+			consumersChanged++
 		}
 	}
 
@@ -288,7 +587,7 @@ func (e *Endpoint) regenerateConsumable(owner Owner, labelsMap *LabelsMap, repo
 
 		if repo.AllowsLabelAccess(&ctx) == api.Allowed {
 			if e.allowConsumer(owner, srcID) {
-				changed = true
+				consumersChanged++
 			}
 		}
 	}
@@ -298,16 +597,17 @@ func (e *Endpoint) regenerateConsumable(owner Owner, labelsMap *LabelsMap, repo
 		if val.DeletionMark {
 			val.DeletionMark = false
 			c.BanConsumerLocked(val.ID)
-			changed = true
+			consumersChanged++
 		}
 	}
 
 	e.getLogger().WithFields(log.Fields{
 		logfields.Identity: c.ID,
 		"consumers":        logfields.Repr(c.Consumers),
+		"consumersChanged": consumersChanged,
 	}).Debug("New consumable with consumers")
 
-	return changed
+	return consumersChanged
 }
 
 // Must be called with global repo.Mutrex, e.Mutex, and c.Mutex held
@@ -441,12 +741,21 @@ func (e *Endpoint) regeneratePolicy(owner Owner, opts models.ConfigurationMap) (
 		e.getLogger().WithField(logfields.Identity, c.ID).Debug("Reusing cached L4 policy")
 	}
 
+	// Refuse policies which can not be installed into the PolicyMap
+	// rather than applying them partially
+	if !owner.DryModeEnabled() {
+		if n := len(l4PolicyMapKeys(c.L4Policy, e.NamedPorts)); n > policymap.MAX_KEYS {
+			return false, fmt.Errorf("L4 policy requires %d PolicyMap entries, exceeding the maximum of %d", n, policymap.MAX_KEYS)
+		}
+	}
+
 	var policyChanged bool
 	if policyChanged, err = e.regenerateL3Policy(owner, repo, revision, c); err != nil {
 		return false, err
 	}
 
-	// no failures after this point
+	// no failures after this point, except for failures to update the
+	// PolicyMap which are reported once all other changes are applied
 
 	// Apply possible option changes before regenerating maps, as map regeneration
 	// depends on the conntrack options
@@ -469,7 +778,8 @@ func (e *Endpoint) regeneratePolicy(owner Owner, opts models.ConfigurationMap) (
 
 	optsChanged := e.applyOptsLocked(opts)
 
-	if e.regenerateConsumable(owner, labelsMap, repo, c) {
+	consumableChanged, consumableErr := e.regenerateConsumable(owner, labelsMap, repo, c)
+	if consumableChanged {
 		policyChanged = true
 	}
 
@@ -504,6 +814,10 @@ func (e *Endpoint) regeneratePolicy(owner Owner, opts models.ConfigurationMap) (
 		"policyRevision.next": e.nextPolicyRevision,
 	}).Debug("Done regenerating")
 
+	if consumableErr != nil {
+		return false, consumableErr
+	}
+
 	// Return true if need to regenerate BPF
 	return optsChanged || policyChanged || e.nextPolicyRevision > e.policyRevision, nil
 }
@@ -604,6 +918,7 @@ func (e *Endpoint) Regenerate(owner Owner, reason string) <-chan bool {
 				buildSuccess = true
 				e.LogStatusOK(BPF, "Successfully regenerated endpoint program due to "+reason)
 			}
+			owner.UpdateCiliumEndpoint(e)
 
 			req.Done <- buildSuccess
 		} else {
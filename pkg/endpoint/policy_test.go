@@ -0,0 +1,377 @@
+// Copyright 2018 Authors of Cilium
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package endpoint
+
+import (
+	"fmt"
+
+	"github.com/cilium/cilium/pkg/labels"
+	"github.com/cilium/cilium/pkg/maps/policymap"
+	"github.com/cilium/cilium/pkg/option"
+	"github.com/cilium/cilium/pkg/policy"
+	"github.com/cilium/cilium/pkg/policy/api"
+	"github.com/cilium/cilium/pkg/u8proto"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *EndpointSuite) TestL4PolicyMapKeys(c *C) {
+	sc := policy.GetSelectorCache()
+	sc.UpsertIdentity(policy.NumericIdentity(1000), labels.ParseLabelArray("app=api"))
+	sc.UpsertIdentity(policy.NumericIdentity(1001), labels.ParseLabelArray("app=web"))
+	defer sc.RemoveIdentity(policy.NumericIdentity(1000))
+	defer sc.RemoveIdentity(policy.NumericIdentity(1001))
+
+	l4 := policy.NewL4Policy()
+	l4.Ingress["5432/TCP"] = policy.L4Filter{
+		Port:          5432,
+		Protocol:      api.ProtoTCP,
+		U8Proto:       u8proto.U8proto(6),
+		FromEndpoints: []api.EndpointSelector{api.NewESFromLabels(labels.ParseSelectLabel("app=api"))},
+		Ingress:       true,
+	}
+	l4.Ingress["80/TCP"] = policy.L4Filter{
+		Port:     80,
+		Protocol: api.ProtoTCP,
+		U8Proto:  u8proto.U8proto(6),
+		Ingress:  true,
+	}
+
+	l4.Ingress["8000-8002/TCP"] = policy.L4Filter{
+		Port:          8000,
+		EndPort:       8002,
+		Protocol:      api.ProtoTCP,
+		U8Proto:       u8proto.U8proto(6),
+		FromEndpoints: []api.EndpointSelector{api.NewESFromLabels(labels.ParseSelectLabel("app=web"))},
+		Ingress:       true,
+	}
+	l4.Ingress["dns/UDP"] = policy.L4Filter{
+		PortName: "dns",
+		Protocol: api.ProtoUDP,
+		U8Proto:  u8proto.U8proto(17),
+		Ingress:  true,
+	}
+	l4.Ingress["metrics/TCP"] = policy.L4Filter{
+		PortName: "metrics",
+		Protocol: api.ProtoTCP,
+		U8Proto:  u8proto.U8proto(6),
+		Ingress:  true,
+	}
+
+	namedPorts := policy.NamedPortMap{
+		"dns":     {Port: 53, Protocol: api.ProtoUDP},
+		"metrics": {Port: 9090, Protocol: api.ProtoUDP},
+	}
+
+	// The named port "metrics" does not match the protocol of the filter
+	c.Assert(l4PolicyMapKeys(l4, namedPorts), DeepEquals, map[policyMapKey]struct{}{
+		{identity: 1000, dport: 5432, proto: 6}:                   {},
+		{identity: policymap.AllIdentities, dport: 80, proto: 6}:  {},
+		{identity: 1001, dport: 8000, proto: 6}:                   {},
+		{identity: 1001, dport: 8001, proto: 6}:                   {},
+		{identity: 1001, dport: 8002, proto: 6}:                   {},
+		{identity: policymap.AllIdentities, dport: 53, proto: 17}: {},
+	})
+
+	c.Assert(l4PolicyMapKeys(nil, namedPorts), HasLen, 0)
+}
+
+func (s *EndpointSuite) TestL4PolicyMapKeysFromCIDR(c *C) {
+	sc := policy.GetSelectorCache()
+	sc.UpsertIdentity(policy.NumericIdentity(1000), labels.ParseLabelArray("app=api"))
+	defer sc.RemoveIdentity(policy.NumericIdentity(1000))
+
+	repo := policy.NewPolicyRepository()
+	_, err := repo.AddList(api.Rules{{
+		EndpointSelector: api.NewESFromLabels(labels.ParseSelectLabel("app=db")),
+		Ingress: []api.IngressRule{
+			{
+				FromCIDRSet: []api.CIDRRule{{Cidr: "10.0.0.0/8"}},
+				ToPorts: []api.PortRule{{
+					Ports: []api.PortProtocol{{Port: "5432", Protocol: api.ProtoTCP}},
+				}},
+			},
+			{
+				FromEndpoints: []api.EndpointSelector{api.NewESFromLabels(labels.ParseSelectLabel("app=api"))},
+				ToPorts: []api.PortRule{{
+					Ports: []api.PortProtocol{{Port: "5432", Protocol: api.ProtoTCP}},
+				}},
+			},
+		},
+	}})
+	c.Assert(err, IsNil)
+
+	ctx := &policy.SearchContext{To: labels.ParseSelectLabelArray("app=db")}
+	l4, err := repo.ResolveL4Policy(ctx)
+	c.Assert(err, IsNil)
+
+	// The port must neither be opened for all identities nor may the
+	// prefix be allowed on all ports
+	c.Assert(l4PolicyMapKeys(l4, nil), DeepEquals, map[policyMapKey]struct{}{
+		{identity: 1000, dport: 5432, proto: 6}:                     {},
+		{identity: policymap.CIDRIdentities, dport: 5432, proto: 6}: {},
+	})
+
+	l3 := repo.ResolveL3Policy(ctx)
+	c.Assert(l3.Ingress.IsPortRestricted("10.0.0.0/8"), Equals, true)
+}
+
+// fakePolicyMap records the L4 entries installed into the PolicyMap
+type fakePolicyMap struct {
+	entries map[policyMapKey]struct{}
+	// fail makes AllowL4 fail for the key
+	fail map[policyMapKey]struct{}
+}
+
+func newFakePolicyMap() *fakePolicyMap {
+	return &fakePolicyMap{
+		entries: map[policyMapKey]struct{}{},
+		fail:    map[policyMapKey]struct{}{},
+	}
+}
+
+func (m *fakePolicyMap) AllowL4(id uint32, dport uint16, proto uint8) error {
+	key := policyMapKey{identity: id, dport: dport, proto: proto}
+	if _, ok := m.fail[key]; ok {
+		return fmt.Errorf("unable to update %+v", key)
+	}
+	m.entries[key] = struct{}{}
+	return nil
+}
+
+func (m *fakePolicyMap) DeleteL4(id uint32, dport uint16, proto uint8) error {
+	key := policyMapKey{identity: id, dport: dport, proto: proto}
+	if _, ok := m.entries[key]; !ok {
+		return fmt.Errorf("%+v not found", key)
+	}
+	delete(m.entries, key)
+	return nil
+}
+
+// testOwner is an Owner with tracing disabled, all other methods are not
+// expected to be called
+type testOwner struct {
+	Owner
+}
+
+func (o *testOwner) TracingEnabled() bool {
+	return false
+}
+
+func newL4PolicyFromEndpoints(port uint16, from string) *policy.L4Policy {
+	l4 := policy.NewL4Policy()
+	l4.Ingress[fmt.Sprintf("%d/TCP", port)] = policy.L4Filter{
+		Port:          int(port),
+		Protocol:      api.ProtoTCP,
+		U8Proto:       u8proto.U8proto(6),
+		FromEndpoints: []api.EndpointSelector{api.NewESFromLabels(labels.ParseSelectLabel(from))},
+		Ingress:       true,
+	}
+	return l4
+}
+
+func (s *EndpointSuite) TestApplyL4PolicyLocked(c *C) {
+	sc := policy.GetSelectorCache()
+	sc.UpsertIdentity(policy.NumericIdentity(1000), labels.ParseLabelArray("app=api"))
+	sc.UpsertIdentity(policy.NumericIdentity(1001), labels.ParseLabelArray("app=web"))
+	defer sc.RemoveIdentity(policy.NumericIdentity(1000))
+	defer sc.RemoveIdentity(policy.NumericIdentity(1001))
+
+	api5432 := policyMapKey{identity: 1000, dport: 5432, proto: 6}
+	web80 := policyMapKey{identity: 1001, dport: 80, proto: 6}
+
+	e := &Endpoint{}
+	pm := newFakePolicyMap()
+
+	c.Assert(e.applyL4PolicyLocked(pm, newL4PolicyFromEndpoints(5432, "app=api")), IsNil)
+	c.Assert(pm.entries, DeepEquals, map[policyMapKey]struct{}{api5432: {}})
+	c.Assert(e.l4PolicyKeys, DeepEquals, pm.entries)
+
+	// Only the delta is applied, the stale entry is removed
+	c.Assert(e.applyL4PolicyLocked(pm, newL4PolicyFromEndpoints(80, "app=web")), IsNil)
+	c.Assert(pm.entries, DeepEquals, map[policyMapKey]struct{}{web80: {}})
+	c.Assert(e.l4PolicyKeys, DeepEquals, pm.entries)
+
+	// An entry which could not be installed is retried on the next update
+	pm.fail[api5432] = struct{}{}
+	c.Assert(e.applyL4PolicyLocked(pm, newL4PolicyFromEndpoints(5432, "app=api")), Not(IsNil))
+	c.Assert(pm.entries, HasLen, 0)
+	c.Assert(e.l4PolicyKeys, HasLen, 0)
+
+	delete(pm.fail, api5432)
+	c.Assert(e.applyL4PolicyLocked(pm, newL4PolicyFromEndpoints(5432, "app=api")), IsNil)
+	c.Assert(pm.entries, DeepEquals, map[policyMapKey]struct{}{api5432: {}})
+
+	// Entries removed from the map already do not fail the update
+	delete(pm.entries, api5432)
+	c.Assert(e.applyL4PolicyLocked(pm, nil), IsNil)
+	c.Assert(e.l4PolicyKeys, HasLen, 0)
+}
+
+func (s *EndpointSuite) TestApplyIdentityChange(c *C) {
+	cache := policy.GetConsumableCache()
+	id := policy.NumericIdentity(1000)
+	api5432 := policyMapKey{identity: 1000, dport: 5432, proto: 6}
+
+	repo := policy.NewPolicyRepository()
+	_, err := repo.AddList(api.Rules{{
+		EndpointSelector: api.NewESFromLabels(labels.ParseSelectLabel("app=db")),
+		Ingress: []api.IngressRule{{
+			FromEndpoints: []api.EndpointSelector{api.NewESFromLabels(labels.ParseSelectLabel("app=api"))},
+		}},
+	}})
+	c.Assert(err, IsNil)
+
+	consumable := policy.NewConsumable(policy.NumericIdentity(500), nil, cache)
+	consumable.LabelArray = labels.ParseLabelArray("app=db")
+	e := &Endpoint{
+		Opts:             option.NewBoolOptions(&EndpointOptionLibrary),
+		Consumable:       consumable,
+		LabelsMap:        &LabelsMap{},
+		L4Policy:         newL4PolicyFromEndpoints(5432, "app=api"),
+		PolicyCalculated: true,
+	}
+	owner := &testOwner{}
+	pm := newFakePolicyMap()
+
+	identity := policy.NewIdentity()
+	identity.ID = id
+	identity.Labels = labels.ParseStringLabels([]string{"app=api"})
+	cache.UpsertIdentity(identity)
+	defer cache.RemoveIdentity(id)
+
+	lbls := labels.LabelArray(identity.Labels.ToSlice())
+	c.Assert(e.IsAffectedByIdentityLocked(repo, lbls), Equals, true)
+	c.Assert(e.IsAffectedByIdentityLocked(repo, labels.ParseLabelArray("app=web")), Equals, false)
+
+	// The new identity is allowed and selected by the L4 policy
+	c.Assert(e.applyIdentityChangeLocked(owner, repo, id, pm), Equals, true)
+	c.Assert(consumable.Allows(id), Equals, true)
+	c.Assert(pm.entries, DeepEquals, map[policyMapKey]struct{}{api5432: {}})
+	c.Assert((*e.LabelsMap)[id], DeepEquals, lbls)
+
+	// The released identity is banned and its L4 entries are removed
+	cache.RemoveIdentity(id)
+	c.Assert(e.applyIdentityChangeLocked(owner, repo, id, pm), Equals, true)
+	c.Assert(consumable.Allows(id), Equals, false)
+	c.Assert(pm.entries, HasLen, 0)
+	_, ok := (*e.LabelsMap)[id]
+	c.Assert(ok, Equals, false)
+
+	// Without a calculated policy or a PolicyMap the endpoint must be
+	// regenerated
+	cache.UpsertIdentity(identity)
+	e.PolicyCalculated = false
+	c.Assert(e.applyIdentityChangeLocked(owner, repo, id, pm), Equals, false)
+	c.Assert(consumable.Allows(id), Equals, false)
+	c.Assert(pm.entries, HasLen, 0)
+
+	e.PolicyCalculated = true
+	c.Assert(e.ApplyIdentityChangeLocked(owner, repo, id), Equals, false)
+	c.Assert(consumable.Allows(id), Equals, false)
+}
+
+// ruleTestOwner is a testOwner enforcing policy on all endpoints
+type ruleTestOwner struct {
+	testOwner
+	repo *policy.Repository
+}
+
+func (o *ruleTestOwner) GetPolicyRepository() *policy.Repository {
+	return o.repo
+}
+
+func (o *ruleTestOwner) EnableEndpointPolicyEnforcement(e *Endpoint) bool {
+	return true
+}
+
+func (o *ruleTestOwner) AlwaysAllowLocalhost() bool {
+	return false
+}
+
+func (s *EndpointSuite) TestApplyRuleChange(c *C) {
+	sc := policy.GetSelectorCache()
+	sc.UpsertIdentity(policy.NumericIdentity(1000), labels.ParseLabelArray("app=api"))
+	sc.UpsertIdentity(policy.NumericIdentity(1001), labels.ParseLabelArray("app=web"))
+	defer sc.RemoveIdentity(policy.NumericIdentity(1000))
+	defer sc.RemoveIdentity(policy.NumericIdentity(1001))
+
+	api5432 := policyMapKey{identity: 1000, dport: 5432, proto: 6}
+	web5432 := policyMapKey{identity: 1001, dport: 5432, proto: 6}
+
+	ingressRule := func(from string, port string) *api.Rule {
+		return &api.Rule{
+			EndpointSelector: api.NewESFromLabels(labels.ParseSelectLabel("app=db")),
+			Ingress: []api.IngressRule{{
+				FromEndpoints: []api.EndpointSelector{api.NewESFromLabels(labels.ParseSelectLabel(from))},
+				ToPorts: []api.PortRule{{
+					Ports: []api.PortProtocol{{Port: port, Protocol: api.ProtoTCP}},
+				}},
+			}},
+			Labels: labels.ParseLabelArray("rule=" + from + "-" + port),
+		}
+	}
+
+	repo := policy.NewPolicyRepository()
+	_, err := repo.AddList(api.Rules{ingressRule("app=api", "5432")})
+	c.Assert(err, IsNil)
+
+	ctx := &policy.SearchContext{To: labels.ParseSelectLabelArray("app=db")}
+	l4, err := repo.ResolveL4Policy(ctx)
+	c.Assert(err, IsNil)
+
+	consumable := policy.NewConsumable(policy.NumericIdentity(500), nil, policy.GetConsumableCache())
+	consumable.LabelArray = labels.ParseLabelArray("app=db")
+	consumable.L4Policy = l4
+	consumable.Iteration = repo.GetRevision()
+	e := &Endpoint{
+		Opts:       option.NewBoolOptions(&EndpointOptionLibrary),
+		Consumable: consumable,
+		LabelsMap: &LabelsMap{
+			1000: labels.ParseLabelArray("app=api"),
+			1001: labels.ParseLabelArray("app=web"),
+		},
+		L3Policy:         repo.ResolveL3Policy(ctx),
+		L4Policy:         l4,
+		PolicyCalculated: true,
+	}
+	e.Opts.Set(OptionPolicy, true)
+	owner := &ruleTestOwner{repo: repo}
+	pm := newFakePolicyMap()
+	c.Assert(e.applyL4PolicyLocked(pm, l4), IsNil)
+	c.Assert(pm.entries, DeepEquals, map[policyMapKey]struct{}{api5432: {}})
+
+	// A rule selecting an additional source for the same port is applied
+	// to the PolicyMap without regeneration
+	_, err = repo.AddList(api.Rules{ingressRule("app=web", "5432")})
+	c.Assert(err, IsNil)
+	c.Assert(e.applyRuleChangeLocked(owner, repo, pm), Equals, true)
+	c.Assert(pm.entries, DeepEquals, map[policyMapKey]struct{}{api5432: {}, web5432: {}})
+	c.Assert(e.policyRevision, Equals, repo.GetRevision())
+
+	// Deleting the rule removes the entries of the source again
+	_, deleted := repo.DeleteByLabels(labels.ParseLabelArray("rule=app=web-5432"))
+	c.Assert(deleted, Equals, 1)
+	c.Assert(e.applyRuleChangeLocked(owner, repo, pm), Equals, true)
+	c.Assert(pm.entries, DeepEquals, map[policyMapKey]struct{}{api5432: {}})
+
+	// A new port requires the program to be regenerated
+	_, err = repo.AddList(api.Rules{ingressRule("app=web", "80")})
+	c.Assert(err, IsNil)
+	c.Assert(e.applyRuleChangeLocked(owner, repo, pm), Equals, false)
+	c.Assert(pm.entries, DeepEquals, map[policyMapKey]struct{}{api5432: {}})
+
+	sc.RemoveSelectors(e.L4Policy.IngressSelectors())
+}
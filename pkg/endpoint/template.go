@@ -0,0 +1,356 @@
+// Copyright 2018 Authors of Cilium
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package endpoint
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/cilium/cilium/common"
+	"github.com/cilium/cilium/pkg/byteorder"
+	"github.com/cilium/cilium/pkg/elf"
+	"github.com/cilium/cilium/pkg/lock"
+	"github.com/cilium/cilium/pkg/logfields"
+	"github.com/cilium/cilium/pkg/mac"
+	"github.com/cilium/cilium/pkg/maps/cidrmap"
+	"github.com/cilium/cilium/pkg/maps/ctmap"
+	"github.com/cilium/cilium/pkg/maps/policymap"
+	"github.com/cilium/cilium/pkg/policy"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// templateLxcID is the endpoint ID endpoint programs are compiled
+	// for. Names derived from the endpoint ID are replaced in place when
+	// a template is instantiated, so this must be the longest ID.
+	templateLxcID = 65535
+
+	// templatesDirName is the name of the directory in the state
+	// directory holding the compiled templates
+	templatesDirName = "templates"
+
+	// templateTmpSuffix is the suffix of the directory a template is
+	// compiled in before it is moved into place
+	templateTmpSuffix = "_next"
+
+	// policyCallMapID is the ID of the map holding the policy programs of
+	// all endpoints, see CILIUM_MAP_POLICY in bpf/lib/maps.h
+	policyCallMapID = 1
+)
+
+// template is an endpoint program compiled for a given configuration
+type template struct {
+	// mutex serializes the compilation of the template
+	mutex lock.Mutex
+	elf   *elf.ELF
+
+	// refs is the number of endpoints whose program is instantiated from
+	// the template, protected by templatesMutex
+	refs int
+}
+
+var (
+	// templatesMutex protects templates
+	templatesMutex lock.Mutex
+
+	// templates maps the hash of the configuration of a template to the
+	// template
+	templates = map[string]*template{}
+)
+
+// programInstance describes the program of an endpoint as an instance of
+// the template compiled for config
+type programInstance struct {
+	// config is the content of the header file the template is
+	// compiled with
+	config []byte
+
+	// intOptions maps the static data accessed by the program to the
+	// values of the endpoint
+	intOptions map[string]uint32
+
+	// strOptions maps names of maps and sections in the template to the
+	// names of the endpoint
+	strOptions map[string]string
+}
+
+// templateHash returns the hash identifying the template compiled for
+// config against the base program bpfSHA
+func templateHash(bpfSHA string, config []byte) string {
+	hash := sha256.New()
+	hash.Write([]byte(bpfSHA))
+	hash.Write(config)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// templateMapName returns the name of the map with the given prefix in the
+// template
+func templateMapName(prefix string) string {
+	return prefix + strconv.Itoa(templateLxcID)
+}
+
+// macWords returns the 32 bit and the 16 bit word of union macaddr holding m
+func macWords(m mac.MAC) (uint32, uint32) {
+	addr := make([]byte, 6)
+	copy(addr, m)
+	return byteorder.Native.Uint32(addr[0:4]), uint32(byteorder.Native.Uint16(addr[4:6]))
+}
+
+// newProgramInstance returns the instance of the template compiled for
+// config describing the endpoint. geneveOpts are the geneve options of the
+// endpoint, staticData holds the values of the static data the configuration
+// refers to in addition to the description of the endpoint.
+// Must be called with e.Mutex held.
+func (e *Endpoint) newProgramInstance(config, geneveOpts []byte, staticData map[string]uint32) *programInstance {
+	p := &programInstance{
+		config:     config,
+		intOptions: map[string]uint32{},
+		strOptions: map[string]string{},
+	}
+
+	secLabel := policy.InvalidIdentity
+	if e.SecLabel != nil {
+		secLabel = e.SecLabel.ID
+	}
+
+	p.intOptions["LXC_ID"] = uint32(e.ID)
+	p.intOptions["LXC_ID_NB"] = uint32(byteorder.HostToNetwork(e.ID).(uint16))
+	p.intOptions["SECLABEL"] = secLabel.Uint32()
+	p.intOptions["SECLABEL_NB"] = byteorder.HostToNetwork(secLabel.Uint32()).(uint32)
+
+	// Addresses are loaded into unions, the words must be in the memory
+	// layout of the address
+	ip6 := make([]byte, net.IPv6len)
+	copy(ip6, e.IPv6)
+	for i := 0; i < 4; i++ {
+		p.intOptions["LXC_IP_"+strconv.Itoa(i+1)] = byteorder.Native.Uint32(ip6[i*4:])
+	}
+	if e.IPv4 != nil {
+		p.intOptions["LXC_IPV4"] = byteorder.HostSliceToNetwork(e.IPv4, reflect.Uint32).(uint32)
+	}
+	p.intOptions["LXC_MAC_1"], p.intOptions["LXC_MAC_2"] = macWords(e.LXCMAC)
+	p.intOptions["NODE_MAC_1"], p.intOptions["NODE_MAC_2"] = macWords(e.NodeMAC)
+	for i, b := range geneveOpts {
+		p.intOptions["GENEVE_OPTS_"+strconv.Itoa(i)] = uint32(b)
+	}
+	for name, value := range staticData {
+		p.intOptions[name] = value
+	}
+
+	p.strOptions[templateMapName(policymap.MapName)] = path.Base(e.PolicyMapPathLocked())
+	p.strOptions[templateMapName(CallsMapName)] = path.Base(e.CallsMapPathLocked())
+	p.strOptions[templateMapName(ctmap.MapName6)] = path.Base(e.Ct6MapPathLocked())
+	p.strOptions[templateMapName(ctmap.MapName4)] = path.Base(e.Ct4MapPathLocked())
+	p.strOptions[templateMapName(cidrmap.MapName+"ingress6_")] = path.Base(e.IPv6IngressMapPathLocked())
+	p.strOptions[templateMapName(cidrmap.MapName+"egress6_")] = path.Base(e.IPv6EgressMapPathLocked())
+	p.strOptions[templateMapName(cidrmap.MapName+"ingress4_")] = path.Base(e.IPv4IngressMapPathLocked())
+	p.strOptions[templateMapName(cidrmap.MapName+"egress4_")] = path.Base(e.IPv4EgressMapPathLocked())
+
+	// The policy program is installed into the policy program map at the
+	// index of the endpoint ID
+	p.strOptions[fmt.Sprintf("%d/%d", policyCallMapID, templateLxcID)] =
+		fmt.Sprintf("%d/%d", policyCallMapID, e.ID)
+
+	return p
+}
+
+// write instantiates the template for the endpoint and writes the program
+// to epdir
+func (p *programInstance) write(tmpl *elf.ELF, epdir string) error {
+	return tmpl.Write(filepath.Join(epdir, programFileName), p.intOptions, p.strOptions)
+}
+
+// getTemplate returns the template compiled for the configuration of p and
+// its hash, compiling the template if it does not exist yet. Endpoints with
+// the same configuration share a template. The caller holds a reference to
+// the template which must be released with releaseTemplate.
+func (e *Endpoint) getTemplate(owner Owner, p *programInstance) (*elf.ELF, string, error) {
+	hash := templateHash(owner.GetBPFSHA(), p.config)
+
+	templatesMutex.Lock()
+	t, ok := templates[hash]
+	if !ok {
+		t = &template{}
+		templates[hash] = t
+	}
+	t.refs++
+	templatesMutex.Unlock()
+
+	tmpl, err := e.loadTemplate(owner, t, hash, p.config)
+	if err != nil {
+		releaseTemplate(owner.GetStateDir(), hash)
+		return nil, "", err
+	}
+
+	return tmpl, hash, nil
+}
+
+// loadTemplate returns the program of t, compiling it for config into the
+// template directory identified by hash if needed
+func (e *Endpoint) loadTemplate(owner Owner, t *template, hash string, config []byte) (*elf.ELF, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.elf != nil {
+		return t.elf, nil
+	}
+
+	dir := filepath.Join(owner.GetStateDir(), templatesDirName, hash)
+	prog := filepath.Join(dir, programFileName)
+	if _, err := os.Stat(prog); err != nil {
+		if err := e.compileTemplate(owner, dir, config); err != nil {
+			return nil, err
+		}
+	} else {
+		log.WithFields(log.Fields{
+			logfields.EndpointID: e.ID,
+			logfields.Path:       dir,
+		}).Debug("Reusing compiled template")
+	}
+
+	tmpl, err := elf.Open(prog)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open template %s: %s", prog, err)
+	}
+	t.elf = tmpl
+
+	return tmpl, nil
+}
+
+// releaseTemplate releases a reference to the template identified by hash.
+// Templates no longer referenced by any endpoint are evicted from memory and
+// removed from the state directory stateDir.
+func releaseTemplate(stateDir, hash string) {
+	if hash == "" {
+		return
+	}
+
+	templatesMutex.Lock()
+	defer templatesMutex.Unlock()
+
+	t, ok := templates[hash]
+	if !ok {
+		return
+	}
+	t.refs--
+	if t.refs > 0 {
+		return
+	}
+
+	// The directory is removed with templatesMutex held so that the
+	// template cannot be compiled again in the meantime
+	delete(templates, hash)
+	dir := filepath.Join(stateDir, templatesDirName, hash)
+	if err := os.RemoveAll(dir); err != nil {
+		log.WithError(err).WithField(logfields.Path, dir).Warn("Unable to remove unused template")
+	}
+}
+
+// setTemplate records that the program of the endpoint is instantiated from
+// the template identified by hash, releasing the template the program was
+// instantiated from before.
+// Must be called with e.BuildMutex held.
+func (e *Endpoint) setTemplate(stateDir, hash string) {
+	old := e.templateHash
+	e.templateHash = hash
+	releaseTemplate(stateDir, old)
+}
+
+// compileTemplate compiles the endpoint program for config into dir. The
+// template is compiled in a temporary directory which is renamed to dir on
+// success so that dir never contains an incomplete template.
+func (e *Endpoint) compileTemplate(owner Owner, dir string, config []byte) error {
+	tmpDir := dir + templateTmpSuffix
+	if err := os.RemoveAll(tmpDir); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(tmpDir, 0755); err != nil {
+		return fmt.Errorf("unable to create template directory %s: %s", tmpDir, err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(tmpDir, common.CHeaderFileName), config, 0644); err != nil {
+		os.RemoveAll(tmpDir)
+		return fmt.Errorf("unable to write template header file: %s", err)
+	}
+
+	libdir := owner.GetBpfDir()
+	rundir := owner.GetStateDir()
+	debug := strconv.FormatBool(owner.DebugEnabled())
+	prog := filepath.Join(libdir, "compile_ep.sh")
+	if err := e.runScript(prog, libdir, rundir, tmpDir, debug); err != nil {
+		os.RemoveAll(tmpDir)
+		return err
+	}
+
+	os.RemoveAll(dir)
+	if err := os.Rename(tmpDir, dir); err != nil {
+		os.RemoveAll(tmpDir)
+		return fmt.Errorf("unable to move template into place: %s", err)
+	}
+
+	return nil
+}
+
+// RemoveTemplates removes all compiled templates from the state directory
+// stateDir. It must be called whenever the base program changes, with the
+// compilation lock held for writing.
+func RemoveTemplates(stateDir string) error {
+	templatesMutex.Lock()
+	templates = map[string]*template{}
+	templatesMutex.Unlock()
+
+	return os.RemoveAll(filepath.Join(stateDir, templatesDirName))
+}
+
+// RemoveUnusedTemplates removes the compiled templates in the state directory
+// stateDir which no endpoint program is instantiated from, e.g. templates
+// left behind by endpoints which did not survive a restart. It must be called
+// once the restored endpoints have been regenerated.
+func RemoveUnusedTemplates(stateDir string) error {
+	templatesMutex.Lock()
+	defer templatesMutex.Unlock()
+
+	dir := filepath.Join(stateDir, templatesDirName)
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	for _, entry := range entries {
+		// Templates being compiled are in a temporary directory
+		hash := strings.TrimSuffix(entry.Name(), templateTmpSuffix)
+		if _, ok := templates[hash]; ok {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(dir, entry.Name())); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
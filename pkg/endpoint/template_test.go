@@ -0,0 +1,150 @@
+// Copyright 2018 Authors of Cilium
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package endpoint
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/cilium/cilium/pkg/byteorder"
+	"github.com/cilium/cilium/pkg/mac"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *EndpointSuite) TestTemplateHash(c *C) {
+	config := []byte("#define LXC_ID fetch_u16(LXC_ID)\n")
+
+	c.Assert(templateHash("sha", config), Equals, templateHash("sha", config))
+	c.Assert(templateHash("sha", config), Not(Equals), templateHash("sha2", config))
+	c.Assert(templateHash("sha", config), Not(Equals), templateHash("sha", []byte("#define DROP_ALL\n")))
+}
+
+func (s *EndpointSuite) TestNewProgramInstance(c *C) {
+	lxcMAC, err := mac.ParseMAC("aa:bb:cc:dd:ee:ff")
+	c.Assert(err, IsNil)
+
+	e := Endpoint{
+		ID:     IPv6Addr.EndpointID(),
+		IPv6:   IPv6Addr,
+		IPv4:   IPv4Addr,
+		LXCMAC: lxcMAC,
+		Status: NewEndpointStatus(),
+	}
+
+	p := e.newProgramInstance([]byte("config"), []byte{0xff, 0x1}, map[string]uint32{
+		"CFG_L4_INGRESS_PORT_0": 80,
+	})
+	c.Assert(string(p.config), Equals, "config")
+
+	c.Assert(p.intOptions["LXC_ID"], Equals, uint32(4370))
+	c.Assert(p.intOptions["LXC_ID_NB"], Equals, uint32(byteorder.HostToNetwork(uint16(4370)).(uint16)))
+	c.Assert(p.intOptions["LXC_IP_1"], Equals, byteorder.Native.Uint32(IPv6Addr[0:4]))
+	c.Assert(p.intOptions["LXC_IP_4"], Equals, byteorder.Native.Uint32(IPv6Addr[12:16]))
+	c.Assert(p.intOptions["LXC_MAC_1"], Equals, byteorder.Native.Uint32([]byte{0xaa, 0xbb, 0xcc, 0xdd}))
+	c.Assert(p.intOptions["LXC_MAC_2"], Equals, uint32(byteorder.Native.Uint16([]byte{0xee, 0xff})))
+	c.Assert(p.intOptions["GENEVE_OPTS_0"], Equals, uint32(0xff))
+	c.Assert(p.intOptions["GENEVE_OPTS_1"], Equals, uint32(0x1))
+	c.Assert(p.intOptions["CFG_L4_INGRESS_PORT_0"], Equals, uint32(80))
+
+	// Without a node MAC the address is zero rather than missing as the
+	// template always accesses it
+	c.Assert(p.intOptions["NODE_MAC_1"], Equals, uint32(0))
+	c.Assert(p.intOptions["NODE_MAC_2"], Equals, uint32(0))
+
+	c.Assert(p.strOptions["cilium_policy_65535"], Equals, "cilium_policy_4370")
+	c.Assert(p.strOptions["cilium_calls_65535"], Equals, "cilium_calls_4370")
+	c.Assert(p.strOptions["1/65535"], Equals, "1/4370")
+}
+
+func createTemplateDir(c *C, stateDir, name string) string {
+	dir := filepath.Join(stateDir, templatesDirName, name)
+	c.Assert(os.MkdirAll(dir, 0755), IsNil)
+	return dir
+}
+
+func (s *EndpointSuite) TestReleaseTemplate(c *C) {
+	stateDir, err := ioutil.TempDir("", "cilium-templates")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(stateDir)
+	defer RemoveTemplates(stateDir)
+
+	dirA := createTemplateDir(c, stateDir, "a")
+	dirB := createTemplateDir(c, stateDir, "b")
+	templatesMutex.Lock()
+	templates["a"] = &template{refs: 2}
+	templates["b"] = &template{refs: 1}
+	templatesMutex.Unlock()
+
+	e1 := &Endpoint{templateHash: "a"}
+	e2 := &Endpoint{templateHash: "a"}
+
+	// Switching to another template releases the previous one, which
+	// is kept as long as other endpoints use it
+	e1.setTemplate(stateDir, "b")
+	templatesMutex.Lock()
+	templates["b"].refs++
+	templatesMutex.Unlock()
+	c.Assert(templates["a"].refs, Equals, 1)
+	_, err = os.Stat(dirA)
+	c.Assert(err, IsNil)
+
+	// Unused templates are evicted from memory and from the state
+	// directory
+	e2.setTemplate(stateDir, "")
+	c.Assert(e2.templateHash, Equals, "")
+	_, ok := templates["a"]
+	c.Assert(ok, Equals, false)
+	_, err = os.Stat(dirA)
+	c.Assert(os.IsNotExist(err), Equals, true)
+
+	releaseTemplate(stateDir, "b")
+	c.Assert(templates["b"].refs, Equals, 1)
+	e1.setTemplate(stateDir, "")
+	_, ok = templates["b"]
+	c.Assert(ok, Equals, false)
+	_, err = os.Stat(dirB)
+	c.Assert(os.IsNotExist(err), Equals, true)
+
+	// Releasing unknown templates is a no-op
+	releaseTemplate(stateDir, "unknown")
+}
+
+func (s *EndpointSuite) TestRemoveUnusedTemplates(c *C) {
+	stateDir, err := ioutil.TempDir("", "cilium-templates")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(stateDir)
+	defer RemoveTemplates(stateDir)
+
+	// Without any templates there is nothing to remove
+	c.Assert(RemoveUnusedTemplates(stateDir), IsNil)
+
+	used := createTemplateDir(c, stateDir, "used")
+	compiling := createTemplateDir(c, stateDir, "used"+templateTmpSuffix)
+	unused := createTemplateDir(c, stateDir, "unused")
+	templatesMutex.Lock()
+	templates["used"] = &template{refs: 1}
+	templatesMutex.Unlock()
+
+	c.Assert(RemoveUnusedTemplates(stateDir), IsNil)
+
+	_, err = os.Stat(used)
+	c.Assert(err, IsNil)
+	_, err = os.Stat(compiling)
+	c.Assert(err, IsNil)
+	_, err = os.Stat(unused)
+	c.Assert(os.IsNotExist(err), Equals, true)
+}
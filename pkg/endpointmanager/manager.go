@@ -19,7 +19,11 @@ import (
 	"sync"
 
 	"github.com/cilium/cilium/pkg/endpoint"
+	"github.com/cilium/cilium/pkg/labels"
 	"github.com/cilium/cilium/pkg/lock"
+	"github.com/cilium/cilium/pkg/logfields"
+	"github.com/cilium/cilium/pkg/policy"
+	"github.com/cilium/cilium/pkg/policy/api"
 
 	log "github.com/sirupsen/logrus"
 )
@@ -234,19 +238,131 @@ func LookupLocked(id string) (*endpoint.Endpoint, error) {
 	}
 }
 
+// GetEndpoints returns a slice of all endpoints present in endpoint manager.
+func GetEndpoints() []*endpoint.Endpoint {
+	Mutex.RLock()
+	eps := make([]*endpoint.Endpoint, 0, len(Endpoints))
+	for _, ep := range Endpoints {
+		eps = append(eps, ep)
+	}
+	Mutex.RUnlock()
+	return eps
+}
+
+// GetPolicyRealization returns the number of endpoints selected by any of the
+// rules and whether all of them run at least the policy revision rev.
+func GetPolicyRealization(rules api.Rules, rev uint64) (int, bool) {
+	selected, realized := 0, true
+
+	for _, ep := range GetEndpoints() {
+		ep.Mutex.RLock()
+		if ep.SecLabel != nil {
+			lbls := ep.SecLabel.Labels.LabelArray()
+			for _, r := range rules {
+				if r.EndpointSelector.Matches(lbls) {
+					selected++
+					if ep.GetPolicyRevisionLocked() < rev {
+						realized = false
+					}
+					break
+				}
+			}
+		}
+		ep.Mutex.RUnlock()
+	}
+
+	return selected, realized
+}
+
 // TriggerPolicyUpdates calls TriggerPolicyUpdatesLocked for each endpoint and
 // regenerates as required. During this process, the endpoint list is locked
 // and cannot be modified.
 // Returns a waiting group that can be used to know when all the endpoints are
 // regenerated.
 func TriggerPolicyUpdates(owner endpoint.Owner) *sync.WaitGroup {
-	var wg sync.WaitGroup
+	Mutex.RLock()
+	eps := make([]*endpoint.Endpoint, 0, len(Endpoints))
+	for _, ep := range Endpoints {
+		eps = append(eps, ep)
+	}
+	Mutex.RUnlock()
+
+	return triggerPolicyUpdates(owner, eps)
+}
+
+// UpdatePolicyForIdentity updates the policy of all endpoints affected by
+// the identity id with the labels lbls, e.g. after the identity has been
+// allocated or released in the cluster. The consumers and policy maps of the
+// endpoints are updated incrementally without regenerating their programs.
+// Endpoints whose policy has not been calculated yet are regenerated.
+func UpdatePolicyForIdentity(owner endpoint.Owner, id policy.NumericIdentity, lbls labels.LabelArray) *sync.WaitGroup {
+	repo := owner.GetPolicyRepository()
 
 	Mutex.RLock()
+	updated := 0
+	eps := []*endpoint.Endpoint{}
+	for _, ep := range Endpoints {
+		ep.Mutex.Lock()
+		repo.Mutex.RLock()
+		if ep.IsAffectedByIdentityLocked(repo, lbls) {
+			if ep.ApplyIdentityChangeLocked(owner, repo, id) {
+				updated++
+			} else {
+				eps = append(eps, ep)
+			}
+		}
+		repo.Mutex.RUnlock()
+		ep.Mutex.Unlock()
+	}
+	Mutex.RUnlock()
+
+	log.WithFields(log.Fields{
+		logfields.Identity:       id,
+		logfields.IdentityLabels: lbls,
+		"endpoints.updated":      updated,
+		"endpoints.regenerated":  len(eps),
+	}).Debug("Updating policy of endpoints affected by identity change")
+
+	return triggerPolicyUpdates(owner, eps)
+}
+
+// UpdatePolicyForRules updates the policy of all endpoints after rules have
+// been added to or deleted from the policy repository. Endpoints whose L4
+// policy only changes in the selected identities are updated incrementally
+// without regenerating their programs, all other endpoints are regenerated.
+func UpdatePolicyForRules(owner endpoint.Owner) *sync.WaitGroup {
+	repo := owner.GetPolicyRepository()
+
+	Mutex.RLock()
+	updated := 0
+	eps := []*endpoint.Endpoint{}
+	for _, ep := range Endpoints {
+		ep.Mutex.Lock()
+		repo.Mutex.RLock()
+		if ep.ApplyRuleChangeLocked(owner, repo) {
+			updated++
+		} else {
+			eps = append(eps, ep)
+		}
+		repo.Mutex.RUnlock()
+		ep.Mutex.Unlock()
+	}
+	Mutex.RUnlock()
 
-	wg.Add(len(Endpoints))
+	log.WithFields(log.Fields{
+		"endpoints.updated":     updated,
+		"endpoints.regenerated": len(eps),
+	}).Debug("Updating policy of endpoints after rule change")
 
-	for k := range Endpoints {
+	return triggerPolicyUpdates(owner, eps)
+}
+
+func triggerPolicyUpdates(owner endpoint.Owner, eps []*endpoint.Endpoint) *sync.WaitGroup {
+	var wg sync.WaitGroup
+
+	wg.Add(len(eps))
+
+	for _, ep := range eps {
 		go func(ep *endpoint.Endpoint, wg *sync.WaitGroup) {
 			ep.Mutex.Lock()
 			policyChanges, err := ep.TriggerPolicyUpdatesLocked(owner, nil)
@@ -268,10 +384,8 @@ func TriggerPolicyUpdates(owner endpoint.Owner) *sync.WaitGroup {
 				}
 			}
 			wg.Done()
-		}(Endpoints[k], &wg)
+		}(ep, &wg)
 	}
 
-	Mutex.RUnlock()
-
 	return &wg
 }
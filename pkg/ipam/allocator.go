@@ -20,9 +20,8 @@ import (
 	"math/big"
 	"net"
 
-	"github.com/cilium/cilium/pkg/node"
-
 	k8sAPI "k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/registry/core/service/ipallocator"
 )
 
 // Error definitions
@@ -34,49 +33,46 @@ var (
 	ErrIPv6Disabled = errors.New("IPv6 allocation disabled")
 )
 
-// AllocateIP allocates a IP address.
-func AllocateIP(ip net.IP) error {
+// AllocateIP allocates a IP address on behalf of owner.
+func AllocateIP(ip net.IP, owner string) error {
 	ipamConf.allocatorMutex.Lock()
 	defer ipamConf.allocatorMutex.Unlock()
 
-	if ip.To4() != nil {
-		if ipamConf.IPv4Allocator == nil {
-			return ErrIPv4Disabled
-		}
-
-		if err := ipamConf.IPv4Allocator.Allocate(ip); err != nil {
-			return err
-		}
-	} else {
-		if ipamConf.IPv6Allocator == nil {
-			return ErrIPv6Disabled
-		}
-
-		if err := ipamConf.IPv6Allocator.Allocate(ip); err != nil {
-			return err
-		}
+	if err := allocateLocked(ip); err != nil {
+		return err
 	}
 
+	journalAddLocked(ip, owner, false)
+
 	return nil
 }
 
 // AllocateIPString is identical to AllocateIP but takes a string
-func AllocateIPString(ipAddr string) error {
+func AllocateIPString(ipAddr, owner string) error {
 	ip := net.ParseIP(ipAddr)
 	if ip == nil {
 		return fmt.Errorf("Invalid IP address: %s", ipAddr)
 	}
 
-	return AllocateIP(ip)
+	return AllocateIP(ip, owner)
 }
 
 // AllocateNext allocates the next available IPv4 and IPv6 address out of the
-// configured address pool. If family is set to "ipv4" or "ipv6", then
-// allocation is limited to the specified address family. If the pool has been
-// drained of addresses, an error will be returned.
-func AllocateNext(family string) (net.IP, net.IP, error) {
+// address pool with the given name or the default pool if pool is empty. If
+// family is set to "ipv4" or "ipv6", then allocation is limited to the
+// specified address family. If the pool has been drained of addresses, an
+// error will be returned. The allocation is journaled on behalf of owner.
+func AllocateNext(family, pool, owner string) (net.IP, net.IP, error) {
 	var ipv4, ipv6 net.IP
 
+	ipamConf.allocatorMutex.Lock()
+	defer ipamConf.allocatorMutex.Unlock()
+
+	p, err := getPool(pool)
+	if err != nil {
+		return nil, nil, err
+	}
+
 	if (family == "ipv6" || family == "") && ipamConf.IPv6Allocator != nil {
 		ipConf, err := ipamConf.IPv6Allocator.AllocateNext()
 		if err != nil {
@@ -86,15 +82,25 @@ func AllocateNext(family string) (net.IP, net.IP, error) {
 		ipv6 = ipConf
 	}
 
-	if (family == "ipv4" || family == "") && ipamConf.IPv4Allocator != nil {
-		ipConf, err := ipamConf.IPv4Allocator.AllocateNext()
+	if (family == "ipv4" || family == "") && p.IPv4Allocator != nil {
+		ipConf, err := p.IPv4Allocator.AllocateNext()
 		if err != nil {
+			if ipv6 != nil {
+				ipamConf.IPv6Allocator.Release(ipv6)
+			}
 			return nil, nil, err
 		}
 
 		ipv4 = ipConf
 	}
 
+	if ipv6 != nil {
+		journalAddLocked(ipv6, owner, false)
+	}
+	if ipv4 != nil {
+		journalAddLocked(ipv4, owner, false)
+	}
+
 	return ipv4, ipv6, nil
 }
 
@@ -108,7 +114,7 @@ func ReleaseIP(ip net.IP) error {
 			return ErrIPv4Disabled
 		}
 
-		if err := ipamConf.IPv4Allocator.Release(ip); err != nil {
+		if err := ipv4AllocatorFor(ip).Release(ip); err != nil {
 			return err
 		}
 	} else {
@@ -121,6 +127,8 @@ func ReleaseIP(ip net.IP) error {
 		}
 	}
 
+	journalRemoveLocked(ip)
+
 	return nil
 }
 
@@ -134,30 +142,36 @@ func ReleaseIPString(ipAddr string) error {
 	return ReleaseIP(ip)
 }
 
-// Dump dumps the list of allocated IP addresses
+// dumpRange returns the list of allocated addresses in the range r covering
+// cidr
+func dumpRange(r *ipallocator.Range, cidr *net.IPNet) []string {
+	alloc := []string{}
+	ral := k8sAPI.RangeAllocation{}
+	r.Snapshot(&ral)
+	origIP := big.NewInt(0).SetBytes(cidr.IP)
+	bits := big.NewInt(0).SetBytes(ral.Data)
+	for i := 0; i < bits.BitLen(); i++ {
+		if bits.Bit(i) != 0 {
+			alloc = append(alloc, net.IP(big.NewInt(0).Add(origIP, big.NewInt(int64(uint(i+1)))).Bytes()).String())
+		}
+	}
+
+	return alloc
+}
+
+// Dump dumps the list of allocated IP addresses of all pools
 func Dump() ([]string, []string) {
 	ipamConf.allocatorMutex.RLock()
 	defer ipamConf.allocatorMutex.RUnlock()
 
 	allocv4 := []string{}
-	ralv4 := k8sAPI.RangeAllocation{}
-	ipamConf.IPv4Allocator.Snapshot(&ralv4)
-	origIP := big.NewInt(0).SetBytes(node.GetIPv4AllocRange().IP)
-	v4Bits := big.NewInt(0).SetBytes(ralv4.Data)
-	for i := 0; i < v4Bits.BitLen(); i++ {
-		if v4Bits.Bit(i) != 0 {
-			allocv4 = append(allocv4, net.IP(big.NewInt(0).Add(origIP, big.NewInt(int64(uint(i+1)))).Bytes()).String())
-		}
-	}
-
 	allocv6 := []string{}
-	ralv6 := k8sAPI.RangeAllocation{}
-	ipamConf.IPv6Allocator.Snapshot(&ralv6)
-	origIP = big.NewInt(0).SetBytes(node.GetIPv6AllocRange().IP)
-	v6Bits := big.NewInt(0).SetBytes(ralv6.Data)
-	for i := 0; i < v6Bits.BitLen(); i++ {
-		if v6Bits.Bit(i) != 0 {
-			allocv6 = append(allocv6, net.IP(big.NewInt(0).Add(origIP, big.NewInt(int64(uint(i+1)))).Bytes()).String())
+	for _, p := range sortedPools() {
+		if p.IPv4Allocator != nil {
+			allocv4 = append(allocv4, dumpRange(p.IPv4Allocator, p.IPv4Range)...)
+		}
+		if p.IPv6Allocator != nil {
+			allocv6 = append(allocv6, dumpRange(p.IPv6Allocator, p.IPv6Range)...)
 		}
 	}
 
@@ -0,0 +1,327 @@
+// Copyright 2018 Authors of Cilium
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ipam
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/cilium/cilium/api/v1/models"
+	"github.com/cilium/cilium/common"
+	"github.com/cilium/cilium/pkg/kvstore"
+	"github.com/cilium/cilium/pkg/lock"
+	"github.com/cilium/cilium/pkg/logfields"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// ModeHostLocal allocates addresses out of the node local range
+	// configured with --ipv4-range/--ipv6-range or derived from the
+	// Kubernetes node PodCIDR
+	ModeHostLocal = "host-local"
+
+	// ModeClusterPool allocates addresses out of a per node CIDR which is
+	// leased from a cluster wide CIDR via the kvstore
+	ModeClusterPool = "cluster-pool"
+
+	// ClusterPoolPath is the base path in the kvstore under which the per
+	// node CIDR leases are stored
+	ClusterPoolPath = common.OperationalPath + "/IPAM/ClusterPool"
+)
+
+// nodeCIDRLease is the value stored in the kvstore for each leased node CIDR
+type nodeCIDRLease struct {
+	Node string `json:"node"`
+	CIDR string `json:"cidr"`
+
+	// value is the raw value as stored in the kvstore
+	value []byte
+}
+
+var (
+	clusterPoolMutex lock.RWMutex
+	mode             = ModeHostLocal
+	clusterPools     = map[string]*net.IPNet{}
+	nodeCIDRs        = map[string]*net.IPNet{}
+)
+
+// SetMode sets the IPAM mode
+func SetMode(m string) error {
+	switch m {
+	case ModeHostLocal, ModeClusterPool:
+	default:
+		return fmt.Errorf("unknown IPAM mode %q", m)
+	}
+
+	clusterPoolMutex.Lock()
+	mode = m
+	clusterPoolMutex.Unlock()
+
+	return nil
+}
+
+// GetMode returns the IPAM mode
+func GetMode() string {
+	clusterPoolMutex.RLock()
+	defer clusterPoolMutex.RUnlock()
+	return mode
+}
+
+func familyOf(cidr *net.IPNet) string {
+	if cidr.IP.To4() != nil {
+		return "ipv4"
+	}
+	return "ipv6"
+}
+
+// leaseKey returns the kvstore key of the lease for the node CIDR
+func leaseKey(cidr *net.IPNet) string {
+	return path.Join(ClusterPoolPath, familyOf(cidr), strings.Replace(cidr.String(), "/", "_", 1))
+}
+
+// nthSubnet returns the n-th subnet with a prefix length of maskSize within
+// clusterCIDR
+func nthSubnet(clusterCIDR *net.IPNet, maskSize int, n *big.Int) *net.IPNet {
+	_, bits := clusterCIDR.Mask.Size()
+
+	ip := clusterCIDR.IP.Mask(clusterCIDR.Mask)
+	if bits == 8*net.IPv4len {
+		ip = ip.To4()
+	}
+
+	offset := new(big.Int).Lsh(n, uint(bits-maskSize))
+	sum := new(big.Int).Add(new(big.Int).SetBytes(ip), offset)
+
+	subnet := make(net.IP, len(ip))
+	b := sum.Bytes()
+	copy(subnet[len(subnet)-len(b):], b)
+
+	return &net.IPNet{IP: subnet, Mask: net.CIDRMask(maskSize, bits)}
+}
+
+// overlapsAny returns true if cidr overlaps with any of the CIDRs in used.
+// Leases may have been created with a different node mask size, two CIDRs
+// overlap if either of them contains the other.
+func overlapsAny(cidr *net.IPNet, used []*net.IPNet) bool {
+	for _, u := range used {
+		if u.Contains(cidr.IP) || cidr.Contains(u.IP) {
+			return true
+		}
+	}
+	return false
+}
+
+func listNodeCIDRLeases(family string) ([]nodeCIDRLease, error) {
+	pairs, err := kvstore.ListPrefix(path.Join(ClusterPoolPath, family))
+	if err != nil {
+		return nil, err
+	}
+
+	leases := make([]nodeCIDRLease, 0, len(pairs))
+	for key, value := range pairs {
+		var l nodeCIDRLease
+		if err := json.Unmarshal(value, &l); err != nil {
+			log.WithError(err).WithField("key", key).Warning("Ignoring invalid node CIDR lease")
+			continue
+		}
+		l.value = value
+		leases = append(leases, l)
+	}
+
+	sort.Slice(leases, func(i, j int) bool { return leases[i].CIDR < leases[j].CIDR })
+
+	return leases, nil
+}
+
+// AllocateNodeCIDR leases a CIDR with a prefix length of maskSize out of
+// clusterCIDR for the node nodeName. The lease is attached to the kvstore
+// lease of the agent and is thus released automatically when the node stops
+// renewing it. A CIDR previously leased by the same node is reused to keep
+// the addresses of endpoints stable across restarts.
+func AllocateNodeCIDR(clusterCIDR *net.IPNet, maskSize int, nodeName string) (*net.IPNet, error) {
+	ones, bits := clusterCIDR.Mask.Size()
+	if maskSize < ones || maskSize > bits {
+		return nil, fmt.Errorf("node mask size /%d does not fit into cluster CIDR %s", maskSize, clusterCIDR)
+	}
+
+	family := familyOf(clusterCIDR)
+	scopedLog := log.WithFields(log.Fields{
+		logfields.NodeName: nodeName,
+		"clusterCIDR":      clusterCIDR,
+	})
+
+	leases, err := listNodeCIDRLeases(family)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list node CIDR leases: %s", err)
+	}
+
+	inUse := []*net.IPNet{}
+	var (
+		previous      *net.IPNet
+		previousValue []byte
+	)
+	for _, l := range leases {
+		_, cidr, err := net.ParseCIDR(l.CIDR)
+		if err != nil {
+			continue
+		}
+		if l.Node == nodeName && previous == nil && clusterCIDR.Contains(cidr.IP) {
+			if size, _ := cidr.Mask.Size(); size == maskSize {
+				previous = cidr
+				previousValue = l.value
+				continue
+			}
+		}
+		inUse = append(inUse, cidr)
+	}
+
+	// claim leases cidr. If previousValue is not nil, the existing lease
+	// with that value is taken over instead of creating a new one.
+	claim := func(cidr *net.IPNet, previousValue []byte) bool {
+		value, err := json.Marshal(nodeCIDRLease{Node: nodeName, CIDR: cidr.String()})
+		if err != nil {
+			return false
+		}
+
+		if previousValue != nil {
+			err = kvstore.UpdateIfValue(leaseKey(cidr), previousValue, value, true)
+		} else {
+			err = kvstore.CreateOnly(leaseKey(cidr), value, true)
+		}
+		if err != nil {
+			scopedLog.WithError(err).WithField("cidr", cidr).Debug("Unable to lease node CIDR")
+			return false
+		}
+
+		clusterPoolMutex.Lock()
+		clusterPools[family] = clusterCIDR
+		nodeCIDRs[family] = cidr
+		clusterPoolMutex.Unlock()
+
+		scopedLog.WithField("cidr", cidr).Info("Leased node CIDR from cluster pool")
+		return true
+	}
+
+	// The lease of a previous incarnation of this node is still attached
+	// to the old kvstore lease, take it over unless it has been modified
+	// since it was listed.
+	if previous != nil && claim(previous, previousValue) {
+		return previous, nil
+	}
+
+	one := big.NewInt(1)
+	count := new(big.Int).Lsh(one, uint(maskSize-ones))
+	for n := big.NewInt(0); n.Cmp(count) < 0; n.Add(n, one) {
+		cidr := nthSubnet(clusterCIDR, maskSize, n)
+		if overlapsAny(cidr, inUse) {
+			continue
+		}
+
+		if claim(cidr, nil) {
+			return cidr, nil
+		}
+	}
+
+	return nil, fmt.Errorf("cluster CIDR %s is exhausted", clusterCIDR)
+}
+
+// ReleaseNodeCIDRs releases all CIDRs leased by the node nodeName. It is
+// called when a node is removed from the cluster.
+func ReleaseNodeCIDRs(nodeName string) {
+	for _, family := range []string{"ipv4", "ipv6"} {
+		leases, err := listNodeCIDRLeases(family)
+		if err != nil {
+			log.WithError(err).WithField("family", family).Warning("Unable to list node CIDR leases")
+			continue
+		}
+
+		for _, l := range leases {
+			if l.Node != nodeName {
+				continue
+			}
+
+			_, cidr, err := net.ParseCIDR(l.CIDR)
+			if err != nil {
+				continue
+			}
+
+			if err := kvstore.Delete(leaseKey(cidr)); err != nil {
+				log.WithError(err).WithFields(log.Fields{
+					logfields.NodeName: nodeName,
+					"cidr":             cidr,
+				}).Warning("Unable to release node CIDR")
+				continue
+			}
+
+			log.WithFields(log.Fields{
+				logfields.NodeName: nodeName,
+				"cidr":             cidr,
+			}).Info("Released node CIDR")
+		}
+	}
+}
+
+// ClusterPoolStatus returns the status of the cluster pool. If listLeases is
+// true, the CIDRs leased by all nodes are included.
+func ClusterPoolStatus(listLeases bool) *models.IPAMClusterPoolStatus {
+	clusterPoolMutex.RLock()
+	defer clusterPoolMutex.RUnlock()
+
+	if mode != ModeClusterPool {
+		return nil
+	}
+
+	status := &models.IPAMClusterPoolStatus{}
+	if c, ok := clusterPools["ipv4"]; ok {
+		status.IPV4ClusterCidr = c.String()
+		status.IPV4NodeCidr = nodeCIDRs["ipv4"].String()
+	}
+	if c, ok := clusterPools["ipv6"]; ok {
+		status.IPV6ClusterCidr = c.String()
+		status.IPV6NodeCidr = nodeCIDRs["ipv6"].String()
+	}
+
+	if !listLeases {
+		return status
+	}
+
+	status.Leases = []*models.IPAMNodeCIDRLease{}
+	for _, family := range []string{"ipv4", "ipv6"} {
+		if _, ok := clusterPools[family]; !ok {
+			continue
+		}
+
+		leases, err := listNodeCIDRLeases(family)
+		if err != nil {
+			log.WithError(err).Warning("Unable to list node CIDR leases")
+			continue
+		}
+
+		for _, l := range leases {
+			status.Leases = append(status.Leases, &models.IPAMNodeCIDRLease{
+				Node: l.Node,
+				Cidr: l.CIDR,
+			})
+		}
+	}
+
+	return status
+}
@@ -169,5 +169,15 @@ func Init() error {
 
 	node.SetIPv6Router(routerIP)
 
+	ipamConf.Pools = map[string]*Pool{
+		DefaultPool: {
+			Name:          DefaultPool,
+			IPv6Range:     node.GetIPv6AllocRange(),
+			IPv4Range:     node.GetIPv4AllocRange(),
+			IPv6Allocator: ipamConf.IPv6Allocator,
+			IPv4Allocator: ipamConf.IPv4Allocator,
+		},
+	}
+
 	return nil
 }
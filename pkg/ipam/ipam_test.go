@@ -15,7 +15,10 @@
 package ipam
 
 import (
+	"math/big"
+	"net"
 	"testing"
+	"time"
 
 	"github.com/cilium/cilium/common/addressing"
 	"github.com/cilium/cilium/pkg/node"
@@ -62,3 +65,89 @@ func (s *IPAMSuite) TestLock(c *C) {
 	err = ipamConf.IPv4Allocator.Release(epipv4.IP())
 	c.Assert(err, IsNil)
 }
+
+func (s *IPAMSuite) TestNthSubnet(c *C) {
+	_, cluster, err := net.ParseCIDR("10.16.0.0/12")
+	c.Assert(err, IsNil)
+
+	c.Assert(nthSubnet(cluster, 24, big.NewInt(0)).String(), Equals, "10.16.0.0/24")
+	c.Assert(nthSubnet(cluster, 24, big.NewInt(1)).String(), Equals, "10.16.1.0/24")
+	c.Assert(nthSubnet(cluster, 24, big.NewInt(256)).String(), Equals, "10.17.0.0/24")
+
+	_, cluster, err = net.ParseCIDR("f00d::/64")
+	c.Assert(err, IsNil)
+
+	c.Assert(nthSubnet(cluster, 96, big.NewInt(3)).String(), Equals, "f00d::3:0:0/96")
+	c.Assert(leaseKey(nthSubnet(cluster, 96, big.NewInt(3))), Equals, ClusterPoolPath+"/ipv6/f00d::3:0:0_96")
+}
+
+func (s *IPAMSuite) TestOverlapsAny(c *C) {
+	parse := func(cidrs ...string) []*net.IPNet {
+		result := []*net.IPNet{}
+		for _, cidr := range cidrs {
+			_, n, err := net.ParseCIDR(cidr)
+			c.Assert(err, IsNil)
+			result = append(result, n)
+		}
+		return result
+	}
+
+	used := parse("10.16.0.0/24", "10.16.4.0/22")
+
+	c.Assert(overlapsAny(parse("10.16.0.0/24")[0], used), Equals, true)
+	c.Assert(overlapsAny(parse("10.16.1.0/24")[0], used), Equals, false)
+	// Contained in a larger lease
+	c.Assert(overlapsAny(parse("10.16.5.0/24")[0], used), Equals, true)
+	// Containing a smaller lease
+	c.Assert(overlapsAny(parse("10.16.0.0/23")[0], used), Equals, true)
+	c.Assert(overlapsAny(parse("10.16.2.0/23")[0], used), Equals, false)
+	c.Assert(overlapsAny(parse("10.16.0.0/24")[0], nil), Equals, false)
+}
+
+func (s *IPAMSuite) TestJournal(c *C) {
+	node.InitDefaultPrefix("")
+	c.Assert(Init(), IsNil)
+
+	dir := c.MkDir()
+	c.Assert(InitJournal(dir, false), IsNil)
+	defer func() {
+		journalPath = ""
+		journal = map[string]*reservation{}
+	}()
+
+	orphan, _, err := AllocateNext("ipv4", DefaultPool, "default/foo")
+	c.Assert(err, IsNil)
+	claimed, _, err := AllocateNext("ipv4", DefaultPool, "default/bar")
+	c.Assert(err, IsNil)
+	c.Assert(ClaimIP(claimed, "endpoint:1"), IsNil)
+	// Addresses allocated without owner are orphaned alike
+	unowned, _, err := AllocateNext("ipv4", DefaultPool, "")
+	c.Assert(err, IsNil)
+	loopback, _, err := AllocateNext("ipv4", DefaultPool, "loopback")
+	c.Assert(err, IsNil)
+	c.Assert(ClaimIP(loopback, "loopback"), IsNil)
+
+	c.Assert(ReleaseOrphans(time.Hour), Equals, 0)
+	c.Assert(ReleaseOrphans(0), Equals, 2)
+	c.Assert(ipamConf.IPv4Allocator.Has(orphan), Equals, false)
+	c.Assert(ipamConf.IPv4Allocator.Has(claimed), Equals, true)
+	c.Assert(ipamConf.IPv4Allocator.Has(unowned), Equals, false)
+
+	// Restart with fresh allocators and restore the journal
+	journal = map[string]*reservation{}
+	c.Assert(Init(), IsNil)
+	c.Assert(InitJournal(dir, true), IsNil)
+	c.Assert(ipamConf.IPv4Allocator.Has(claimed), Equals, true)
+	c.Assert(journal[claimed.String()].Claimed, Equals, false)
+	c.Assert(journal[claimed.String()].Owner, Equals, "endpoint:1")
+	c.Assert(ipamConf.IPv4Allocator.Has(unowned), Equals, false)
+
+	// The restored addresses of an owner can be looked up to claim them
+	// again instead of allocating new ones
+	owned := OwnedIPs("loopback")
+	c.Assert(owned, HasLen, 1)
+	c.Assert(owned[0].Equal(loopback), Equals, true)
+	c.Assert(OwnedIPs("unknown"), HasLen, 0)
+	c.Assert(ClaimIP(owned[0], "loopback"), IsNil)
+	c.Assert(journal[loopback.String()].Claimed, Equals, true)
+}
@@ -0,0 +1,269 @@
+// Copyright 2018 Authors of Cilium
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ipam
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/cilium/cilium/pkg/logfields"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// JournalFile is the name of the file in the state directory in which
+	// IP address reservations are journaled
+	JournalFile = "ipam.json"
+
+	// OrphanGracePeriod is the time after which a reservation which has
+	// not been claimed by an endpoint is considered orphaned and released
+	OrphanGracePeriod = 10 * time.Minute
+)
+
+// reservation is the journal entry of an allocated IP address
+type reservation struct {
+	// Owner is the entity which requested the address, e.g. the pod in
+	// the form namespace/pod, the container or the endpoint which claimed
+	// it. It is informational only, addresses with and without owner are
+	// released alike if they are not claimed within the grace period.
+	Owner string `json:"owner,omitempty"`
+
+	// Claimed is true if the address is in use, e.g. by an endpoint
+	Claimed bool `json:"claimed,omitempty"`
+
+	// Timestamp is the time the address was allocated or claimed
+	Timestamp time.Time `json:"timestamp"`
+}
+
+var (
+	// journalPath is the path of the journal file. Reservations are
+	// only journaled after InitJournal has been called.
+	journalPath string
+
+	// journal maps IP addresses in string form to their reservation. It is
+	// protected by ipamConf.allocatorMutex.
+	journal = map[string]*reservation{}
+)
+
+// writeJournalLocked writes the journal to disk. Must be called with
+// allocatorMutex held.
+func writeJournalLocked() {
+	if journalPath == "" {
+		return
+	}
+
+	scopedLog := log.WithField(logfields.Path, journalPath)
+
+	data, err := json.MarshalIndent(journal, "", "  ")
+	if err != nil {
+		scopedLog.WithError(err).Warning("Unable to marshal IPAM journal")
+		return
+	}
+
+	tmp := journalPath + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		scopedLog.WithError(err).Warning("Unable to write IPAM journal")
+		return
+	}
+
+	if err := os.Rename(tmp, journalPath); err != nil {
+		scopedLog.WithError(err).Warning("Unable to write IPAM journal")
+	}
+}
+
+// journalAddLocked records the allocation of ip. Must be called with
+// allocatorMutex held.
+func journalAddLocked(ip net.IP, owner string, claimed bool) {
+	journal[ip.String()] = &reservation{
+		Owner:     owner,
+		Claimed:   claimed,
+		Timestamp: time.Now(),
+	}
+	writeJournalLocked()
+}
+
+// journalRemoveLocked records the release of ip. Must be called with
+// allocatorMutex held.
+func journalRemoveLocked(ip net.IP) {
+	if _, ok := journal[ip.String()]; ok {
+		delete(journal, ip.String())
+		writeJournalLocked()
+	}
+}
+
+// allocateLocked reserves ip in the allocator of the pool it belongs to.
+// Must be called with allocatorMutex held.
+func allocateLocked(ip net.IP) error {
+	if ip.To4() != nil {
+		if ipamConf.IPv4Allocator == nil {
+			return ErrIPv4Disabled
+		}
+		return ipv4AllocatorFor(ip).Allocate(ip)
+	}
+
+	if ipamConf.IPv6Allocator == nil {
+		return ErrIPv6Disabled
+	}
+	return ipamConf.IPv6Allocator.Allocate(ip)
+}
+
+// InitJournal journals all allocations in the state directory stateDir. If
+// restore is true, the reservations journaled by a previous run are restored
+// first. Restored reservations are considered unclaimed until they are
+// claimed again with ClaimIP, e.g. when the owning endpoint is restored. Must
+// be called after Init and after all pools have been added.
+func InitJournal(stateDir string, restore bool) error {
+	ipamConf.allocatorMutex.Lock()
+	defer ipamConf.allocatorMutex.Unlock()
+
+	journalPath = filepath.Join(stateDir, JournalFile)
+
+	if !restore {
+		writeJournalLocked()
+		return nil
+	}
+
+	data, err := ioutil.ReadFile(journalPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	restored := map[string]*reservation{}
+	if err := json.Unmarshal(data, &restored); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for ipStr, r := range restored {
+		scopedLog := log.WithFields(log.Fields{
+			logfields.IPAddr: ipStr,
+			"owner":          r.Owner,
+		})
+
+		ip := net.ParseIP(ipStr)
+		if ip == nil {
+			scopedLog.Warning("Ignoring invalid IP address in IPAM journal")
+			continue
+		}
+
+		if err := allocateLocked(ip); err != nil {
+			scopedLog.WithError(err).Warning("Unable to restore IP address reservation")
+			continue
+		}
+
+		// Addresses which were in use are given the full grace period
+		// to be claimed again.
+		if r.Claimed {
+			r.Timestamp = now
+		}
+		r.Claimed = false
+		journal[ip.String()] = r
+	}
+
+	writeJournalLocked()
+
+	log.WithField("count", len(journal)).Info("Restored IP address reservations")
+
+	return nil
+}
+
+// ClaimIP marks ip as in use by owner, e.g. an endpoint. If ip is not
+// allocated yet, it is allocated.
+func ClaimIP(ip net.IP, owner string) error {
+	ipamConf.allocatorMutex.Lock()
+	defer ipamConf.allocatorMutex.Unlock()
+
+	if r, ok := journal[ip.String()]; ok {
+		r.Owner = owner
+		r.Claimed = true
+		r.Timestamp = time.Now()
+		writeJournalLocked()
+		return nil
+	}
+
+	if err := allocateLocked(ip); err != nil {
+		return err
+	}
+
+	journalAddLocked(ip, owner, true)
+
+	return nil
+}
+
+// OwnedIPs returns all addresses journaled on behalf of owner, e.g. to reuse
+// the addresses of the agent itself which were restored from the journal.
+func OwnedIPs(owner string) []net.IP {
+	ipamConf.allocatorMutex.Lock()
+	defer ipamConf.allocatorMutex.Unlock()
+
+	ips := []net.IP{}
+	for ipStr, r := range journal {
+		if r.Owner == owner {
+			ips = append(ips, net.ParseIP(ipStr))
+		}
+	}
+
+	return ips
+}
+
+// ReleaseOrphans releases all reservations which have not been claimed within
+// gracePeriod and returns the number of released addresses.
+func ReleaseOrphans(gracePeriod time.Duration) int {
+	ipamConf.allocatorMutex.Lock()
+	defer ipamConf.allocatorMutex.Unlock()
+
+	released := 0
+	deadline := time.Now().Add(-gracePeriod)
+	for ipStr, r := range journal {
+		if r.Claimed || r.Timestamp.After(deadline) {
+			continue
+		}
+
+		scopedLog := log.WithFields(log.Fields{
+			logfields.IPAddr: ipStr,
+			"owner":          r.Owner,
+		})
+
+		ip := net.ParseIP(ipStr)
+		var err error
+		if ip.To4() != nil {
+			err = ipv4AllocatorFor(ip).Release(ip)
+		} else {
+			err = ipamConf.IPv6Allocator.Release(ip)
+		}
+		if err != nil {
+			scopedLog.WithError(err).Warning("Unable to release orphaned IP address")
+			continue
+		}
+
+		delete(journal, ipStr)
+		released++
+		scopedLog.Info("Released orphaned IP address")
+	}
+
+	if released > 0 {
+		writeJournalLocked()
+	}
+
+	return released
+}
@@ -0,0 +1,137 @@
+// Copyright 2018 Authors of Cilium
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ipam
+
+import (
+	"fmt"
+	"net"
+	"sort"
+
+	"github.com/cilium/cilium/api/v1/models"
+	"github.com/cilium/cilium/pkg/logfields"
+
+	log "github.com/sirupsen/logrus"
+	"k8s.io/kubernetes/pkg/registry/core/service/ipallocator"
+)
+
+// DefaultPool is the name of the pool backed by the node allocation ranges
+const DefaultPool = "default"
+
+// AddPool adds an IPv4 pool with the given name. As the endpoint ID is
+// derived from the IPv6 address of an endpoint, IPv6 addresses are always
+// allocated out of the default pool.
+func AddPool(name string, cidr *net.IPNet) error {
+	if cidr.IP.To4() == nil {
+		return fmt.Errorf("pool %s: only IPv4 pools are supported", name)
+	}
+
+	ipamConf.allocatorMutex.Lock()
+	defer ipamConf.allocatorMutex.Unlock()
+
+	if _, ok := ipamConf.Pools[name]; ok {
+		return fmt.Errorf("pool %s already exists", name)
+	}
+
+	for _, p := range ipamConf.Pools {
+		if p.IPv4Range != nil && (p.IPv4Range.Contains(cidr.IP) || cidr.Contains(p.IPv4Range.IP)) {
+			return fmt.Errorf("pool %s: %s overlaps with pool %s", name, cidr, p.Name)
+		}
+	}
+
+	ipamConf.Pools[name] = &Pool{
+		Name:          name,
+		IPv4Range:     cidr,
+		IPv4Allocator: ipallocator.NewCIDRRange(cidr),
+	}
+
+	log.WithFields(log.Fields{
+		"pool":             name,
+		logfields.V4Prefix: cidr,
+	}).Info("Added IP pool")
+
+	return nil
+}
+
+// getPool returns the pool with the given name or the default pool if name
+// is empty. Must be called with allocatorMutex held.
+func getPool(name string) (*Pool, error) {
+	if name == "" {
+		name = DefaultPool
+	}
+
+	p, ok := ipamConf.Pools[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown IP pool %q", name)
+	}
+
+	return p, nil
+}
+
+// ipv4AllocatorFor returns the allocator of the pool containing ip or the
+// allocator of the default pool. Must be called with allocatorMutex held.
+func ipv4AllocatorFor(ip net.IP) *ipallocator.Range {
+	for _, p := range ipamConf.Pools {
+		if p.Name != DefaultPool && p.IPv4Range.Contains(ip) {
+			return p.IPv4Allocator
+		}
+	}
+
+	return ipamConf.IPv4Allocator
+}
+
+// sortedPools returns the pools sorted by name with the default pool first.
+// Must be called with allocatorMutex held.
+func sortedPools() []*Pool {
+	pools := make([]*Pool, 0, len(ipamConf.Pools))
+	for _, p := range ipamConf.Pools {
+		pools = append(pools, p)
+	}
+
+	sort.Slice(pools, func(i, j int) bool {
+		if pools[i].Name == DefaultPool || pools[j].Name == DefaultPool {
+			return pools[i].Name == DefaultPool
+		}
+		return pools[i].Name < pools[j].Name
+	})
+
+	return pools
+}
+
+// PoolStatus returns the usage of all IP pools
+func PoolStatus() []*models.IPAMPoolStatus {
+	ipamConf.allocatorMutex.RLock()
+	defer ipamConf.allocatorMutex.RUnlock()
+
+	status := []*models.IPAMPoolStatus{}
+	for _, p := range sortedPools() {
+		s := &models.IPAMPoolStatus{Name: p.Name}
+
+		if p.IPv4Allocator != nil {
+			s.IPV4Cidr = p.IPv4Range.String()
+			s.IPV4Used = int64(len(dumpRange(p.IPv4Allocator, p.IPv4Range)))
+			s.IPV4Free = int64(p.IPv4Allocator.Free())
+		}
+
+		if p.IPv6Allocator != nil {
+			s.IPV6Cidr = p.IPv6Range.String()
+			s.IPV6Used = int64(len(dumpRange(p.IPv6Allocator, p.IPv6Range)))
+			s.IPV6Free = int64(p.IPv6Allocator.Free())
+		}
+
+		status = append(status, s)
+	}
+
+	return status
+}
@@ -0,0 +1,105 @@
+// Copyright 2018 Authors of Cilium
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ipam
+
+import (
+	"net"
+
+	"github.com/cilium/cilium/pkg/node"
+
+	. "gopkg.in/check.v1"
+)
+
+func mustParseCIDR(c *C, cidr string) *net.IPNet {
+	_, n, err := net.ParseCIDR(cidr)
+	c.Assert(err, IsNil)
+	return n
+}
+
+func (s *IPAMSuite) TestAddPool(c *C) {
+	node.InitDefaultPrefix("")
+	c.Assert(Init(), IsNil)
+
+	c.Assert(AddPool("blue", mustParseCIDR(c, "192.168.100.0/24")), IsNil)
+
+	// IPv6 pools are not supported
+	c.Assert(AddPool("v6", mustParseCIDR(c, "f00d::/112")), Not(IsNil))
+	// Pool names are unique
+	c.Assert(AddPool("blue", mustParseCIDR(c, "192.168.101.0/24")), Not(IsNil))
+	// Pools may not overlap in either direction
+	c.Assert(AddPool("red", mustParseCIDR(c, "192.168.100.128/25")), Not(IsNil))
+	c.Assert(AddPool("red", mustParseCIDR(c, "192.168.0.0/16")), Not(IsNil))
+	c.Assert(AddPool("red", node.GetIPv4AllocRange()), Not(IsNil))
+
+	c.Assert(AddPool("red", mustParseCIDR(c, "192.168.101.0/24")), IsNil)
+}
+
+func (s *IPAMSuite) TestAllocateFromPool(c *C) {
+	node.InitDefaultPrefix("")
+	c.Assert(Init(), IsNil)
+
+	blue := mustParseCIDR(c, "192.168.100.0/24")
+	c.Assert(AddPool("blue", blue), IsNil)
+
+	_, _, err := AllocateNext("", "unknown", "")
+	c.Assert(err, Not(IsNil))
+
+	// IPv4 addresses are allocated out of the pool, IPv6 addresses always
+	// out of the default pool
+	ipv4, ipv6, err := AllocateNext("", "blue", "")
+	c.Assert(err, IsNil)
+	c.Assert(blue.Contains(ipv4), Equals, true)
+	c.Assert(node.GetIPv6AllocRange().Contains(ipv6), Equals, true)
+
+	defaultIPv4, _, err := AllocateNext("ipv4", "", "")
+	c.Assert(err, IsNil)
+	c.Assert(node.GetIPv4AllocRange().Contains(defaultIPv4), Equals, true)
+
+	// Addresses are allocated and released in the pool containing them
+	c.Assert(ReleaseIP(ipv4), IsNil)
+	c.Assert(ipamConf.Pools["blue"].IPv4Allocator.Has(ipv4), Equals, false)
+	c.Assert(AllocateIP(ipv4, ""), IsNil)
+	c.Assert(ipamConf.Pools["blue"].IPv4Allocator.Has(ipv4), Equals, true)
+	c.Assert(ipamConf.IPv4Allocator.Has(ipv4), Equals, false)
+
+	allocv4, _ := Dump()
+	c.Assert(allocv4, Not(HasLen), 0)
+	c.Assert(allocv4[len(allocv4)-1], Equals, ipv4.String())
+}
+
+func (s *IPAMSuite) TestPoolStatus(c *C) {
+	node.InitDefaultPrefix("")
+	c.Assert(Init(), IsNil)
+
+	c.Assert(AddPool("red", mustParseCIDR(c, "192.168.101.0/24")), IsNil)
+	c.Assert(AddPool("blue", mustParseCIDR(c, "192.168.100.0/24")), IsNil)
+
+	_, _, err := AllocateNext("ipv4", "blue", "")
+	c.Assert(err, IsNil)
+
+	status := PoolStatus()
+	c.Assert(status, HasLen, 3)
+
+	// The default pool is listed first, followed by all pools by name
+	c.Assert(status[0].Name, Equals, DefaultPool)
+	c.Assert(status[0].IPV6Cidr, Equals, node.GetIPv6AllocRange().String())
+	c.Assert(status[1].Name, Equals, "blue")
+	c.Assert(status[1].IPV4Cidr, Equals, "192.168.100.0/24")
+	c.Assert(status[1].IPV4Used, Equals, int64(1))
+	c.Assert(status[1].IPV6Cidr, Equals, "")
+	c.Assert(status[2].Name, Equals, "red")
+	c.Assert(status[2].IPV4Used, Equals, int64(0))
+	c.Assert(status[2].IPV4Free, Equals, status[1].IPV4Free+1)
+}
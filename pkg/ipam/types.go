@@ -15,6 +15,8 @@
 package ipam
 
 import (
+	"net"
+
 	"github.com/cilium/cilium/pkg/lock"
 
 	"github.com/containernetworking/cni/plugins/ipam/host-local/backend/allocator"
@@ -27,6 +29,19 @@ type Config struct {
 	IPv6Allocator *ipallocator.Range
 	IPv4Allocator *ipallocator.Range
 
+	// Pools is the list of named IP pools. The default pool refers to
+	// IPv6Allocator and IPv4Allocator.
+	Pools map[string]*Pool
+
 	// mutex covers access to all members of this struct
 	allocatorMutex lock.RWMutex
 }
+
+// Pool is a named pool of IP addresses
+type Pool struct {
+	Name          string
+	IPv6Range     *net.IPNet
+	IPv4Range     *net.IPNet
+	IPv6Allocator *ipallocator.Range
+	IPv4Allocator *ipallocator.Range
+}
@@ -25,6 +25,14 @@ const (
 	// PodNamespaceLabel is the label used in kubernetes containers to
 	// specify which namespace they belong to.
 	PodNamespaceLabel = types.KubernetesPodNamespaceLabel
+
+	// PolicyLabelServiceAccount is the label used in kubernetes containers
+	// to specify which ServiceAccount they are running as.
+	PolicyLabelServiceAccount = "io.cilium.k8s.policy.serviceaccount"
+
+	// PodNamespaceMetaLabels is the prefix of the labels used in kubernetes
+	// containers to specify the labels of the namespace they belong to.
+	PodNamespaceMetaLabels = "io.cilium.k8s.namespace.labels"
 )
 
 const (
@@ -44,6 +44,30 @@ const (
 
 	// CustomResourceDefinitionVersion is the current version of the resource
 	CustomResourceDefinitionVersion = "v2"
+
+	// IdentitySingularName is the singular name of the Cilium identity
+	// custom resource definition
+	IdentitySingularName = "ciliumidentity"
+
+	// IdentityPluralName is the plural name of the Cilium identity custom
+	// resource definition
+	IdentityPluralName = "ciliumidentities"
+
+	// IdentityKind is the Kind name of the Cilium identity custom resource
+	// definition
+	IdentityKind = "CiliumIdentity"
+
+	// EndpointSingularName is the singular name of the Cilium endpoint
+	// custom resource definition
+	EndpointSingularName = "ciliumendpoint"
+
+	// EndpointPluralName is the plural name of the Cilium endpoint custom
+	// resource definition
+	EndpointPluralName = "ciliumendpoints"
+
+	// EndpointKind is the Kind name of the Cilium endpoint custom resource
+	// definition
+	EndpointKind = "CiliumEndpoint"
 )
 
 // SchemeGroupVersion is group version used to register these objects
@@ -89,19 +113,21 @@ func addKnownTypes(scheme *runtime.Scheme) error {
 	scheme.AddKnownTypes(SchemeGroupVersion,
 		&CiliumNetworkPolicy{},
 		&CiliumNetworkPolicyList{},
+		&CiliumIdentity{},
+		&CiliumIdentityList{},
+		&CiliumEndpoint{},
+		&CiliumEndpointList{},
 	)
 	metav1.AddToGroupVersion(scheme, SchemeGroupVersion)
 	return nil
 }
 
-// CreateCustomResourceDefinitions creates the CRD object in the kubernetes
+// CreateCustomResourceDefinitions creates the CRD objects in the kubernetes
 // cluster
 func CreateCustomResourceDefinitions(clientset apiextensionsclient.Interface) error {
-	cnpCRDName := CustomResourceDefinitionPluralName + "." + SchemeGroupVersion.Group
-
-	res := &apiextensionsv1beta1.CustomResourceDefinition{
+	cnp := &apiextensionsv1beta1.CustomResourceDefinition{
 		ObjectMeta: metav1.ObjectMeta{
-			Name: cnpCRDName,
+			Name: CustomResourceDefinitionPluralName + "." + SchemeGroupVersion.Group,
 		},
 		Spec: apiextensionsv1beta1.CustomResourceDefinitionSpec{
 			Group:   SchemeGroupVersion.Group,
@@ -116,15 +142,65 @@ func CreateCustomResourceDefinitions(clientset apiextensionsclient.Interface) er
 		},
 	}
 
+	if err := createCustomResourceDefinition(clientset, cnp); err != nil {
+		return err
+	}
+
+	identity := &apiextensionsv1beta1.CustomResourceDefinition{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: IdentityPluralName + "." + SchemeGroupVersion.Group,
+		},
+		Spec: apiextensionsv1beta1.CustomResourceDefinitionSpec{
+			Group:   SchemeGroupVersion.Group,
+			Version: SchemeGroupVersion.Version,
+			Names: apiextensionsv1beta1.CustomResourceDefinitionNames{
+				Plural:     IdentityPluralName,
+				Singular:   IdentitySingularName,
+				ShortNames: []string{"ciliumid"},
+				Kind:       IdentityKind,
+			},
+			Scope: apiextensionsv1beta1.ClusterScoped,
+		},
+	}
+
+	if err := createCustomResourceDefinition(clientset, identity); err != nil {
+		return err
+	}
+
+	endpoint := &apiextensionsv1beta1.CustomResourceDefinition{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: EndpointPluralName + "." + SchemeGroupVersion.Group,
+		},
+		Spec: apiextensionsv1beta1.CustomResourceDefinitionSpec{
+			Group:   SchemeGroupVersion.Group,
+			Version: SchemeGroupVersion.Version,
+			Names: apiextensionsv1beta1.CustomResourceDefinitionNames{
+				Plural:     EndpointPluralName,
+				Singular:   EndpointSingularName,
+				ShortNames: []string{"cep", "ciliumep"},
+				Kind:       EndpointKind,
+			},
+			Scope: apiextensionsv1beta1.NamespaceScoped,
+		},
+	}
+
+	return createCustomResourceDefinition(clientset, endpoint)
+}
+
+// createCustomResourceDefinition creates the CRD res and waits for it to be
+// established
+func createCustomResourceDefinition(clientset apiextensionsclient.Interface, res *apiextensionsv1beta1.CustomResourceDefinition) error {
+	crdName := res.ObjectMeta.Name
+
 	_, err := clientset.ApiextensionsV1beta1().CustomResourceDefinitions().Create(res)
 	if err != nil && !errors.IsAlreadyExists(err) {
 		return err
 	}
 
-	log.Info("Creating v2.CiliumNetworkPolicy CustomResourceDefinition")
+	log.Infof("Creating v2.%s CustomResourceDefinition", res.Spec.Names.Kind)
 	// wait for CRD being established
 	err = wait.Poll(500*time.Millisecond, 60*time.Second, func() (bool, error) {
-		crd, err := clientset.ApiextensionsV1beta1().CustomResourceDefinitions().Get(cnpCRDName, metav1.GetOptions{})
+		crd, err := clientset.ApiextensionsV1beta1().CustomResourceDefinitions().Get(crdName, metav1.GetOptions{})
 		if err != nil {
 			return false, err
 		}
@@ -144,7 +220,7 @@ func CreateCustomResourceDefinitions(clientset apiextensionsclient.Interface) er
 		return false, err
 	})
 	if err != nil {
-		deleteErr := clientset.ApiextensionsV1beta1().CustomResourceDefinitions().Delete(cnpCRDName, nil)
+		deleteErr := clientset.ApiextensionsV1beta1().CustomResourceDefinitions().Delete(crdName, nil)
 		if deleteErr != nil {
 			return fmt.Errorf("unable to delete k8s CRD %s. Deleting CRD due: %s", deleteErr, err)
 		}
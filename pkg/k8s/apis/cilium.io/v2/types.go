@@ -72,6 +72,19 @@ type CiliumNetworkPolicyNodeStatus struct {
 	// Error describes the error condition if OK is false
 	Error string `json:"error,omitempty"`
 
+	// Revision is the revision of the policy repository of the node
+	// which contains the policy rule
+	Revision uint64 `json:"localPolicyRevision,omitempty"`
+
+	// Enforcing is true when the policy rule has been realized by all
+	// endpoints selected by the rule on the node, i.e. all selected
+	// endpoints run at least policy repository revision Revision
+	Enforcing bool `json:"enforcing,omitempty"`
+
+	// SelectedEndpoints is the number of endpoints on the node selected
+	// by the policy rule
+	SelectedEndpoints int `json:"selectedEndpoints,omitempty"`
+
 	// LastUpdated contains the last time this status was updated
 	LastUpdated Timestamp `json:"lastUpdated,omitempty"`
 }
@@ -155,3 +168,125 @@ type CiliumNetworkPolicyList struct {
 	// Items is a list of CiliumNetworkPolicy
 	Items []CiliumNetworkPolicy `json:"items"`
 }
+
+// +genclient
+// +genclient:nonNamespaced
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// CiliumIdentity is a cluster wide security identity. The name of the object
+// is the numeric identity.
+type CiliumIdentity struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata"`
+
+	// SecurityLabels are the labels which make up the identity. The value
+	// of each label is keyed by source:key, keys and values may contain
+	// '=' and are thus not joined.
+	SecurityLabels map[string]string `json:"security-labels"`
+
+	// Status is the usage status of the identity
+	Status CiliumIdentityStatus `json:"status"`
+}
+
+// CiliumIdentityStatus is the usage status of a Cilium identity
+type CiliumIdentityStatus struct {
+	// Endpoints maps the cluster wide ID of each endpoint associated with
+	// the identity to the last time the association was refreshed
+	Endpoints map[string]Timestamp `json:"endpoints,omitempty"`
+
+	// Deleted marks an unused identity which is about to be deleted. A
+	// deleted identity is never associated with an endpoint again.
+	Deleted bool `json:"deleted,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// CiliumIdentityList is a list of CiliumIdentity objects
+type CiliumIdentityList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata"`
+
+	// Items is a list of CiliumIdentity
+	Items []CiliumIdentity `json:"items"`
+}
+
+// +genclient
+// +genclient:noStatus
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// CiliumEndpoint is the status of a Cilium endpoint as published by the agent
+// managing it. The object is named after the pod of the endpoint and lives in
+// the namespace of the pod.
+type CiliumEndpoint struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata"`
+
+	// Status is the status of the endpoint
+	Status EndpointStatus `json:"status"`
+}
+
+// EndpointStatus is the status of a Cilium endpoint
+type EndpointStatus struct {
+	// ID is the identifier of the endpoint on its node
+	ID int64 `json:"id,omitempty"`
+
+	// Node is the name of the node managing the endpoint
+	Node string `json:"node,omitempty"`
+
+	// Identity is the numeric security identity of the endpoint
+	Identity int64 `json:"identity,omitempty"`
+
+	// IdentityLabels is the list of labels which make up the security
+	// identity of the endpoint
+	IdentityLabels []string `json:"identity-labels,omitempty"`
+
+	// PolicyEnabled is true if policy is enforced on the endpoint
+	PolicyEnabled bool `json:"policy-enabled"`
+
+	// PolicyRevision is the revision of the policy repository which has
+	// been realized by the endpoint
+	PolicyRevision int64 `json:"policy-revision,omitempty"`
+
+	// IPv4 is the IPv4 address of the endpoint
+	IPv4 string `json:"ipv4,omitempty"`
+
+	// IPv6 is the IPv6 address of the endpoint
+	IPv6 string `json:"ipv6,omitempty"`
+
+	// State is the state of the endpoint, e.g. ready or regenerating
+	State string `json:"state,omitempty"`
+
+	// Health is the overall health of the endpoint { OK | Warning |
+	// Failure | Disabled }
+	Health string `json:"health,omitempty"`
+
+	// Log is the list of the most recent status changes of the endpoint,
+	// most recent first
+	Log []EndpointStatusChange `json:"log,omitempty"`
+}
+
+// EndpointStatusChange is a status change of a Cilium endpoint
+type EndpointStatusChange struct {
+	// Timestamp is the time of the status change
+	Timestamp string `json:"timestamp,omitempty"`
+
+	// Code is the result of the change { ok | failed }
+	Code string `json:"code,omitempty"`
+
+	// Message is the human readable description of the change
+	Message string `json:"message,omitempty"`
+
+	// State is the state the endpoint transitioned to
+	State string `json:"state,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// CiliumEndpointList is a list of CiliumEndpoint objects
+type CiliumEndpointList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata"`
+
+	// Items is a list of CiliumEndpoint
+	Items []CiliumEndpoint `json:"items"`
+}
@@ -35,6 +35,26 @@ func init() {
 // Deprecated: deepcopy registration will go away when static deepcopy is fully implemented.
 func RegisterDeepCopies(scheme *runtime.Scheme) error {
 	return scheme.AddGeneratedDeepCopyFuncs(
+		conversion.GeneratedDeepCopyFunc{Fn: func(in interface{}, out interface{}, c *conversion.Cloner) error {
+			in.(*CiliumEndpoint).DeepCopyInto(out.(*CiliumEndpoint))
+			return nil
+		}, InType: reflect.TypeOf(&CiliumEndpoint{})},
+		conversion.GeneratedDeepCopyFunc{Fn: func(in interface{}, out interface{}, c *conversion.Cloner) error {
+			in.(*CiliumEndpointList).DeepCopyInto(out.(*CiliumEndpointList))
+			return nil
+		}, InType: reflect.TypeOf(&CiliumEndpointList{})},
+		conversion.GeneratedDeepCopyFunc{Fn: func(in interface{}, out interface{}, c *conversion.Cloner) error {
+			in.(*CiliumIdentity).DeepCopyInto(out.(*CiliumIdentity))
+			return nil
+		}, InType: reflect.TypeOf(&CiliumIdentity{})},
+		conversion.GeneratedDeepCopyFunc{Fn: func(in interface{}, out interface{}, c *conversion.Cloner) error {
+			in.(*CiliumIdentityList).DeepCopyInto(out.(*CiliumIdentityList))
+			return nil
+		}, InType: reflect.TypeOf(&CiliumIdentityList{})},
+		conversion.GeneratedDeepCopyFunc{Fn: func(in interface{}, out interface{}, c *conversion.Cloner) error {
+			in.(*CiliumIdentityStatus).DeepCopyInto(out.(*CiliumIdentityStatus))
+			return nil
+		}, InType: reflect.TypeOf(&CiliumIdentityStatus{})},
 		conversion.GeneratedDeepCopyFunc{Fn: func(in interface{}, out interface{}, c *conversion.Cloner) error {
 			in.(*CiliumNetworkPolicy).DeepCopyInto(out.(*CiliumNetworkPolicy))
 			return nil
@@ -51,6 +71,14 @@ func RegisterDeepCopies(scheme *runtime.Scheme) error {
 			in.(*CiliumNetworkPolicyStatus).DeepCopyInto(out.(*CiliumNetworkPolicyStatus))
 			return nil
 		}, InType: reflect.TypeOf(&CiliumNetworkPolicyStatus{})},
+		conversion.GeneratedDeepCopyFunc{Fn: func(in interface{}, out interface{}, c *conversion.Cloner) error {
+			in.(*EndpointStatus).DeepCopyInto(out.(*EndpointStatus))
+			return nil
+		}, InType: reflect.TypeOf(&EndpointStatus{})},
+		conversion.GeneratedDeepCopyFunc{Fn: func(in interface{}, out interface{}, c *conversion.Cloner) error {
+			in.(*EndpointStatusChange).DeepCopyInto(out.(*EndpointStatusChange))
+			return nil
+		}, InType: reflect.TypeOf(&EndpointStatusChange{})},
 		conversion.GeneratedDeepCopyFunc{Fn: func(in interface{}, out interface{}, c *conversion.Cloner) error {
 			in.(*Timestamp).DeepCopyInto(out.(*Timestamp))
 			return nil
@@ -58,6 +86,162 @@ func RegisterDeepCopies(scheme *runtime.Scheme) error {
 	)
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CiliumEndpoint) DeepCopyInto(out *CiliumEndpoint) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Status.DeepCopyInto(&out.Status)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CiliumEndpoint.
+func (in *CiliumEndpoint) DeepCopy() *CiliumEndpoint {
+	if in == nil {
+		return nil
+	}
+	out := new(CiliumEndpoint)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *CiliumEndpoint) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	} else {
+		return nil
+	}
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CiliumEndpointList) DeepCopyInto(out *CiliumEndpointList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	out.ListMeta = in.ListMeta
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]CiliumEndpoint, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CiliumEndpointList.
+func (in *CiliumEndpointList) DeepCopy() *CiliumEndpointList {
+	if in == nil {
+		return nil
+	}
+	out := new(CiliumEndpointList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *CiliumEndpointList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	} else {
+		return nil
+	}
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CiliumIdentity) DeepCopyInto(out *CiliumIdentity) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	if in.SecurityLabels != nil {
+		in, out := &in.SecurityLabels, &out.SecurityLabels
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	in.Status.DeepCopyInto(&out.Status)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CiliumIdentity.
+func (in *CiliumIdentity) DeepCopy() *CiliumIdentity {
+	if in == nil {
+		return nil
+	}
+	out := new(CiliumIdentity)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *CiliumIdentity) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	} else {
+		return nil
+	}
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CiliumIdentityList) DeepCopyInto(out *CiliumIdentityList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	out.ListMeta = in.ListMeta
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]CiliumIdentity, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CiliumIdentityList.
+func (in *CiliumIdentityList) DeepCopy() *CiliumIdentityList {
+	if in == nil {
+		return nil
+	}
+	out := new(CiliumIdentityList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *CiliumIdentityList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	} else {
+		return nil
+	}
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CiliumIdentityStatus) DeepCopyInto(out *CiliumIdentityStatus) {
+	*out = *in
+	if in.Endpoints != nil {
+		in, out := &in.Endpoints, &out.Endpoints
+		*out = make(map[string]Timestamp, len(*in))
+		for key, val := range *in {
+			newVal := new(Timestamp)
+			val.DeepCopyInto(newVal)
+			(*out)[key] = *newVal
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CiliumIdentityStatus.
+func (in *CiliumIdentityStatus) DeepCopy() *CiliumIdentityStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(CiliumIdentityStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *CiliumNetworkPolicy) DeepCopyInto(out *CiliumNetworkPolicy) {
 	*out = *in
@@ -183,6 +367,48 @@ func (in *CiliumNetworkPolicyStatus) DeepCopy() *CiliumNetworkPolicyStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *EndpointStatus) DeepCopyInto(out *EndpointStatus) {
+	*out = *in
+	if in.IdentityLabels != nil {
+		in, out := &in.IdentityLabels, &out.IdentityLabels
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Log != nil {
+		in, out := &in.Log, &out.Log
+		*out = make([]EndpointStatusChange, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EndpointStatus.
+func (in *EndpointStatus) DeepCopy() *EndpointStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(EndpointStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *EndpointStatusChange) DeepCopyInto(out *EndpointStatusChange) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EndpointStatusChange.
+func (in *EndpointStatusChange) DeepCopy() *EndpointStatusChange {
+	if in == nil {
+		return nil
+	}
+	out := new(EndpointStatusChange)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Timestamp.
 func (in *Timestamp) DeepCopy() *Timestamp {
 	if in == nil {
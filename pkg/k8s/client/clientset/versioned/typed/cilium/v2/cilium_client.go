@@ -23,6 +23,8 @@ import (
 
 type CiliumV2Interface interface {
 	RESTClient() rest.Interface
+	CiliumEndpointsGetter
+	CiliumIdentitiesGetter
 	CiliumNetworkPoliciesGetter
 }
 
@@ -31,6 +33,14 @@ type CiliumV2Client struct {
 	restClient rest.Interface
 }
 
+func (c *CiliumV2Client) CiliumEndpoints(namespace string) CiliumEndpointInterface {
+	return newCiliumEndpoints(c, namespace)
+}
+
+func (c *CiliumV2Client) CiliumIdentities() CiliumIdentityInterface {
+	return newCiliumIdentities(c)
+}
+
 func (c *CiliumV2Client) CiliumNetworkPolicies(namespace string) CiliumNetworkPolicyInterface {
 	return newCiliumNetworkPolicies(c, namespace)
 }
@@ -0,0 +1,123 @@
+// Copyright 2018 Authors of Cilium
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fake
+
+import (
+	v2 "github.com/cilium/cilium/pkg/k8s/apis/cilium.io/v2"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	labels "k8s.io/apimachinery/pkg/labels"
+	schema "k8s.io/apimachinery/pkg/runtime/schema"
+	types "k8s.io/apimachinery/pkg/types"
+	watch "k8s.io/apimachinery/pkg/watch"
+	testing "k8s.io/client-go/testing"
+)
+
+// FakeCiliumIdentities implements CiliumIdentityInterface
+type FakeCiliumIdentities struct {
+	Fake *FakeCiliumV2
+}
+
+var ciliumidentitiesResource = schema.GroupVersionResource{Group: "cilium.io", Version: "v2", Resource: "ciliumidentities"}
+
+var ciliumidentitiesKind = schema.GroupVersionKind{Group: "cilium.io", Version: "v2", Kind: "CiliumIdentity"}
+
+// Get takes name of the ciliumIdentity, and returns the corresponding ciliumIdentity object, and an error if there is any.
+func (c *FakeCiliumIdentities) Get(name string, options v1.GetOptions) (result *v2.CiliumIdentity, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewRootGetAction(ciliumidentitiesResource, name), &v2.CiliumIdentity{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v2.CiliumIdentity), err
+}
+
+// List takes label and field selectors, and returns the list of CiliumIdentities that match those selectors.
+func (c *FakeCiliumIdentities) List(opts v1.ListOptions) (result *v2.CiliumIdentityList, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewRootListAction(ciliumidentitiesResource, ciliumidentitiesKind, opts), &v2.CiliumIdentityList{})
+
+	if obj == nil {
+		return nil, err
+	}
+
+	label, _, _ := testing.ExtractFromListOptions(opts)
+	if label == nil {
+		label = labels.Everything()
+	}
+	list := &v2.CiliumIdentityList{}
+	for _, item := range obj.(*v2.CiliumIdentityList).Items {
+		if label.Matches(labels.Set(item.Labels)) {
+			list.Items = append(list.Items, item)
+		}
+	}
+	return list, err
+}
+
+// Watch returns a watch.Interface that watches the requested ciliumIdentities.
+func (c *FakeCiliumIdentities) Watch(opts v1.ListOptions) (watch.Interface, error) {
+	return c.Fake.
+		InvokesWatch(testing.NewRootWatchAction(ciliumidentitiesResource, opts))
+
+}
+
+// Create takes the representation of a ciliumIdentity and creates it.  Returns the server's representation of the ciliumIdentity, and an error, if there is any.
+func (c *FakeCiliumIdentities) Create(ciliumIdentity *v2.CiliumIdentity) (result *v2.CiliumIdentity, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewRootCreateAction(ciliumidentitiesResource, ciliumIdentity), &v2.CiliumIdentity{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v2.CiliumIdentity), err
+}
+
+// Update takes the representation of a ciliumIdentity and updates it. Returns the server's representation of the ciliumIdentity, and an error, if there is any.
+func (c *FakeCiliumIdentities) Update(ciliumIdentity *v2.CiliumIdentity) (result *v2.CiliumIdentity, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewRootUpdateAction(ciliumidentitiesResource, ciliumIdentity), &v2.CiliumIdentity{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v2.CiliumIdentity), err
+}
+
+// Delete takes name of the ciliumIdentity and deletes it. Returns an error if one occurs.
+func (c *FakeCiliumIdentities) Delete(name string, options *v1.DeleteOptions) error {
+	_, err := c.Fake.
+		Invokes(testing.NewRootDeleteAction(ciliumidentitiesResource, name), &v2.CiliumIdentity{})
+
+	return err
+}
+
+// DeleteCollection deletes a collection of objects.
+func (c *FakeCiliumIdentities) DeleteCollection(options *v1.DeleteOptions, listOptions v1.ListOptions) error {
+	action := testing.NewRootDeleteCollectionAction(ciliumidentitiesResource, listOptions)
+
+	_, err := c.Fake.Invokes(action, &v2.CiliumIdentityList{})
+	return err
+}
+
+// Patch applies the patch and returns the patched ciliumIdentity.
+func (c *FakeCiliumIdentities) Patch(name string, pt types.PatchType, data []byte, subresources ...string) (result *v2.CiliumIdentity, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewRootPatchSubresourceAction(ciliumidentitiesResource, name, data, subresources...), &v2.CiliumIdentity{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v2.CiliumIdentity), err
+}
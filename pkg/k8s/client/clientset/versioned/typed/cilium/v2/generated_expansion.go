@@ -14,4 +14,8 @@
 
 package v2
 
+type CiliumEndpointExpansion interface{}
+
+type CiliumIdentityExpansion interface{}
+
 type CiliumNetworkPolicyExpansion interface{}
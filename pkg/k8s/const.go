@@ -39,6 +39,28 @@ const (
 	// pod CIDR in the node's annotations.
 	Annotationv6CIDRName = "io.cilium.network.ipv6-pod-cidr"
 
+	// AnnotationIPAMPool is the annotation name used on pods and namespaces
+	// to select the IP pool out of which pod addresses are allocated.
+	AnnotationIPAMPool = "io.cilium.network.ipam-pool"
+
+	// AnnotationEndpointOptions is the annotation name used on pods to
+	// override the options of the endpoint of the pod. The value is a
+	// comma separated list of options in the format accepted by
+	// `cilium endpoint config`.
+	AnnotationEndpointOptions = "io.cilium.endpoint.options"
+
+	// AnnotationPolicyAuditMode is the annotation name used on pods to
+	// enable or disable the policy audit mode of the endpoint of the pod.
+	AnnotationPolicyAuditMode = "io.cilium.endpoint.policy-audit-mode"
+
+	// AnnotationIngressBandwidth is the annotation name used on pods to
+	// limit the bandwidth of the traffic received by the pod
+	AnnotationIngressBandwidth = "kubernetes.io/ingress-bandwidth"
+
+	// AnnotationEgressBandwidth is the annotation name used on pods to
+	// limit the bandwidth of the traffic sent by the pod
+	AnnotationEgressBandwidth = "kubernetes.io/egress-bandwidth"
+
 	// EnvNodeNameSpec is the environment label used by Kubernetes to
 	// specify the node's name.
 	EnvNodeNameSpec = "K8S_NODE_NAME"
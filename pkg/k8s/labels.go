@@ -0,0 +1,64 @@
+// Copyright 2017 Authors of Cilium
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package k8s
+
+import (
+	"strings"
+
+	k8sconst "github.com/cilium/cilium/pkg/k8s/apis/cilium.io"
+
+	"k8s.io/api/core/v1"
+)
+
+// GetNamespaceMetaLabels returns the labels of a namespace in the form in
+// which they are added to the labels of the pods in that namespace.
+func GetNamespaceMetaLabels(nsLabels map[string]string) map[string]string {
+	result := map[string]string{}
+	for k, v := range nsLabels {
+		result[k8sconst.PodNamespaceMetaLabels+"."+k] = v
+	}
+	return result
+}
+
+// IsNamespaceMetaLabel returns true if the label key was derived from the
+// labels of a namespace by GetNamespaceMetaLabels.
+func IsNamespaceMetaLabel(key string) bool {
+	return strings.HasPrefix(key, k8sconst.PodNamespaceMetaLabels+".")
+}
+
+// GetPodLabels returns the labels of a pod which are relevant for its
+// security identity: the pod labels, the namespace the pod belongs to, the
+// ServiceAccount the pod runs as and, if ns is not nil, the labels of the
+// namespace.
+func GetPodLabels(pod *v1.Pod, ns *v1.Namespace) map[string]string {
+	result := map[string]string{}
+	for k, v := range pod.GetLabels() {
+		result[k] = v
+	}
+
+	result[k8sconst.PodNamespaceLabel] = pod.Namespace
+
+	if pod.Spec.ServiceAccountName != "" {
+		result[k8sconst.PolicyLabelServiceAccount] = pod.Spec.ServiceAccountName
+	}
+
+	if ns != nil {
+		for k, v := range GetNamespaceMetaLabels(ns.GetLabels()) {
+			result[k] = v
+		}
+	}
+
+	return result
+}
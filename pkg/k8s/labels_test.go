@@ -0,0 +1,58 @@
+// Copyright 2017 Authors of Cilium
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package k8s
+
+import (
+	k8sconst "github.com/cilium/cilium/pkg/k8s/apis/cilium.io"
+
+	. "gopkg.in/check.v1"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func (s *K8sSuite) TestGetPodLabels(c *C) {
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "pod1",
+			Namespace: "payments",
+			Labels:    map[string]string{"app": "db"},
+		},
+		Spec: v1.PodSpec{
+			ServiceAccountName: "backend",
+		},
+	}
+	ns := &v1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   "payments",
+			Labels: map[string]string{"team": "payments"},
+		},
+	}
+
+	c.Assert(GetPodLabels(pod, ns), DeepEquals, map[string]string{
+		"app":                              "db",
+		k8sconst.PodNamespaceLabel:         "payments",
+		k8sconst.PolicyLabelServiceAccount: "backend",
+		k8sconst.PodNamespaceMetaLabels + ".team": "payments",
+	})
+
+	pod.Spec.ServiceAccountName = ""
+	c.Assert(GetPodLabels(pod, nil), DeepEquals, map[string]string{
+		"app":                      "db",
+		k8sconst.PodNamespaceLabel: "payments",
+	})
+
+	c.Assert(IsNamespaceMetaLabel(k8sconst.PodNamespaceMetaLabels+".team"), Equals, true)
+	c.Assert(IsNamespaceMetaLabel(k8sconst.PodNamespaceLabel), Equals, false)
+}
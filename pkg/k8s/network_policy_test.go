@@ -160,7 +160,7 @@ func (s *K8sSuite) TestParseNetworkPolicyUnknownProto(c *C) {
 						{
 							Port: &intstr.IntOrString{
 								Type:   intstr.String,
-								StrVal: "unknown",
+								StrVal: "unknown_port",
 							},
 						},
 					},
@@ -169,9 +169,71 @@ func (s *K8sSuite) TestParseNetworkPolicyUnknownProto(c *C) {
 		},
 	}
 
+	// Port strings which are neither numbers nor valid port names are
+	// rejected
 	rules, err := ParseNetworkPolicy(netPolicy)
 	c.Assert(err, Not(IsNil))
 	c.Assert(len(rules), Equals, 0)
+
+	// Valid port names such as "unknown" used to be rejected as well but
+	// are now accepted as named ports, resolved against the container
+	// ports of the selected pods
+	netPolicy.Spec.Ingress[0].Ports[0].Port.StrVal = "unknown"
+	rules, err = ParseNetworkPolicy(netPolicy)
+	c.Assert(err, IsNil)
+	c.Assert(len(rules), Equals, 1)
+}
+
+func (s *K8sSuite) TestParseNetworkPolicyNamedPort(c *C) {
+	netPolicy := &networkingv1.NetworkPolicy{
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{
+				MatchLabels: map[string]string{
+					"foo1": "bar1",
+				},
+			},
+			Ingress: []networkingv1.NetworkPolicyIngressRule{
+				{
+					Ports: []networkingv1.NetworkPolicyPort{
+						{
+							Port: &intstr.IntOrString{
+								Type:   intstr.String,
+								StrVal: "http",
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	rules, err := ParseNetworkPolicy(netPolicy)
+	c.Assert(err, IsNil)
+	c.Assert(len(rules), Equals, 1)
+
+	repo := policy.NewPolicyRepository()
+	repo.AddList(rules)
+
+	ctx := policy.SearchContext{
+		To: labels.LabelArray{
+			labels.NewLabel(k8sconst.PodNamespaceLabel, v1.NamespaceDefault, labels.LabelSourceK8s),
+			labels.NewLabel("foo1", "bar1", labels.LabelSourceK8s),
+		},
+	}
+
+	result, err := repo.ResolveL4Policy(&ctx)
+	c.Assert(err, IsNil)
+	filter, ok := result.Ingress["http/TCP"]
+	c.Assert(ok, Equals, true)
+	c.Assert(filter.PortName, Equals, "http")
+	c.Assert(filter.Port, Equals, 0)
+
+	c.Assert(result.IngressCoversDPorts([]*models.Port{
+		{Name: "http", Protocol: models.PortProtocolTCP},
+	}), Equals, api.Allowed)
+	c.Assert(result.IngressCoversDPorts([]*models.Port{
+		{Port: 80, Protocol: models.PortProtocolTCP},
+	}), Equals, api.Denied)
 }
 
 func (s *K8sSuite) TestParseNetworkPolicyEmptyFrom(c *C) {
@@ -148,7 +148,7 @@ func (s *K8sSuite) TestParseNetworkPolicyUnknownProtoDeprecated(c *C) {
 						{
 							Port: &intstr.IntOrString{
 								Type:   intstr.String,
-								StrVal: "unknown",
+								StrVal: "unknown_port",
 							},
 						},
 					},
@@ -157,9 +157,19 @@ func (s *K8sSuite) TestParseNetworkPolicyUnknownProtoDeprecated(c *C) {
 		},
 	}
 
+	// Port strings which are neither numbers nor valid port names are
+	// rejected
 	rules, err := ParseNetworkPolicyDeprecated(netPolicy)
 	c.Assert(err, Not(IsNil))
 	c.Assert(len(rules), Equals, 0)
+
+	// Valid port names such as "unknown" used to be rejected as well but
+	// are now accepted as named ports, resolved against the container
+	// ports of the selected pods
+	netPolicy.Spec.Ingress[0].Ports[0].Port.StrVal = "unknown"
+	rules, err = ParseNetworkPolicyDeprecated(netPolicy)
+	c.Assert(err, IsNil)
+	c.Assert(len(rules), Equals, 1)
 }
 
 func (s *K8sSuite) TestParseNetworkPolicyEmptyFromDeprecated(c *C) {
@@ -0,0 +1,56 @@
+// Copyright 2018 Authors of Cilium
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kvstore
+
+import (
+	"time"
+)
+
+// backoff is an exponential backoff which doubles the wait duration with
+// every attempt, starting at min and capped at max
+type backoff struct {
+	min      time.Duration
+	max      time.Duration
+	attempts uint
+}
+
+// duration returns the duration to wait before the next attempt
+func (b *backoff) duration() time.Duration {
+	d := b.min << b.attempts
+	if d <= 0 || d > b.max {
+		return b.max
+	}
+	return d
+}
+
+// next returns the duration to wait before the next attempt and increases
+// the duration of subsequent attempts
+func (b *backoff) next() time.Duration {
+	d := b.duration()
+	if d < b.max {
+		b.attempts++
+	}
+	return d
+}
+
+// wait sleeps for the duration of the next attempt
+func (b *backoff) wait() {
+	time.Sleep(b.next())
+}
+
+// reset restarts the backoff at min
+func (b *backoff) reset() {
+	b.attempts = 0
+}
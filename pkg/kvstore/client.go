@@ -24,7 +24,7 @@ var (
 	clientInstance KVClient
 
 	// leaseInstance is the backend specific lease object. The lease is
-	// created by initClient()
+	// created by initClient(). Protected by leaseMU.
 	leaseInstance interface{}
 )
 
@@ -65,11 +65,16 @@ func initClient() error {
 		clientInstance = nil
 		return fmt.Errorf("Unable to create lease: %s", err)
 	}
+	leaseMU.Lock()
 	leaseInstance = l
+	leaseMU.Unlock()
 
 	// Start go subroutine which will renew kvstore leases
 	startKeepalive()
 
+	// Start go subroutine which will track the health of the kvstore
+	startHealthCheck()
+
 	return nil
 }
 
@@ -77,3 +82,8 @@ func initClient() error {
 func Client() KVClient {
 	return clientInstance
 }
+
+// IsEnabled returns true if a kvstore client has been set up
+func IsEnabled() bool {
+	return Client() != nil
+}
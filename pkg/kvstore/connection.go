@@ -0,0 +1,298 @@
+// Copyright 2018 Authors of Cilium
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kvstore
+
+import (
+	"time"
+
+	"github.com/cilium/cilium/pkg/lock"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ConnectionState is the state of the connection to the kvstore
+type ConnectionState string
+
+const (
+	// StateConnecting is the state until the first health check of the
+	// kvstore has completed
+	StateConnecting ConnectionState = "Connecting"
+
+	// StateConnected is the state while the kvstore is reachable and has
+	// quorum
+	StateConnected ConnectionState = "Connected"
+
+	// StateDegraded is the state while the kvstore is unreachable or has
+	// lost quorum. Cached state keeps being served and writes issued with
+	// QueueSet or QueueDelete are queued until the kvstore recovers.
+	StateDegraded ConnectionState = "Degraded"
+)
+
+var (
+	// HealthCheckInterval is the interval in which the health of the
+	// kvstore is checked while connected
+	HealthCheckInterval = 15 * time.Second
+
+	// HealthCheckTimeout is the time after which a health check of the
+	// kvstore is considered failed
+	HealthCheckTimeout = 5 * time.Second
+
+	// MinRetryInterval is the interval after which the health of the
+	// kvstore is checked again after the first failed check. The interval
+	// doubles with every consecutive failure up to MaxRetryInterval.
+	MinRetryInterval = 1 * time.Second
+
+	// MaxRetryInterval is the maximum interval between health checks and
+	// retries of queued writes while the kvstore is degraded
+	MaxRetryInterval = 2 * time.Minute
+
+	// WriteTimeout is the time after which a write issued with QueueSet or
+	// QueueDelete is queued if it has not completed yet
+	WriteTimeout = 5 * time.Second
+)
+
+// ConnectionStatus is the status of the connection to the kvstore
+type ConnectionStatus struct {
+	// State is the state of the connection
+	State ConnectionState
+
+	// Since is the time of the last state transition
+	Since time.Time
+
+	// Info is the backend status of the last successful health check
+	Info string
+
+	// LastError is the error of the last failed health check
+	LastError error
+
+	// Failures is the number of consecutive failed health checks
+	Failures int
+
+	// QueuedWrites is the number of writes waiting for the kvstore to
+	// recover
+	QueuedWrites int
+}
+
+// pendingWrite is a write to a key of the kvstore
+type pendingWrite struct {
+	op func() error
+}
+
+// connection tracks the health of the kvstore and queues writes while the
+// kvstore is degraded
+type connection struct {
+	mutex  lock.RWMutex
+	status ConnectionStatus
+
+	// queue is the set of writes waiting for the kvstore to recover,
+	// indexed by key. Protected by mutex.
+	queue map[string]*pendingWrite
+
+	// inflight is the set of keys with a write in progress. Writes to
+	// the same key are never performed concurrently so a write always
+	// supersedes an earlier write of the same key. Protected by mutex.
+	inflight map[string]struct{}
+}
+
+var conn = newConnection()
+
+func newConnection() *connection {
+	return &connection{
+		status: ConnectionStatus{
+			State: StateConnecting,
+			Since: time.Now(),
+		},
+		queue:    map[string]*pendingWrite{},
+		inflight: map[string]struct{}{},
+	}
+}
+
+// GetConnectionStatus returns the status of the connection to the kvstore
+func GetConnectionStatus() ConnectionStatus {
+	conn.mutex.RLock()
+	status := conn.status
+	status.QueuedWrites = len(conn.queue)
+	conn.mutex.RUnlock()
+	return status
+}
+
+// checkHealth checks the health of the kvstore
+func checkHealth() (string, error) {
+	if err := Client().CheckQuorum(HealthCheckTimeout); err != nil {
+		return "", err
+	}
+	return Client().Status()
+}
+
+// setState transitions the connection into state. Returns true if the state
+// has changed.
+func (c *connection) setState(state ConnectionState, info string, err error) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if err != nil {
+		c.status.LastError = err
+		c.status.Failures++
+	} else {
+		c.status.Info = info
+		c.status.Failures = 0
+	}
+
+	if c.status.State == state {
+		return false
+	}
+
+	c.status.State = state
+	c.status.Since = time.Now()
+	return true
+}
+
+// startHealthCheck starts a go subroutine which periodically checks the
+// health of the kvstore. While the kvstore is degraded, the health is checked
+// with an exponential backoff and queued writes are retried as soon as the
+// kvstore has recovered.
+func startHealthCheck() {
+	go func() {
+		b := backoff{min: MinRetryInterval, max: MaxRetryInterval}
+		for {
+			info, err := checkHealth()
+			if err != nil {
+				if conn.setState(StateDegraded, "", err) {
+					log.WithError(err).Warning("kvstore is unavailable, serving cached state")
+				}
+				b.wait()
+				continue
+			}
+
+			if conn.setState(StateConnected, info, nil) {
+				log.WithField("status", info).Info("kvstore is available")
+			}
+			b.reset()
+
+			conn.flush()
+			time.Sleep(HealthCheckInterval)
+		}
+	}()
+}
+
+// enqueue performs the write op of key immediately unless the kvstore is
+// degraded or a write of key is already in progress. If the kvstore is
+// degraded, the write fails or does not complete within WriteTimeout, it is
+// queued and retried when the kvstore has recovered.
+func (c *connection) enqueue(key string, op func() error) {
+	w := &pendingWrite{op: op}
+
+	c.mutex.Lock()
+	_, busy := c.inflight[key]
+	if c.status.State == StateDegraded || busy {
+		c.queue[key] = w
+		c.mutex.Unlock()
+		return
+	}
+	delete(c.queue, key)
+	c.inflight[key] = struct{}{}
+	c.mutex.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		err := w.op()
+		c.complete(key, w, err)
+		if err != nil {
+			log.WithError(err).WithField(fieldKey, key).Warning("Unable to write to kvstore, queueing write")
+		}
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(WriteTimeout):
+		log.WithField(fieldKey, key).Warning("Timeout while writing to kvstore, queueing write")
+		c.mutex.Lock()
+		if _, ok := c.queue[key]; !ok {
+			c.queue[key] = w
+		}
+		c.mutex.Unlock()
+	}
+}
+
+// complete records the result err of the write w of key. A successful write
+// is removed from the queue unless it has been superseded, a failed write is
+// queued unless a later write of key is queued already.
+func (c *connection) complete(key string, w *pendingWrite, err error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	delete(c.inflight, key)
+	if err == nil {
+		if c.queue[key] == w {
+			delete(c.queue, key)
+		}
+	} else if _, ok := c.queue[key]; !ok {
+		c.queue[key] = w
+	}
+}
+
+// flush retries all queued writes of keys without a write in progress
+func (c *connection) flush() {
+	c.mutex.Lock()
+	queue := make(map[string]*pendingWrite, len(c.queue))
+	for key, w := range c.queue {
+		if _, busy := c.inflight[key]; busy {
+			continue
+		}
+		c.inflight[key] = struct{}{}
+		queue[key] = w
+	}
+	c.mutex.Unlock()
+
+	for key, w := range queue {
+		err := w.op()
+		c.complete(key, w, err)
+		if err != nil {
+			log.WithError(err).WithField(fieldKey, key).Warning("Unable to write queued write to kvstore")
+		}
+	}
+
+	if len(queue) > 0 {
+		log.WithField(fieldNumEntries, len(queue)).Debug("Flushed queued kvstore writes")
+	}
+}
+
+// QueueSet sets the value of key. If lease is true, the key is attached to the
+// lease of the agent. If the kvstore is degraded or the write fails, the write
+// is queued and retried once the kvstore has recovered. A later write to the
+// same key supersedes a queued write.
+func QueueSet(key string, value []byte, lease bool) {
+	conn.enqueue(key, func() error {
+		if !lease {
+			return Set(key, value)
+		}
+
+		// A key can only be attached to a lease on creation
+		if err := Delete(key); err != nil {
+			return err
+		}
+		return CreateOnly(key, value, true)
+	})
+}
+
+// QueueDelete deletes key. If the kvstore is degraded or the deletion fails,
+// the deletion is queued and retried once the kvstore has recovered. A later
+// write to the same key supersedes a queued deletion.
+func QueueDelete(key string) {
+	conn.enqueue(key, func() error {
+		return Delete(key)
+	})
+}
@@ -0,0 +1,177 @@
+// Copyright 2018 Authors of Cilium
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kvstore
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+// writeRecorder records the writes performed by queued operations
+type writeRecorder struct {
+	writes []string
+	err    error
+}
+
+func (r *writeRecorder) op(value string) func() error {
+	return func() error {
+		if r.err != nil {
+			return r.err
+		}
+		r.writes = append(r.writes, value)
+		return nil
+	}
+}
+
+func (s *KVStoreSuite) TestConnectionState(c *C) {
+	conn := newConnection()
+	c.Assert(conn.status.State, Equals, StateConnecting)
+
+	errDown := fmt.Errorf("no quorum")
+	c.Assert(conn.setState(StateDegraded, "", errDown), Equals, true)
+	c.Assert(conn.status.State, Equals, StateDegraded)
+	c.Assert(conn.status.LastError, Equals, errDown)
+	c.Assert(conn.status.Failures, Equals, 1)
+	since := conn.status.Since
+
+	// Consecutive failures are counted without a state transition
+	c.Assert(conn.setState(StateDegraded, "", errDown), Equals, false)
+	c.Assert(conn.status.Failures, Equals, 2)
+	c.Assert(conn.status.Since, Equals, since)
+
+	c.Assert(conn.setState(StateConnected, "etcd: 1 member", nil), Equals, true)
+	c.Assert(conn.status.State, Equals, StateConnected)
+	c.Assert(conn.status.Info, Equals, "etcd: 1 member")
+	c.Assert(conn.status.Failures, Equals, 0)
+	c.Assert(conn.status.LastError, Equals, errDown)
+
+	c.Assert(conn.setState(StateConnected, "etcd: 3 members", nil), Equals, false)
+	c.Assert(conn.status.Info, Equals, "etcd: 3 members")
+}
+
+func (s *KVStoreSuite) TestEnqueue(c *C) {
+	conn := newConnection()
+	r := &writeRecorder{}
+
+	// Written immediately while not degraded
+	conn.enqueue("a", r.op("a1"))
+	c.Assert(r.writes, DeepEquals, []string{"a1"})
+	c.Assert(conn.queue, HasLen, 0)
+
+	// Failed writes are queued
+	r.err = fmt.Errorf("unavailable")
+	conn.enqueue("a", r.op("a2"))
+	c.Assert(conn.queue, HasLen, 1)
+
+	// Writes are not attempted while degraded
+	conn.setState(StateDegraded, "", r.err)
+	r.err = nil
+	conn.enqueue("b", r.op("b1"))
+	c.Assert(r.writes, DeepEquals, []string{"a1"})
+	c.Assert(conn.queue, HasLen, 2)
+
+	// A later write supersedes the queued write of the same key
+	conn.enqueue("a", r.op("a3"))
+	c.Assert(conn.queue, HasLen, 2)
+
+	conn.setState(StateConnected, "", nil)
+	conn.flush()
+	flushed := append([]string{}, r.writes[1:]...)
+	sort.Strings(flushed)
+	c.Assert(flushed, DeepEquals, []string{"a3", "b1"})
+	c.Assert(conn.queue, HasLen, 0)
+
+	// A successful write removes a queued write of the same key
+	r.err = fmt.Errorf("unavailable")
+	conn.enqueue("a", r.op("a4"))
+	c.Assert(conn.queue, HasLen, 1)
+	r.err = nil
+	conn.enqueue("a", r.op("a5"))
+	c.Assert(conn.queue, HasLen, 0)
+	conn.flush()
+	c.Assert(r.writes[len(r.writes)-1], Equals, "a5")
+}
+
+func (s *KVStoreSuite) TestFlushKeepsFailedWrites(c *C) {
+	conn := newConnection()
+	conn.setState(StateDegraded, "", fmt.Errorf("unavailable"))
+
+	r := &writeRecorder{}
+	failing := &writeRecorder{err: fmt.Errorf("unavailable")}
+	conn.enqueue("a", r.op("a1"))
+	conn.enqueue("b", failing.op("b1"))
+
+	conn.flush()
+	c.Assert(r.writes, DeepEquals, []string{"a1"})
+	c.Assert(conn.queue, HasLen, 1)
+	_, ok := conn.queue["b"]
+	c.Assert(ok, Equals, true)
+
+	failing.err = nil
+	conn.flush()
+	c.Assert(failing.writes, DeepEquals, []string{"b1"})
+	c.Assert(conn.queue, HasLen, 0)
+}
+
+func (s *KVStoreSuite) TestEnqueueTimeout(c *C) {
+	oldTimeout := WriteTimeout
+	WriteTimeout = 10 * time.Millisecond
+	defer func() { WriteTimeout = oldTimeout }()
+
+	conn := newConnection()
+	release := make(chan struct{})
+	completed := make(chan struct{})
+	conn.enqueue("a", func() error {
+		<-release
+		close(completed)
+		return nil
+	})
+
+	// The write has timed out and is queued but still in progress
+	c.Assert(conn.queue, HasLen, 1)
+	c.Assert(conn.inflight, HasLen, 1)
+
+	// A write of the same key is queued instead of being performed
+	// concurrently and is not flushed while the first write is in progress
+	r := &writeRecorder{}
+	conn.enqueue("a", r.op("a2"))
+	conn.flush()
+	c.Assert(r.writes, HasLen, 0)
+
+	// Writes of other keys are not blocked
+	conn.enqueue("b", r.op("b1"))
+	c.Assert(r.writes, DeepEquals, []string{"b1"})
+
+	close(release)
+	<-completed
+	for i := 0; i < 100; i++ {
+		conn.mutex.RLock()
+		n := len(conn.inflight)
+		conn.mutex.RUnlock()
+		if n == 0 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// The queued write supersedes the completed one
+	c.Assert(conn.queue, HasLen, 1)
+	conn.flush()
+	c.Assert(r.writes, DeepEquals, []string{"b1", "a2"})
+	c.Assert(conn.queue, HasLen, 0)
+}
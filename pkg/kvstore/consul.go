@@ -15,6 +15,7 @@
 package kvstore
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -470,41 +471,32 @@ func (c *ConsulClient) Watch(w *Watcher, list bool) {
 	}
 }
 
-// GetWatcher watches for kvstore changes in the given key. Triggers the returned channel
-// every time the key path is changed.
-// FIXME This function is highly tightened to the maxFreeID, change name accordingly
-func (c *ConsulClient) GetWatcher(key string, timeSleep time.Duration) <-chan []policy.NumericIdentity {
-	ch := make(chan []policy.NumericIdentity, 100)
-	go func(ch chan []policy.NumericIdentity) {
-		curSeconds := time.Second
-		var (
-			k   *consulAPI.KVPair
-			q   *consulAPI.QueryMeta
-			qo  consulAPI.QueryOptions
-			err error
-		)
-		for {
-			k, q, err = c.KV().Get(key, &qo)
-			if err != nil {
-				log.WithError(err).Error("Unable to retrieve last free Index")
-			}
-			if k == nil || q == nil {
-				log.Warn("Unable to retrieve last free Index, please start some containers with labels")
-				time.Sleep(curSeconds)
-				if curSeconds < timeSleep {
-					curSeconds += time.Second
-				}
-				continue
-			}
-			curSeconds = time.Second
-			qo.WaitIndex = q.LastIndex
-			maxFreeID := uint32(0)
-			if err := json.Unmarshal(k.Value, &maxFreeID); err == nil {
-				ch <- []policy.NumericIdentity{policy.NumericIdentity(maxFreeID)}
-			}
+// CheckQuorum returns an error if consul cannot be reached within timeout or
+// has no leader
+func (c *ConsulClient) CheckQuorum(timeout time.Duration) error {
+	type result struct {
+		leader string
+		err    error
+	}
+
+	resultChan := make(chan result, 1)
+	go func() {
+		leader, err := c.Client.Status().Leader()
+		resultChan <- result{leader, err}
+	}()
+
+	select {
+	case r := <-resultChan:
+		if r.err != nil {
+			return r.err
+		}
+		if r.leader == "" {
+			return errors.New("no leader returned")
 		}
-	}(ch)
-	return ch
+		return nil
+	case <-time.After(timeout):
+		return fmt.Errorf("timeout while contacting consul after %s", timeout)
+	}
 }
 
 func (c *ConsulClient) Status() (string, error) {
@@ -564,7 +556,7 @@ func (c *ConsulClient) CreateOnly(key string, value []byte, lease bool) error {
 	}
 
 	if lease {
-		id, ok := leaseInstance.(string)
+		id, ok := getLease().(string)
 		if !ok {
 			return fmt.Errorf("argument not a LeaseID")
 		}
@@ -583,6 +575,30 @@ func (c *ConsulClient) CreateOnly(key string, value []byte, lease bool) error {
 	return nil
 }
 
+// UpdateIfValue replaces the value of a key if its current value is
+// oldValue. Consul cannot attach a session with a compare-and-swap, the key is
+// therefore deleted conditionally on its modify index and then re-created. If
+// the key is created by someone else in between, the update fails.
+func (c *ConsulClient) UpdateIfValue(key string, oldValue, newValue []byte, lease bool) error {
+	pair, _, err := c.KV().Get(key, nil)
+	if err != nil {
+		return err
+	}
+	if pair == nil || !bytes.Equal(pair.Value, oldValue) {
+		return fmt.Errorf("update was unsuccessful")
+	}
+
+	success, _, err := c.KV().DeleteCAS(pair, nil)
+	if err != nil {
+		return fmt.Errorf("unable to compare-and-delete: %s", err)
+	}
+	if !success {
+		return fmt.Errorf("update was unsuccessful")
+	}
+
+	return c.CreateOnly(key, newValue, lease)
+}
+
 // ListPrefix returns a map of matching keys
 func (c *ConsulClient) ListPrefix(prefix string) (KeyValuePairs, error) {
 	pairs, _, err := c.KV().List(prefix, nil)
@@ -31,7 +31,6 @@ import (
 	client "github.com/coreos/etcd/clientv3"
 	"github.com/coreos/etcd/clientv3/concurrency"
 	clientyaml "github.com/coreos/etcd/clientv3/yaml"
-	"github.com/coreos/etcd/mvcc/mvccpb"
 	"github.com/hashicorp/go-version"
 	log "github.com/sirupsen/logrus"
 	ctx "golang.org/x/net/context"
@@ -48,6 +47,9 @@ const (
 
 var (
 	minEVersion, _ = version.NewConstraint(">= 3.1.0")
+
+	// healthCheckKey is the key read to check whether etcd has quorum
+	healthCheckKey = path.Join(common.OperationalPath, "Health")
 )
 
 // EtcdOpts is the set of supported options for Etcd configuration.
@@ -423,6 +425,7 @@ func (e *EtcdClient) DeleteTree(path string) error {
 // Watch starts watching for changes in a prefix
 func (e *EtcdClient) Watch(w *Watcher, list bool) {
 	lastRev := int64(0)
+	listBackoff := backoff{min: MinRetryInterval, max: MaxRetryInterval}
 
 	for {
 		res, err := e.cli.Get(ctx.Background(), w.prefix, client.WithPrefix(),
@@ -433,8 +436,15 @@ func (e *EtcdClient) Watch(w *Watcher, list bool) {
 				fieldPrefix:  w.prefix,
 				fieldWatcher: w,
 			}).WithError(err).Warn("Unable to list keys before watching")
+
+			select {
+			case <-w.stopWatch:
+				return
+			case <-time.After(listBackoff.next()):
+			}
 			continue
 		}
+		listBackoff.reset()
 
 		lastRev := res.Header.Revision
 
@@ -498,52 +508,24 @@ func (e *EtcdClient) Watch(w *Watcher, list bool) {
 	}
 }
 
-// GetWatcher watches for kvstore changes in the given key. Triggers the returned channel
-// every time the key path is changed.
-// FIXME This function is highly tightened to the maxFreeID, change name accordingly
-func (e *EtcdClient) GetWatcher(key string, timeSleep time.Duration) <-chan []policy.NumericIdentity {
-	ch := make(chan []policy.NumericIdentity, 100)
-	go func(ch chan []policy.NumericIdentity) {
-		curSeconds := time.Second
-		lastRevision := int64(0)
-		for {
-			w := <-e.cli.Watch(ctx.Background(), key, client.WithRev(lastRevision))
-			if w.Err() != nil {
-				log.WithField(fieldKey, key).Warn("Unable to watch key, retrying...")
-				time.Sleep(curSeconds)
-				if curSeconds < timeSleep {
-					curSeconds += time.Second
-				}
-				continue
-			}
-			curSeconds = time.Second
-			lastRevision = w.CompactRevision
-			freeID := uint32(0)
-			maxFreeID := uint32(0)
-			for _, event := range w.Events {
-				if event.Type != mvccpb.PUT || event.Kv == nil {
-					continue
-				}
-				if err := json.Unmarshal(event.Kv.Value, &freeID); err != nil {
-					continue
-				}
-				if freeID > maxFreeID {
-					maxFreeID = freeID
-				}
-			}
-			if maxFreeID != 0 {
-				ch <- []policy.NumericIdentity{policy.NumericIdentity(maxFreeID)}
-			}
-		}
-	}(ch)
-	return ch
+// CheckQuorum returns an error if etcd cannot be reached within timeout or
+// has lost quorum. A linearizable read is only served with quorum.
+func (e *EtcdClient) CheckQuorum(timeout time.Duration) error {
+	ctxTimeout, cancel := ctx.WithTimeout(ctx.Background(), timeout)
+	defer cancel()
+
+	_, err := e.cli.Get(ctxTimeout, healthCheckKey)
+	return err
 }
 
 func (e *EtcdClient) Status() (string, error) {
 	eps := e.cli.Endpoints()
 	var err1 error
 	for i, ep := range eps {
-		if sr, err := e.cli.Status(ctx.Background(), ep); err != nil {
+		ctxTimeout, cancel := ctx.WithTimeout(ctx.Background(), HealthCheckTimeout)
+		sr, err := e.cli.Status(ctxTimeout, ep)
+		cancel()
+		if err != nil {
 			err1 = err
 		} else if sr.Header.MemberId == sr.Leader {
 			eps[i] = fmt.Sprintf("%s - (Leader) %s", ep, sr.Version)
@@ -594,7 +576,7 @@ func (e *EtcdClient) Delete(key string) error {
 
 func createOpPut(key string, value []byte, lease bool) (*client.Op, error) {
 	if lease {
-		r, ok := leaseInstance.(*client.LeaseGrantResponse)
+		r, ok := getLease().(*client.LeaseGrantResponse)
 		if !ok {
 			return nil, fmt.Errorf("argument not a LeaseID")
 		}
@@ -626,6 +608,26 @@ func (e *EtcdClient) CreateOnly(key string, value []byte, lease bool) error {
 	return nil
 }
 
+// UpdateIfValue replaces the value of a key if its current value is oldValue
+func (e *EtcdClient) UpdateIfValue(key string, oldValue, newValue []byte, lease bool) error {
+	req, err := createOpPut(key, newValue, lease)
+	if err != nil {
+		return err
+	}
+
+	cond := client.Compare(client.Value(key), "=", string(oldValue))
+	txnresp, err := e.cli.Txn(ctx.TODO()).If(cond).Then(*req).Commit()
+	if err != nil {
+		return err
+	}
+
+	if txnresp.Succeeded == false {
+		return fmt.Errorf("update was unsuccessful")
+	}
+
+	return nil
+}
+
 // ListPrefix returns a map of matching keys
 func (e *EtcdClient) ListPrefix(prefix string) (KeyValuePairs, error) {
 	getR, err := e.cli.Get(ctx.Background(), prefix, client.WithPrefix())
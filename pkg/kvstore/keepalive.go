@@ -17,6 +17,8 @@ package kvstore
 import (
 	"time"
 
+	"github.com/cilium/cilium/pkg/lock"
+
 	log "github.com/sirupsen/logrus"
 )
 
@@ -33,8 +35,54 @@ var (
 	// small value to account for temporary errors while communicating with
 	// the KVstore.
 	RetryInterval = 1 * time.Minute
+
+	// leaseMU protects leaseInstance and leaseHooks
+	leaseMU lock.RWMutex
+
+	// leaseHooks are called whenever leaseInstance has been replaced
+	leaseHooks []func()
 )
 
+// getLease returns the backend specific lease object of the agent
+func getLease() interface{} {
+	leaseMU.RLock()
+	defer leaseMU.RUnlock()
+	return leaseInstance
+}
+
+// OnNewLease registers f to be called whenever the lease of the agent has been
+// replaced with a new lease, e.g. because the previous lease expired while the
+// kvstore was unavailable. Keys attached to the previous lease are removed by
+// the kvstore and must be re-created by f.
+func OnNewLease(f func()) {
+	leaseMU.Lock()
+	leaseHooks = append(leaseHooks, f)
+	leaseMU.Unlock()
+}
+
+// renewLease replaces the lease of the agent with a new lease and calls all
+// hooks registered with OnNewLease
+func renewLease() error {
+	l, err := CreateLease(LeaseTTL)
+	if err != nil {
+		return err
+	}
+
+	leaseMU.Lock()
+	leaseInstance = l
+	hooks := make([]func(), len(leaseHooks))
+	copy(hooks, leaseHooks)
+	leaseMU.Unlock()
+
+	log.WithField(fieldLease, l).Info("Created new kvstore lease")
+
+	for _, f := range hooks {
+		f()
+	}
+
+	return nil
+}
+
 // CreateLease creates a new lease with the given ttl
 func CreateLease(ttl time.Duration) (interface{}, error) {
 	lease, err := Client().CreateLease(ttl)
@@ -49,15 +97,25 @@ func KeepAlive(lease interface{}) error {
 	return err
 }
 
+// startKeepalive starts a go subroutine which renews the lease of the agent.
+// If the lease cannot be renewed, e.g. because it expired while the kvstore
+// was unavailable, a new lease is created. Failed attempts are retried with an
+// exponential backoff up to RetryInterval.
 func startKeepalive() {
 	go func() {
-		sleepTime := KeepAliveInterval
+		b := backoff{min: MinRetryInterval, max: RetryInterval}
 		for {
-			if err := KeepAlive(leaseInstance); err != nil {
+			if err := KeepAlive(getLease()); err != nil {
 				log.WithError(err).Warn("Unable to keep lease alive")
-				sleepTime = RetryInterval
+
+				if err := renewLease(); err != nil {
+					log.WithError(err).Warn("Unable to create new lease")
+					b.wait()
+					continue
+				}
 			}
-			time.Sleep(sleepTime)
+			b.reset()
+			time.Sleep(KeepAliveInterval)
 		}
 	}()
 }
@@ -37,10 +37,12 @@ type KVClient interface {
 
 	DeleteTree(path string) error
 
-	GetWatcher(key string, timeSleep time.Duration) <-chan []policy.NumericIdentity
-
 	Status() (string, error)
 
+	// CheckQuorum returns an error if the kvstore cannot be reached
+	// within timeout or has lost quorum
+	CheckQuorum(timeout time.Duration) error
+
 	// Get returns value of key
 	Get(key string) ([]byte, error)
 
@@ -56,6 +58,10 @@ type KVClient interface {
 	// CreateOnly atomically creates a key or fails if it already exists
 	CreateOnly(key string, value []byte, lease bool) error
 
+	// UpdateIfValue atomically replaces the value of a key with newValue
+	// if its current value is oldValue or fails otherwise
+	UpdateIfValue(key string, oldValue, newValue []byte, lease bool) error
+
 	// ListPrefix returns a list of keys matching the prefix
 	ListPrefix(prefix string) (KeyValuePairs, error)
 
@@ -105,6 +111,14 @@ func CreateOnly(key string, value []byte, lease bool) error {
 	return err
 }
 
+// UpdateIfValue atomically replaces the value of a key with newValue if its
+// current value is oldValue or fails otherwise
+func UpdateIfValue(key string, oldValue, newValue []byte, lease bool) error {
+	err := Client().UpdateIfValue(key, oldValue, newValue, lease)
+	trace("UpdateIfValue", err, log.Fields{fieldKey: key, fieldValue: string(newValue), fieldAttachLease: lease})
+	return err
+}
+
 // Set sets the value of a key
 func Set(key string, value []byte) error {
 	err := Client().Set(key, value)
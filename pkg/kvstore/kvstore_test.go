@@ -16,6 +16,7 @@ package kvstore
 
 import (
 	"testing"
+	"time"
 
 	. "gopkg.in/check.v1"
 )
@@ -36,3 +37,17 @@ func (s *KvstoreSuite) TestLock(c *C) {
 	c.Assert(lock, Not(IsNil))
 	lock.Unlock()
 }
+
+func (s *KVStoreSuite) TestBackoff(c *C) {
+	b := backoff{min: time.Second, max: 10 * time.Second}
+
+	c.Assert(b.next(), Equals, time.Second)
+	c.Assert(b.next(), Equals, 2*time.Second)
+	c.Assert(b.next(), Equals, 4*time.Second)
+	c.Assert(b.next(), Equals, 8*time.Second)
+	c.Assert(b.next(), Equals, 10*time.Second)
+	c.Assert(b.next(), Equals, 10*time.Second)
+
+	b.reset()
+	c.Assert(b.next(), Equals, time.Second)
+}
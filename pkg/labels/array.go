@@ -129,3 +129,13 @@ func (ls LabelArray) Get(key string) string {
 	}
 	return ""
 }
+
+// GetModel returns the LabelArray as a string array with fully-qualified
+// labels.
+func (ls LabelArray) GetModel() []string {
+	res := []string{}
+	for _, v := range ls {
+		res = append(res, v.String())
+	}
+	return res
+}
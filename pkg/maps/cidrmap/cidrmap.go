@@ -40,6 +40,11 @@ type CIDRMap struct {
 const (
 	MAX_KEYS           = 1024
 	LPM_MAP_VALUE_SIZE = 1
+
+	// LPM_FLAG_PORT_RESTRICTED is the value of entries whose prefix is
+	// only allowed on the ports of the L4 policy. Must be in sync with
+	// LPM_FLAG_PORT_RESTRICTED in <bpf/lib/maps.h>
+	LPM_FLAG_PORT_RESTRICTED = 1
 )
 
 type cidrKey struct {
@@ -63,11 +68,19 @@ func (cm *CIDRMap) keyCidrInit(key cidrKey) (cidr net.IPNet) {
 	return
 }
 
-// InsertCIDR inserts an entry to 'cm' with key 'cidr'. Value is currently not
-// used.
+// InsertCIDR inserts an entry to 'cm' with key 'cidr'.
 func (cm *CIDRMap) InsertCIDR(cidr net.IPNet) error {
+	return cm.insertCIDR(cidr, [LPM_MAP_VALUE_SIZE]byte{})
+}
+
+// InsertPortRestrictedCIDR inserts an entry to 'cm' with key 'cidr' which
+// only allows the prefix on the ports of the L4 policy.
+func (cm *CIDRMap) InsertPortRestrictedCIDR(cidr net.IPNet) error {
+	return cm.insertCIDR(cidr, [LPM_MAP_VALUE_SIZE]byte{LPM_FLAG_PORT_RESTRICTED})
+}
+
+func (cm *CIDRMap) insertCIDR(cidr net.IPNet, entry [LPM_MAP_VALUE_SIZE]byte) error {
 	key := cm.cidrKeyInit(cidr)
-	entry := [LPM_MAP_VALUE_SIZE]byte{}
 	if cm.Prefixlen != 0 && cm.Prefixlen != key.Prefixlen {
 		return fmt.Errorf("Unable to update element with different prefixlen than map!")
 	}
@@ -34,6 +34,16 @@ type PolicyMap struct {
 
 const (
 	MAX_KEYS = 1024
+
+	// AllIdentities is the identity of L4 entries allowing a port for
+	// all identities. Must be in sync with POLICY_ALL_IDENTITIES in
+	// <bpf/lib/policy.h>
+	AllIdentities = 0
+
+	// CIDRIdentities is the identity of L4 entries allowing a port for
+	// sources matching a port restricted CIDR prefix. Must be in sync
+	// with POLICY_CIDR_IDENTITIES in <bpf/lib/policy.h>
+	CIDRIdentities = 0xffffffff
 )
 
 func (pe *PolicyEntry) String() string {
@@ -71,6 +81,12 @@ func (key *policyKey) String() string {
 	return fmt.Sprintf("%d", key.Identity)
 }
 
+// GetDestPort returns the destination port of the key in host byte-order or
+// 0 if the key allows all ports
+func (key *policyKey) GetDestPort() uint16 {
+	return byteorder.NetworkToHost(key.DestPort).(uint16)
+}
+
 func (pm *PolicyMap) AllowConsumer(id uint32) error {
 	key := policyKey{Identity: id}
 	entry := PolicyEntry{Action: 1}
@@ -78,7 +94,10 @@ func (pm *PolicyMap) AllowConsumer(id uint32) error {
 }
 
 // AllowL4 pushes an entry into the PolicyMap to allow source identity `id`
-// send traffic with destination port `dport` over protocol `proto`.
+// send traffic with destination port `dport` over protocol `proto`. If `id`
+// is AllIdentities, the port is allowed for all source identities. If `id`
+// is CIDRIdentities, the port is allowed for sources in port restricted
+// CIDR prefixes.
 func (pm *PolicyMap) AllowL4(id uint32, dport uint16, proto uint8) error {
 	key := policyKey{Identity: id, DestPort: byteorder.HostToNetwork(dport).(uint16), Nexthdr: proto}
 	entry := PolicyEntry{Action: 1}
@@ -112,6 +131,12 @@ func (pm *PolicyMap) DeleteL4(id uint32, dport uint16, proto uint8) error {
 	return bpf.DeleteElement(pm.Fd, unsafe.Pointer(&key))
 }
 
+// DeleteEntry removes the entry with the key of the dumped entry `entry` from
+// the PolicyMap.
+func (pm *PolicyMap) DeleteEntry(entry *PolicyEntryDump) error {
+	return bpf.DeleteElement(pm.Fd, unsafe.Pointer(&entry.Key))
+}
+
 func (pm *PolicyMap) String() string {
 	return pm.path
 }
@@ -0,0 +1,184 @@
+// Copyright 2018 Authors of Cilium
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package throttlemap represents the BPF map holding the token buckets used
+// to limit the bandwidth of endpoints.
+package throttlemap
+
+import (
+	"fmt"
+	"unsafe"
+
+	"github.com/cilium/cilium/pkg/bpf"
+)
+
+const (
+	// MapName is the name of the throttle map
+	MapName = "cilium_throttle"
+
+	// MaxEntries is the maximum number of entries in the throttle map
+	MaxEntries = 65536
+
+	// MinBurst is the minimum size in bytes of a token bucket. It exceeds
+	// the maximum size of a GSO packet so that a packet of any size can
+	// pass an idle bucket.
+	MinBurst = 128 * 1024
+
+	// burstDivisor is the fraction of a second worth of tokens a bucket
+	// can hold, i.e. the bucket allows bursts of 20ms at the full rate.
+	burstDivisor = 50
+)
+
+// Direction is the direction of the traffic limited by a token bucket
+type Direction uint8
+
+const (
+	// Ingress limits the traffic received by the endpoint
+	//
+	// Must be in sync with THROTTLE_INGRESS in <bpf/lib/throttle.h>
+	Ingress Direction = 1
+
+	// Egress limits the traffic sent by the endpoint
+	//
+	// Must be in sync with THROTTLE_EGRESS in <bpf/lib/throttle.h>
+	Egress Direction = 2
+)
+
+func (d Direction) String() string {
+	switch d {
+	case Ingress:
+		return "ingress"
+	case Egress:
+		return "egress"
+	}
+	return fmt.Sprintf("%d", d)
+}
+
+var (
+	mapInstance = bpf.NewMap(MapName,
+		bpf.MapTypeHash,
+		int(unsafe.Sizeof(Key{})),
+		int(unsafe.Sizeof(Info{})),
+		MaxEntries, 0)
+)
+
+func init() {
+	bpf.OpenAfterMount(mapInstance)
+}
+
+// Key is the key of the throttle map
+//
+// Must be in sync with struct throttle_key in <bpf/lib/common.h>
+type Key struct {
+	LxcID     uint16
+	Direction Direction
+	Pad       uint8
+}
+
+// GetKeyPtr returns the unsafe pointer to the BPF key
+func (k *Key) GetKeyPtr() unsafe.Pointer { return unsafe.Pointer(k) }
+
+// NewValue returns a new empty instance of the structure representing the BPF
+// map value
+func (k *Key) NewValue() bpf.MapValue { return &Info{} }
+
+// String returns the human readable representation of a Key
+func (k Key) String() string {
+	return fmt.Sprintf("id=%-5d %s", k.LxcID, k.Direction)
+}
+
+// Info is the token bucket of an endpoint and direction. Rate and Burst are
+// configured by the agent, Tokens and Last are maintained by the datapath.
+//
+// Must be in sync with struct throttle_info in <bpf/lib/common.h>
+type Info struct {
+	// Rate is the rate in bytes per second at which tokens are added
+	Rate uint64
+
+	// Burst is the maximum number of tokens in bytes
+	Burst uint64
+
+	// Tokens is the number of tokens in bytes currently available
+	Tokens uint64
+
+	// Last is the time in nanoseconds at which the tokens were last
+	// updated
+	Last uint64
+}
+
+// GetValuePtr returns the unsafe pointer to the BPF value
+func (v *Info) GetValuePtr() unsafe.Pointer { return unsafe.Pointer(v) }
+
+// String returns the human readable representation of an Info
+func (v Info) String() string {
+	return fmt.Sprintf("rate=%d bit/s burst=%d tokens=%d", v.Rate*8, v.Burst, v.Tokens)
+}
+
+// newInfo returns a full token bucket limiting the traffic to bitsPerSec
+func newInfo(bitsPerSec uint64) *Info {
+	rate := bitsPerSec / 8
+	burst := rate / burstDivisor
+	if burst < MinBurst {
+		burst = MinBurst
+	}
+
+	return &Info{
+		Rate:   rate,
+		Burst:  burst,
+		Tokens: burst,
+	}
+}
+
+// update sets the limit of the endpoint in the given direction to bitsPerSec.
+// A limit of 0 removes the limit. The state of an existing bucket is retained
+// if the limit is unchanged.
+func update(id uint16, dir Direction, bitsPerSec uint64) error {
+	key := &Key{LxcID: id, Direction: dir}
+
+	if bitsPerSec == 0 {
+		if _, err := mapInstance.Lookup(key); err != nil {
+			// No limit installed
+			return nil
+		}
+		return mapInstance.Delete(key)
+	}
+
+	info := newInfo(bitsPerSec)
+	if v, err := mapInstance.Lookup(key); err == nil {
+		if old := v.(*Info); old.Rate == info.Rate && old.Burst == info.Burst {
+			return nil
+		}
+	}
+
+	return mapInstance.Update(key, info)
+}
+
+// SetLimits sets the bandwidth limits in bits per second of the endpoint with
+// the given ID. A limit of 0 removes the limit in that direction.
+func SetLimits(id uint16, ingress, egress uint64) error {
+	if err := update(id, Ingress, ingress); err != nil {
+		return fmt.Errorf("unable to set %s bandwidth limit: %s", Ingress, err)
+	}
+
+	if err := update(id, Egress, egress); err != nil {
+		return fmt.Errorf("unable to set %s bandwidth limit: %s", Egress, err)
+	}
+
+	return nil
+}
+
+// DeleteLimits removes all bandwidth limits of the endpoint with the given ID
+func DeleteLimits(id uint16) error {
+	return SetLimits(id, 0, 0)
+}
@@ -0,0 +1,54 @@
+// Copyright 2017 Authors of Cilium
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package metrics exports counters of the agent via expvar
+package metrics
+
+import (
+	"expvar"
+	"net/http"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	// IdentityGCRuns is the number of identity garbage collection runs
+	IdentityGCRuns = expvar.NewInt("identity_gc_runs")
+
+	// IdentityGCFailures is the number of failed identity garbage
+	// collection runs
+	IdentityGCFailures = expvar.NewInt("identity_gc_failures")
+
+	// IdentitiesReclaimed is the number of identities removed by the
+	// identity garbage collector
+	IdentitiesReclaimed = expvar.NewInt("identity_gc_reclaimed")
+
+	// IdentitiesRefTracked is the number of identities created by agents
+	// which do not reference identities that have been marked as tracked
+	// once all nodes using them referenced them
+	IdentitiesRefTracked = expvar.NewInt("identity_gc_ref_tracked")
+)
+
+// Enable runs an HTTP server serving the metrics in JSON format on address
+// under /debug/vars
+func Enable(address string) {
+	mux := http.NewServeMux()
+	mux.Handle("/debug/vars", expvar.Handler())
+
+	go func() {
+		if err := http.ListenAndServe(address, mux); err != nil {
+			log.WithError(err).Warn("Unable to serve metrics")
+		}
+	}()
+}
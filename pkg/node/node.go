@@ -86,7 +86,7 @@ func (n *Node) GetNodeIP(ipv6 bool) net.IP {
 
 // GetLocalNode returns the identity and node spec for the local node
 func GetLocalNode() (Identity, *Node) {
-	return Identity{Name: nodeName}, &Node{
+	n := &Node{
 		Name: nodeName,
 		IPAddresses: []Address{
 			{
@@ -98,4 +98,12 @@ func GetLocalNode() (Identity, *Node) {
 		IPv6AllocCIDR: GetIPv6AllocRange(),
 	}
 
+	if ipv6 := GetIPv6(); ipv6 != nil {
+		n.IPAddresses = append(n.IPAddresses, Address{
+			AddressType: v1.NodeInternalIP,
+			IP:          ipv6,
+		})
+	}
+
+	return Identity{Name: nodeName}, n
 }
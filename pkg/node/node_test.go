@@ -15,6 +15,7 @@
 package node
 
 import (
+	"encoding/json"
 	"net"
 	"testing"
 
@@ -68,3 +69,32 @@ func (s *NodeSuite) TestGetNodeIP(c *C) {
 	c.Assert(ip.Equal(net.ParseIP("198.51.100.2")), Equals, true)
 
 }
+
+func (s *NodeSuite) TestMarshalNode(c *C) {
+	_, v4CIDR, err := net.ParseCIDR("10.1.0.0/16")
+	c.Assert(err, IsNil)
+	_, v6CIDR, err := net.ParseCIDR("f00d::a0f:0:0/96")
+	c.Assert(err, IsNil)
+
+	n := Node{
+		Name: "node-1",
+		IPAddresses: []Address{
+			{IP: net.ParseIP("192.0.2.3"), AddressType: v1.NodeInternalIP},
+			{IP: net.ParseIP("2001:DB8::1"), AddressType: v1.NodeInternalIP},
+		},
+		IPv4AllocCIDR: v4CIDR,
+		IPv6AllocCIDR: v6CIDR,
+	}
+
+	value, err := json.Marshal(n)
+	c.Assert(err, IsNil)
+
+	var n2 Node
+	err = json.Unmarshal(value, &n2)
+	c.Assert(err, IsNil)
+	c.Assert(n2.Name, Equals, n.Name)
+	c.Assert(n2.GetNodeIP(false).Equal(net.ParseIP("192.0.2.3")), Equals, true)
+	c.Assert(n2.GetNodeIP(true).Equal(net.ParseIP("2001:DB8::1")), Equals, true)
+	c.Assert(n2.IPv4AllocCIDR.String(), Equals, v4CIDR.String())
+	c.Assert(n2.IPv6AllocCIDR.String(), Equals, v6CIDR.String())
+}
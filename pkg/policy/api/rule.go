@@ -279,9 +279,10 @@ const (
 
 // PortProtocol specifies an L4 port with an optional transport protocol
 type PortProtocol struct {
-	// Port is an L4 port number. For now the string will be strictly
-	// parsed as a single uint16. In the future, this field may support
-	// ranges in the form "1024-2048
+	// Port is an L4 port number, a range of port numbers in the form
+	// "1024-2048" or the name of a port of the endpoints selected by the
+	// rule, e.g. "http". Named ports are resolved against the container
+	// ports of the selected pods and are only supported at ingress.
 	Port string `json:"port"`
 
 	// Protocol is the L4 protocol. If omitted or empty, any protocol
@@ -51,10 +51,6 @@ func (i *IngressRule) sanitize() error {
 		return fmt.Errorf("Combining FromCIDR and FromEndpoints is not supported yet")
 	}
 
-	if len(i.FromCIDR) > 0 && len(i.ToPorts) > 0 {
-		return fmt.Errorf("Combining ToPorts and FromCIDR is not supported yet")
-	}
-
 	for n := range i.ToPorts {
 		if err := i.ToPorts[n].sanitize(); err != nil {
 			return err
@@ -89,6 +85,12 @@ func (e *EgressRule) sanitize() error {
 		if err := e.ToPorts[i].sanitize(); err != nil {
 			return err
 		}
+
+		for _, p := range e.ToPorts[i].Ports {
+			if p.IsNamedPort() {
+				return fmt.Errorf("Named port %q is not supported in egress rules", p.Port)
+			}
+		}
 	}
 	if l := len(e.ToCIDR); l > MaxCIDREntries {
 		return fmt.Errorf("too many egress L3 entries %d/%d", l, MaxCIDREntries)
@@ -167,6 +169,13 @@ func (pr *PortRule) sanitize() error {
 		if err := pr.Ports[i].sanitize(); err != nil {
 			return err
 		}
+
+		// L7 proxies are configured per port number
+		if pr.NumRules() > 0 || pr.RedirectPort != 0 {
+			if start, end, err := pr.Ports[i].PortRange(); err != nil || start != end {
+				return fmt.Errorf("L7 rules can only be applied to a single port number, not to %q", pr.Ports[i].Port)
+			}
+		}
 	}
 
 	// Sanitize L7 rules
@@ -183,15 +192,26 @@ func (pp *PortProtocol) sanitize() error {
 		return fmt.Errorf("Port must be specified")
 	}
 
-	p, err := strconv.ParseUint(pp.Port, 0, 16)
-	if err != nil {
-		return fmt.Errorf("Unable to parse port: %s", err)
-	}
+	if !pp.IsNamedPort() {
+		start, end, err := pp.PortRange()
+		if err != nil {
+			return fmt.Errorf("Unable to parse port: %s", err)
+		}
+
+		if start == 0 {
+			return fmt.Errorf("Port cannot be 0")
+		}
+
+		if end < start {
+			return fmt.Errorf("Invalid port range %s: end port must not be lower than start port", pp.Port)
+		}
 
-	if p == 0 {
-		return fmt.Errorf("Port cannot be 0")
+		if int(end)-int(start)+1 > MaxPortRangeSize {
+			return fmt.Errorf("Invalid port range %s: port ranges may span at most %d ports", pp.Port, MaxPortRangeSize)
+		}
 	}
 
+	var err error
 	pp.Protocol, err = ParseL4Proto(string(pp.Protocol))
 	if err != nil {
 		return err
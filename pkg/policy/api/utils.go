@@ -16,9 +16,24 @@ package api
 
 import (
 	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
 	"strings"
 )
 
+// portNameRegexp matches IANA service names as used for the names of
+// container ports
+var portNameRegexp = regexp.MustCompile("^[a-z0-9]([a-z0-9-]*[a-z0-9])?$")
+
+// maxPortNameLen is the maximum length of an IANA service name
+const maxPortNameLen = 15
+
+// MaxPortRangeSize is the maximum number of ports a single port range may
+// span. Port ranges are installed as one policy map entry per port, so
+// larger ranges would quickly exhaust the policy map of the endpoint.
+const MaxPortRangeSize = 256
+
 // Len returns the total number of rules inside `L7Rules`.
 func (rules *L7Rules) Len() int {
 	return len(rules.HTTP) + len(rules.Kafka)
@@ -52,6 +67,62 @@ func (h *PortRuleHTTP) Equal(o PortRuleHTTP) bool {
 	return true
 }
 
+// matchesRegexp returns true if the whole value matches the extended POSIX
+// regex expr, as the proxy does. An empty expr matches all values.
+func matchesRegexp(expr, value string) bool {
+	if expr == "" {
+		return true
+	}
+
+	matched, err := regexp.MatchString("^(?:"+expr+")$", value)
+	return err == nil && matched
+}
+
+// Matches returns true if the HTTP request is allowed by the rule. Path,
+// method and host are matched as regular expressions, headers must be present
+// and, if the rule specifies a value, carry that value.
+func (h *PortRuleHTTP) Matches(req *http.Request) bool {
+	if req == nil {
+		return false
+	}
+
+	path := ""
+	if req.URL != nil {
+		path = req.URL.Path
+	}
+
+	if !matchesRegexp(h.Path, path) ||
+		!matchesRegexp(h.Method, req.Method) ||
+		!matchesRegexp(h.Host, req.Host) {
+		return false
+	}
+
+	for _, hdr := range h.Headers {
+		s := strings.SplitN(hdr, " ", 2)
+		// Remove ':' in "X-Key: true"
+		key := strings.TrimRight(s[0], ":")
+		values, ok := req.Header[http.CanonicalHeaderKey(key)]
+		if !ok {
+			return false
+		}
+
+		if len(s) == 2 {
+			found := false
+			for _, v := range values {
+				if v == s[1] {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
 // Exists returns true if the HTTP rule already exists in the list of rules
 func (k *PortRuleKafka) Exists(rules L7Rules) bool {
 	for _, existingRule := range rules.Kafka {
@@ -68,6 +139,29 @@ func (k *PortRuleKafka) Equal(o PortRuleKafka) bool {
 	return k.APIVersion == o.APIVersion && k.APIKey == o.APIKey && k.Topic == o.Topic
 }
 
+// Matches returns true if a Kafka request with the given API key, API
+// version, client ID and topic is allowed by the rule. The rule must have been
+// sanitized.
+func (k *PortRuleKafka) Matches(apiKey, apiVersion int16, clientID, topic string) bool {
+	if key, isWildcard := k.GetAPIKey(); !isWildcard && key != apiKey {
+		return false
+	}
+
+	if version, isWildcard := k.GetAPIVersion(); !isWildcard && version != apiVersion {
+		return false
+	}
+
+	if k.Topic != "" && k.Topic != topic {
+		return false
+	}
+
+	if k.ClientID != "" && k.ClientID != clientID {
+		return false
+	}
+
+	return true
+}
+
 // Validate returns an error if the layer 4 protocol is not valid
 func (l4 L4Proto) Validate() error {
 	switch l4 {
@@ -97,3 +191,39 @@ func ParseL4Proto(proto string) (L4Proto, error) {
 	p := L4Proto(strings.ToUpper(proto))
 	return p, p.Validate()
 }
+
+// PortRange returns the first and the last port of the port range specified
+// by the port. Both are equal if a single port is specified.
+func (pp *PortProtocol) PortRange() (uint16, uint16, error) {
+	s := strings.SplitN(pp.Port, "-", 2)
+
+	start, err := strconv.ParseUint(s[0], 0, 16)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	end := start
+	if len(s) == 2 {
+		end, err = strconv.ParseUint(s[1], 0, 16)
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+
+	return uint16(start), uint16(end), nil
+}
+
+// IsNamedPort returns true if the port refers to a port by name rather than
+// by number. Port names must be valid IANA service names, i.e. consist of at
+// most 15 lower case alphanumeric characters or '-' and contain at least one
+// letter.
+func (pp *PortProtocol) IsNamedPort() bool {
+	if _, _, err := pp.PortRange(); err == nil {
+		return false
+	}
+
+	return len(pp.Port) <= maxPortNameLen &&
+		portNameRegexp.MatchString(pp.Port) &&
+		!strings.Contains(pp.Port, "--") &&
+		strings.IndexFunc(pp.Port, func(r rune) bool { return r >= 'a' && r <= 'z' }) >= 0
+}
@@ -89,3 +89,87 @@ func (s *PolicyAPITestSuite) TestParseL4Proto(c *C) {
 	_, err = ParseL4Proto("foo2")
 	c.Assert(err, Not(IsNil))
 }
+
+func (s *PolicyAPITestSuite) TestPortRange(c *C) {
+	pp := PortProtocol{Port: "80"}
+	start, end, err := pp.PortRange()
+	c.Assert(err, IsNil)
+	c.Assert(start, Equals, uint16(80))
+	c.Assert(end, Equals, uint16(80))
+	c.Assert(pp.IsNamedPort(), Equals, false)
+
+	pp = PortProtocol{Port: "8000-8100"}
+	start, end, err = pp.PortRange()
+	c.Assert(err, IsNil)
+	c.Assert(start, Equals, uint16(8000))
+	c.Assert(end, Equals, uint16(8100))
+	c.Assert(pp.IsNamedPort(), Equals, false)
+
+	pp = PortProtocol{Port: "http"}
+	_, _, err = pp.PortRange()
+	c.Assert(err, Not(IsNil))
+	c.Assert(pp.IsNamedPort(), Equals, true)
+
+	for _, name := range []string{"http-alt", "h2c", "8080-web"} {
+		pp = PortProtocol{Port: name}
+		c.Assert(pp.IsNamedPort(), Equals, true, Commentf("port %s", name))
+	}
+
+	for _, name := range []string{"HTTP", "-http", "http-", "web--api", "a-very-long-port-name", "80-90-100"} {
+		pp = PortProtocol{Port: name}
+		c.Assert(pp.IsNamedPort(), Equals, false, Commentf("port %s", name))
+	}
+}
+
+func (s *PolicyAPITestSuite) TestSanitizePortRule(c *C) {
+	rule := Rule{
+		EndpointSelector: NewESFromLabels(),
+		Ingress: []IngressRule{{
+			ToPorts: []PortRule{{
+				Ports: []PortProtocol{
+					{Port: "80"},
+					{Port: "8000-8100", Protocol: "tcp"},
+					{Port: "9000-9255"},
+					{Port: "http"},
+				},
+			}},
+		}},
+	}
+	c.Assert(rule.Sanitize(), IsNil)
+
+	for _, pp := range []PortProtocol{
+		{Port: ""},
+		{Port: "0"},
+		{Port: "65536"},
+		{Port: "0-80"},
+		{Port: "8100-8000"},
+		{Port: "1-65535"},
+		{Port: "8000-8256"},
+		{Port: "HTTP"},
+	} {
+		rule.Ingress[0].ToPorts[0].Ports = []PortProtocol{pp}
+		c.Assert(rule.Sanitize(), Not(IsNil), Commentf("port %s", pp.Port))
+	}
+
+	// L7 rules require a single port number
+	rule.Ingress[0].ToPorts[0].Rules = &L7Rules{HTTP: []PortRuleHTTP{{Path: "/"}}}
+	for _, port := range []string{"8000-8100", "http"} {
+		rule.Ingress[0].ToPorts[0].Ports = []PortProtocol{{Port: port}}
+		c.Assert(rule.Sanitize(), Not(IsNil), Commentf("port %s", port))
+	}
+	rule.Ingress[0].ToPorts[0].Ports = []PortProtocol{{Port: "80"}}
+	c.Assert(rule.Sanitize(), IsNil)
+
+	// Named ports cannot be resolved for the destination of egress traffic
+	rule = Rule{
+		EndpointSelector: NewESFromLabels(),
+		Egress: []EgressRule{{
+			ToPorts: []PortRule{{
+				Ports: []PortProtocol{{Port: "8000-8100"}},
+			}},
+		}},
+	}
+	c.Assert(rule.Sanitize(), IsNil)
+	rule.Egress[0].ToPorts[0].Ports = []PortProtocol{{Port: "http"}}
+	c.Assert(rule.Sanitize(), Not(IsNil))
+}
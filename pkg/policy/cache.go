@@ -15,6 +15,7 @@
 package policy
 
 import (
+	"github.com/cilium/cilium/pkg/labels"
 	"github.com/cilium/cilium/pkg/lock"
 )
 
@@ -27,6 +28,12 @@ type ConsumableCache struct {
 	cache   map[NumericIdentity]*Consumable
 	// List of consumables representing the reserved identities
 	reserved []*Consumable
+	// identities contains all identities allocated in the cluster which
+	// are in use by at least one endpoint
+	identities map[NumericIdentity]*Identity
+	// selectors caches the reserved and cluster identities selected by
+	// the endpoint selectors in use
+	selectors *SelectorCache
 }
 
 // GetConsumableCache returns the consumable cache. The cache is a list of all
@@ -38,8 +45,10 @@ func GetConsumableCache() *ConsumableCache {
 
 func newConsumableCache() *ConsumableCache {
 	return &ConsumableCache{
-		cache:    map[NumericIdentity]*Consumable{},
-		reserved: make([]*Consumable, 0),
+		cache:      map[NumericIdentity]*Consumable{},
+		reserved:   make([]*Consumable, 0),
+		identities: map[NumericIdentity]*Identity{},
+		selectors:  NewSelectorCache(),
 	}
 }
 
@@ -70,6 +79,7 @@ func (c *ConsumableCache) Remove(elem *Consumable) {
 func (c *ConsumableCache) AddReserved(elem *Consumable) {
 	c.cacheMU.Lock()
 	c.reserved = append(c.reserved, elem)
+	c.selectors.UpsertIdentity(elem.ID, elem.LabelArray)
 	c.cacheMU.Unlock()
 }
 
@@ -101,6 +111,21 @@ func (c *ConsumableCache) GetConsumables() map[NumericIdentity][]NumericIdentity
 	return consumables
 }
 
+// GetIdentityLabels returns a map of the numeric identities of all
+// consumables, including the reserved ones, mapped to their labels.
+func (c *ConsumableCache) GetIdentityLabels() map[NumericIdentity]labels.LabelArray {
+	identities := map[NumericIdentity]labels.LabelArray{}
+	c.cacheMU.RLock()
+	for _, consumable := range c.reserved {
+		identities[consumable.ID] = consumable.LabelArray
+	}
+	for _, consumable := range c.cache {
+		identities[consumable.ID] = consumable.LabelArray
+	}
+	c.cacheMU.RUnlock()
+	return identities
+}
+
 // ConsumablesInANotInB returns a map of consumables numeric identity mapped to
 // consumers numeric identities which are present in `a` but not in `b`.
 // Example:
@@ -133,3 +158,55 @@ func ConsumablesInANotInB(a, b map[NumericIdentity][]NumericIdentity) map[Numeri
 	}
 	return c
 }
+
+// UpsertIdentity adds or updates the cluster wide identity id and returns
+// true if the identity was not known before or if its labels have changed.
+func (c *ConsumableCache) UpsertIdentity(id *Identity) bool {
+	c.cacheMU.Lock()
+	defer c.cacheMU.Unlock()
+
+	if old, ok := c.identities[id.ID]; ok && old.Labels.SHA256Sum() == id.Labels.SHA256Sum() {
+		c.identities[id.ID] = id
+		return false
+	}
+
+	c.identities[id.ID] = id
+	c.selectors.UpsertIdentity(id.ID, id.Labels.ToSlice())
+	return true
+}
+
+// RemoveIdentity removes the cluster wide identity with the numeric identity
+// id and returns the removed identity or nil if the identity was not known.
+func (c *ConsumableCache) RemoveIdentity(id NumericIdentity) *Identity {
+	c.cacheMU.Lock()
+	defer c.cacheMU.Unlock()
+
+	old, ok := c.identities[id]
+	if !ok {
+		return nil
+	}
+
+	delete(c.identities, id)
+	c.selectors.RemoveIdentity(id)
+	return old
+}
+
+// LookupIdentity returns the cluster wide identity with the numeric identity
+// id or nil if the identity is not known.
+func (c *ConsumableCache) LookupIdentity(id NumericIdentity) *Identity {
+	c.cacheMU.RLock()
+	defer c.cacheMU.RUnlock()
+	return c.identities[id]
+}
+
+// GetClusterIdentities returns a map of the numeric identities of all cluster
+// wide identities mapped to their labels.
+func (c *ConsumableCache) GetClusterIdentities() map[NumericIdentity]labels.LabelArray {
+	identities := map[NumericIdentity]labels.LabelArray{}
+	c.cacheMU.RLock()
+	for id, identity := range c.identities {
+		identities[id] = identity.Labels.ToSlice()
+	}
+	c.cacheMU.RUnlock()
+	return identities
+}
@@ -15,6 +15,8 @@
 package policy
 
 import (
+	"github.com/cilium/cilium/pkg/labels"
+
 	. "gopkg.in/check.v1"
 )
 
@@ -50,3 +52,34 @@ func (s *PolicyTestSuite) TestConsumablesInANotInB(c *C) {
 		}
 	}
 }
+
+func (s *PolicyTestSuite) TestClusterIdentities(c *C) {
+	cache := newConsumableCache()
+
+	id := NewIdentity()
+	id.ID = NumericIdentity(300)
+	id.Labels = labels.Labels{"foo": labels.NewLabel("foo", "bar", labels.LabelSourceK8s)}
+
+	c.Assert(cache.UpsertIdentity(id), Equals, true)
+	c.Assert(cache.LookupIdentity(id.ID), Equals, id)
+
+	// Refreshing the endpoint associations does not change the identity
+	id2 := NewIdentity()
+	id2.ID = id.ID
+	id2.Labels = id.Labels.DeepCopy()
+	id2.AssociateEndpoint("1")
+	c.Assert(cache.UpsertIdentity(id2), Equals, false)
+
+	id3 := NewIdentity()
+	id3.ID = id.ID
+	id3.Labels = labels.Labels{"foo": labels.NewLabel("foo", "baz", labels.LabelSourceK8s)}
+	c.Assert(cache.UpsertIdentity(id3), Equals, true)
+
+	identities := cache.GetClusterIdentities()
+	c.Assert(len(identities), Equals, 1)
+	c.Assert(identities[id.ID].Contains(labels.ParseLabelArray("k8s:foo=baz")), Equals, true)
+
+	c.Assert(cache.RemoveIdentity(id.ID), Equals, id3)
+	c.Assert(cache.RemoveIdentity(id.ID), IsNil)
+	c.Assert(cache.LookupIdentity(id.ID), IsNil)
+}
@@ -0,0 +1,218 @@
+// Copyright 2017 Authors of Cilium
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package policy
+
+import (
+	"sort"
+
+	"github.com/cilium/cilium/pkg/labels"
+	"github.com/cilium/cilium/pkg/policy/api"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// AccessAny denotes access on all ports, i.e. the source identity is allowed
+// on L3 by the destination identity.
+const AccessAny = "ANY"
+
+// AccessChange describes how the access from one security identity to
+// another security identity changes between two policy repositories. Ports
+// are in the "port/PROTO" form of L4PolicyMap keys or AccessAny. Egress
+// indicates whether the change is caused by the egress policy of the source
+// rather than by the ingress policy of the destination.
+type AccessChange struct {
+	From   NumericIdentity
+	To     NumericIdentity
+	Egress bool
+	Gained []string
+	Lost   []string
+}
+
+// CopyRLocked returns a copy of the policy repository which can be modified
+// without affecting the receiver. The policy repository mutex must be held.
+func (p *Repository) CopyRLocked() *Repository {
+	rules := make([]*rule, len(p.rules))
+	copy(rules, p.rules)
+
+	return &Repository{
+		rules:    rules,
+		revision: p.revision,
+	}
+}
+
+// identityPolicy is the policy of a security identity which does not depend
+// on the peer it communicates with
+type identityPolicy struct {
+	// enforced is true if ingress policy is enforced for the identity
+	enforced bool
+
+	// ingress is nil if the L4 ingress policy could not be resolved
+	ingress L4PolicyMap
+
+	// egress is nil if the L4 egress policy could not be resolved
+	egress L4PolicyMap
+}
+
+// resolveIdentityRLocked resolves the L4 ingress and egress policy of the
+// identity with the given labels. If alwaysEnforce is false, ingress policy is
+// only enforced if the identity is selected by at least one rule. The policy
+// repository mutex must be held.
+func (p *Repository) resolveIdentityRLocked(lbls labels.LabelArray, alwaysEnforce bool) identityPolicy {
+	result := identityPolicy{
+		enforced: alwaysEnforce || p.GetRulesMatching(lbls, false),
+	}
+
+	if result.enforced {
+		ctx := SearchContext{To: lbls, IngressL4Only: true}
+		if l4, err := p.ResolveL4Policy(&ctx); err != nil {
+			log.WithError(err).Warn("Evaluation error while resolving L4 ingress policy")
+		} else {
+			result.ingress = l4.Ingress
+		}
+	}
+
+	ctx := SearchContext{To: lbls, EgressL4Only: true}
+	if l4, err := p.ResolveL4Policy(&ctx); err != nil {
+		log.WithError(err).Warn("Evaluation error while resolving L4 egress policy")
+	} else {
+		result.egress = l4.Egress
+	}
+
+	return result
+}
+
+// ingressAccessRLocked returns the set of ports on which `from` is allowed
+// to reach `to` by the ingress policy `toPolicy` of `to`. The policy
+// repository mutex must be held.
+func (p *Repository) ingressAccessRLocked(from, to labels.LabelArray, toPolicy identityPolicy) map[string]struct{} {
+	access := map[string]struct{}{}
+
+	if !toPolicy.enforced {
+		access[AccessAny] = struct{}{}
+		return access
+	}
+
+	ctx := SearchContext{From: from, To: to}
+	switch p.CanReachRLocked(&ctx) {
+	case api.Denied:
+		return access
+	case api.Allowed:
+		access[AccessAny] = struct{}{}
+	}
+
+	for port, filter := range toPolicy.ingress {
+		if filter.matchesLabels(from) {
+			access[port] = struct{}{}
+		}
+	}
+
+	return access
+}
+
+// egressAccess returns the set of ports on which `from` is allowed to reach
+// `to` by the egress policy `fromPolicy` of `from`. Without any L4 egress
+// policy, all ports are allowed.
+func egressAccess(to labels.LabelArray, fromPolicy identityPolicy) map[string]struct{} {
+	access := map[string]struct{}{}
+
+	if fromPolicy.egress == nil {
+		return access
+	} else if len(fromPolicy.egress) == 0 {
+		access[AccessAny] = struct{}{}
+		return access
+	}
+
+	for port, filter := range fromPolicy.egress {
+		if filter.matchesLabels(to) {
+			access[port] = struct{}{}
+		}
+	}
+
+	return access
+}
+
+// inANotInB returns the sorted list of keys present in a but not in b
+func inANotInB(a, b map[string]struct{}) []string {
+	result := []string{}
+	for k := range a {
+		if _, ok := b[k]; !ok {
+			result = append(result, k)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+// newAccessChange returns the change between oldAccess and newAccess or nil
+// if the access does not change
+func newAccessChange(from, to NumericIdentity, egress bool, oldAccess, newAccess map[string]struct{}) *AccessChange {
+	gained := inANotInB(newAccess, oldAccess)
+	lost := inANotInB(oldAccess, newAccess)
+	if len(gained) == 0 && len(lost) == 0 {
+		return nil
+	}
+
+	return &AccessChange{
+		From:   from,
+		To:     to,
+		Egress: egress,
+		Gained: gained,
+		Lost:   lost,
+	}
+}
+
+// DiffAccessRLocked compares the access between all pairs of the given
+// identities as allowed by the policy repositories oldRepo and newRepo and
+// returns the list of pairs for which access changes, ordered by source and
+// destination identity with ingress changes preceding egress changes. The
+// L4 policy of each identity is resolved once per repository. The mutexes
+// of both repositories must be held.
+func DiffAccessRLocked(oldRepo, newRepo *Repository, identities map[NumericIdentity]labels.LabelArray, alwaysEnforce bool) []AccessChange {
+	ids := make([]int, 0, len(identities))
+	for id := range identities {
+		ids = append(ids, int(id))
+	}
+	sort.Ints(ids)
+
+	oldPolicies := make(map[int]identityPolicy, len(ids))
+	newPolicies := make(map[int]identityPolicy, len(ids))
+	for _, id := range ids {
+		lbls := identities[NumericIdentity(id)]
+		oldPolicies[id] = oldRepo.resolveIdentityRLocked(lbls, alwaysEnforce)
+		newPolicies[id] = newRepo.resolveIdentityRLocked(lbls, alwaysEnforce)
+	}
+
+	changes := []AccessChange{}
+	for _, from := range ids {
+		fromLabels := identities[NumericIdentity(from)]
+		for _, to := range ids {
+			toLabels := identities[NumericIdentity(to)]
+
+			oldAccess := oldRepo.ingressAccessRLocked(fromLabels, toLabels, oldPolicies[to])
+			newAccess := newRepo.ingressAccessRLocked(fromLabels, toLabels, newPolicies[to])
+			if c := newAccessChange(NumericIdentity(from), NumericIdentity(to), false, oldAccess, newAccess); c != nil {
+				changes = append(changes, *c)
+			}
+
+			oldAccess = egressAccess(toLabels, oldPolicies[from])
+			newAccess = egressAccess(toLabels, newPolicies[from])
+			if c := newAccessChange(NumericIdentity(from), NumericIdentity(to), true, oldAccess, newAccess); c != nil {
+				changes = append(changes, *c)
+			}
+		}
+	}
+
+	return changes
+}
@@ -0,0 +1,130 @@
+// Copyright 2017 Authors of Cilium
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package policy
+
+import (
+	"github.com/cilium/cilium/pkg/labels"
+	"github.com/cilium/cilium/pkg/policy/api"
+
+	. "gopkg.in/check.v1"
+)
+
+func (ds *PolicyTestSuite) TestDiffAccess(c *C) {
+	app1 := labels.LabelArray{labels.ParseSelectLabel("id=app1")}
+	app2 := labels.LabelArray{labels.ParseSelectLabel("id=app2")}
+	app3 := labels.LabelArray{labels.ParseSelectLabel("id=app3")}
+	identities := map[NumericIdentity]labels.LabelArray{
+		1001: app1,
+		1002: app2,
+		1003: app3,
+	}
+
+	oldRepo := NewPolicyRepository()
+	_, err := oldRepo.Add(api.Rule{
+		EndpointSelector: api.NewESFromLabels(labels.ParseSelectLabel("id=app1")),
+		Ingress: []api.IngressRule{
+			{
+				FromEndpoints: []api.EndpointSelector{
+					api.NewESFromLabels(labels.ParseSelectLabel("id=app3")),
+				},
+			},
+		},
+	})
+	c.Assert(err, IsNil)
+
+	newRepo := oldRepo.CopyRLocked()
+	_, err = newRepo.AddListLocked(api.Rules{
+		&api.Rule{
+			EndpointSelector: api.NewESFromLabels(labels.ParseSelectLabel("id=app1")),
+			Ingress: []api.IngressRule{
+				{
+					FromEndpoints: []api.EndpointSelector{
+						api.NewESFromLabels(labels.ParseSelectLabel("id=app2")),
+					},
+					ToPorts: []api.PortRule{{
+						Ports: []api.PortProtocol{
+							{Port: "80", Protocol: api.ProtoTCP},
+						},
+					}},
+				},
+			},
+		},
+		&api.Rule{
+			EndpointSelector: api.NewESFromLabels(labels.ParseSelectLabel("id=app2")),
+			Ingress: []api.IngressRule{
+				{
+					FromEndpoints: []api.EndpointSelector{
+						api.NewESFromLabels(labels.ParseSelectLabel("id=app1")),
+					},
+				},
+			},
+		},
+	})
+	c.Assert(err, IsNil)
+	c.Assert(oldRepo.NumRules(), Equals, 1)
+	c.Assert(newRepo.NumRules(), Equals, 3)
+
+	changes := DiffAccessRLocked(oldRepo, newRepo, identities, false)
+	c.Assert(changes, DeepEquals, []AccessChange{
+		{From: 1002, To: 1001, Gained: []string{"80/TCP"}, Lost: []string{}},
+		{From: 1002, To: 1002, Gained: []string{}, Lost: []string{AccessAny}},
+		{From: 1003, To: 1002, Gained: []string{}, Lost: []string{AccessAny}},
+	})
+
+	// With policy always enforced, app2 was not reachable before either
+	changes = DiffAccessRLocked(oldRepo, newRepo, identities, true)
+	c.Assert(changes, DeepEquals, []AccessChange{
+		{From: 1001, To: 1002, Gained: []string{AccessAny}, Lost: []string{}},
+		{From: 1002, To: 1001, Gained: []string{"80/TCP"}, Lost: []string{}},
+	})
+
+	c.Assert(DiffAccessRLocked(oldRepo, oldRepo, identities, false), HasLen, 0)
+}
+
+func (ds *PolicyTestSuite) TestDiffAccessEgress(c *C) {
+	app1 := labels.LabelArray{labels.ParseSelectLabel("id=app1")}
+	app2 := labels.LabelArray{labels.ParseSelectLabel("id=app2")}
+	identities := map[NumericIdentity]labels.LabelArray{
+		1001: app1,
+		1002: app2,
+	}
+
+	oldRepo := NewPolicyRepository()
+	newRepo := oldRepo.CopyRLocked()
+	_, err := newRepo.AddListLocked(api.Rules{
+		&api.Rule{
+			EndpointSelector: api.NewESFromLabels(labels.ParseSelectLabel("id=app1")),
+			Egress: []api.EgressRule{
+				{
+					ToPorts: []api.PortRule{{
+						Ports: []api.PortProtocol{
+							{Port: "53", Protocol: api.ProtoUDP},
+						},
+					}},
+				},
+			},
+		},
+	})
+	c.Assert(err, IsNil)
+
+	// Selecting app1 also enforces ingress policy on it
+	changes := DiffAccessRLocked(oldRepo, newRepo, identities, false)
+	c.Assert(changes, DeepEquals, []AccessChange{
+		{From: 1001, To: 1001, Gained: []string{}, Lost: []string{AccessAny}},
+		{From: 1001, To: 1001, Egress: true, Gained: []string{"53/UDP"}, Lost: []string{AccessAny}},
+		{From: 1001, To: 1002, Egress: true, Gained: []string{"53/UDP"}, Lost: []string{AccessAny}},
+		{From: 1002, To: 1001, Gained: []string{}, Lost: []string{AccessAny}},
+	})
+}
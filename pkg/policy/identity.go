@@ -75,6 +75,10 @@ type Identity struct {
 	// Endpoints that have this Identity where their value is the last time they were seen.
 	// Also, If an identity is no longer used (i.e. all endpoints have disassociated from it) we can recycle the identity.
 	Endpoints map[string]time.Time `json:"containers"`
+	// RefTracked is true if all nodes using the identity reference it in
+	// the kvstore. Agents which do not reference identities drop it when
+	// updating the identity.
+	RefTracked bool `json:"ref-tracked,omitempty"`
 }
 
 func NewIdentityFromModel(base *models.Identity) *Identity {
@@ -35,11 +35,14 @@ type L3PolicyMap struct {
 	Map       map[string]net.IPNet // Allowed L3 prefixes
 	IPv6Count int                  // Count of IPv6 prefixes in 'Map'
 	IPv4Count int                  // Count of IPv4 prefixes in 'Map'
+
+	// PortRestricted contains the keys of the prefixes in 'Map' which
+	// are only allowed on the ports of the L4 policy
+	PortRestricted map[string]struct{}
 }
 
-// Insert places 'cidr' in to map 'm'. Returns `1` if `cidr` is added
-// to the map, `0` otherwise
-func (m *L3PolicyMap) Insert(cidr string) int {
+// parseCIDR parses 'cidr' and returns the prefix and its key in the map
+func parseCIDR(cidr string) (*net.IPNet, string) {
 	_, ipnet, err := net.ParseCIDR(cidr)
 	if err != nil {
 		var mask net.IPMask
@@ -62,34 +65,99 @@ func (m *L3PolicyMap) Insert(cidr string) int {
 
 	ones, _ := ipnet.Mask.Size()
 
-	key := ipnet.IP.String() + "/" + strconv.Itoa(ones)
-	if _, found := m.Map[key]; !found {
-		m.Map[key] = *ipnet
-		if ipnet.IP.To4() == nil {
-			m.IPv6Count++
-		} else {
-			m.IPv4Count++
+	return ipnet, ipnet.IP.String() + "/" + strconv.Itoa(ones)
+}
+
+// insert places 'ipnet' in to map 'm' under 'key'. Returns `1` if `ipnet`
+// is added to the map, `0` otherwise
+func (m *L3PolicyMap) insert(key string, ipnet *net.IPNet) int {
+	if _, found := m.Map[key]; found {
+		return 0
+	}
+
+	m.Map[key] = *ipnet
+	if ipnet.IP.To4() == nil {
+		m.IPv6Count++
+	} else {
+		m.IPv4Count++
+	}
+	return 1
+}
+
+// Insert places 'cidr' in to map 'm'. Returns `1` if `cidr` is added
+// to the map, `0` otherwise
+func (m *L3PolicyMap) Insert(cidr string) int {
+	ipnet, key := parseCIDR(cidr)
+
+	// The prefix is now allowed on all ports
+	delete(m.PortRestricted, key)
+
+	return m.insert(key, ipnet)
+}
+
+// InsertPortRestricted places 'cidr' in to map 'm' unless it is present
+// already. Unless it is also inserted with Insert(), the prefix is only
+// allowed on the ports of the L4 policy. Returns `1` if `cidr` is added to
+// the map, `0` otherwise
+func (m *L3PolicyMap) InsertPortRestricted(cidr string) int {
+	ipnet, key := parseCIDR(cidr)
+	if _, found := m.Map[key]; found {
+		return 0
+	}
+
+	if m.PortRestricted == nil {
+		m.PortRestricted = map[string]struct{}{}
+	}
+	m.PortRestricted[key] = struct{}{}
+
+	return m.insert(key, ipnet)
+}
+
+// IsPortRestricted returns true if the prefix with 'key' is only allowed on
+// the ports of the L4 policy, i.e. if it was inserted port restricted and is
+// not contained in a prefix allowed on all ports. Sources are matched
+// against the longest matching prefix only, so the prefix must inherit the
+// permissions of the prefixes it is contained in.
+func (m *L3PolicyMap) IsPortRestricted(key string) bool {
+	if _, ok := m.PortRestricted[key]; !ok {
+		return false
+	}
+
+	ipnet := m.Map[key]
+	ones, _ := ipnet.Mask.Size()
+	for k, v := range m.Map {
+		if _, ok := m.PortRestricted[k]; ok {
+			continue
+		}
+		vOnes, _ := v.Mask.Size()
+		if vOnes <= ones && v.Contains(ipnet.IP) {
+			return false
 		}
-		return 1
 	}
 
-	return 0
+	return true
 }
 
 // ToBPFData converts map 'm' into string slices 's6' and 's4',
 // formatted for insertion into bpf program.
 func (m *L3PolicyMap) ToBPFData() (s6, s4 []string) {
-	for _, v := range m.Map {
+	for k, v := range m.Map {
+		flags := 0
+		if m.IsPortRestricted(k) {
+			flags = cidrmap.LPM_FLAG_PORT_RESTRICTED
+		}
+
 		ip4 := v.IP.To4()
 		if ip4 == nil { // IPv6
 			s6 = append(s6,
-				fmt.Sprintf("{{{__constant_htonl(%#x),__constant_htonl(%#x),__constant_htonl(%#x),__constant_htonl(%#x)}},{{__constant_htonl(%#x),__constant_htonl(%#x),__constant_htonl(%#x),__constant_htonl(%#x)}}}",
+				fmt.Sprintf("{{{__constant_htonl(%#x),__constant_htonl(%#x),__constant_htonl(%#x),__constant_htonl(%#x)}},{{__constant_htonl(%#x),__constant_htonl(%#x),__constant_htonl(%#x),__constant_htonl(%#x)}},%d}",
 					byteorder.HostToNetworkSlice(v.IP[0:4], reflect.Uint32), byteorder.HostToNetworkSlice(v.IP[4:8], reflect.Uint32),
 					byteorder.HostToNetworkSlice(v.IP[8:12], reflect.Uint32), byteorder.HostToNetworkSlice(v.IP[12:16], reflect.Uint32),
 					byteorder.HostToNetworkSlice(v.Mask[0:4], reflect.Uint32), byteorder.HostToNetworkSlice(v.Mask[4:8], reflect.Uint32),
-					byteorder.HostToNetworkSlice(v.Mask[8:12], reflect.Uint32), byteorder.HostToNetworkSlice(v.Mask[12:16], reflect.Uint32)))
+					byteorder.HostToNetworkSlice(v.Mask[8:12], reflect.Uint32), byteorder.HostToNetworkSlice(v.Mask[12:16], reflect.Uint32),
+					flags))
 		} else {
-			s4 = append(s4, fmt.Sprintf("{__constant_htonl(%#x),__constant_htonl(%#x)}", byteorder.HostToNetworkSlice(ip4, reflect.Uint32), byteorder.HostToNetworkSlice(v.Mask, reflect.Uint32)))
+			s4 = append(s4, fmt.Sprintf("{__constant_htonl(%#x),__constant_htonl(%#x),%d}", byteorder.HostToNetworkSlice(ip4, reflect.Uint32), byteorder.HostToNetworkSlice(v.Mask, reflect.Uint32), flags))
 		}
 	}
 	return
@@ -97,7 +165,7 @@ func (m *L3PolicyMap) ToBPFData() (s6, s4 []string) {
 
 // PopulateBPF inserts the entries in map 'm' in to 'cidrmap'.
 func (m *L3PolicyMap) PopulateBPF(cidrmap *cidrmap.CIDRMap) error {
-	for _, value := range m.Map {
+	for k, value := range m.Map {
 		if value.IP.To4() == nil {
 			if cidrmap.AddrSize != 16 {
 				continue
@@ -107,7 +175,12 @@ func (m *L3PolicyMap) PopulateBPF(cidrmap *cidrmap.CIDRMap) error {
 				continue
 			}
 		}
-		err := cidrmap.InsertCIDR(value)
+		var err error
+		if m.IsPortRestricted(k) {
+			err = cidrmap.InsertPortRestrictedCIDR(value)
+		} else {
+			err = cidrmap.InsertCIDR(value)
+		}
 		if err != nil {
 			return err
 		}
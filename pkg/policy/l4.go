@@ -17,9 +17,9 @@ package policy
 import (
 	"bytes"
 	"encoding/json"
-	"fmt"
+	"net/http"
+	"reflect"
 	"sort"
-	"strconv"
 	"strings"
 
 	"github.com/cilium/cilium/api/v1/models"
@@ -84,15 +84,26 @@ const (
 )
 
 type L4Filter struct {
-	// Port is the destination port to allow
+	// Port is the destination port to allow or the first port of the
+	// port range to allow. Port is 0 if the filter refers to a named port.
 	Port int `json:"port"`
+	// EndPort is the last port of the port range to allow or 0 if the
+	// filter applies to a single port
+	EndPort int `json:"end-port,omitempty"`
+	// PortName is the name of the port to allow if the filter refers to
+	// a named port of the endpoint
+	PortName string `json:"port-name,omitempty"`
 	// Protocol is the L4 protocol to allow or NONE
 	Protocol api.L4Proto `json:"protocol"`
 	// U8Proto is the Protocol in numeric format, or 0 for NONE
 	U8Proto u8proto.U8proto `json:"-"`
 	// FromEndpoints limit the source labels for allowing traffic. If
-	// FromEndpoints is empty, then it selects all endpoints.
+	// both FromEndpoints and FromCIDRs are empty, then it selects all
+	// endpoints.
 	FromEndpoints []api.EndpointSelector `json:"-"`
+	// FromCIDRs limit the source prefixes for allowing traffic from
+	// outside of the cluster
+	FromCIDRs []api.CIDR `json:"-"`
 	// L7Parser specifies the L7 protocol parser (optional)
 	L7Parser L7ParserType `json:"-"`
 	// L7RedirectPort is the L7 proxy port to redirect to (optional)
@@ -106,16 +117,23 @@ type L4Filter struct {
 // GetRelevantRules returns the relevant rules based on the source and
 // destination addressing/identity information.
 func (dm L7DataMap) GetRelevantRules(identity *Identity) api.L7Rules {
+	if identity == nil {
+		return dm.GetRelevantRulesForLabels(nil)
+	}
+	return dm.GetRelevantRulesForLabels(identity.Labels.LabelArray())
+}
+
+// GetRelevantRulesForLabels returns the rules relevant for traffic from a
+// source with the given labels.
+func (dm L7DataMap) GetRelevantRulesForLabels(lbls labels.LabelArray) api.L7Rules {
 	rules := api.L7Rules{}
 	matched := 0
 
-	if identity != nil {
-		for selector, endpointRules := range dm {
-			if selector.Matches(identity.Labels.LabelArray()) {
-				matched++
-				rules.HTTP = append(rules.HTTP, endpointRules.HTTP...)
-				rules.Kafka = append(rules.Kafka, endpointRules.Kafka...)
-			}
+	for selector, endpointRules := range dm {
+		if selector.Matches(lbls) {
+			matched++
+			rules.HTTP = append(rules.HTTP, endpointRules.HTTP...)
+			rules.Kafka = append(rules.Kafka, endpointRules.Kafka...)
 		}
 	}
 
@@ -152,23 +170,33 @@ func (dm L7DataMap) addRulesForEndpoints(rules api.L7Rules, fromEndpoints []api.
 
 // CreateL4Filter creates an L4Filter for the specified api.PortProtocol in
 // the direction ("ingress"/"egress") for a particular protocol.
-// This L4Filter will only apply to endpoints covered by `fromEndpoints`.
+// This L4Filter will only apply to endpoints covered by `fromEndpoints` and
+// to sources in `fromCIDRs`.
 // `rule` allows a series of L7 rules to be associated with this L4Filter.
-func CreateL4Filter(fromEndpoints []api.EndpointSelector, rule api.PortRule, port api.PortProtocol,
+func CreateL4Filter(fromEndpoints []api.EndpointSelector, fromCIDRs []api.CIDR, rule api.PortRule, port api.PortProtocol,
 	direction string, protocol api.L4Proto) L4Filter {
 
-	// already validated via PortRule.Validate()
-	p, _ := strconv.ParseUint(port.Port, 0, 16)
 	// already validated via L4Proto.Validate()
 	u8p, _ := u8proto.ParseProtocol(string(protocol))
 
 	l4 := L4Filter{
-		Port:           int(p),
 		Protocol:       protocol,
 		U8Proto:        u8p,
 		L7RedirectPort: rule.RedirectPort,
 		L7RulesPerEp:   make(L7DataMap),
 		FromEndpoints:  fromEndpoints,
+		FromCIDRs:      fromCIDRs,
+	}
+
+	if port.IsNamedPort() {
+		l4.PortName = port.Port
+	} else {
+		// already validated via PortRule.Validate()
+		start, end, _ := port.PortRange()
+		l4.Port = int(start)
+		if end != start {
+			l4.EndPort = int(end)
+		}
 	}
 
 	if strings.ToLower(direction) == "ingress" {
@@ -212,8 +240,67 @@ func (l4 L4Filter) String() string {
 	return string(b)
 }
 
+// Resolve returns the first and the last port of the destination ports the
+// filter applies to. Named ports are looked up in namedPorts, false is
+// returned if the named port is not present or has a different protocol.
+func (l4 *L4Filter) Resolve(namedPorts NamedPortMap) (uint16, uint16, bool) {
+	if l4.PortName != "" {
+		np, ok := namedPorts[l4.PortName]
+		if !ok || np.Protocol != l4.Protocol {
+			return 0, 0, false
+		}
+		return np.Port, np.Port, true
+	}
+
+	if l4.EndPort != 0 {
+		return uint16(l4.Port), uint16(l4.EndPort), true
+	}
+
+	return uint16(l4.Port), uint16(l4.Port), true
+}
+
+// coversPort returns true if the filter applies to the destination port and
+// protocol of port. A port without protocol or with protocol ANY is covered
+// by both TCP and UDP filters. Named ports of both the port and the filter
+// are resolved against the named ports of the destination, if the names are
+// unknown they are only matched by name.
+func (l4 *L4Filter) coversPort(port *models.Port, namedPorts NamedPortMap) bool {
+	switch port.Protocol {
+	case "", models.PortProtocolANY:
+		if l4.Protocol != api.ProtoTCP && l4.Protocol != api.ProtoUDP {
+			return false
+		}
+	default:
+		if string(l4.Protocol) != port.Protocol {
+			return false
+		}
+	}
+
+	if port.Name != "" && port.Name == l4.PortName {
+		return true
+	}
+
+	dport := port.Port
+	if port.Name != "" {
+		np, ok := namedPorts[port.Name]
+		if !ok || np.Protocol != l4.Protocol {
+			return false
+		}
+		dport = np.Port
+	}
+
+	start, end, ok := l4.Resolve(namedPorts)
+	return ok && dport >= start && dport <= end
+}
+
+// AllowsAllSources returns true if the filter is neither restricted to
+// endpoints nor to CIDRs, i.e. if the port is allowed from everywhere
+func (l4 *L4Filter) AllowsAllSources() bool {
+	return len(l4.FromEndpoints) == 0 && len(l4.FromCIDRs) == 0
+}
+
 func (l4 L4Filter) matchesLabels(labels labels.LabelArray) bool {
-	if len(l4.FromEndpoints) == 0 {
+	if l4.AllowsAllSources() {
 		return true
 	} else if len(labels) == 0 {
 		return false
@@ -228,8 +315,69 @@ func (l4 L4Filter) matchesLabels(labels labels.LabelArray) bool {
 	return false
 }
 
+// AllowsHTTPRequest returns true if the filter allows the HTTP request from a
+// source with the given labels. Requests are allowed if the filter has no L7
+// parser, otherwise they must match one of the HTTP rules relevant for the
+// source.
+func (l4 *L4Filter) AllowsHTTPRequest(from labels.LabelArray, req *http.Request) bool {
+	if !l4.matchesLabels(from) {
+		return false
+	}
+
+	if l4.L7Parser == "" {
+		return true
+	} else if l4.L7Parser != ParserTypeHTTP {
+		return false
+	}
+
+	rules := l4.L7RulesPerEp.GetRelevantRulesForLabels(from)
+	for _, r := range rules.HTTP {
+		if r.Matches(req) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// AllowsKafkaRequest returns true if the filter allows a Kafka request with
+// the given properties from a source with the given labels. Requests are
+// allowed if the filter has no L7 parser, otherwise they must match one of the
+// Kafka rules relevant for the source.
+func (l4 *L4Filter) AllowsKafkaRequest(from labels.LabelArray, apiKey, apiVersion int16, clientID, topic string) bool {
+	if !l4.matchesLabels(from) {
+		return false
+	}
+
+	if l4.L7Parser == "" {
+		return true
+	} else if l4.L7Parser != ParserTypeKafka {
+		return false
+	}
+
+	rules := l4.L7RulesPerEp.GetRelevantRulesForLabels(from)
+	for _, r := range rules.Kafka {
+		if r.Matches(apiKey, apiVersion, clientID, topic) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// NamedPort is the port number and protocol of a named port
+type NamedPort struct {
+	Port     uint16
+	Protocol api.L4Proto
+}
+
+// NamedPortMap maps the names of the named ports of an endpoint to the port
+// number and protocol they refer to
+type NamedPortMap map[string]NamedPort
+
 // L4PolicyMap is a list of L4 filters indexable by protocol/port
-// key format: "port/proto"
+// key format: "port/proto", where port is a port number, a port range in
+// the form "start-end" or a port name
 type L4PolicyMap map[string]L4Filter
 
 // HasRedirect returns true if at least one L4 filter contains a port
@@ -244,16 +392,68 @@ func (l4 L4PolicyMap) HasRedirect() bool {
 	return false
 }
 
+// equalsExceptSources returns true if both maps contain the same filters
+// which differ at most in the sources they select. Filters redirecting to a
+// proxy must be identical as the proxy enforces their L7 rules per source.
+func (l4 L4PolicyMap) equalsExceptSources(o L4PolicyMap) bool {
+	if len(l4) != len(o) {
+		return false
+	}
+
+	for k, f := range l4 {
+		of, ok := o[k]
+		if !ok {
+			return false
+		}
+		if f.IsRedirect() || of.IsRedirect() {
+			if !reflect.DeepEqual(f, of) {
+				return false
+			}
+			continue
+		}
+		f.FromEndpoints, of.FromEndpoints = nil, nil
+		f.FromCIDRs, of.FromCIDRs = nil, nil
+		if !reflect.DeepEqual(f, of) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// FilterPorts returns the subset of the L4PolicyMap covering the L4 ports in
+// `ports`. A port without protocol or with protocol ANY selects both the TCP
+// and the UDP filter. Port numbers also select the filters of port ranges
+// containing them, named ports are resolved against `namedPorts`. If `ports`
+// is empty, the full L4PolicyMap is returned.
+func (l4 L4PolicyMap) FilterPorts(ports []*models.Port, namedPorts NamedPortMap) L4PolicyMap {
+	if len(ports) == 0 {
+		return l4
+	}
+
+	result := L4PolicyMap{}
+	for _, p := range ports {
+		for key, filter := range l4 {
+			if filter.coversPort(p, namedPorts) {
+				result[key] = filter
+			}
+		}
+	}
+
+	return result
+}
+
 // containsAllL3L4 checks if the L4PolicyMap contains all L4 ports in `ports`.
 // For L4Filters that specify FromEndpoints, uses `labels` to determine whether
 // the policy allows L4 communication between the corresponding endpoints.
+// Named ports are resolved against `namedPorts` of the destination.
 // Returns api.Denied in the following conditions:
 // * If the `L4PolicyMap` has at least one rule and `ports` is empty.
 // * If a single port is not present in the `L4PolicyMap`.
 // * If a port is present in the `L4PolicyMap`, but it applies FromEndpoints
 //   constraints that require labels not present in `labels`.
 // Otherwise, returns api.Allowed.
-func (l4 L4PolicyMap) containsAllL3L4(labels labels.LabelArray, ports []*models.Port) api.Decision {
+func (l4 L4PolicyMap) containsAllL3L4(labels labels.LabelArray, ports []*models.Port, namedPorts NamedPortMap) api.Decision {
 	if len(l4) == 0 {
 		return api.Allowed
 	}
@@ -263,29 +463,16 @@ func (l4 L4PolicyMap) containsAllL3L4(labels labels.LabelArray, ports []*models.
 	}
 
 	for _, l4CtxIng := range ports {
-		lwrProtocol := l4CtxIng.Protocol
-		switch lwrProtocol {
-		case "", models.PortProtocolANY:
-			tcpPort := fmt.Sprintf("%d/TCP", l4CtxIng.Port)
-			tcpFilter, tcpmatch := l4[tcpPort]
-			if tcpmatch {
-				tcpmatch = tcpFilter.matchesLabels(labels)
-			}
-			udpPort := fmt.Sprintf("%d/UDP", l4CtxIng.Port)
-			udpFilter, udpmatch := l4[udpPort]
-			if udpmatch {
-				udpmatch = udpFilter.matchesLabels(labels)
-			}
-			if !tcpmatch && !udpmatch {
-				return api.Denied
-			}
-		default:
-			port := fmt.Sprintf("%d/%s", l4CtxIng.Port, lwrProtocol)
-			filter, match := l4[port]
-			if !match || !filter.matchesLabels(labels) {
-				return api.Denied
+		match := false
+		for _, filter := range l4 {
+			if filter.coversPort(l4CtxIng, namedPorts) && filter.matchesLabels(labels) {
+				match = true
+				break
 			}
 		}
+		if !match {
+			return api.Denied
+		}
 	}
 	return api.Allowed
 }
@@ -305,19 +492,20 @@ func NewL4Policy() *L4Policy {
 // IngressCoversDPorts checks if the receiver's ingress `L4Policy` contains all
 // `dPorts`.
 func (l4 *L4Policy) IngressCoversDPorts(dPorts []*models.Port) api.Decision {
-	return l4.Ingress.containsAllL3L4(labels.LabelArray{}, dPorts)
+	return l4.Ingress.containsAllL3L4(labels.LabelArray{}, dPorts, nil)
 }
 
 // IngressCoversContext checks if the receiver's ingress `L4Policy` contains
-// all `dPorts` and `labels`.
+// all `dPorts` and `labels`. Named ports are resolved against the named ports
+// of the destination in the context.
 func (l4 *L4Policy) IngressCoversContext(ctx *SearchContext) api.Decision {
-	return l4.Ingress.containsAllL3L4(ctx.From, ctx.DPorts)
+	return l4.Ingress.containsAllL3L4(ctx.From, ctx.DPorts, ctx.NamedPorts)
 }
 
 // EgressCoversDPorts checks if the receiver's egress `L4Policy` contains all
 // `dPorts`.
 func (l4 *L4Policy) EgressCoversDPorts(dPorts []*models.Port) api.Decision {
-	return l4.Egress.containsAllL3L4(labels.LabelArray{}, dPorts)
+	return l4.Egress.containsAllL3L4(labels.LabelArray{}, dPorts, nil)
 }
 
 // HasRedirect returns true if the L4 policy contains at least one port redirection
@@ -325,12 +513,36 @@ func (l4 *L4Policy) HasRedirect() bool {
 	return l4 != nil && (l4.Ingress.HasRedirect() || l4.Egress.HasRedirect())
 }
 
+// EqualsExceptSources returns true if l4 and o allow the same ports with the
+// same L7 rules and differ at most in the sources selected by the filters,
+// i.e. if switching between them only changes the identities allowed in the
+// PolicyMap of the endpoint.
+func (l4 *L4Policy) EqualsExceptSources(o *L4Policy) bool {
+	if l4 == nil || o == nil {
+		return l4 == o
+	}
+	return l4.Ingress.equalsExceptSources(o.Ingress) && l4.Egress.equalsExceptSources(o.Egress)
+}
+
 // RequiresConntrack returns true if if the L4 configuration requires
 // connection tracking to be enabled.
 func (l4 *L4Policy) RequiresConntrack() bool {
 	return l4 != nil && (len(l4.Ingress) > 0 || len(l4.Egress) > 0)
 }
 
+// IngressSelectors returns the endpoint selectors of all ingress filters
+func (l4 *L4Policy) IngressSelectors() []api.EndpointSelector {
+	selectors := []api.EndpointSelector{}
+	if l4 == nil {
+		return selectors
+	}
+
+	for _, filter := range l4.Ingress {
+		selectors = append(selectors, filter.FromEndpoints...)
+	}
+	return selectors
+}
+
 func (l4 *L4Policy) GetModel() *models.L4Policy {
 	if l4 == nil {
 		return nil
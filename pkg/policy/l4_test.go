@@ -15,6 +15,7 @@
 package policy
 
 import (
+	"net/http"
 	"sort"
 
 	"github.com/cilium/cilium/api/v1/models"
@@ -93,6 +94,101 @@ func (s *PolicyTestSuite) TestEgressCoversDPorts(c *C) {
 	s.testDPortCoverage(c, policy, policy.EgressCoversDPorts)
 }
 
+func (s *PolicyTestSuite) TestCoversDPortsRangeAndName(c *C) {
+	policy := L4Policy{
+		Ingress: L4PolicyMap{
+			"8000-8100/TCP": {
+				Port:     8000,
+				EndPort:  8100,
+				Protocol: api.ProtoTCP,
+				Ingress:  true,
+			},
+			"http/TCP": {
+				PortName: "http",
+				Protocol: api.ProtoTCP,
+				Ingress:  true,
+			},
+		},
+	}
+
+	for _, port := range []*models.Port{
+		{Port: 8000, Protocol: models.PortProtocolTCP},
+		{Port: 8050, Protocol: models.PortProtocolANY},
+		{Port: 8100, Protocol: models.PortProtocolTCP},
+		{Name: "http", Protocol: models.PortProtocolTCP},
+	} {
+		c.Assert(policy.IngressCoversDPorts([]*models.Port{port}), Equals, api.Allowed, Commentf("port %+v", port))
+	}
+
+	for _, port := range []*models.Port{
+		{Port: 7999, Protocol: models.PortProtocolTCP},
+		{Port: 8101, Protocol: models.PortProtocolTCP},
+		{Port: 8050, Protocol: models.PortProtocolUDP},
+		{Name: "http", Protocol: models.PortProtocolUDP},
+		{Name: "https", Protocol: models.PortProtocolTCP},
+	} {
+		c.Assert(policy.IngressCoversDPorts([]*models.Port{port}), Equals, api.Denied, Commentf("port %+v", port))
+	}
+
+	filtered := policy.Ingress.FilterPorts([]*models.Port{{Port: 8080}}, nil)
+	c.Assert(filtered, HasLen, 1)
+	c.Assert(filtered["8000-8100/TCP"].EndPort, Equals, 8100)
+
+	// Named ports of the destination match port numbers and vice versa
+	namedPorts := NamedPortMap{
+		"http":  {Port: 8200, Protocol: api.ProtoTCP},
+		"proxy": {Port: 8050, Protocol: api.ProtoTCP},
+		"dns":   {Port: 8060, Protocol: api.ProtoUDP},
+	}
+	for _, port := range []*models.Port{
+		{Port: 8200, Protocol: models.PortProtocolTCP},
+		{Name: "proxy", Protocol: models.PortProtocolTCP},
+		{Name: "http", Protocol: models.PortProtocolANY},
+	} {
+		ctx := SearchContext{DPorts: []*models.Port{port}, NamedPorts: namedPorts}
+		c.Assert(policy.IngressCoversContext(&ctx), Equals, api.Allowed, Commentf("port %+v", port))
+	}
+	for _, port := range []*models.Port{
+		{Port: 8201, Protocol: models.PortProtocolTCP},
+		{Name: "dns", Protocol: models.PortProtocolANY},
+		{Name: "https", Protocol: models.PortProtocolTCP},
+	} {
+		ctx := SearchContext{DPorts: []*models.Port{port}, NamedPorts: namedPorts}
+		c.Assert(policy.IngressCoversContext(&ctx), Equals, api.Denied, Commentf("port %+v", port))
+	}
+
+	filtered = policy.Ingress.FilterPorts([]*models.Port{{Port: 8200}}, namedPorts)
+	c.Assert(filtered, HasLen, 1)
+	c.Assert(filtered["http/TCP"].PortName, Equals, "http")
+}
+
+func (s *PolicyTestSuite) TestCreateL4FilterRangeAndName(c *C) {
+	tuple := api.PortProtocol{Port: "8000-8100", Protocol: api.ProtoTCP}
+	filter := CreateL4Filter(nil, nil, api.PortRule{Ports: []api.PortProtocol{tuple}}, tuple, "ingress", api.ProtoTCP)
+	c.Assert(filter.Port, Equals, 8000)
+	c.Assert(filter.EndPort, Equals, 8100)
+	c.Assert(filter.PortName, Equals, "")
+	start, end, ok := filter.Resolve(nil)
+	c.Assert(ok, Equals, true)
+	c.Assert(start, Equals, uint16(8000))
+	c.Assert(end, Equals, uint16(8100))
+
+	tuple = api.PortProtocol{Port: "http", Protocol: api.ProtoTCP}
+	filter = CreateL4Filter(nil, nil, api.PortRule{Ports: []api.PortProtocol{tuple}}, tuple, "ingress", api.ProtoTCP)
+	c.Assert(filter.Port, Equals, 0)
+	c.Assert(filter.EndPort, Equals, 0)
+	c.Assert(filter.PortName, Equals, "http")
+
+	_, _, ok = filter.Resolve(nil)
+	c.Assert(ok, Equals, false)
+	_, _, ok = filter.Resolve(NamedPortMap{"http": {Port: 8080, Protocol: api.ProtoUDP}})
+	c.Assert(ok, Equals, false)
+	start, end, ok = filter.Resolve(NamedPortMap{"http": {Port: 8080, Protocol: api.ProtoTCP}})
+	c.Assert(ok, Equals, true)
+	c.Assert(start, Equals, uint16(8080))
+	c.Assert(end, Equals, uint16(8080))
+}
+
 func (s *PolicyTestSuite) TestCreateL4Filter(c *C) {
 	tuple := api.PortProtocol{Port: "80", Protocol: api.ProtoTCP}
 	portrule := api.PortRule{
@@ -114,7 +210,7 @@ func (s *PolicyTestSuite) TestCreateL4Filter(c *C) {
 			// Regardless of ingress/egress, we should end up with
 			// a single L7 rule whether the selector is wildcarded
 			// or if it is based on specific labels.
-			filter := CreateL4Filter(eps, portrule, tuple,
+			filter := CreateL4Filter(eps, nil, portrule, tuple,
 				direction, tuple.Protocol)
 			c.Assert(len(filter.L7RulesPerEp), Equals, 1)
 		}
@@ -227,3 +323,94 @@ func (s *PolicyTestSuite) TestJSONMarshal(c *C) {
 	result.Sort()
 	c.Assert(pretty.Sprintf("%+ v", result), comparator.DeepEquals, expected)
 }
+
+func (s *PolicyTestSuite) TestL4FilterAllowsL7Request(c *C) {
+	fooLabels := labels.LabelArray{labels.ParseSelectLabel("foo")}
+	barLabels := labels.LabelArray{labels.ParseSelectLabel("bar")}
+	fooSelector := api.NewESFromLabels(labels.ParseSelectLabel("foo"))
+
+	httpFilter := L4Filter{
+		Port: 80, Protocol: api.ProtoTCP,
+		FromEndpoints: []api.EndpointSelector{fooSelector},
+		L7Parser:      ParserTypeHTTP,
+		L7RulesPerEp: L7DataMap{
+			fooSelector: api.L7Rules{
+				HTTP: []api.PortRuleHTTP{
+					{Path: "/public/.*", Method: "GET"},
+					{Method: "POST", Headers: []string{"X-Token: secret"}},
+				},
+			},
+		},
+		Ingress: true,
+	}
+
+	req, err := http.NewRequest("GET", "http://example.com/public/index.html", nil)
+	c.Assert(err, IsNil)
+	c.Assert(httpFilter.AllowsHTTPRequest(fooLabels, req), Equals, true)
+	c.Assert(httpFilter.AllowsHTTPRequest(barLabels, req), Equals, false)
+
+	req, err = http.NewRequest("GET", "http://example.com/private", nil)
+	c.Assert(err, IsNil)
+	c.Assert(httpFilter.AllowsHTTPRequest(fooLabels, req), Equals, false)
+
+	// The whole path must match
+	req, err = http.NewRequest("GET", "http://example.com/private/public/", nil)
+	c.Assert(err, IsNil)
+	c.Assert(httpFilter.AllowsHTTPRequest(fooLabels, req), Equals, false)
+
+	req, err = http.NewRequest("POST", "http://example.com/private", nil)
+	c.Assert(err, IsNil)
+	c.Assert(httpFilter.AllowsHTTPRequest(fooLabels, req), Equals, false)
+	req.Header.Set("X-Token", "secret")
+	c.Assert(httpFilter.AllowsHTTPRequest(fooLabels, req), Equals, true)
+
+	// Kafka requests are never allowed on a port with an HTTP parser
+	c.Assert(httpFilter.AllowsKafkaRequest(fooLabels, 0, 0, "", ""), Equals, false)
+
+	kafkaRule := api.PortRuleKafka{APIKey: "produce", Topic: "orders"}
+	c.Assert(kafkaRule.Sanitize(), IsNil)
+	kafkaFilter := L4Filter{
+		Port: 9092, Protocol: api.ProtoTCP,
+		L7Parser: ParserTypeKafka,
+		L7RulesPerEp: L7DataMap{
+			WildcardEndpointSelector: api.L7Rules{
+				Kafka: []api.PortRuleKafka{kafkaRule},
+			},
+		},
+		Ingress: true,
+	}
+
+	produce := api.KafkaAPIKeyMap["produce"]
+	fetch := api.KafkaAPIKeyMap["fetch"]
+	c.Assert(kafkaFilter.AllowsKafkaRequest(barLabels, produce, 0, "client", "orders"), Equals, true)
+	c.Assert(kafkaFilter.AllowsKafkaRequest(barLabels, produce, 0, "client", "payments"), Equals, false)
+	c.Assert(kafkaFilter.AllowsKafkaRequest(barLabels, fetch, 0, "client", "orders"), Equals, false)
+
+	// Ports without L7 parser allow all requests of selected sources
+	l4Filter := L4Filter{Port: 8080, Protocol: api.ProtoTCP, Ingress: true}
+	c.Assert(l4Filter.AllowsHTTPRequest(barLabels, req), Equals, true)
+}
+
+func (s *PolicyTestSuite) TestEqualsExceptSources(c *C) {
+	newPolicy := func(from string, port int, parser L7ParserType) *L4Policy {
+		l4 := NewL4Policy()
+		l4.Ingress["port"] = L4Filter{
+			Port: port, Protocol: api.ProtoTCP,
+			FromEndpoints: []api.EndpointSelector{api.NewESFromLabels(labels.ParseSelectLabel(from))},
+			L7Parser:      parser,
+			Ingress:       true,
+		}
+		return l4
+	}
+
+	c.Assert(newPolicy("app=foo", 80, "").EqualsExceptSources(newPolicy("app=bar", 80, "")), Equals, true)
+	c.Assert(newPolicy("app=foo", 80, "").EqualsExceptSources(newPolicy("app=foo", 8080, "")), Equals, false)
+
+	// The proxy enforces the L7 rules per source
+	c.Assert(newPolicy("app=foo", 80, ParserTypeHTTP).EqualsExceptSources(newPolicy("app=bar", 80, ParserTypeHTTP)), Equals, false)
+	c.Assert(newPolicy("app=foo", 80, ParserTypeHTTP).EqualsExceptSources(newPolicy("app=foo", 80, ParserTypeHTTP)), Equals, true)
+
+	var nilPolicy *L4Policy
+	c.Assert(nilPolicy.EqualsExceptSources(nil), Equals, true)
+	c.Assert(nilPolicy.EqualsExceptSources(NewL4Policy()), Equals, false)
+}
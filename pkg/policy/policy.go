@@ -70,6 +70,10 @@ type SearchContext struct {
 	To      labels.LabelArray
 	DPorts  []*models.Port
 
+	// NamedPorts are the named ports of the destination, used to match
+	// named ports against port numbers
+	NamedPorts NamedPortMap
+
 	// IngressL4Only is true if only ingress L4 policy should be evaluated
 	IngressL4Only bool
 	// EgressL4Only is true if only egress L4 policy should be evaluated
@@ -87,7 +91,11 @@ func (s *SearchContext) String() string {
 		to = append(to, toLabel.String())
 	}
 	for _, dport := range s.DPorts {
-		dports = append(dports, fmt.Sprintf("%d/%s", dport.Port, dport.Protocol))
+		if dport.Name != "" {
+			dports = append(dports, fmt.Sprintf("%s/%s", dport.Name, dport.Protocol))
+		} else {
+			dports = append(dports, fmt.Sprintf("%d/%s", dport.Port, dport.Protocol))
+		}
 	}
 	ret := fmt.Sprintf("From: [%s]", strings.Join(from, ", "))
 	ret += fmt.Sprintf(" => To: [%s]", strings.Join(to, ", "))
@@ -267,6 +267,21 @@ func (p *Repository) SearchRLocked(labels labels.LabelArray) api.Rules {
 	return result
 }
 
+// GetRulesSelectingRLocked returns all rules of the policy repository whose
+// EndpointSelector selects the specified labels. The policy repository mutex
+// must be held.
+func (p *Repository) GetRulesSelectingRLocked(labels labels.LabelArray) api.Rules {
+	result := api.Rules{}
+
+	for _, r := range p.rules {
+		if r.EndpointSelector.Matches(labels) {
+			result = append(result, &r.Rule)
+		}
+	}
+
+	return result
+}
+
 // Add inserts a rule into the policy repository
 func (p *Repository) Add(r api.Rule) (uint64, error) {
 	p.Mutex.Lock()
@@ -83,9 +83,13 @@ func (r *rule) sanitize() error {
 	return nil
 }
 
-func (policy *L4Filter) addFromEndpoints(fromEndpoints []api.EndpointSelector) bool {
+// addFromPeers adds the sources fromEndpoints and fromCIDRs to the filter.
+// A filter without any sources allows all sources, so it absorbs all
+// restricted sources merged into it.
+func (policy *L4Filter) addFromPeers(fromEndpoints []api.EndpointSelector, fromCIDRs []api.CIDR) bool {
+	restricted := len(fromEndpoints) > 0 || len(fromCIDRs) > 0
 
-	if len(policy.FromEndpoints) == 0 && len(fromEndpoints) > 0 {
+	if policy.AllowsAllSources() && restricted {
 		log.WithFields(log.Fields{
 			logfields.EndpointSelector: fromEndpoints,
 			"policy":                   policy,
@@ -93,26 +97,28 @@ func (policy *L4Filter) addFromEndpoints(fromEndpoints []api.EndpointSelector) b
 		return true
 	}
 
-	if len(policy.FromEndpoints) > 0 && len(fromEndpoints) == 0 {
+	if !policy.AllowsAllSources() && !restricted {
 		// new policy is more permissive than the existing policy
 		// use a more permissive one
 		policy.FromEndpoints = nil
+		policy.FromCIDRs = nil
 	}
 
 	policy.FromEndpoints = append(policy.FromEndpoints, fromEndpoints...)
+	policy.FromCIDRs = append(policy.FromCIDRs, fromCIDRs...)
 	return false
 }
 
-func mergeL4Port(ctx *SearchContext, fromEndpoints []api.EndpointSelector, r api.PortRule, p api.PortProtocol,
+func mergeL4Port(ctx *SearchContext, fromEndpoints []api.EndpointSelector, fromCIDRs []api.CIDR, r api.PortRule, p api.PortProtocol,
 	dir string, proto api.L4Proto, resMap L4PolicyMap) (int, error) {
 
 	key := p.Port + "/" + string(proto)
 	v, ok := resMap[key]
 	if !ok {
-		resMap[key] = CreateL4Filter(fromEndpoints, r, p, dir, proto)
+		resMap[key] = CreateL4Filter(fromEndpoints, fromCIDRs, r, p, dir, proto)
 		return 1, nil
 	}
-	l4Filter := CreateL4Filter(fromEndpoints, r, p, dir, proto)
+	l4Filter := CreateL4Filter(fromEndpoints, fromCIDRs, r, p, dir, proto)
 	if l4Filter.L7Parser != "" {
 		if v.L7Parser == "" {
 			v.L7Parser = l4Filter.L7Parser
@@ -131,7 +137,7 @@ func mergeL4Port(ctx *SearchContext, fromEndpoints []api.EndpointSelector, r api
 		}
 	}
 
-	if v.addFromEndpoints(fromEndpoints) && r.NumRules() == 0 {
+	if v.addFromPeers(fromEndpoints, fromCIDRs) && r.NumRules() == 0 {
 		// skip this policy as it is already covered and it does not contain L7 rules
 		return 1, nil
 	}
@@ -174,7 +180,7 @@ func mergeL4Port(ctx *SearchContext, fromEndpoints []api.EndpointSelector, r api
 	return 1, nil
 }
 
-func mergeL4(ctx *SearchContext, dir string, fromEndpoints []api.EndpointSelector, portRules []api.PortRule,
+func mergeL4(ctx *SearchContext, dir string, fromEndpoints []api.EndpointSelector, fromCIDRs []api.CIDR, portRules []api.PortRule,
 	resMap L4PolicyMap) (int, error) {
 
 	if len(portRules) == 0 {
@@ -188,7 +194,11 @@ func mergeL4(ctx *SearchContext, dir string, fromEndpoints []api.EndpointSelecto
 	for _, r := range portRules {
 		if fromEndpoints != nil {
 			ctx.PolicyTrace("    Allows %s port %v from endpoints %v\n", dir, r.Ports, fromEndpoints)
-		} else {
+		}
+		if fromCIDRs != nil {
+			ctx.PolicyTrace("    Allows %s port %v from CIDRs %v\n", dir, r.Ports, fromCIDRs)
+		}
+		if fromEndpoints == nil && fromCIDRs == nil {
 			ctx.PolicyTrace("    Allows %s port %v\n", dir, r.Ports)
 		}
 
@@ -203,7 +213,7 @@ func mergeL4(ctx *SearchContext, dir string, fromEndpoints []api.EndpointSelecto
 		}
 
 		l3match := false
-		if ctx.From != nil && fromEndpoints != nil {
+		if ctx.From != nil && (fromEndpoints != nil || fromCIDRs != nil) {
 			for _, labels := range fromEndpoints {
 				if labels.Matches(ctx.From) {
 					l3match = true
@@ -220,19 +230,19 @@ func mergeL4(ctx *SearchContext, dir string, fromEndpoints []api.EndpointSelecto
 		for _, p := range r.Ports {
 			var cnt int
 			if p.Protocol != api.ProtoAny {
-				cnt, err = mergeL4Port(ctx, fromEndpoints, r, p, dir, p.Protocol, resMap)
+				cnt, err = mergeL4Port(ctx, fromEndpoints, fromCIDRs, r, p, dir, p.Protocol, resMap)
 				if err != nil {
 					return found, err
 				}
 				found += cnt
 			} else {
-				cnt, err = mergeL4Port(ctx, fromEndpoints, r, p, dir, api.ProtoTCP, resMap)
+				cnt, err = mergeL4Port(ctx, fromEndpoints, fromCIDRs, r, p, dir, api.ProtoTCP, resMap)
 				if err != nil {
 					return found, err
 				}
 				found += cnt
 
-				cnt, err = mergeL4Port(ctx, fromEndpoints, r, p, dir, api.ProtoUDP, resMap)
+				cnt, err = mergeL4Port(ctx, fromEndpoints, fromCIDRs, r, p, dir, api.ProtoUDP, resMap)
 				if err != nil {
 					return found, err
 				}
@@ -245,7 +255,11 @@ func mergeL4(ctx *SearchContext, dir string, fromEndpoints []api.EndpointSelecto
 }
 
 func (state *traceState) selectRule(ctx *SearchContext, r *rule) {
-	ctx.PolicyTrace("* Rule %s: selected\n", r)
+	if len(r.Labels) > 0 {
+		ctx.PolicyTrace("* Rule %s %v: selected\n", r, r.Labels.GetModel())
+	} else {
+		ctx.PolicyTrace("* Rule %s: selected\n", r)
+	}
 	state.selectedRules++
 }
 
@@ -267,7 +281,17 @@ func (r *rule) resolveL4Policy(ctx *SearchContext, state *traceState, result *L4
 			ctx.PolicyTrace("    No L4 rules\n")
 		}
 		for _, r := range r.Ingress {
-			cnt, err := mergeL4(ctx, "Ingress", r.FromEndpoints, r.ToPorts, result.Ingress)
+			// Sources selected by entities or CIDRs are only allowed
+			// on the ports of the rule, not on all ports
+			fromEndpoints := append([]api.EndpointSelector(nil), r.FromEndpoints...)
+			for _, entity := range r.FromEntities {
+				fromEndpoints = append(fromEndpoints, api.EntitySelectorMapping[entity])
+			}
+			var fromCIDRs []api.CIDR
+			fromCIDRs = append(fromCIDRs, r.FromCIDR...)
+			fromCIDRs = append(fromCIDRs, computeResultantCIDRSet(r.FromCIDRSet)...)
+
+			cnt, err := mergeL4(ctx, "Ingress", fromEndpoints, fromCIDRs, r.ToPorts, result.Ingress)
 			if err != nil {
 				return nil, err
 			}
@@ -280,7 +304,7 @@ func (r *rule) resolveL4Policy(ctx *SearchContext, state *traceState, result *L4
 			ctx.PolicyTrace("    No L4 rules\n")
 		}
 		for _, r := range r.Egress {
-			cnt, err := mergeL4(ctx, "Egress", nil, r.ToPorts, result.Egress)
+			cnt, err := mergeL4(ctx, "Egress", nil, nil, r.ToPorts, result.Egress)
 			if err != nil {
 				return nil, err
 			}
@@ -295,14 +319,18 @@ func (r *rule) resolveL4Policy(ctx *SearchContext, state *traceState, result *L4
 	return nil, nil
 }
 
-func mergeL3(ctx *SearchContext, dir string, ipRules []api.CIDR, resMap *L3PolicyMap) int {
+func mergeL3(ctx *SearchContext, dir string, ipRules []api.CIDR, portRestricted bool, resMap *L3PolicyMap) int {
 	found := 0
 
 	for _, r := range ipRules {
 		strCIDR := string(r)
-		ctx.PolicyTrace("  Allows %s IP %s\n", dir, strCIDR)
-
-		found += resMap.Insert(strCIDR)
+		if portRestricted {
+			ctx.PolicyTrace("  Allows %s IP %s on the ports of the L4 policy\n", dir, strCIDR)
+			found += resMap.InsertPortRestricted(strCIDR)
+		} else {
+			ctx.PolicyTrace("  Allows %s IP %s\n", dir, strCIDR)
+			found += resMap.Insert(strCIDR)
+		}
 	}
 
 	return found
@@ -348,7 +376,9 @@ func (r *rule) resolveL3Policy(ctx *SearchContext, state *traceState, result *L3
 
 		allCIDRs = append(allCIDRs, computeResultantCIDRSet(r.FromCIDRSet)...)
 
-		found += mergeL3(ctx, "Ingress", allCIDRs, &result.Ingress)
+		// CIDRs of rules with ToPorts are only allowed on the ports
+		// of the rule, see resolveL4Policy()
+		found += mergeL3(ctx, "Ingress", allCIDRs, len(r.ToPorts) > 0, &result.Ingress)
 	}
 	for _, r := range r.Egress {
 		// TODO(ianvernon): GH-1658
@@ -357,7 +387,7 @@ func (r *rule) resolveL3Policy(ctx *SearchContext, state *traceState, result *L3
 
 		allCIDRs = append(allCIDRs, computeResultantCIDRSet(r.ToCIDRSet)...)
 
-		found += mergeL3(ctx, "Egress", allCIDRs, &result.Egress)
+		found += mergeL3(ctx, "Egress", allCIDRs, false, &result.Egress)
 	}
 
 	if found > 0 {
@@ -412,13 +442,18 @@ func (r *rule) canReach(ctx *SearchContext, state *traceState) api.Decision {
 		}
 	}
 
-	for _, entitySelector := range r.fromEntities {
-		if entitySelector.Matches(ctx.From) {
-			ctx.PolicyTrace("+     Found all required labels to match entity %s\n", entitySelector.String())
-			state.matchedRules++
-			return api.Allowed
+	for _, r := range r.Ingress {
+		for _, entity := range r.FromEntities {
+			entitySelector := api.EntitySelectorMapping[entity]
+			if entitySelector.Matches(ctx.From) {
+				if len(r.ToPorts) == 0 {
+					ctx.PolicyTrace("+     Found all required labels to match entity %s\n", entitySelector.String())
+					state.matchedRules++
+					return api.Allowed
+				}
+				ctx.PolicyTrace("      Found all required labels to match entity %s, deferring policy decision to L4 policy stage\n", entitySelector.String())
+			}
 		}
-
 	}
 
 	return entitiesDecision
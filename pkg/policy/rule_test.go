@@ -17,6 +17,7 @@ package policy
 import (
 	"net"
 
+	"github.com/cilium/cilium/api/v1/models"
 	"github.com/cilium/cilium/pkg/comparator"
 	"github.com/cilium/cilium/pkg/labels"
 	"github.com/cilium/cilium/pkg/policy/api"
@@ -625,6 +626,72 @@ func (ds *PolicyTestSuite) TestL3Policy(c *C) {
 	c.Assert(err, Not(IsNil))
 }
 
+func (ds *PolicyTestSuite) TestL4PolicyFromCIDRAndEntities(c *C) {
+	toBar := &SearchContext{To: labels.ParseSelectLabelArray("bar")}
+	fromWorld := &SearchContext{
+		From: labels.ParseSelectLabelArray("reserved:world"),
+		To:   labels.ParseSelectLabelArray("bar"),
+	}
+
+	ports := []api.PortRule{{
+		Ports: []api.PortProtocol{{Port: "80", Protocol: api.ProtoTCP}},
+	}}
+	rule1 := rule{
+		Rule: api.Rule{
+			EndpointSelector: api.NewESFromLabels(labels.ParseSelectLabel("bar")),
+			Ingress: []api.IngressRule{
+				{
+					FromCIDR: []api.CIDR{"10.0.1.0/24"},
+					ToPorts:  ports,
+				},
+				{
+					FromEntities: []api.Entity{api.EntityWorld},
+					ToPorts:      ports,
+				},
+				{
+					FromCIDR: []api.CIDR{"10.0.0.0/8", "192.168.0.0/16"},
+				},
+			},
+		},
+	}
+	c.Assert(rule1.sanitize(), IsNil)
+
+	// The sources of the CIDR and entity rules are carried into the
+	// filter, the port is not allowed from everywhere
+	res, err := rule1.resolveL4Policy(toBar, &traceState{}, NewL4Policy())
+	c.Assert(err, IsNil)
+	c.Assert(res, Not(IsNil))
+	filter := res.Ingress["80/TCP"]
+	c.Assert(filter.AllowsAllSources(), Equals, false)
+	c.Assert(filter.FromCIDRs, DeepEquals, []api.CIDR{"10.0.1.0/24"})
+	c.Assert(filter.FromEndpoints, DeepEquals, []api.EndpointSelector{api.EntitySelectorMapping[api.EntityWorld]})
+
+	// The entity with ports is deferred to the L4 policy
+	c.Assert(rule1.canReach(fromWorld, &traceState{}), Equals, api.Undecided)
+	c.Assert(res.IngressCoversContext(&SearchContext{
+		From:   fromWorld.From,
+		To:     fromWorld.To,
+		DPorts: []*models.Port{{Port: 80, Protocol: models.PortProtocolTCP}},
+	}), Equals, api.Allowed)
+
+	// The prefix of the rule with ports is only allowed on the ports of
+	// the L4 policy unless it is contained in a prefix allowed on all
+	// ports
+	l3 := rule1.resolveL3Policy(toBar, &traceState{}, NewL3Policy())
+	c.Assert(l3, Not(IsNil))
+	c.Assert(l3.Ingress.IsPortRestricted("10.0.1.0/24"), Equals, false)
+	c.Assert(l3.Ingress.IsPortRestricted("10.0.0.0/8"), Equals, false)
+
+	rule1.Ingress = rule1.Ingress[:2]
+	l3 = rule1.resolveL3Policy(toBar, &traceState{}, NewL3Policy())
+	c.Assert(l3, Not(IsNil))
+	c.Assert(l3.Ingress.IsPortRestricted("10.0.1.0/24"), Equals, true)
+
+	// Allowing the prefix on all ports lifts the restriction
+	c.Assert(l3.Ingress.Insert("10.0.1.0/24"), Equals, 0)
+	c.Assert(l3.Ingress.IsPortRestricted("10.0.1.0/24"), Equals, false)
+}
+
 func (ds *PolicyTestSuite) TestRuleCanReachFromEntity(c *C) {
 	fromWorld := &SearchContext{
 		From: labels.ParseSelectLabelArray("reserved:world"),
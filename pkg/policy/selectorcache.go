@@ -0,0 +1,167 @@
+// Copyright 2018 Authors of Cilium
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package policy
+
+import (
+	"sort"
+
+	"github.com/cilium/cilium/pkg/labels"
+	"github.com/cilium/cilium/pkg/lock"
+	"github.com/cilium/cilium/pkg/policy/api"
+)
+
+// selection is the set of identities selected by an endpoint selector
+type selection struct {
+	selector api.EndpointSelector
+
+	// users is the number of users which have added the selector
+	users int
+
+	identities map[NumericIdentity]struct{}
+}
+
+// SelectorCache caches the identities selected by the endpoint selectors in
+// use by the policy of local endpoints. The selections are updated whenever
+// an identity is added or removed so that the policy does not need to match
+// all selectors against all identities on every policy calculation.
+type SelectorCache struct {
+	mutex lock.RWMutex
+
+	// identities contains the labels of all known identities
+	identities map[NumericIdentity]labels.LabelArray
+
+	// selections maps the string representation of a selector to the
+	// identities it selects
+	selections map[string]*selection
+}
+
+// GetSelectorCache returns the selector cache. The identities of the cache
+// are kept in sync with the reserved and cluster identities of the
+// consumable cache.
+func GetSelectorCache() *SelectorCache {
+	return consumableCache.selectors
+}
+
+// NewSelectorCache returns a new empty selector cache
+func NewSelectorCache() *SelectorCache {
+	return &SelectorCache{
+		identities: map[NumericIdentity]labels.LabelArray{},
+		selections: map[string]*selection{},
+	}
+}
+
+func (sc *SelectorCache) selectLocked(selector api.EndpointSelector) map[NumericIdentity]struct{} {
+	selected := map[NumericIdentity]struct{}{}
+	for id, lbls := range sc.identities {
+		if selector.Matches(lbls) {
+			selected[id] = struct{}{}
+		}
+	}
+	return selected
+}
+
+// AddSelectors starts caching the identities selected by selectors. Each
+// call must be balanced by a call to RemoveSelectors once the selectors are
+// no longer in use.
+func (sc *SelectorCache) AddSelectors(selectors []api.EndpointSelector) {
+	sc.mutex.Lock()
+	defer sc.mutex.Unlock()
+
+	for _, selector := range selectors {
+		key := selector.String()
+		if sel, ok := sc.selections[key]; ok {
+			sel.users++
+			continue
+		}
+
+		sc.selections[key] = &selection{
+			selector:   selector,
+			users:      1,
+			identities: sc.selectLocked(selector),
+		}
+	}
+}
+
+// RemoveSelectors releases selectors previously added with AddSelectors.
+// Selectors without any remaining users are removed from the cache.
+func (sc *SelectorCache) RemoveSelectors(selectors []api.EndpointSelector) {
+	sc.mutex.Lock()
+	defer sc.mutex.Unlock()
+
+	for _, selector := range selectors {
+		key := selector.String()
+		if sel, ok := sc.selections[key]; ok {
+			sel.users--
+			if sel.users <= 0 {
+				delete(sc.selections, key)
+			}
+		}
+	}
+}
+
+// GetSelections returns the sorted list of identities selected by selector.
+// Selections of selectors which have not been added to the cache are
+// calculated on demand.
+func (sc *SelectorCache) GetSelections(selector api.EndpointSelector) []NumericIdentity {
+	sc.mutex.RLock()
+	defer sc.mutex.RUnlock()
+
+	var selected map[NumericIdentity]struct{}
+	if sel, ok := sc.selections[selector.String()]; ok {
+		selected = sel.identities
+	} else {
+		selected = sc.selectLocked(selector)
+	}
+
+	identities := make([]NumericIdentity, 0, len(selected))
+	for id := range selected {
+		identities = append(identities, id)
+	}
+	sort.Slice(identities, func(i, j int) bool {
+		return identities[i] < identities[j]
+	})
+
+	return identities
+}
+
+// UpsertIdentity adds the identity id with the labels lbls or updates its
+// labels and updates the selections of all cached selectors accordingly.
+func (sc *SelectorCache) UpsertIdentity(id NumericIdentity, lbls labels.LabelArray) {
+	sc.mutex.Lock()
+	defer sc.mutex.Unlock()
+
+	sc.identities[id] = lbls
+
+	for _, sel := range sc.selections {
+		if sel.selector.Matches(lbls) {
+			sel.identities[id] = struct{}{}
+		} else {
+			delete(sel.identities, id)
+		}
+	}
+}
+
+// RemoveIdentity removes the identity id from the selections of all cached
+// selectors.
+func (sc *SelectorCache) RemoveIdentity(id NumericIdentity) {
+	sc.mutex.Lock()
+	defer sc.mutex.Unlock()
+
+	delete(sc.identities, id)
+
+	for _, sel := range sc.selections {
+		delete(sel.identities, id)
+	}
+}
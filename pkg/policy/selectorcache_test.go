@@ -0,0 +1,56 @@
+// Copyright 2018 Authors of Cilium
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package policy
+
+import (
+	"github.com/cilium/cilium/pkg/labels"
+	"github.com/cilium/cilium/pkg/policy/api"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *PolicyTestSuite) TestSelectorCache(c *C) {
+	sc := NewSelectorCache()
+
+	fooSelector := api.NewESFromLabels(labels.ParseSelectLabel("foo"))
+	barSelector := api.NewESFromLabels(labels.ParseSelectLabel("bar"))
+
+	sc.UpsertIdentity(NumericIdentity(100), labels.ParseLabelArray("foo"))
+	sc.AddSelectors([]api.EndpointSelector{fooSelector, fooSelector, barSelector})
+	c.Assert(sc.GetSelections(fooSelector), DeepEquals, []NumericIdentity{100})
+	c.Assert(sc.GetSelections(barSelector), DeepEquals, []NumericIdentity{})
+
+	// Selections follow identities being added, changed and removed
+	sc.UpsertIdentity(NumericIdentity(200), labels.ParseLabelArray("foo", "bar"))
+	c.Assert(sc.GetSelections(fooSelector), DeepEquals, []NumericIdentity{100, 200})
+	c.Assert(sc.GetSelections(barSelector), DeepEquals, []NumericIdentity{200})
+
+	sc.UpsertIdentity(NumericIdentity(100), labels.ParseLabelArray("bar"))
+	c.Assert(sc.GetSelections(fooSelector), DeepEquals, []NumericIdentity{200})
+	c.Assert(sc.GetSelections(barSelector), DeepEquals, []NumericIdentity{100, 200})
+
+	sc.RemoveIdentity(NumericIdentity(200))
+	c.Assert(sc.GetSelections(fooSelector), DeepEquals, []NumericIdentity{})
+	c.Assert(sc.GetSelections(barSelector), DeepEquals, []NumericIdentity{100})
+
+	// The selector remains cached until all users have removed it
+	sc.RemoveSelectors([]api.EndpointSelector{fooSelector, barSelector})
+	c.Assert(sc.selections, HasLen, 1)
+	sc.RemoveSelectors([]api.EndpointSelector{fooSelector})
+	c.Assert(sc.selections, HasLen, 0)
+
+	// Selectors which are not cached are resolved on demand
+	c.Assert(sc.GetSelections(barSelector), DeepEquals, []NumericIdentity{100})
+}
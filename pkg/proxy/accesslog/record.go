@@ -45,6 +45,10 @@ const (
 
 	// VerdictError indicates that there was an error processing the flow
 	VerdictError = "Error"
+
+	// VerdictAudit indicates that the flow would have been denied but was
+	// forwarded as policy audit mode is enabled
+	VerdictAudit = "Audit"
 )
 
 // ObservationPoint is the type used to describe point of observation
@@ -264,22 +264,28 @@ func (k *kafkaRedirect) handleRequest(pair *connectionPair, req *kafka.RequestMe
 
 	record.fillInfo(k, addr.String(), dstIPPort, srcIdentity)
 
+	verdict, info := accesslog.VerdictForwarded, ""
 	if !k.canAccess(req, policy.NumericIdentity(srcIdentity)) {
-		scopedLog.Debug("Kafka request is denied by policy")
+		if !k.conf.source.PolicyAuditModeEnabled() {
+			scopedLog.Debug("Kafka request is denied by policy")
 
-		record.log(accesslog.TypeRequest, accesslog.VerdictDenied,
-			kafka.ErrTopicAuthorizationFailed, fmt.Sprint("Kafka request is denied by policy"))
+			record.log(accesslog.TypeRequest, accesslog.VerdictDenied,
+				kafka.ErrTopicAuthorizationFailed, fmt.Sprint("Kafka request is denied by policy"))
 
-		resp, err := req.CreateResponse(proto.ErrTopicAuthorizationFailed)
-		if err != nil {
-			scopedLog.WithError(err).Error("Unable to create response message")
-			record.log(accesslog.TypeRequest, accesslog.VerdictError,
-				kafka.ErrInvalidMessage, fmt.Sprintf("Unable to create response message: %s", err))
+			resp, err := req.CreateResponse(proto.ErrTopicAuthorizationFailed)
+			if err != nil {
+				scopedLog.WithError(err).Error("Unable to create response message")
+				record.log(accesslog.TypeRequest, accesslog.VerdictError,
+					kafka.ErrInvalidMessage, fmt.Sprintf("Unable to create response message: %s", err))
+				return
+			}
+
+			pair.rx.Enqueue(resp.GetRaw())
 			return
 		}
 
-		pair.rx.Enqueue(resp.GetRaw())
-		return
+		scopedLog.Debug("Kafka request is denied by policy, allowed in audit mode")
+		verdict, info = accesslog.VerdictAudit, "Kafka request is denied by policy, allowed in audit mode"
 	}
 
 	if pair.tx.Closed() {
@@ -309,7 +315,7 @@ func (k *kafkaRedirect) handleRequest(pair *connectionPair, req *kafka.RequestMe
 
 	scopedLog.Debug("Forwarding Kafka request")
 	// log valid request
-	record.log(accesslog.TypeRequest, accesslog.VerdictForwarded, kafka.ErrNone, "")
+	record.log(accesslog.TypeRequest, verdict, kafka.ErrNone, info)
 
 	// Write the entire raw request onto the outgoing connection
 	pair.tx.Enqueue(req.GetRaw())
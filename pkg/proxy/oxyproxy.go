@@ -204,21 +204,28 @@ func createOxyRedirect(l4 *policy.L4Filter, id string, source ProxySource, to ui
 		record.fillInfo(redir, req.RemoteAddr, dstIPPort, srcIdentity)
 
 		var info string
+		verdict := accesslog.VerdictForwarded
 		// Validate access to L4/L7 resource
 		redir.mutex.Lock()
 		if len(redir.rules) > 0 {
 			rule, _ := redir.router.Route(req)
 			if rule == nil {
-				http.Error(w, "Access denied", http.StatusForbidden)
-				redir.mutex.Unlock()
-				record.log(accesslog.TypeRequest, accesslog.VerdictDenied,
-					http.StatusForbidden, "")
-				return
+				if !redir.source.PolicyAuditModeEnabled() {
+					http.Error(w, "Access denied", http.StatusForbidden)
+					redir.mutex.Unlock()
+					record.log(accesslog.TypeRequest, accesslog.VerdictDenied,
+						http.StatusForbidden, "")
+					return
+				}
+				log.Debug("Allowing denied request in policy audit mode")
+				verdict = accesslog.VerdictAudit
+				info = "denied by policy, allowed in audit mode"
+			} else {
+				ar := rule.(string)
+				log.WithField(logfields.Object,
+					logfields.Repr(ar)).Debug("Allowing request based on rule")
+				info = fmt.Sprintf("rule: %+v", ar)
 			}
-			ar := rule.(string)
-			log.WithField(logfields.Object,
-				logfields.Repr(ar)).Debug("Allowing request based on rule")
-			info = fmt.Sprintf("rule: %+v", ar)
 		} else {
 			log.Debug("Allowing request as there are no rules")
 		}
@@ -228,7 +235,7 @@ func createOxyRedirect(l4 *policy.L4Filter, id string, source ProxySource, to ui
 		req.URL = generateURL(req.URL, dstIPPort)
 
 		// log valid request
-		record.log(accesslog.TypeRequest, accesslog.VerdictForwarded, http.StatusOK, info)
+		record.log(accesslog.TypeRequest, verdict, http.StatusOK, info)
 
 		ctx := req.Context()
 		if ctx != nil {
@@ -239,7 +246,7 @@ func createOxyRedirect(l4 *policy.L4Filter, id string, source ProxySource, to ui
 		fwd.ServeHTTP(w, req)
 
 		// log valid response
-		record.log(accesslog.TypeResponse, accesslog.VerdictForwarded, http.StatusOK, info)
+		record.log(accesslog.TypeResponse, verdict, http.StatusOK, info)
 	})
 
 	redir.server = manners.NewWithServer(&http.Server{
@@ -88,6 +88,7 @@ type ProxySource interface {
 	ResolveIdentity(policy.NumericIdentity) *policy.Identity
 	GetIPv4Address() string
 	GetIPv6Address() string
+	PolicyAuditModeEnabled() bool
 	RUnlock()
 }
 
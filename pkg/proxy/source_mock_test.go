@@ -27,6 +27,7 @@ type proxySourceMocker struct {
 	ipv6     string
 	labels   []string
 	identity policy.NumericIdentity
+	audit    bool
 }
 
 func (m *proxySourceMocker) RLock()   { m.RWMutex.RLock() }
@@ -37,6 +38,7 @@ func (m *proxySourceMocker) GetIPv4Address() string              { return m.ipv4
 func (m *proxySourceMocker) GetIPv6Address() string              { return m.ipv6 }
 func (m *proxySourceMocker) GetLabels() []string                 { return m.labels }
 func (m *proxySourceMocker) GetIdentity() policy.NumericIdentity { return m.identity }
+func (m *proxySourceMocker) PolicyAuditModeEnabled() bool        { return m.audit }
 
 func (m *proxySourceMocker) GetLabelsSHA() string {
 	return labels.NewLabelsFromModel(m.labels).SHA256Sum()
@@ -29,7 +29,6 @@ import (
 	"github.com/cilium/cilium/pkg/endpointmanager"
 	"github.com/cilium/cilium/pkg/ipam"
 	"github.com/cilium/cilium/pkg/k8s"
-	k8sconst "github.com/cilium/cilium/pkg/k8s/apis/cilium.io"
 	"github.com/cilium/cilium/pkg/labels"
 	"github.com/cilium/cilium/pkg/logfields"
 	"github.com/cilium/cilium/pkg/node"
@@ -194,12 +193,17 @@ func fetchK8sLabels(dockerLbls map[string]string) (map[string]string, error) {
 	if err != nil {
 		return nil, err
 	}
-	k8sLabels := result.GetLabels()
-	if k8sLabels == nil {
-		return nil, nil
+
+	// The labels of the namespace are part of the identity. If they
+	// cannot be retrieved, the namespace watcher will update the identity
+	// on the next resync of the namespace.
+	namespace, err := k8s.Client().CoreV1().Namespaces().Get(ns, metav1.GetOptions{})
+	if err != nil {
+		log.WithError(err).WithField(logfields.K8sNamespace, ns).Warn("Unable to retrieve labels of namespace")
+		namespace = nil
 	}
-	k8sLabels[k8sconst.PodNamespaceLabel] = ns
-	return k8sLabels, nil
+
+	return k8s.GetPodLabels(result, namespace), nil
 }
 
 func getFilteredLabels(allLabels map[string]string) (identityLabels, informationLabels labels.Labels) {
@@ -357,7 +361,7 @@ func IgnoreRunningContainers() {
 		if cIP == nil {
 			continue
 		}
-		if err := ipam.AllocateIP(cIP.IP()); err != nil {
+		if err := ipam.ClaimIP(cIP.IP(), "container:"+cont.ID); err != nil {
 			continue
 		}
 		// TODO Release this address when the ignored container leaves
@@ -0,0 +1,234 @@
+// Copyright 2018 Authors of Cilium
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+
+	"github.com/cilium/cilium/api/v1/models"
+	"github.com/cilium/cilium/common/addressing"
+	"github.com/cilium/cilium/pkg/client"
+	"github.com/cilium/cilium/pkg/logfields"
+
+	"github.com/containernetworking/cni/pkg/ns"
+	"github.com/containernetworking/cni/pkg/skel"
+	cniTypesVer "github.com/containernetworking/cni/pkg/types/current"
+	"github.com/sirupsen/logrus"
+	"github.com/vishvananda/netlink"
+)
+
+const (
+	// chainingModeGenericVeth attaches to the veth pair created by the
+	// previous plugin in the chain
+	chainingModeGenericVeth = "generic-veth"
+)
+
+// isChained returns true if the plugin runs chained on top of another plugin
+func (n *netConf) isChained() bool {
+	return n.ChainingMode != ""
+}
+
+// parsePrevResult returns the result of the previous plugin in the chain
+func (n *netConf) parsePrevResult() (*cniTypesVer.Result, error) {
+	if n.RawPrevResult == nil {
+		return nil, fmt.Errorf("chaining mode %q requires a prevResult", n.ChainingMode)
+	}
+
+	resultBytes, err := json.Marshal(n.RawPrevResult)
+	if err != nil {
+		return nil, fmt.Errorf("unable to serialize prevResult: %s", err)
+	}
+
+	res, err := parseResult(n.CNIVersion, resultBytes)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse prevResult: %s", err)
+	}
+
+	return res, nil
+}
+
+// chainedInterface is the interface created by the previous plugin in the
+// chain
+type chainedInterface struct {
+	// mac is the MAC address of the interface in the container
+	mac string
+
+	// peerIndex is the index of the host side peer of the interface
+	peerIndex int
+}
+
+// lookupChainedInterface returns the veth interface ifName created in netNs
+// by the previous plugin in the chain
+func lookupChainedInterface(netNs ns.NetNS, ifName string) (*chainedInterface, error) {
+	var iface *chainedInterface
+
+	err := netNs.Do(func(_ ns.NetNS) error {
+		link, err := netlink.LinkByName(ifName)
+		if err != nil {
+			return fmt.Errorf("unable to lookup %q: %s", ifName, err)
+		}
+
+		if _, ok := link.(*netlink.Veth); !ok {
+			return fmt.Errorf("interface %q is of type %q, chaining mode %q requires a veth",
+				ifName, link.Type(), chainingModeGenericVeth)
+		}
+
+		// The link of a veth interface refers to its peer
+		if link.Attrs().ParentIndex == 0 {
+			return fmt.Errorf("unable to determine peer of veth %q", ifName)
+		}
+
+		iface = &chainedInterface{
+			mac:       link.Attrs().HardwareAddr.String(),
+			peerIndex: link.Attrs().ParentIndex,
+		}
+		return nil
+	})
+
+	return iface, err
+}
+
+// cmdAddChained creates an endpoint for the interface and addresses
+// configured by the previous plugin in the chain. The host side of the veth
+// pair is used as endpoint device so the policy is enforced on it. The result
+// of the previous plugin is passed on unmodified.
+func cmdAddChained(args *skel.CmdArgs, n *netConf, c *client.Client, ep *models.EndpointChangeRequest) (err error) {
+	if n.ChainingMode != chainingModeGenericVeth {
+		return fmt.Errorf("unsupported chaining mode %q", n.ChainingMode)
+	}
+
+	prevResult, err := n.parsePrevResult()
+	if err != nil {
+		return err
+	}
+
+	netNs, err := ns.GetNS(args.Netns)
+	if err != nil {
+		return fmt.Errorf("failed to open netns %q: %s", args.Netns, err)
+	}
+	defer netNs.Close()
+
+	iface, err := lookupChainedInterface(netNs, args.IfName)
+	if err != nil {
+		return err
+	}
+
+	hostLink, err := netlink.LinkByIndex(iface.peerIndex)
+	if err != nil {
+		return fmt.Errorf("unable to lookup host side of veth %q: %s", args.IfName, err)
+	}
+
+	ep.Mac = iface.mac
+	ep.HostMac = hostLink.Attrs().HardwareAddr.String()
+	ep.InterfaceIndex = int64(hostLink.Attrs().Index)
+	ep.InterfaceName = hostLink.Attrs().Name
+
+	for _, ipConfig := range prevResult.IPs {
+		switch ipConfig.Version {
+		case "4":
+			ep.Addressing.IPV4 = ipConfig.Address.IP.String()
+		case "6":
+			ep.Addressing.IPV6 = ipConfig.Address.IP.String()
+		}
+	}
+
+	// The endpoint ID is allocated by the agent as an address of the node
+	// prefix, IDs derived from addresses of the previous plugin may
+	// collide. The address is not configured in the container, it is only
+	// used as the IPv6 address of the endpoint if the previous plugin did
+	// not configure one.
+	ipam, err := c.IPAMAllocate("ipv6", "", ipamOwner(ep))
+	if err != nil {
+		return fmt.Errorf("unable to allocate endpoint ID: %s", err)
+	}
+	if ipam.Endpoint == nil || ipam.Endpoint.IPV6 == "" {
+		return fmt.Errorf("Invalid IPAM response, missing IPv6 address")
+	}
+	idAddr := ipam.Endpoint.IPV6
+
+	defer func() {
+		if err != nil {
+			releaseIP(c, idAddr)
+		}
+	}()
+
+	ip6, err := addressing.NewCiliumIPv6(idAddr)
+	if err != nil {
+		return err
+	}
+	ep.ID = int64(ip6.EndpointID())
+
+	if ep.Addressing.IPV6 == "" {
+		ep.Addressing.IPV6 = idAddr
+	}
+
+	log.WithFields(logrus.Fields{
+		logfields.EndpointID: ep.ID,
+		logfields.Interface:  ep.InterfaceName,
+		logfields.IPAddr:     []string{ep.Addressing.IPV4, ep.Addressing.IPV6},
+	}).Debug("Attaching to interface of previous plugin")
+
+	if err = c.EndpointCreate(ep); err != nil {
+		return fmt.Errorf("Unable to create endpoint: %s", err)
+	}
+
+	return printResult(prevResult, n.CNIVersion)
+}
+
+// chainedIDAddress returns the address of the node prefix allocRange which
+// identifies the chained endpoint with the given ID
+func chainedIDAddress(allocRange string, id int64) (net.IP, error) {
+	_, prefix, err := net.ParseCIDR(allocRange)
+	if err != nil {
+		return nil, fmt.Errorf("invalid allocation range %q: %s", allocRange, err)
+	}
+
+	ones, bits := prefix.Mask.Size()
+	if bits != net.IPv6len*8 || ones > bits-16 {
+		return nil, fmt.Errorf("allocation range %s is too small to hold endpoint IDs", allocRange)
+	}
+
+	ip := make(net.IP, net.IPv6len)
+	copy(ip, prefix.IP)
+	ip[14], ip[15] = byte(id>>8), byte(id)
+	return ip, nil
+}
+
+// releaseChainedIPs releases the address allocated by cmdAddChained to
+// identify the chained endpoint with the given ID. The addresses of the
+// endpoint assigned by the previous plugin in the chain are owned by it and
+// are never released.
+func releaseChainedIPs(c *client.Client, id int64) {
+	cfg, err := c.ConfigGet()
+	if err != nil {
+		log.WithError(err).Warn("Unable to retrieve agent configuration, not releasing endpoint ID")
+		return
+	}
+
+	if cfg.Addressing == nil || cfg.Addressing.IPV6 == nil {
+		log.Warn("Agent configuration lacks IPv6 addressing, not releasing endpoint ID")
+		return
+	}
+
+	ip, err := chainedIDAddress(cfg.Addressing.IPV6.AllocRange, id)
+	if err != nil {
+		log.WithError(err).Warn("Unable to determine address of endpoint ID")
+		return
+	}
+
+	releaseIP(c, ip.String())
+}
@@ -0,0 +1,70 @@
+// Copyright 2018 Authors of Cilium
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net"
+
+	"github.com/cilium/cilium/common/addressing"
+
+	cniTypes "github.com/containernetworking/cni/pkg/types"
+	. "gopkg.in/check.v1"
+)
+
+func (s *CNISuite) TestIsChained(c *C) {
+	c.Assert((&netConf{}).isChained(), Equals, false)
+	c.Assert((&netConf{ChainingMode: chainingModeGenericVeth}).isChained(), Equals, true)
+}
+
+func (s *CNISuite) TestParsePrevResult(c *C) {
+	n := prevResultConf(c, "0.3.1", "10.0.0.2")
+	n.ChainingMode = chainingModeGenericVeth
+	res, err := n.parsePrevResult()
+	c.Assert(err, IsNil)
+	c.Assert(len(res.IPs), Equals, 1)
+	c.Assert(res.IPs[0].Address.IP.Equal(net.ParseIP("10.0.0.2")), Equals, true)
+
+	// Chaining requires the result of the previous plugin
+	n = &netConf{
+		NetConf:      cniTypes.NetConf{CNIVersion: "0.3.1"},
+		ChainingMode: chainingModeGenericVeth,
+	}
+	_, err = n.parsePrevResult()
+	c.Assert(err, Not(IsNil))
+}
+
+func (s *CNISuite) TestChainedIDAddress(c *C) {
+	for _, id := range []int64{1, 0x1234, 0xffff} {
+		ip, err := chainedIDAddress("f00d::ac10:14:0:0/112", id)
+		c.Assert(err, IsNil)
+
+		// The address maps back to the endpoint ID
+		ip6, err := addressing.NewCiliumIPv6(ip.String())
+		c.Assert(err, IsNil)
+		c.Assert(int64(ip6.EndpointID()), Equals, id)
+
+		_, prefix, err := net.ParseCIDR("f00d::ac10:14:0:0/112")
+		c.Assert(err, IsNil)
+		c.Assert(prefix.Contains(ip), Equals, true)
+	}
+
+	// The allocation range must hold 16 bit endpoint IDs
+	_, err := chainedIDAddress("f00d::ac10:14:0:0/120", 1)
+	c.Assert(err, Not(IsNil))
+	_, err = chainedIDAddress("10.0.0.0/8", 1)
+	c.Assert(err, Not(IsNil))
+	_, err = chainedIDAddress("invalid", 1)
+	c.Assert(err, Not(IsNil))
+}
@@ -0,0 +1,348 @@
+// Copyright 2018 Authors of Cilium
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+
+	endpointClient "github.com/cilium/cilium/api/v1/client/endpoint"
+	"github.com/cilium/cilium/api/v1/models"
+	"github.com/cilium/cilium/common/plugins"
+	"github.com/cilium/cilium/pkg/client"
+	"github.com/cilium/cilium/pkg/endpoint"
+
+	"github.com/containernetworking/cni/pkg/ns"
+	"github.com/containernetworking/cni/pkg/skel"
+	cniTypes "github.com/containernetworking/cni/pkg/types"
+	cniTypesVer "github.com/containernetworking/cni/pkg/types/current"
+	"github.com/containernetworking/cni/pkg/version"
+	"github.com/vishvananda/netlink"
+)
+
+const (
+	// cniVersion040 is the CNI spec version introducing the CHECK command.
+	// Results of version 0.4.0 are identical to results of version 0.3.1.
+	cniVersion040 = "0.4.0"
+
+	// Well known CNI error codes introduced with version 0.4.0
+	errUnknownContainer = 3
+	errInvalidEnvVars   = 4
+	errIOFailure        = 5
+	errDecodingFailure  = 6
+)
+
+// supportedVersions are the CNI spec versions supported by the plugin
+var supportedVersions = version.PluginSupports("0.1.0", "0.2.0", "0.3.0", "0.3.1", cniVersion040)
+
+// newCNIError returns a CNI error with the given code
+func newCNIError(code uint, format string, args ...interface{}) *cniTypes.Error {
+	return &cniTypes.Error{
+		Code: code,
+		Msg:  fmt.Sprintf(format, args...),
+	}
+}
+
+// printResult prints the result in the format of cniVersion
+func printResult(res cniTypes.Result, cniVersion string) error {
+	if cniVersion != cniVersion040 {
+		return cniTypes.PrintResult(res, cniVersion)
+	}
+
+	res031, err := res.GetAsVersion("0.3.1")
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(res031)
+	if err != nil {
+		return err
+	}
+
+	result := map[string]interface{}{}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return err
+	}
+	result["cniVersion"] = cniVersion040
+
+	data, err = json.MarshalIndent(result, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	_, err = os.Stdout.Write(data)
+	return err
+}
+
+// parseResult parses a result in the format of cniVersion
+func parseResult(cniVersion string, data []byte) (*cniTypesVer.Result, error) {
+	if cniVersion == cniVersion040 {
+		res, err := cniTypesVer.NewResult(data)
+		if err != nil {
+			return nil, err
+		}
+		return cniTypesVer.GetResult(res)
+	}
+
+	res, err := version.NewResult(cniVersion, data)
+	if err != nil {
+		return nil, err
+	}
+
+	return cniTypesVer.NewResultFromResult(res)
+}
+
+// checkMain runs the CNI CHECK command. The command is dispatched outside of
+// skel.PluginMain as it predates the CHECK command.
+func checkMain() {
+	if err := runCheck(); err != nil {
+		e, ok := err.(*cniTypes.Error)
+		if !ok {
+			e = newCNIError(100, "%s", err)
+		}
+		if err := e.Print(); err != nil {
+			log.WithError(err).Warn("Error writing error JSON to stdout")
+		}
+		os.Exit(1)
+	}
+}
+
+// runCheck reads the arguments of the CHECK command from the environment
+// and stdin and calls cmdCheck
+func runCheck() error {
+	args := &skel.CmdArgs{
+		ContainerID: os.Getenv("CNI_CONTAINERID"),
+		Netns:       os.Getenv("CNI_NETNS"),
+		IfName:      os.Getenv("CNI_IFNAME"),
+		Args:        os.Getenv("CNI_ARGS"),
+		Path:        os.Getenv("CNI_PATH"),
+	}
+
+	for name, val := range map[string]string{
+		"CNI_CONTAINERID": args.ContainerID,
+		"CNI_NETNS":       args.Netns,
+		"CNI_IFNAME":      args.IfName,
+		"CNI_PATH":        args.Path,
+	} {
+		if val == "" {
+			return newCNIError(errInvalidEnvVars, "%s env variable missing", name)
+		}
+	}
+
+	stdinData, err := ioutil.ReadAll(os.Stdin)
+	if err != nil {
+		return newCNIError(errIOFailure, "error reading from stdin: %s", err)
+	}
+	args.StdinData = stdinData
+
+	confVersion, err := (&version.ConfigDecoder{}).Decode(stdinData)
+	if err != nil {
+		return newCNIError(errDecodingFailure, "%s", err)
+	}
+
+	if confVersion != cniVersion040 {
+		return &cniTypes.Error{
+			Code:    cniTypes.ErrIncompatibleCNIVersion,
+			Msg:     "incompatible CNI versions",
+			Details: fmt.Sprintf("the CHECK command requires version %s, config has version %s", cniVersion040, confVersion),
+		}
+	}
+
+	return cmdCheck(args)
+}
+
+// cmdCheck verifies that the endpoint of the container exists in the agent
+// and is ready, and that the interface, addresses and routes in the network
+// namespace of the container match the addressing of the endpoint.
+func cmdCheck(args *skel.CmdArgs) error {
+	log.WithField("args", args).Debug("Processing CNI CHECK request")
+
+	n, _, err := loadNetConf(args.StdinData)
+	if err != nil {
+		return newCNIError(errDecodingFailure, "%s", err)
+	}
+
+	c, err := client.NewDefaultClient()
+	if err != nil {
+		return fmt.Errorf("unable to connect to Cilium daemon: %s", err)
+	}
+
+	id := endpoint.NewID(endpoint.ContainerIdPrefix, args.ContainerID)
+	ep, err := c.EndpointGet(id)
+	if err != nil {
+		if _, ok := err.(*endpointClient.GetEndpointIDNotFound); !ok {
+			return fmt.Errorf("unable to retrieve endpoint %s from the agent: %s", id, client.Hint(err))
+		}
+	}
+	if ep == nil {
+		return newCNIError(errUnknownContainer, "endpoint %s of container is unknown to the agent", id)
+	}
+
+	if ep.State != models.EndpointStateReady {
+		return fmt.Errorf("endpoint %s is in state %q instead of %q", id, ep.State, models.EndpointStateReady)
+	}
+
+	if ep.Addressing == nil {
+		return fmt.Errorf("endpoint %s has no addressing", id)
+	}
+
+	if _, err := netlink.LinkByName(ep.InterfaceName); err != nil {
+		return fmt.Errorf("host interface %q of endpoint %s not found: %s", ep.InterfaceName, id, err)
+	}
+
+	ips := []string{}
+	if ep.Addressing.IPV4 != "" {
+		ips = append(ips, ep.Addressing.IPV4)
+	}
+	if ep.Addressing.IPV6 != "" && !n.isChained() {
+		// In chaining mode, the IPv6 address may only be used to
+		// identify the endpoint and is not configured in the container
+		ips = append(ips, ep.Addressing.IPV6)
+	}
+
+	if n.RawPrevResult != nil {
+		if err := checkPrevResult(n, ips); err != nil {
+			return err
+		}
+	}
+
+	var routes []plugins.Route
+	if !n.isChained() {
+		// Routes of chained endpoints are owned by the previous plugin
+		cfg, err := c.ConfigGet()
+		if err != nil {
+			return fmt.Errorf("unable to retrieve agent configuration: %s", err)
+		}
+
+		if ep.Addressing.IPV4 != "" {
+			r, err := plugins.IPv4Routes(cfg.Addressing)
+			if err != nil {
+				return err
+			}
+			routes = append(routes, r...)
+		}
+
+		r, err := plugins.IPv6Routes(cfg.Addressing)
+		if err != nil {
+			return err
+		}
+		routes = append(routes, r...)
+	}
+
+	return ns.WithNetNSPath(args.Netns, func(_ ns.NetNS) error {
+		return checkInterface(args.IfName, ips, routes)
+	})
+}
+
+// checkPrevResult verifies that all ips are part of the result of the
+// previous invocation of the plugin
+func checkPrevResult(n *netConf, ips []string) error {
+	data, err := json.Marshal(n.RawPrevResult)
+	if err != nil {
+		return newCNIError(errDecodingFailure, "unable to serialize prevResult: %s", err)
+	}
+
+	prevResult, err := parseResult(n.CNIVersion, data)
+	if err != nil {
+		return newCNIError(errDecodingFailure, "unable to parse prevResult: %s", err)
+	}
+
+	for _, ip := range ips {
+		found := false
+		for _, ipConfig := range prevResult.IPs {
+			if ipConfig.Address.IP.Equal(net.ParseIP(ip)) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("address %s of endpoint is not part of prevResult", ip)
+		}
+	}
+
+	return nil
+}
+
+// checkInterface verifies that the interface ifName is up, carries all ips
+// and has all routes installed. Must be called in the network namespace of
+// the container.
+func checkInterface(ifName string, ips []string, routes []plugins.Route) error {
+	link, err := netlink.LinkByName(ifName)
+	if err != nil {
+		return fmt.Errorf("interface %q not found: %s", ifName, err)
+	}
+
+	if link.Attrs().Flags&net.FlagUp == 0 {
+		return fmt.Errorf("interface %q is down", ifName)
+	}
+
+	addrs, err := netlink.AddrList(link, netlink.FAMILY_ALL)
+	if err != nil {
+		return fmt.Errorf("unable to list addresses of %q: %s", ifName, err)
+	}
+
+	for _, ip := range ips {
+		found := false
+		for _, addr := range addrs {
+			if addr.IP.Equal(net.ParseIP(ip)) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("address %s not configured on %q", ip, ifName)
+		}
+	}
+
+	for _, r := range routes {
+		family := netlink.FAMILY_V4
+		if r.Prefix.IP.To4() == nil {
+			family = netlink.FAMILY_V6
+		}
+
+		installed, err := netlink.RouteList(link, family)
+		if err != nil {
+			return fmt.Errorf("unable to list routes of %q: %s", ifName, err)
+		}
+
+		if !hasRoute(installed, r) {
+			return fmt.Errorf("route '%s via %v' missing on %q", r.Prefix.String(), r.Nexthop, ifName)
+		}
+	}
+
+	return nil
+}
+
+// hasRoute returns true if route r is part of installed
+func hasRoute(installed []netlink.Route, r plugins.Route) bool {
+	for _, rt := range installed {
+		if rt.Dst == nil {
+			// Default route
+			if ones, _ := r.Prefix.Mask.Size(); ones != 0 {
+				continue
+			}
+		} else if rt.Dst.String() != r.Prefix.String() {
+			continue
+		}
+
+		if r.Nexthop == nil || rt.Gw.Equal(*r.Nexthop) {
+			return true
+		}
+	}
+	return false
+}
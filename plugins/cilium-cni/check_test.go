@@ -0,0 +1,149 @@
+// Copyright 2018 Authors of Cilium
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"os"
+	"testing"
+
+	"github.com/cilium/cilium/common/plugins"
+
+	cniTypes "github.com/containernetworking/cni/pkg/types"
+	cniTypesVer "github.com/containernetworking/cni/pkg/types/current"
+	"github.com/vishvananda/netlink"
+	. "gopkg.in/check.v1"
+)
+
+// Hook up gocheck into the "go test" runner.
+func Test(t *testing.T) { TestingT(t) }
+
+type CNISuite struct{}
+
+var _ = Suite(&CNISuite{})
+
+func mustParseCIDR(c *C, s string) *net.IPNet {
+	_, n, err := net.ParseCIDR(s)
+	c.Assert(err, IsNil)
+	return n
+}
+
+func (s *CNISuite) TestHasRoute(c *C) {
+	gw := net.ParseIP("10.0.0.1")
+	installed := []netlink.Route{
+		{Dst: mustParseCIDR(c, "10.0.0.1/32")},
+		{Dst: nil, Gw: gw},
+	}
+
+	c.Assert(hasRoute(installed, plugins.Route{Prefix: *mustParseCIDR(c, "10.0.0.1/32")}), Equals, true)
+	c.Assert(hasRoute(installed, plugins.Route{Prefix: *mustParseCIDR(c, "0.0.0.0/0"), Nexthop: &gw}), Equals, true)
+
+	// Prefix or nexthop differ
+	otherGw := net.ParseIP("10.0.0.2")
+	c.Assert(hasRoute(installed, plugins.Route{Prefix: *mustParseCIDR(c, "0.0.0.0/0"), Nexthop: &otherGw}), Equals, false)
+	c.Assert(hasRoute(installed, plugins.Route{Prefix: *mustParseCIDR(c, "10.0.0.2/32")}), Equals, false)
+
+	// The default route only matches a zero length prefix
+	c.Assert(hasRoute([]netlink.Route{{Gw: gw}}, plugins.Route{Prefix: *mustParseCIDR(c, "10.0.0.0/8"), Nexthop: &gw}), Equals, false)
+	c.Assert(hasRoute(nil, plugins.Route{Prefix: *mustParseCIDR(c, "10.0.0.1/32")}), Equals, false)
+}
+
+func prevResultConf(c *C, cniVersion string, ips ...string) *netConf {
+	res := &cniTypesVer.Result{}
+	for _, ip := range ips {
+		addr := net.IPNet{IP: net.ParseIP(ip), Mask: net.CIDRMask(32, 32)}
+		if addr.IP.To4() == nil {
+			addr.Mask = net.CIDRMask(128, 128)
+		}
+		res.IPs = append(res.IPs, &cniTypesVer.IPConfig{Address: addr})
+	}
+
+	data, err := json.Marshal(res)
+	c.Assert(err, IsNil)
+
+	n := &netConf{NetConf: cniTypes.NetConf{CNIVersion: cniVersion}}
+	c.Assert(json.Unmarshal(data, &n.RawPrevResult), IsNil)
+	return n
+}
+
+func (s *CNISuite) TestCheckPrevResult(c *C) {
+	for _, cniVersion := range []string{"0.3.1", cniVersion040} {
+		n := prevResultConf(c, cniVersion, "10.0.0.2", "f00d::1")
+
+		c.Assert(checkPrevResult(n, nil), IsNil)
+		c.Assert(checkPrevResult(n, []string{"10.0.0.2", "f00d::1"}), IsNil)
+		c.Assert(checkPrevResult(n, []string{"10.0.0.3"}), Not(IsNil))
+	}
+
+	// Unparseable results are decoding failures
+	n := &netConf{
+		NetConf:       cniTypes.NetConf{CNIVersion: "0.3.1"},
+		RawPrevResult: map[string]interface{}{"ips": "invalid"},
+	}
+	err := checkPrevResult(n, []string{"10.0.0.2"})
+	c.Assert(err, Not(IsNil))
+	cniErr, ok := err.(*cniTypes.Error)
+	c.Assert(ok, Equals, true)
+	c.Assert(cniErr.Code, Equals, uint(errDecodingFailure))
+}
+
+// capturePrintResult returns the output of printResult
+func capturePrintResult(c *C, res cniTypes.Result, cniVersion string) map[string]interface{} {
+	r, w, err := os.Pipe()
+	c.Assert(err, IsNil)
+	defer r.Close()
+
+	stdout := os.Stdout
+	os.Stdout = w
+	err = printResult(res, cniVersion)
+	os.Stdout = stdout
+	w.Close()
+	c.Assert(err, IsNil)
+
+	data, err := ioutil.ReadAll(r)
+	c.Assert(err, IsNil)
+
+	result := map[string]interface{}{}
+	c.Assert(json.Unmarshal(data, &result), IsNil)
+	return result
+}
+
+func (s *CNISuite) TestPrintResult(c *C) {
+	res := &cniTypesVer.Result{
+		IPs: []*cniTypesVer.IPConfig{{
+			Version: "4",
+			Address: net.IPNet{IP: net.ParseIP("10.0.0.2"), Mask: net.CIDRMask(32, 32)},
+		}},
+	}
+
+	// Version 0.4.0 results are printed as 0.3.1 results
+	result := capturePrintResult(c, res, cniVersion040)
+	c.Assert(result["cniVersion"], Equals, cniVersion040)
+	ips, ok := result["ips"].([]interface{})
+	c.Assert(ok, Equals, true)
+	c.Assert(len(ips), Equals, 1)
+	c.Assert(ips[0].(map[string]interface{})["address"], Equals, "10.0.0.2/32")
+
+	result = capturePrintResult(c, res, "0.3.1")
+	c.Assert(len(result["ips"].([]interface{})), Equals, 1)
+
+	// Older versions are converted by the CNI library
+	result = capturePrintResult(c, res, "0.2.0")
+	ip4, ok := result["ip4"].(map[string]interface{})
+	c.Assert(ok, Equals, true)
+	c.Assert(ip4["ip"], Equals, "10.0.0.2/32")
+}
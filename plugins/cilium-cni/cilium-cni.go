@@ -36,7 +36,6 @@ import (
 	"github.com/containernetworking/cni/pkg/skel"
 	cniTypes "github.com/containernetworking/cni/pkg/types"
 	cniTypesVer "github.com/containernetworking/cni/pkg/types/current"
-	"github.com/containernetworking/cni/pkg/version"
 	"github.com/sirupsen/logrus"
 	"github.com/vishvananda/netlink"
 )
@@ -62,8 +61,18 @@ type CmdState struct {
 
 type netConf struct {
 	cniTypes.NetConf
-	MTU  int  `json:"mtu"`
-	Args Args `json:"args"`
+	MTU           int                    `json:"mtu"`
+	IPAMPool      string                 `json:"ipam-pool,omitempty"`
+	ChainingMode  string                 `json:"chaining-mode,omitempty"`
+	RawPrevResult map[string]interface{} `json:"prevResult,omitempty"`
+	Args          Args                   `json:"args"`
+}
+
+// k8sArgs contains the pod information passed by kubelet in CNI_ARGS
+type k8sArgs struct {
+	cniTypes.CommonArgs
+	K8S_POD_NAME      cniTypes.UnmarshallableString
+	K8S_POD_NAMESPACE cniTypes.UnmarshallableString
 }
 
 // Args contains arbitrary information a scheduler
@@ -89,7 +98,12 @@ type NetworkInfo struct {
 }
 
 func main() {
-	skel.PluginMain(cmdAdd, cmdDel, version.All)
+	if os.Getenv("CNI_COMMAND") == "CHECK" {
+		checkMain()
+		return
+	}
+
+	skel.PluginMain(cmdAdd, cmdDel, supportedVersions)
 }
 
 func IPv6IsEnabled(ipam *models.IPAM) bool {
@@ -294,6 +308,17 @@ func prepareIP(ipAddr string, isIPv6 bool, state *CmdState) (*cniTypesVer.IPConf
 	}, rt, nil
 }
 
+// ipamOwner returns the owner of the addresses allocated for the endpoint.
+// The pod in the form namespace/pod allows the daemon to select the IP pool
+// based on the annotations of the pod. Without Kubernetes, the container
+// owns the addresses.
+func ipamOwner(ep *models.EndpointChangeRequest) string {
+	if ep.K8sPodName != "" {
+		return ep.K8sNamespace + "/" + ep.K8sPodName
+	}
+	return "container:" + ep.ContainerID
+}
+
 func cmdAdd(args *skel.CmdArgs) error {
 	log.WithField("args", args).Debug("Processing CNI ADD request")
 
@@ -307,17 +332,6 @@ func cmdAdd(args *skel.CmdArgs) error {
 		return fmt.Errorf("unable to connect to Cilium daemon: %s", err)
 	}
 
-	netNs, err := ns.GetNS(args.Netns)
-	if err != nil {
-		return fmt.Errorf("failed to open netns %q: %s", args.Netns, err)
-	}
-	defer netNs.Close()
-
-	if err := removeIfFromNSIfExists(netNs, args.IfName); err != nil {
-		return fmt.Errorf("failed removing interface %q from namespace %q: %s",
-			args.IfName, args.Netns, err)
-	}
-
 	addLabels := models.Labels{}
 
 	for _, label := range n.Args.Mesos.NetworkInfo.Labels.Labels {
@@ -331,6 +345,29 @@ func cmdAdd(args *skel.CmdArgs) error {
 		Addressing:  &models.EndpointAddressing{},
 	}
 
+	// The pod allows the daemon to apply the annotations of the pod to
+	// the endpoint when creating it
+	cniArgs := k8sArgs{}
+	if err := cniTypes.LoadArgs(args.Args, &cniArgs); err == nil && cniArgs.K8S_POD_NAME != "" {
+		ep.K8sPodName = string(cniArgs.K8S_POD_NAME)
+		ep.K8sNamespace = string(cniArgs.K8S_POD_NAMESPACE)
+	}
+
+	if n.isChained() {
+		return cmdAddChained(args, n, client, ep)
+	}
+
+	netNs, err := ns.GetNS(args.Netns)
+	if err != nil {
+		return fmt.Errorf("failed to open netns %q: %s", args.Netns, err)
+	}
+	defer netNs.Close()
+
+	if err := removeIfFromNSIfExists(netNs, args.IfName); err != nil {
+		return fmt.Errorf("failed removing interface %q from namespace %q: %s",
+			args.IfName, args.Netns, err)
+	}
+
 	veth, peer, tmpIfName, err := plugins.SetupVeth(ep.ContainerID, n.MTU, ep)
 	if err != nil {
 		return err
@@ -355,7 +392,7 @@ func cmdAdd(args *skel.CmdArgs) error {
 		return nil
 	})
 
-	ipam, err := client.IPAMAllocate("")
+	ipam, err := client.IPAMAllocate("", n.IPAMPool, ipamOwner(ep))
 	if err != nil {
 		return err
 	}
@@ -431,12 +468,17 @@ func cmdAdd(args *skel.CmdArgs) error {
 		return fmt.Errorf("Unable to create endpoint: %s", err)
 	}
 
-	return cniTypes.PrintResult(res, cniVersion)
+	return printResult(res, cniVersion)
 }
 
 func cmdDel(args *skel.CmdArgs) error {
 	log.WithField("args", args).Debug("Processing CNI DEL request")
 
+	n, _, err := loadNetConf(args.StdinData)
+	if err != nil {
+		return err
+	}
+
 	client, err := client.NewDefaultClient()
 	if err != nil {
 		return fmt.Errorf("unable to connect to Cilium daemon: %s", err)
@@ -450,6 +492,8 @@ func cmdDel(args *skel.CmdArgs) error {
 	} else if ep == nil {
 		log.WithError(err).WithField(logfields.EndpointID, id).Debug("Agent is not aware of endpoint")
 		return nil
+	} else if n.isChained() {
+		releaseChainedIPs(client, ep.ID)
 	} else {
 		releaseIPs(client, ep.Addressing)
 	}
@@ -458,6 +502,11 @@ func cmdDel(args *skel.CmdArgs) error {
 		log.WithError(err).Warn("Deletion of endpoint failed")
 	}
 
+	// The interface is owned by the previous plugin in the chain
+	if n.isChained() {
+		return nil
+	}
+
 	return ns.WithNetNSPath(args.Netns, func(_ ns.NetNS) error {
 		return plugins.DelLinkByName(args.IfName)
 	})
@@ -18,6 +18,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strings"
 
 	"github.com/cilium/cilium/pkg/client"
 	"github.com/cilium/cilium/pkg/logfields"
@@ -29,8 +30,22 @@ import (
 const (
 	PoolIPv4 = "CiliumPoolv4"
 	PoolIPv6 = "CiliumPoolv6"
+
+	// OptionIPAMPool is the IPAM option selecting the Cilium IP pool
+	// addresses are allocated from, e.g. --ipam-opt io.cilium.ipam.pool=routable
+	OptionIPAMPool = "io.cilium.ipam.pool"
+
+	// ipamOwner is the owner of all addresses allocated by the plugin.
+	// Docker does not pass the container to the IPAM driver, the address
+	// is claimed by the endpoint created for the container in
+	// CreateEndpoint and released by the agent if that never happens.
+	ipamOwner = "docker"
 )
 
+// poolIDSeparator separates the address family pool ID from the name of the
+// Cilium IP pool in the pool ID handed to libnetwork
+const poolIDSeparator = ":"
+
 func (driver *driver) ipamCapabilities(w http.ResponseWriter, r *http.Request) {
 	err := json.NewEncoder(w).Encode(&api.GetCapabilityResponse{})
 	if err != nil {
@@ -56,8 +71,13 @@ func (driver *driver) getDefaultAddressSpaces(w http.ResponseWriter, r *http.Req
 func (driver *driver) getPoolResponse(req *api.RequestPoolRequest) *api.RequestPoolResponse {
 	addr := driver.conf.Addressing
 	if req.V6 == false {
+		poolID := PoolIPv4
+		if pool := req.Options[OptionIPAMPool]; pool != "" {
+			poolID += poolIDSeparator + pool
+		}
+
 		return &api.RequestPoolResponse{
-			PoolID: PoolIPv4,
+			PoolID: poolID,
 			Pool:   "0.0.0.0/0",
 			Data: map[string]string{
 				"com.docker.network.gateway": addr.IPV4.IP + "/32",
@@ -109,15 +129,20 @@ func (driver *driver) requestAddress(w http.ResponseWriter, r *http.Request) {
 
 	log.WithField(logfields.Request, logfields.Repr(&request)).Debug("Request Address request")
 
+	poolID, pool := request.PoolID, ""
+	if i := strings.Index(poolID, poolIDSeparator); i >= 0 {
+		poolID, pool = poolID[:i], poolID[i+1:]
+	}
+
 	family := client.AddressFamilyIPv6 // Default
-	switch request.PoolID {
+	switch poolID {
 	case PoolIPv4:
 		family = client.AddressFamilyIPv4
 	case PoolIPv6:
 		family = client.AddressFamilyIPv6
 	}
 
-	ipam, err := driver.client.IPAMAllocate(family)
+	ipam, err := driver.client.IPAMAllocate(family, pool, ipamOwner)
 	if err != nil {
 		sendError(w, fmt.Sprintf("Could not allocate IP address: %s", err), http.StatusBadRequest)
 		return
@@ -110,6 +110,7 @@ const (
 	OptionTraceNotify         = "TraceNotification"
 	OptionNAT46               = "NAT46"
 	OptionPolicy              = "Policy"
+	OptionPolicyAuditMode     = "PolicyAuditMode"
 
 	OptionDisabled = "Disabled"
 	OptionEnabled  = "Enabled"
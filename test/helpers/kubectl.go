@@ -425,6 +425,45 @@ func (kub *Kubectl) CiliumImportPolicy(namespace string, filepath string, timeou
 	return "", nil
 }
 
+// CiliumNetworkPolicyWaitEnforced waits up until timeout for the
+// CiliumNetworkPolicy name in namespace to be enforced on all nodes running
+// Cilium, as reported in the status of the policy. Returns an error if the
+// policy is not enforced before the timeout is exceeded.
+func (kub *Kubectl) CiliumNetworkPolicyWaitEnforced(namespace string, name string, timeout time.Duration) error {
+	pods, err := kub.GetCiliumPods(KubeSystemNamespace)
+	if err != nil {
+		return err
+	}
+
+	body := func() bool {
+		res := kub.Node.Exec(fmt.Sprintf(
+			"%s get cnp -n %s %s -o jsonpath='{.status.nodes.*.enforcing}'",
+			kubectl, namespace, name))
+		if !res.WasSuccessful() {
+			kub.logCxt.Errorf("CiliumNetworkPolicyWaitEnforced: cannot get policy %s/%s", namespace, name)
+			return false
+		}
+
+		enforcing := 0
+		for _, v := range strings.Fields(res.Output().String()) {
+			if val, _ := govalidator.ToBoolean(v); val {
+				enforcing++
+			}
+		}
+		if enforcing >= len(pods) {
+			return true
+		}
+		kub.logCxt.Infof("CiliumNetworkPolicyWaitEnforced: policy %s/%s enforced on %d of %d nodes",
+			namespace, name, enforcing, len(pods))
+		return false
+	}
+
+	return WithTimeout(
+		body,
+		fmt.Sprintf("CiliumNetworkPolicy %s/%s is not enforced on all nodes", namespace, name),
+		&TimeoutConfig{Timeout: timeout})
+}
+
 //CiliumReport report the cilium pod to the log and apppend the logs for the
 //given commands. Return err in case of any problem
 func (kub *Kubectl) CiliumReport(namespace string, pod string, commands []string) error {
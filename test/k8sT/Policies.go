@@ -238,6 +238,9 @@ var _ = Describe("K8sPolicyTest", func() {
 		err = waitUntilEndpointUpdates(ciliumPod, eps, 4)
 		Expect(err).Should(BeNil())
 
+		err = kubectl.CiliumNetworkPolicyWaitEnforced(helpers.DefaultNamespace, "rule1", 300)
+		Expect(err).Should(BeNil())
+
 		appPods = getAppPods()
 
 		_, err = kubectl.Exec(
@@ -15,6 +15,7 @@
 package RuntimeTest
 
 import (
+	"context"
 	"fmt"
 	"os"
 
@@ -571,6 +572,70 @@ var _ = Describe("RuntimePolicies", func() {
 		}
 	})
 
+	It("Policy Audit Mode", func() {
+		script := `
+		[{
+			"endpointSelector": {
+				"matchLabels":{"id.httpd1":""}
+			},
+			"ingress": [{
+				"fromEndpoints": [{"matchLabels":{"id.app1":""}}]
+			}]
+		},
+		{
+			"endpointSelector": {
+				"matchLabels":{"id.app2":""}
+			},
+			"egress": [{
+				"toPorts": [{
+					"ports": [{"port": "8080", "protocol": "TCP"}]
+				}]
+			}]
+		}]`
+		err := helpers.RenderTemplateToFile(policyJSON, script, 0777)
+		Expect(err).Should(BeNil())
+		defer os.Remove(policyJSON)
+
+		_, err = cilium.PolicyImport(helpers.GetFilePath(policyJSON), helpers.HelperTimeout)
+		Expect(err).Should(BeNil())
+
+		endpoints, err := cilium.GetEndpointsIds()
+		Expect(err).Should(BeNil())
+
+		// App2 is denied by the egress L4 policy of app2 and by the
+		// ingress policy of httpd1
+		connectivityTest(httpRequestsPublic, helpers.App2, helpers.Httpd1, BeFalse)
+
+		By("Enabling the audit mode on the destination only")
+
+		Expect(cilium.EndpointSetConfig(endpoints[helpers.Httpd1], helpers.OptionPolicyAuditMode, helpers.OptionEnabled)).Should(BeTrue())
+		connectivityTest(httpRequestsPublic, helpers.App2, helpers.Httpd1, BeFalse)
+
+		By("Enabling the audit mode on the source")
+
+		Expect(cilium.EndpointSetConfig(endpoints[helpers.App2], helpers.OptionPolicyAuditMode, helpers.OptionEnabled)).Should(BeTrue())
+
+		ctx, cancel := context.WithCancel(context.Background())
+		res := docker.Node.ExecContext(ctx, "cilium monitor --type drop -v")
+		connectivityTest(httpRequestsPublic, helpers.App2, helpers.Httpd1, BeTrue)
+		helpers.Sleep(5)
+		cancel()
+
+		// Both the egress L4 verdict of app2 and the ingress verdict of
+		// httpd1 are reported
+		for _, ep := range []string{helpers.App2, helpers.Httpd1} {
+			Expect(res.Output().String()).Should(MatchRegexp(
+				`FROM %s DROP: \d+ bytes, reason Policy denied \(audit mode, allowed\)`,
+				endpoints[ep]), "No audit notification from %s", ep)
+		}
+
+		By("Disabling the audit mode")
+
+		Expect(cilium.EndpointSetConfig(endpoints[helpers.App2], helpers.OptionPolicyAuditMode, helpers.OptionDisabled)).Should(BeTrue())
+		Expect(cilium.EndpointSetConfig(endpoints[helpers.Httpd1], helpers.OptionPolicyAuditMode, helpers.OptionDisabled)).Should(BeTrue())
+		connectivityTest(httpRequestsPublic, helpers.App2, helpers.Httpd1, BeFalse)
+	})
+
 	It("L7 Checks", func() {
 
 		_, err := cilium.PolicyImport(cilium.GetFullPath(policiesL7JSON), helpers.HelperTimeout)